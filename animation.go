@@ -0,0 +1,348 @@
+// animation.go
+package kryc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/waozixyz/kryc/krb"
+	"github.com/waozixyz/kryc/syntax"
+)
+
+// --- Animations ---
+// An `@animation "name" { ... }` block defines an entry of the KRB Animation
+// Table: timing settings followed by keyframes such as `50% { opacity: 0.5 }`.
+// Keyframe properties are converted like style properties. Elements and
+// styles refer to animations by name with the `animation` property.
+
+func (state *CompilerState) parseAnimation(n *syntax.Animation) error {
+	line := n.At.Line
+	name, _ := cleanAndQuoteValue(n.Name.Text)
+	if name == "" {
+		return state.errorAt(CodeSyntax, n.At, "animation name cannot be empty")
+	}
+	if existing := state.findAnimationByName(name); existing != nil {
+		return withRelated(state.errorAt(CodeRedefinition, textPos(n.Name), "animation '%s' redefined", name),
+			state.relatedAt(existing.DefLine, name+`"`, "previous definition is here"))
+	}
+	if len(state.Animations) >= MaxAnimations {
+		return state.errorAt(CodeLimit, n.At, "maximum animations (%d) exceeded", MaxAnimations)
+	}
+	nameIdx, err := state.addString(name)
+	if err != nil {
+		return state.errorAt(CodeLimit, textPos(n.Name), "failed adding animation name '%s': %w", name, err)
+	}
+	anim := AnimationEntry{
+		Name:       name,
+		NameIndex:  nameIdx,
+		Index:      uint16(len(state.Animations)),
+		Easing:     EasingLinear,
+		Iterations: 1,
+		DefLine:    line,
+	}
+	state.addSymbol(SymbolAnimation, name, textPos(n.Name), "")
+
+	hasDuration := false
+	err = state.parseNodes(n.Body.Nodes, func(child syntax.Node) error {
+		switch child := child.(type) {
+		case *syntax.Keyframe:
+			return state.parseKeyframe(&anim, child)
+		case *syntax.Property:
+			if child.Body != nil {
+				break
+			}
+			key, keyPos := child.Key.Text, child.Key.Pos
+			value, _ := cleanAndQuoteValue(child.Value.Raw)
+			var err error
+			switch key {
+			case "duration":
+				anim.DurationMs, err = parseDuration(value)
+				hasDuration = true
+			case "easing":
+				anim.Easing, err = parseEasing(value)
+			case "iterations":
+				anim.Iterations, err = parseIterations(value)
+			default:
+				return state.errorAt(CodeAnimation, keyPos, "unknown @animation setting '%s' in animation '%s' (expected duration, easing, iterations or a keyframe block)", key, name)
+			}
+			if err != nil {
+				return state.errorAt(CodePropertyValue, keyPos, "error processing '%s: %s' in animation '%s': %w", key, child.Value.Raw, name, err)
+			}
+			return nil
+		}
+		return state.misplaced(child, CtxAnimation)
+	})
+	if err != nil {
+		return err
+	}
+
+	if !hasDuration {
+		return state.errorAt(CodeAnimation, textPos(n.Name), "animation '%s' has no duration", name)
+	}
+	if len(anim.Keyframes) == 0 {
+		return state.errorAt(CodeAnimation, textPos(n.Name), "animation '%s' has no keyframes", name)
+	}
+	sort.Slice(anim.Keyframes, func(i, j int) bool {
+		return anim.Keyframes[i].Offset < anim.Keyframes[j].Offset
+	})
+	state.Animations = append(state.Animations, anim)
+	state.HeaderFlags |= FlagHasAnimations
+	return nil
+}
+
+// parseKeyframe converts one keyframe block and adds it to anim. Offsets are
+// unique, so an animation has at most 101 keyframes.
+func (state *CompilerState) parseKeyframe(anim *AnimationEntry, n *syntax.Keyframe) error {
+	offsetStr := n.Offset.Text
+	offset, err := strconv.ParseUint(strings.TrimSuffix(offsetStr, "%"), 10, 8)
+	if err != nil || offset > 100 {
+		return state.errorAt(CodeAnimation, n.Offset.Pos, "invalid keyframe offset '%s' in animation '%s' (expected 0%% to 100%%)", offsetStr, anim.Name)
+	}
+	for _, kf := range anim.Keyframes {
+		if kf.Offset == uint8(offset) {
+			return state.errorAt(CodeRedefinition, n.Offset.Pos, "keyframe %s of animation '%s' redefined", offsetStr, anim.Name)
+		}
+	}
+
+	owner := fmt.Sprintf("keyframe %s of animation '%s'", offsetStr, anim.Name)
+	props := make(map[uint8]KrbProperty)
+	addProperty := func(key, value string, keyPos, valuePos syntax.Pos) error {
+		if key == "transition" {
+			return state.errorAt(CodeAnimation, keyPos, "'transition' cannot be used in %s", owner)
+		}
+		cleaned, _ := cleanAndQuoteValue(value)
+		krbProp, err := state.convertStyleProperty(key, cleaned, keyPos, valuePos, owner)
+		if err != nil {
+			return state.errorAt(CodePropertyValue, keyPos, "error processing property '%s: %s' in %s: %w", key, shortValue(value), owner, err)
+		}
+		if krbProp == nil {
+			return nil // Unhandled keys were warned about
+		}
+		if _, exists := props[krbProp.PropertyID]; !exists && len(props) >= MaxProperties {
+			return state.errorAt(CodeLimit, keyPos, "maximum properties (%d) exceeded in %s", MaxProperties, owner)
+		}
+		props[krbProp.PropertyID] = *krbProp // The last definition wins
+		return nil
+	}
+	err = state.parseNodes(n.Body.Nodes, func(child syntax.Node) error {
+		prop, ok := child.(*syntax.Property)
+		switch {
+		case !ok:
+			return state.misplaced(child, CtxKeyframe)
+		case prop.Body != nil:
+			return state.parseEdgeInsets(prop, addProperty)
+		}
+		return addProperty(prop.Key.Text, prop.Value.Raw, prop.Key.Pos, valuePos(prop))
+	})
+	if err != nil {
+		return err
+	}
+
+	kf := KrbKeyframe{Offset: uint8(offset), Properties: make([]KrbProperty, 0, len(props))}
+	for _, p := range props {
+		kf.Properties = append(kf.Properties, p)
+	}
+	sort.Slice(kf.Properties, func(i, j int) bool {
+		return kf.Properties[i].PropertyID < kf.Properties[j].PropertyID
+	})
+	anim.Keyframes = append(anim.Keyframes, kf)
+	return nil
+}
+
+// findAnimationByName returns the animation with the given name, or nil.
+func (state *CompilerState) findAnimationByName(name string) *AnimationEntry {
+	for i := range state.Animations {
+		if state.Animations[i].Name == name {
+			return &state.Animations[i]
+		}
+	}
+	return nil
+}
+
+// --- Animation References ---
+
+// parseAnimationRefs parses the value of an `animation` property: a
+// comma-separated list of animation names, each optionally followed by the
+// trigger that starts it (load, hover, press or focus; load by default).
+// "none" yields an empty list, which overrides the animations of a style.
+func (state *CompilerState) parseAnimationRefs(value string) ([]KrbAnimationRef, error) {
+	groups, err := valueList(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 1 && len(groups[0]) == 1 && groups[0][0].Kind == syntax.WORD && groups[0][0].Text == "none" {
+		return []KrbAnimationRef{}, nil
+	}
+	refs := make([]KrbAnimationRef, 0, len(groups))
+	for _, g := range groups {
+		if len(g) > 2 {
+			return nil, fmt.Errorf("unexpected '%s' after animation %s", g[2].Text, g[0].Text)
+		}
+		name := g[0].Text
+		if g[0].Kind == syntax.STRING {
+			name, _ = cleanAndQuoteValue(name)
+		}
+		anim := state.findAnimationByName(name)
+		if anim == nil {
+			return nil, fmt.Errorf("animation '%s' not found", name)
+		}
+		ref := KrbAnimationRef{AnimationIndex: anim.Index, Trigger: AnimTriggerLoad}
+		if len(g) == 2 {
+			trigger, ok := krb.AnimationTriggerByName(g[1].Text)
+			if !ok {
+				return nil, fmt.Errorf("invalid animation trigger '%s' (expected load, hover, press or focus)", g[1].Text)
+			}
+			ref.Trigger = trigger
+		}
+		refs = append(refs, ref)
+	}
+	if len(refs) > MaxAnimationRefs {
+		return nil, fmt.Errorf("too many animations (%d, maximum %d)", len(refs), MaxAnimationRefs)
+	}
+	return refs, nil
+}
+
+// valueList splits a property value into its comma-separated items, each a
+// non-empty list of word and string tokens.
+func valueList(value string) ([][]syntax.Token, error) {
+	tokens, errs := syntax.Tokenize([]byte(value))
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	var groups [][]syntax.Token
+	var cur []syntax.Token
+	for _, t := range tokens {
+		switch t.Kind {
+		case syntax.WORD, syntax.STRING:
+			cur = append(cur, t)
+			continue
+		case syntax.COMMENT, syntax.NEWLINE:
+			continue
+		case syntax.COMMA, syntax.EOF:
+		default:
+			return nil, fmt.Errorf("unexpected %s in '%s'", t.Kind, value)
+		}
+		if len(cur) == 0 {
+			return nil, fmt.Errorf("empty item in '%s'", value)
+		}
+		groups = append(groups, cur)
+		cur = nil
+	}
+	return groups, nil
+}
+
+// valueTokenPos maps the position of a token that valueList found in the
+// value of prop back to the source.
+func valueTokenPos(prop *syntax.Property, tok syntax.Token) syntax.Pos {
+	return advancePos(valuePos(prop), prop.Value.Raw, tok.Pos.Offset)
+}
+
+// --- Transitions ---
+
+// parseTransition parses the value of a `transition` property: a
+// comma-separated list of animatable property keys, each followed by a
+// duration and optionally an easing (linear by default), e.g.
+// `opacity 200ms ease-out, background_color 1s`. "none" yields an empty
+// list, which overrides the transitions of a style.
+func parseTransition(value string) (*KrbProperty, error) {
+	groups, err := valueList(value)
+	if err != nil {
+		return nil, err
+	}
+	var transitions []krb.Transition
+	if !(len(groups) == 1 && len(groups[0]) == 1 && groups[0][0].Text == "none") {
+		for _, g := range groups {
+			key := g[0].Text
+			propID, ok := kryPropertyID(key)
+			switch {
+			case !ok:
+				return nil, fmt.Errorf("unknown property '%s' in transition", key)
+			case !animatableProperties[propID]:
+				return nil, fmt.Errorf("property '%s' cannot be transitioned", key)
+			case len(g) < 2:
+				return nil, fmt.Errorf("transition of '%s' has no duration", key)
+			case len(g) > 3:
+				return nil, fmt.Errorf("unexpected '%s' in transition of '%s'", g[3].Text, key)
+			}
+			t := krb.Transition{PropertyID: propID, Easing: EasingLinear}
+			if t.DurationMs, err = parseDuration(g[1].Text); err != nil {
+				return nil, err
+			}
+			if len(g) == 3 {
+				if t.Easing, err = parseEasing(g[2].Text); err != nil {
+					return nil, err
+				}
+			}
+			for _, prev := range transitions {
+				if prev.PropertyID == propID {
+					return nil, fmt.Errorf("property '%s' transitioned more than once", key)
+				}
+			}
+			transitions = append(transitions, t)
+		}
+	}
+	if len(transitions) > MaxTransitions {
+		return nil, fmt.Errorf("too many transitions (%d, maximum %d)", len(transitions), MaxTransitions)
+	}
+	data := krb.EncodeTransitions(transitions)
+	return &KrbProperty{PropertyID: PropIDTransition, ValueType: ValTypeTransition, Size: uint8(len(data)), Value: data}, nil
+}
+
+// kryPropertyID returns the standard PropID a KRY key resolves to.
+func kryPropertyID(key string) (uint8, bool) {
+	for id, keys := range kryPropertyKeys {
+		for _, k := range keys {
+			if k == key {
+				return id, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// --- Timing Values ---
+
+// parseDuration parses a duration such as "300ms", "1.5s" or "300" (ms).
+func parseDuration(value string) (uint16, error) {
+	numStr, scale := value, 1.0
+	switch {
+	case strings.HasSuffix(value, "ms"):
+		numStr = strings.TrimSuffix(value, "ms")
+	case strings.HasSuffix(value, "s"):
+		numStr, scale = strings.TrimSuffix(value, "s"), 1000
+	}
+	f, err := strconv.ParseFloat(numStr, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid duration '%s' (expected e.g. 300ms or 1.5s)", value)
+	}
+	ms := math.Round(f * scale)
+	if ms < 0 || ms > math.MaxUint16 {
+		return 0, fmt.Errorf("duration '%s' out of range (0-%dms)", value, math.MaxUint16)
+	}
+	return uint16(ms), nil
+}
+
+// parseEasing parses an easing function name. CSS spellings with dashes,
+// such as "ease-in-out", are accepted as well.
+func parseEasing(value string) (uint8, error) {
+	easing, ok := krb.EasingByName(strings.ReplaceAll(strings.ToLower(value), "-", "_"))
+	if !ok {
+		return 0, fmt.Errorf("invalid easing '%s' (expected linear, ease, ease_in, ease_out or ease_in_out)", value)
+	}
+	return easing, nil
+}
+
+// parseIterations parses an iteration count of 1 to 255, or "infinite".
+func parseIterations(value string) (uint8, error) {
+	if value == "infinite" {
+		return AnimIterationsInfinite, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid iteration count '%s' (expected 1-%d or infinite)", value, math.MaxUint8)
+	}
+	return uint8(n), nil
+}
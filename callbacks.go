@@ -0,0 +1,111 @@
+// callbacks.go
+package kryc
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/waozixyz/kryc/krb"
+	"github.com/waozixyz/kryc/syntax"
+)
+
+// --- Callback Manifest ---
+// An `@callbacks { handleSave: click; validate: change, submit }` block
+// declares the callbacks the runtime provides and the events each handles,
+// or `any`. A manifest usually lives in its own file that is @included.
+// Without one, callback names are not checked. With one, every event handler
+// must name a declared callback that handles its event, and declared
+// callbacks that no handler names are reported.
+
+func (state *CompilerState) parseCallbacks(n *syntax.Callbacks) error {
+	if state.Callbacks == nil {
+		state.Callbacks = []CallbackEntry{} // An empty manifest still declares that there are no callbacks
+	}
+	return state.parseNodes(n.Body.Nodes, func(child syntax.Node) error {
+		def, ok := child.(*syntax.Property)
+		if !ok || def.Body != nil {
+			return state.misplaced(child, CtxCallbacks)
+		}
+		return state.parseCallbackDecl(def)
+	})
+}
+
+// parseCallbackDecl adds one `name: event, ...` declaration to the manifest.
+func (state *CompilerState) parseCallbackDecl(def *syntax.Property) error {
+	line, name := def.Key.Pos.Line, def.Key.Text
+	if existing := state.findCallback(name); existing != nil {
+		return withRelated(state.errorAt(CodeRedefinition, def.Key.Pos, "callback '%s' redefined", name),
+			state.relatedAt(existing.DefLine, name, "previous definition is here"))
+	}
+
+	groups, err := valueList(def.Value.Raw)
+	if err != nil || len(groups) == 0 {
+		return state.errorAt(CodeCallback, def.Key.Pos, "invalid callback declaration '%s: %s' (expected e.g. 'handleSave: click' or 'validate: change, submit')", name, def.Value.Raw)
+	}
+	entry := CallbackEntry{Name: name, DefLine: line}
+	for _, g := range groups {
+		if len(g) != 1 || g[0].Kind != syntax.WORD {
+			return state.errorAt(CodeCallback, def.Key.Pos, "invalid callback declaration '%s: %s' (expected a comma-separated list of events)", name, def.Value.Raw)
+		}
+		event := g[0].Text
+		if event == "any" {
+			if len(groups) > 1 {
+				return state.errorAt(CodeCallback, valueTokenPos(def, g[0]), "'any' cannot be combined with other events for callback '%s'", name)
+			}
+			break
+		}
+		evType, ok := krb.EventTypeByName(event)
+		if !ok {
+			return state.errorAt(CodeCallback, valueTokenPos(def, g[0]), "unknown event '%s' for callback '%s' (expected any or one of %s)", event, name, strings.Join(krb.EventTypeNames(), ", "))
+		}
+		if !slices.Contains(entry.Events, evType) {
+			entry.Events = append(entry.Events, evType)
+		}
+	}
+	state.Callbacks = append(state.Callbacks, entry)
+	state.addSymbol(SymbolCallback, name, def.Key.Pos, def.Value.Raw)
+	return nil
+}
+
+// findCallback returns the callback declared with the given name, or nil.
+func (state *CompilerState) findCallback(name string) *CallbackEntry {
+	for i := range state.Callbacks {
+		if state.Callbacks[i].Name == name {
+			return &state.Callbacks[i]
+		}
+	}
+	return nil
+}
+
+// checkCallback validates the callback named by an event handler against
+// the manifest and marks it used. key is the handler's property key and pos
+// the position of its value.
+func (state *CompilerState) checkCallback(name string, evType uint8, key string, pos syntax.Pos) error {
+	if state.Callbacks == nil {
+		return nil
+	}
+	cb := state.findCallback(name)
+	if cb == nil {
+		return state.errorAt(CodeCallback, pos, "callback '%s' of '%s' is not declared in @callbacks", name, key)
+	}
+	cb.Used = true
+	if cb.Events != nil && !slices.Contains(cb.Events, evType) {
+		var events []string
+		for _, t := range cb.Events {
+			events = append(events, krb.EventTypeName(t))
+		}
+		return withRelated(state.errorAt(CodeCallback, pos, "callback '%s' does not handle %s events (it is declared for %s)", name, krb.EventTypeName(evType), strings.Join(events, ", ")),
+			state.relatedAt(cb.DefLine, name, "declared here"))
+	}
+	return nil
+}
+
+// reportUnusedCallbacks warns about declared callbacks that no event handler
+// names. It runs after every element has been resolved.
+func (state *CompilerState) reportUnusedCallbacks() {
+	for _, cb := range state.Callbacks {
+		if !cb.Used {
+			state.warnf(CodeCallbackUnused, cb.DefLine, cb.Name, "callback '%s' is declared but not used by any event handler", cb.Name)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// decompile.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/waozixyz/kryc"
+	"github.com/waozixyz/kryc/krb"
+)
+
+// --- Decompile Command ---
+
+// runDecompile implements `kryc decompile [-o out.kry] <file.krb>`.
+func runDecompile(args []string) int {
+	fs := flag.NewFlagSet("decompile", flag.ContinueOnError)
+	outputFile := fs.String("o", "", "write the KRY source to `file` instead of stdout")
+	diagFormat := fs.String("diagnostics-format", diagnosticsText, "print diagnostics as `text` or json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kryc decompile [-o out.kry] [--diagnostics-format=text|json] <file.krb>\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || !validDiagnosticsFormat(*diagFormat) {
+		fs.Usage()
+		return 2
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+		return 1
+	}
+	file, err := krb.Decode(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+		return 1
+	}
+	src, diagnostics, err := kryc.Decompile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+		return 1
+	}
+	// Recompile the output to report files that do not round-trip exactly.
+	name := *outputFile
+	if name == "" {
+		name = "decompiled.kry"
+	}
+	sources := map[string][]byte{name: src}
+	for _, res := range file.Resources {
+		if path, ok := file.String(res.NameIndex); ok && res.Format == krb.ResFormatInline && !filepath.IsAbs(path) {
+			sources[filepath.Join(filepath.Dir(name), path)] = res.Data // Embedded files are read back from memory
+		}
+	}
+	result, err := kryc.Compile(context.Background(), kryc.Options{
+		Filename: name,
+		Sources:  sources,
+		Compress: file.Header.HasFlag(krb.FlagCompressed),
+	})
+	if err != nil {
+		diagnostics = append(diagnostics, kryc.Diagnostic{Severity: kryc.SeverityWarning, Code: kryc.CodeDecompileLossy,
+			Message: fmt.Sprintf("decompiled source does not compile: %v", err)})
+	} else if !bytes.Equal(result.KRB, data) {
+		diagnostics = append(diagnostics, kryc.Diagnostic{Severity: kryc.SeverityWarning, Code: kryc.CodeDecompileLossy,
+			Message: fmt.Sprintf("recompiling the decompiled source does not reproduce '%s' exactly", fs.Arg(0))})
+	}
+	printDiagnostics(os.Stderr, *diagFormat, diagnostics)
+
+	if *outputFile == "" {
+		_, err = os.Stdout.Write(src)
+	} else {
+		err = os.WriteFile(*outputFile, src, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
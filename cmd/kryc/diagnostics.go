@@ -0,0 +1,95 @@
+// diagnostics.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/waozixyz/kryc"
+)
+
+// --- Diagnostic Output ---
+
+// Diagnostic output formats accepted by --diagnostics-format.
+const (
+	diagnosticsText = "text"
+	diagnosticsJSON = "json"
+)
+
+// validDiagnosticsFormat reports whether format is a known --diagnostics-format.
+func validDiagnosticsFormat(format string) bool {
+	return format == diagnosticsText || format == diagnosticsJSON
+}
+
+// printDiagnostics writes diagnostics to w. The text format prints each one
+// with its source excerpt and related notes; the JSON format prints one
+// object per line.
+func printDiagnostics(w io.Writer, format string, diagnostics []kryc.Diagnostic) {
+	if format == diagnosticsJSON {
+		enc := json.NewEncoder(w)
+		for _, d := range diagnostics {
+			_ = enc.Encode(newJSONDiagnostic(d))
+		}
+		return
+	}
+	for _, d := range diagnostics {
+		fmt.Fprintln(w, d)
+		if excerpt := d.Excerpt(); excerpt != "" {
+			fmt.Fprintln(w, excerpt)
+		}
+		for _, r := range d.Related {
+			fmt.Fprintln(w, r)
+		}
+	}
+}
+
+// countDiagnostics summarises diagnostics as "N errors, M warnings".
+func countDiagnostics(diagnostics []kryc.Diagnostic) string {
+	errs, warns := 0, 0
+	for _, d := range diagnostics {
+		switch d.Severity {
+		case kryc.SeverityError:
+			errs++
+		case kryc.SeverityWarning:
+			warns++
+		}
+	}
+	return fmt.Sprintf("%d errors, %d warnings", errs, warns)
+}
+
+// --- JSON Records ---
+
+type jsonDiagnostic struct {
+	Severity string         `json:"severity"`
+	Code     string         `json:"code,omitempty"`
+	File     string         `json:"file,omitempty"`
+	Line     int            `json:"line,omitempty"`
+	Column   int            `json:"column,omitempty"`
+	Message  string         `json:"message"`
+	Snippet  string         `json:"snippet,omitempty"`
+	Related  []jsonLocation `json:"related,omitempty"`
+}
+
+type jsonLocation struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func newJSONDiagnostic(d kryc.Diagnostic) jsonDiagnostic {
+	out := jsonDiagnostic{
+		Severity: d.Severity.String(),
+		Code:     d.Code,
+		File:     d.File,
+		Line:     d.Line,
+		Column:   d.Column,
+		Message:  d.Message,
+		Snippet:  d.Snippet,
+	}
+	for _, r := range d.Related {
+		out.Related = append(out.Related, jsonLocation{File: r.File, Line: r.Line, Column: r.Column, Message: r.Message})
+	}
+	return out
+}
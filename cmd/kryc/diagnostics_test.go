@@ -0,0 +1,52 @@
+// diagnostics_test.go
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/waozixyz/kryc"
+)
+
+var testDiagnostics = []kryc.Diagnostic{
+	{
+		Severity: kryc.SeverityError, Code: "E0103", File: "main.kry", Line: 2, Column: 8,
+		Message: "style 'base' redefined", Snippet: `style "base" {`,
+		Related: []kryc.RelatedLocation{{File: "inc.kry", Line: 4, Column: 8, Message: "previous definition is here"}},
+	},
+	{Severity: kryc.SeverityWarning, Message: "no location"},
+}
+
+func TestPrintDiagnosticsText(t *testing.T) {
+	var buf bytes.Buffer
+	printDiagnostics(&buf, diagnosticsText, testDiagnostics)
+	want := `main.kry:2:8: error[E0103]: style 'base' redefined
+    2 | style "base" {
+      |        ^
+inc.kry:4:8: note: previous definition is here
+warning: no location
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrintDiagnosticsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	printDiagnostics(&buf, diagnosticsJSON, testDiagnostics)
+	want := []string{
+		`{"severity":"error","code":"E0103","file":"main.kry","line":2,"column":8,"message":"style 'base' redefined","snippet":"style \"base\" {",` +
+			`"related":[{"file":"inc.kry","line":4,"column":8,"message":"previous definition is here"}]}`,
+		`{"severity":"warning","message":"no location"}`,
+	}
+	got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(got), len(want), buf.String())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d:\ngot  %s\nwant %s", i+1, got[i], want[i])
+		}
+	}
+}
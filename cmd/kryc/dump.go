@@ -0,0 +1,460 @@
+// dump.go
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/waozixyz/kryc/krb"
+)
+
+// --- Dump Command ---
+
+// runDump implements `kryc dump [--json] <file.krb>`.
+func runDump(args []string) int {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the decoded file as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kryc dump [--json] <file.krb>\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	file, err := krb.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+		return 1
+	}
+	d := newDump(file)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(d)
+	} else {
+		err = d.writeText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// --- Dump Model ---
+// The dump model is krb.File with every index and code resolved to text,
+// shared by the text and JSON outputs.
+
+type dumpFile struct {
+	Version       string          `json:"version"`
+	Flags         []string        `json:"flags"`
+	Header        dumpHeader      `json:"header"`
+	Elements      []*dumpElement  `json:"elements"`
+	Styles        []dumpStyle     `json:"styles"`
+	ComponentDefs []dumpComponent `json:"component_defs"`
+	Animations    []dumpAnimation `json:"animations"`
+	Strings       []string        `json:"strings"`
+	Resources     []dumpResource  `json:"resources"`
+}
+
+type dumpHeader struct {
+	Flags              uint16 `json:"flags"`
+	ElementCount       uint16 `json:"element_count"`
+	StyleCount         uint16 `json:"style_count"`
+	ComponentDefCount  uint16 `json:"component_def_count"`
+	AnimationCount     uint16 `json:"animation_count"`
+	StringCount        uint16 `json:"string_count"`
+	ResourceCount      uint16 `json:"resource_count"`
+	ElementOffset      uint32 `json:"element_offset"`
+	StyleOffset        uint32 `json:"style_offset"`
+	ComponentDefOffset uint32 `json:"component_def_offset"`
+	AnimationOffset    uint32 `json:"animation_offset"`
+	StringOffset       uint32 `json:"string_offset"`
+	ResourceOffset     uint32 `json:"resource_offset"`
+	TotalSize          uint32 `json:"total_size"`
+}
+
+type dumpElement struct {
+	Offset           uint32         `json:"offset"`
+	Type             string         `json:"type"`
+	ID               string         `json:"id,omitempty"`
+	PosX             uint16         `json:"pos_x"`
+	PosY             uint16         `json:"pos_y"`
+	Width            uint16         `json:"width"`
+	Height           uint16         `json:"height"`
+	Layout           uint8          `json:"layout"`
+	LayoutText       string         `json:"layout_text"`
+	StyleID          uint16         `json:"style_id"`
+	Style            string         `json:"style,omitempty"`
+	Properties       []dumpProperty `json:"properties"`
+	CustomProperties []dumpProperty `json:"custom_properties"`
+	Events           []dumpEvent    `json:"events"`
+	Animations       []dumpAnimRef  `json:"animations"`
+	ChildOffsets     []uint32       `json:"child_offsets"`
+	Children         []*dumpElement `json:"children"`
+}
+
+type dumpProperty struct {
+	Name      string `json:"name"`
+	ID        *uint8 `json:"id,omitempty"` // Standard properties only
+	ValueType string `json:"value_type"`
+	Value     string `json:"value"`
+	Raw       []int  `json:"raw"`
+}
+
+type dumpEvent struct {
+	Type     string `json:"type"`
+	Callback string `json:"callback"`
+}
+
+type dumpAnimRef struct {
+	Index   uint16 `json:"index"`
+	Name    string `json:"name"`
+	Trigger string `json:"trigger"`
+}
+
+type dumpAnimation struct {
+	Name       string         `json:"name"`
+	DurationMs uint16         `json:"duration_ms"`
+	Easing     string         `json:"easing"`
+	Iterations uint8          `json:"iterations"` // 0 repeats forever
+	Keyframes  []dumpKeyframe `json:"keyframes"`
+}
+
+type dumpKeyframe struct {
+	Offset     uint8          `json:"offset"`
+	Properties []dumpProperty `json:"properties"`
+}
+
+type dumpStyle struct {
+	ID         uint16         `json:"id"`
+	Name       string         `json:"name"`
+	Properties []dumpProperty `json:"properties"`
+	Variants   []dumpVariant  `json:"variants,omitempty"`
+	Media      []dumpMedia    `json:"media,omitempty"`
+}
+
+type dumpMedia struct {
+	Query      string         `json:"query"`
+	Properties []dumpProperty `json:"properties"`
+}
+
+type dumpVariant struct {
+	State      string         `json:"state"`
+	Properties []dumpProperty `json:"properties"`
+}
+
+type dumpComponent struct {
+	Name       string         `json:"name"`
+	Properties []dumpPropDef  `json:"properties"`
+	Template   []*dumpElement `json:"template"`
+}
+
+type dumpPropDef struct {
+	Name    string `json:"name"`
+	Hint    string `json:"hint"`
+	Default string `json:"default"`
+	Raw     []int  `json:"raw"`
+}
+
+type dumpResource struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Format uint8  `json:"format"`
+	Data   string `json:"data"`
+	Size   int    `json:"size,omitempty"` // Inline resources only
+}
+
+func newDump(f *krb.File) *dumpFile {
+	h := f.Header
+	d := &dumpFile{
+		Version: fmt.Sprintf("%d.%d", h.VersionMajor, h.VersionMinor),
+		Flags:   flagNames(h.Flags),
+		Header: dumpHeader{
+			Flags: h.Flags, ElementCount: h.ElementCount, StyleCount: h.StyleCount, ComponentDefCount: h.ComponentDefCount,
+			AnimationCount: h.AnimationCount, StringCount: h.StringCount, ResourceCount: h.ResourceCount,
+			ElementOffset: h.ElementOffset, StyleOffset: h.StyleOffset, ComponentDefOffset: h.ComponentDefOffset,
+			AnimationOffset: h.AnimationOffset, StringOffset: h.StringOffset, ResourceOffset: h.ResourceOffset,
+			TotalSize: h.TotalSize,
+		},
+		Strings: f.Strings,
+	}
+	for _, root := range f.Roots {
+		d.Elements = append(d.Elements, dumpTree(f, root))
+	}
+	for _, s := range f.Styles {
+		ds := dumpStyle{ID: s.ID, Name: str(f, s.NameIndex), Properties: dumpProps(f, s.Properties)}
+		for _, v := range s.Variants {
+			ds.Variants = append(ds.Variants, dumpVariant{State: krb.StateName(v.State), Properties: dumpProps(f, v.Properties)})
+		}
+		for _, m := range s.Media {
+			ds.Media = append(ds.Media, dumpMedia{Query: krb.FormatMediaQuery(m.Conditions), Properties: dumpProps(f, m.Properties)})
+		}
+		d.Styles = append(d.Styles, ds)
+	}
+	for _, def := range f.ComponentDefs {
+		c := dumpComponent{Name: str(f, def.NameIndex)}
+		for _, pd := range def.Properties {
+			c.Properties = append(c.Properties, dumpPropDef{Name: str(f, pd.NameIndex), Hint: krb.ValueTypeName(pd.ValueTypeHint),
+				Default: krb.FormatValue(f, krb.HintValueType(pd.ValueTypeHint), pd.DefaultValue), Raw: ints(pd.DefaultValue)})
+		}
+		c.Template = append(c.Template, dumpTree(f, def.Root))
+		d.ComponentDefs = append(d.ComponentDefs, c)
+	}
+	for _, a := range f.Animations {
+		anim := dumpAnimation{Name: str(f, a.NameIndex), DurationMs: a.DurationMs, Easing: krb.EasingName(a.Easing), Iterations: a.Iterations}
+		for _, kf := range a.Keyframes {
+			anim.Keyframes = append(anim.Keyframes, dumpKeyframe{Offset: kf.Offset, Properties: dumpProps(f, kf.Properties)})
+		}
+		d.Animations = append(d.Animations, anim)
+	}
+	for _, r := range f.Resources {
+		res := dumpResource{Type: krb.ResourceTypeName(r.Type), Name: str(f, r.NameIndex), Format: r.Format}
+		if r.Format == krb.ResFormatInline {
+			res.Size = len(r.Data)
+		} else {
+			res.Data = str(f, r.DataStringIndex)
+		}
+		d.Resources = append(d.Resources, res)
+	}
+	return d
+}
+
+func dumpTree(f *krb.File, el *krb.Element) *dumpElement {
+	d := &dumpElement{
+		Offset:       el.Offset,
+		Type:         krb.ElementTypeName(el.Type),
+		PosX:         el.PosX,
+		PosY:         el.PosY,
+		Width:        el.Width,
+		Height:       el.Height,
+		Layout:       el.Layout,
+		LayoutText:   krb.LayoutString(el.Layout),
+		StyleID:      el.StyleID,
+		Properties:   dumpProps(f, el.Properties),
+		ChildOffsets: el.ChildOffsets,
+	}
+	if el.IDStringIndex != 0 {
+		d.ID = str(f, el.IDStringIndex)
+	}
+	if s := f.StyleByID(el.StyleID); s != nil {
+		d.Style = str(f, s.NameIndex)
+	}
+	for _, cp := range el.CustomProperties {
+		d.CustomProperties = append(d.CustomProperties, dumpProperty{
+			Name:      str(f, cp.KeyIndex),
+			ValueType: krb.ValueTypeName(cp.ValueType),
+			Value:     krb.FormatValue(f, cp.ValueType, cp.Value),
+			Raw:       ints(cp.Value),
+		})
+	}
+	for _, ev := range el.Events {
+		d.Events = append(d.Events, dumpEvent{Type: krb.EventTypeName(ev.Type), Callback: str(f, ev.CallbackIndex)})
+	}
+	for _, ref := range el.AnimationRefs {
+		d.Animations = append(d.Animations, dumpAnimRef{Index: ref.AnimationIndex, Name: str(f, f.Animations[ref.AnimationIndex].NameIndex), Trigger: krb.AnimationTriggerName(ref.Trigger)})
+	}
+	for _, child := range el.Children {
+		d.Children = append(d.Children, dumpTree(f, child))
+	}
+	return d
+}
+
+func dumpProps(f *krb.File, props []krb.Property) []dumpProperty {
+	out := make([]dumpProperty, 0, len(props))
+	for _, p := range props {
+		id := p.ID
+		out = append(out, dumpProperty{
+			Name:      krb.PropertyName(p.ID),
+			ID:        &id,
+			ValueType: krb.ValueTypeName(p.ValueType),
+			Value:     krb.FormatValue(f, p.ValueType, p.Value),
+			Raw:       ints(p.Value),
+		})
+	}
+	return out
+}
+
+// ints converts raw bytes to ints so JSON shows them as numbers, not base64.
+func ints(b []byte) []int {
+	out := make([]int, len(b))
+	for i, v := range b {
+		out[i] = int(v)
+	}
+	return out
+}
+
+func str(f *krb.File, index uint16) string {
+	s, _ := f.String(index)
+	return s
+}
+
+func flagNames(flags uint16) []string {
+	names := []struct {
+		bit  uint16
+		name string
+	}{
+		{krb.FlagHasStyles, "has_styles"},
+		{krb.FlagHasComponentDefs, "has_component_defs"},
+		{krb.FlagHasAnimations, "has_animations"},
+		{krb.FlagHasResources, "has_resources"},
+		{krb.FlagCompressed, "compressed"},
+		{krb.FlagFixedPoint, "fixed_point"},
+		{krb.FlagExtendedColor, "extended_color"},
+		{krb.FlagHasApp, "has_app"},
+		{krb.FlagLongStrings, "long_strings"},
+		{krb.FlagWideElements, "wide_elements"},
+		{krb.FlagHasStyleVariants, "has_style_variants"},
+		{krb.FlagHasMediaVariants, "has_media_variants"},
+	}
+	out := []string{}
+	for _, n := range names {
+		if flags&n.bit != 0 {
+			out = append(out, n.name)
+		}
+	}
+	return out
+}
+
+// --- Text Output ---
+
+func (d *dumpFile) writeText(w io.Writer) error {
+	p := &textPrinter{w: w}
+	h := d.Header
+	p.line(0, "KRB v%s (%d bytes)", d.Version, h.TotalSize)
+	p.line(0, "Flags: 0x%04X [%s]", h.Flags, strings.Join(d.Flags, " "))
+	p.line(0, "Sections:")
+	p.line(1, "elements        count=%-4d offset=%d", h.ElementCount, h.ElementOffset)
+	p.line(1, "styles          count=%-4d offset=%d", h.StyleCount, h.StyleOffset)
+	p.line(1, "component defs  count=%-4d offset=%d", h.ComponentDefCount, h.ComponentDefOffset)
+	p.line(1, "animations      count=%-4d offset=%d", h.AnimationCount, h.AnimationOffset)
+	p.line(1, "strings         count=%-4d offset=%d", h.StringCount, h.StringOffset)
+	p.line(1, "resources       count=%-4d offset=%d", h.ResourceCount, h.ResourceOffset)
+
+	p.line(0, "")
+	p.line(0, "Elements:")
+	for _, el := range d.Elements {
+		p.element(1, el)
+	}
+
+	if len(d.Styles) > 0 {
+		p.line(0, "")
+		p.line(0, "Styles:")
+		for _, s := range d.Styles {
+			p.line(1, "[%d] %q", s.ID, s.Name)
+			p.props(2, s.Properties)
+			for _, v := range s.Variants {
+				p.line(2, "state %s", v.State)
+				p.props(3, v.Properties)
+			}
+			for _, m := range s.Media {
+				p.line(2, "@media %s", m.Query)
+				p.props(3, m.Properties)
+			}
+		}
+	}
+
+	if len(d.ComponentDefs) > 0 {
+		p.line(0, "")
+		p.line(0, "Component Definitions:")
+		for _, c := range d.ComponentDefs {
+			p.line(1, "%s", c.Name)
+			for _, pd := range c.Properties {
+				p.line(2, "prop %s: %s = %s", pd.Name, pd.Hint, pd.Default)
+			}
+			for _, el := range c.Template {
+				p.element(2, el)
+			}
+		}
+	}
+
+	if len(d.Animations) > 0 {
+		p.line(0, "")
+		p.line(0, "Animations:")
+		for i, a := range d.Animations {
+			iterations := fmt.Sprint(a.Iterations)
+			if a.Iterations == krb.AnimIterationsInfinite {
+				iterations = "infinite"
+			}
+			p.line(1, "[%d] %q duration=%dms easing=%s iterations=%s", i, a.Name, a.DurationMs, a.Easing, iterations)
+			for _, kf := range a.Keyframes {
+				p.line(2, "%d%%", kf.Offset)
+				p.props(3, kf.Properties)
+			}
+		}
+	}
+
+	p.line(0, "")
+	p.line(0, "Strings:")
+	for i, s := range d.Strings {
+		p.line(1, "[%d] %q", i, s)
+	}
+
+	if len(d.Resources) > 0 {
+		p.line(0, "")
+		p.line(0, "Resources:")
+		for i, r := range d.Resources {
+			if r.Format == krb.ResFormatInline {
+				p.line(1, "[%d] %s %q format=%d inline size=%d", i, r.Type, r.Name, r.Format, r.Size)
+				continue
+			}
+			p.line(1, "[%d] %s %q format=%d data=%q", i, r.Type, r.Name, r.Format, r.Data)
+		}
+	}
+	return p.err
+}
+
+type textPrinter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *textPrinter) line(indent int, format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, "%s%s\n", strings.Repeat("  ", indent), fmt.Sprintf(format, args...))
+}
+
+func (p *textPrinter) element(indent int, el *dumpElement) {
+	head := fmt.Sprintf("%s @%d", el.Type, el.Offset)
+	if el.ID != "" {
+		head += fmt.Sprintf(" id=%q", el.ID)
+	}
+	p.line(indent, "%s", head)
+	p.line(indent+1, "pos=(%d,%d) size=(%d,%d) layout=0x%02X (%s)", el.PosX, el.PosY, el.Width, el.Height, el.Layout, el.LayoutText)
+	if el.StyleID != 0 {
+		p.line(indent+1, "style=%d %q", el.StyleID, el.Style)
+	}
+	p.props(indent+1, el.Properties)
+	for _, cp := range el.CustomProperties {
+		p.line(indent+1, "custom %s: %s = %s", cp.Name, cp.ValueType, cp.Value)
+	}
+	for _, ev := range el.Events {
+		p.line(indent+1, "on %s -> %s", ev.Type, ev.Callback)
+	}
+	for _, a := range el.Animations {
+		p.line(indent+1, "animation [%d] %q on %s", a.Index, a.Name, a.Trigger)
+	}
+	if len(el.ChildOffsets) > 0 {
+		p.line(indent+1, "child offsets: %v", el.ChildOffsets)
+	}
+	for _, child := range el.Children {
+		p.element(indent+1, child)
+	}
+}
+
+func (p *textPrinter) props(indent int, props []dumpProperty) {
+	for _, prop := range props {
+		p.line(indent, "%s (0x%02X): %s = %s", prop.Name, *prop.ID, prop.ValueType, prop.Value)
+	}
+}
@@ -0,0 +1,136 @@
+// fmt.go
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/waozixyz/kryc/syntax"
+)
+
+// --- Format Command ---
+
+// runFmt implements `kryc fmt [--check | -w] [path ...]`. Directories are
+// searched for .kry files; with no paths, stdin is formatted to stdout.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	check := flags.Bool("check", false, "list files whose formatting differs and exit with status 1 if any")
+	write := flags.Bool("w", false, "write the result back to the source files instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: kryc fmt [--check | -w] [file.kry | dir ...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *check && *write {
+		flags.Usage()
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintf(os.Stderr, "Failed: -w needs file arguments\n")
+			return 2
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+			return 1
+		}
+		return formatSource("<stdin>", src, *check, false)
+	}
+
+	files, err := kryFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+		return 1
+	}
+	status := 0
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+			status = 1
+			continue
+		}
+		if code := formatSource(path, src, *check, *write); code != 0 {
+			status = code
+		}
+	}
+	return status
+}
+
+// formatSource formats one file and reports, rewrites or prints the result.
+func formatSource(path string, src []byte, check, write bool) int {
+	out, err := syntax.Format(src)
+	if err != nil {
+		var list syntax.ErrorList
+		if errors.As(err, &list) {
+			for _, e := range list {
+				fmt.Fprintf(os.Stderr, "%s:%s\n", path, e)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		}
+		return 1
+	}
+
+	switch {
+	case check:
+		if !bytes.Equal(src, out) {
+			fmt.Println(path)
+			return 1
+		}
+	case write:
+		if bytes.Equal(src, out) {
+			return 0
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+			return 1
+		}
+		if err := os.WriteFile(path, out, info.Mode().Perm()); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+			return 1
+		}
+	default:
+		os.Stdout.Write(out)
+	}
+	return 0
+}
+
+// kryFiles expands directory arguments to the .kry files beneath them.
+func kryFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(p) == ".kry" {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,38 @@
+// lsp.go
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/waozixyz/kryc/lsp"
+)
+
+// --- LSP Subcommand ---
+
+// runLSP implements `kryc lsp`, which serves the Language Server Protocol over stdin and stdout. Server
+// errors go to stderr, which editors usually show in an output panel.
+func runLSP(args []string) int {
+	fs := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kryc lsp\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	logger := log.New(os.Stderr, "kryc lsp: ", 0)
+	server := lsp.NewServer(os.Stdin, os.Stdout, logger)
+	if err := server.Serve(context.Background()); err != nil {
+		logger.Println(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+// main.go
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/waozixyz/kryc"
+)
+
+// --- Main Function ---
+func main() {
+	// Use log package for consistent output formatting
+	log.SetFlags(0) // Remove timestamp prefixes
+
+	// --- Subcommands ---
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "dump":
+			os.Exit(runDump(os.Args[2:]))
+		case "decompile":
+			os.Exit(runDecompile(os.Args[2:]))
+		case "fmt":
+			os.Exit(runFmt(os.Args[2:]))
+		case "lsp":
+			os.Exit(runLSP(os.Args[2:]))
+		}
+	}
+
+	// --- Argument Handling ---
+	fs := flag.NewFlagSet("kryc", flag.ContinueOnError)
+	diagFormat := fs.String("diagnostics-format", diagnosticsText, "print diagnostics as `text` or json")
+	maxErrors := fs.Int("max-errors", kryc.DefaultMaxErrors, "stop after `n` errors (0 for no limit)")
+	target := fs.String("target", kryc.DefaultTarget, "build for the runtime `name`: "+strings.Join(kryc.TargetNames(), " or "))
+	compress := fs.Bool("compress", false, "DEFLATE-compress the sections after the file header")
+	embed := fs.Bool("embed-resources", false, "write every resource file into the KRB file instead of its path")
+	maxEmbedSize := fs.Int("max-embed-size", kryc.DefaultMaxEmbedSize, "limit each embedded resource to `bytes`")
+	fs.Usage = usage
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+	if fs.NArg() != 2 || !validDiagnosticsFormat(*diagFormat) {
+		usage()
+		os.Exit(2)
+	}
+	if *maxErrors == 0 {
+		*maxErrors = -1 // Options uses 0 for the default and a negative value for no limit
+	}
+	inputFile := fs.Arg(0)
+	outputFile := fs.Arg(1)
+
+	// In JSON mode stderr carries nothing but diagnostic records.
+	var logger *log.Logger
+	if *diagFormat == diagnosticsText {
+		logger = log.Default()
+	}
+
+	// --- Compile ---
+	result, err := kryc.Compile(context.Background(), kryc.Options{
+		Filename:       inputFile,
+		Logger:         logger,
+		MaxErrors:      *maxErrors,
+		Target:         *target,
+		Compress:       *compress,
+		EmbedResources: *embed,
+		MaxEmbedSize:   *maxEmbedSize,
+	})
+	if result != nil {
+		printDiagnostics(os.Stderr, *diagFormat, result.Diagnostics)
+	}
+	if err != nil {
+		if result == nil {
+			log.Printf("Failed: %v\n", err)
+		} else if logger != nil {
+			logger.Printf("Failed: %s\n", countDiagnostics(result.Diagnostics))
+		}
+		os.Exit(1)
+	}
+
+	// --- Write Output ---
+	if err := os.WriteFile(outputFile, result.KRB, 0o644); err != nil {
+		log.Printf("Failed: Writing '%s' - %v\n", outputFile, err)
+		_ = os.Remove(outputFile)
+		os.Exit(1)
+	}
+
+	// --- Success Message ---
+	if logger != nil {
+		logger.Printf("Success. Wrote '%s' (%d bytes, %s).\n", outputFile, len(result.KRB), countDiagnostics(result.Diagnostics))
+	}
+}
+
+func usage() {
+	name := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  %s [--diagnostics-format=text|json] [--max-errors=N] [--target=NAME] [--compress]\n", name)
+	fmt.Fprintf(os.Stderr, "         [--embed-resources] [--max-embed-size=BYTES] <input.kry> <output.krb>\n")
+	fmt.Fprintf(os.Stderr, "                                 compile a KRY file\n")
+	fmt.Fprintf(os.Stderr, "  %s dump [--json] <file.krb>   print the contents of a KRB file\n", name)
+	fmt.Fprintf(os.Stderr, "  %s decompile [-o out.kry] [--diagnostics-format=text|json] <file.krb>\n", name)
+	fmt.Fprintf(os.Stderr, "                                 convert a KRB file back into KRY source\n")
+	fmt.Fprintf(os.Stderr, "  %s fmt [--check | -w] [path ...]\n", name)
+	fmt.Fprintf(os.Stderr, "                                 format KRY source in canonical style\n")
+	fmt.Fprintf(os.Stderr, "  %s lsp                        run a KRY language server over stdio\n", name)
+}
@@ -0,0 +1,209 @@
+// compile.go
+package kryc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/waozixyz/kryc/krb"
+)
+
+// Options configures a single compilation.
+type Options struct {
+	// Filename is the path of the main KRY file. It is used to resolve
+	// relative @include paths and to label diagnostics.
+	Filename string
+
+	// Sources holds in-memory file contents keyed by path. The main file and
+	// any @include target found here are read from memory; anything else is
+	// read from the file system.
+	Sources map[string][]byte
+
+	// Logger receives progress output for each pass. Nil discards it.
+	Logger *log.Logger
+
+	// MaxErrors stops compilation once this many errors have been reported.
+	// Zero means DefaultMaxErrors; a negative value means no limit.
+	MaxErrors int
+
+	// Target names the runtime the KRB file is built for (see LookupTarget).
+	// Empty means DefaultTarget.
+	Target string
+
+	// Compress DEFLATE-compresses everything after the file header and sets
+	// FlagCompressed. The target must support compressed files.
+	Compress bool
+
+	// EmbedResources writes every resource inline (ResFormatInline) instead
+	// of referring to its path. Single resources are embedded with the
+	// `embed` keyword, e.g. `source: "logo.png" embed`.
+	EmbedResources bool
+
+	// MaxEmbedSize limits the size in bytes of each embedded resource file.
+	// Zero means DefaultMaxEmbedSize.
+	MaxEmbedSize int
+}
+
+// DefaultMaxErrors is the error limit used when Options.MaxErrors is zero.
+const DefaultMaxErrors = 20
+
+// DefaultMaxEmbedSize is the embedded resource size limit used when
+// Options.MaxEmbedSize is zero.
+const DefaultMaxEmbedSize = 4 << 20
+
+// Result is the output of a compilation.
+type Result struct {
+	KRB         []byte       // The compiled KRB file; nil if compilation failed
+	Diagnostics []Diagnostic // Warnings, and the error that stopped compilation if any
+	Symbols     []Symbol     // Styles, components and variables defined by the source
+}
+
+// Compile compiles the KRY file described by opts into a KRB binary.
+// On failure the returned Result still carries the diagnostics collected so
+// far, ending with one describing err.
+func Compile(ctx context.Context, opts Options) (*Result, error) {
+	if opts.Filename == "" {
+		return nil, errors.New("kryc: Options.Filename is required")
+	}
+	target, err := LookupTarget(opts.Target)
+	if err != nil {
+		return nil, fmt.Errorf("kryc: %w", err)
+	}
+	if opts.Compress && !target.Compression {
+		return nil, fmt.Errorf("kryc: target '%s' does not support compressed files", target.Name)
+	}
+
+	state := newCompilerState(opts)
+	state.target = target
+	result := &Result{}
+	krb, err := state.compile(ctx, opts.Filename)
+	if err != nil && ctx.Err() == nil && !errors.Is(err, errCompilationFailed) {
+		state.diagnostics = append(state.diagnostics, state.errorDiagnostic(err))
+	}
+	result.Diagnostics = state.diagnostics
+	result.Symbols = state.symbols
+	if err != nil {
+		return result, err
+	}
+	result.KRB = krb
+	return result, nil
+}
+
+// newCompilerState returns an empty CompilerState configured from opts.
+func newCompilerState(opts Options) *CompilerState {
+	sources := make(map[string][]byte, len(opts.Sources))
+	for path, content := range opts.Sources {
+		sources[filepath.Clean(path)] = content
+	}
+	maxErrors := opts.MaxErrors
+	if maxErrors == 0 {
+		maxErrors = DefaultMaxErrors
+	} else if maxErrors < 0 {
+		maxErrors = 0
+	}
+	maxEmbedSize := opts.MaxEmbedSize
+	if maxEmbedSize <= 0 {
+		maxEmbedSize = DefaultMaxEmbedSize
+	}
+	return &CompilerState{
+		Elements:      make([]Element, 0, 64),
+		Strings:       make([]StringEntry, 0, 128),
+		Styles:        make([]StyleEntry, 0, 32),
+		Resources:     make([]ResourceEntry, 0, 16),
+		ComponentDefs: make([]ComponentDefinition, 0, 16),
+		Variables:     make(map[string]VariableDef),
+		sources:       sources,
+		logger:        opts.Logger,
+		maxErrors:     maxErrors,
+		compress:      opts.Compress,
+		embedAll:      opts.EmbedResources,
+		maxEmbedSize:  maxEmbedSize,
+	}
+}
+
+// compile runs every pass over inputFile and returns the encoded KRB bytes.
+func (state *CompilerState) compile(ctx context.Context, inputFile string) ([]byte, error) {
+	state.logf("Compiling '%s' (KRB v%d.%d)...\n", inputFile, KRBVersionMajor, KRBVersionMinor)
+
+	// --- Pass 0.1: Process Includes ---
+	state.logf("Pass 0.1: Processing includes...")
+	sourceAfterIncludes, totalLines, err := state.preprocessIncludes(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("preprocessing includes: %w", err)
+	}
+	state.logf("   Preprocessed includes: approx %d lines.\n", totalLines)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// --- Pass 0.2: Process Variables ---
+	state.logf("Pass 0.2: Processing variables...")
+	state.CurrentFilePath = inputFile
+	sourceAfterVariables, err := state.ProcessAndSubstituteVariables(sourceAfterIncludes)
+	if err != nil {
+		return nil, fmt.Errorf("processing variables: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// --- Pass 1: Parse Source ---
+	state.logf("Pass 1: Parsing source...")
+	if err := state.parseKrySource(sourceAfterVariables); err != nil {
+		return nil, fmt.Errorf("parsing: %w", err)
+	}
+	if err := state.recordedErrors(); err != nil {
+		return nil, err // Resolving a partially parsed tree would only add follow-on errors
+	}
+	state.logf("   Parsed %d items, %d styles, %d strings, %d res, %d defs.\n",
+		len(state.Elements), len(state.Styles), len(state.Strings), len(state.Resources), len(state.ComponentDefs))
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// --- Pass 1.2: Resolve Style Inheritance ---
+	if err := state.resolveStyleInheritance(); err != nil {
+		return nil, fmt.Errorf("style resolution: %w", err)
+	}
+
+	// --- Pass 1.5: Resolve Components and Element Properties ---
+	if err := state.resolveComponentsAndProperties(); err != nil {
+		return nil, fmt.Errorf("expansion/resolution: %w", err)
+	}
+	if err := state.recordedErrors(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// --- Pass 2: Calculate Offsets and Final Sizes ---
+	if err := state.calculateOffsetsAndSizes(); err != nil {
+		return nil, fmt.Errorf("offset calculation: %w", err)
+	}
+
+	// --- Pass 3: Write Binary KRB ---
+	if state.compress {
+		state.HeaderFlags |= FlagCompressed
+	}
+	var buf bytes.Buffer
+	buf.Grow(int(state.TotalSize))
+	if err := state.writeKrbFile(&buf); err != nil {
+		return nil, fmt.Errorf("writing binary: %w", err)
+	}
+	if !state.compress {
+		return buf.Bytes(), nil
+	}
+
+	// --- Pass 4: Compress Section Payloads ---
+	compressed, err := krb.Compress(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("compressing: %w", err)
+	}
+	state.logf("Pass 4: Compressed %d bytes to %d bytes.\n", buf.Len(), len(compressed))
+	return compressed, nil
+}
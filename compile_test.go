@@ -0,0 +1,263 @@
+// compile_test.go
+package kryc
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/waozixyz/kryc/krb"
+)
+
+// errorLines returns the lines of the error diagnostics in diags, in order.
+func errorLines(diags []Diagnostic) []int {
+	var lines []int
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			lines = append(lines, d.Line)
+		}
+	}
+	return lines
+}
+
+func TestCompileReportsEveryError(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []int // Lines of the expected errors
+	}{
+		{
+			name: "parse",
+			src: `App {
+    Container { id "x" }
+    Text { text: "ok" }
+    Button { : 1 }
+}
+`,
+			want: []int{2, 4},
+		},
+		{
+			name: "variables",
+			src: `@variables {
+    a: $b
+    b: $a
+    c: $nope
+    1x: 2
+}
+App { window_width: $c; window_title: $zz }
+`,
+			want: []int{5, 2, 4, 7},
+		},
+		{
+			name: "style properties",
+			src: `style "s" {
+    background_color: "#12345"
+    text_color: "#zz"
+    state hover { opacity: x; font_size: y }
+}
+App { Container { style: "s" } }
+`,
+			want: []int{2, 3, 4, 4},
+		},
+		{
+			name: "element properties",
+			src: `App {
+    Text { font_size: "zz" }
+    Container {
+        state pressed { opacity: q }
+        @media (max_width: 10) { font_size: w }
+    }
+    Image { opacity: "x" }
+}
+`,
+			want: []int{2, 4, 5, 7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := diagnostics(t, map[string]string{"main.kry": tt.src})
+			if got := errorLines(diags); !slices.Equal(got, tt.want) {
+				for _, d := range diags {
+					t.Log(d)
+				}
+				t.Errorf("got errors on lines %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileMaxErrors(t *testing.T) {
+	var src strings.Builder
+	src.WriteString("App {\n")
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&src, "    Text { font_size: \"x%d\" }\n", i)
+	}
+	src.WriteString("}\n")
+
+	tests := []struct {
+		maxErrors int
+		want      int
+	}{
+		{0, DefaultMaxErrors},
+		{3, 3},
+		{-1, 30},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.maxErrors), func(t *testing.T) {
+			res, err := Compile(context.Background(), Options{
+				Filename:  "main.kry",
+				Sources:   map[string][]byte{"main.kry": []byte(src.String())},
+				MaxErrors: tt.maxErrors,
+			})
+			if err == nil {
+				t.Fatal("compile succeeded, want an error")
+			}
+			if got := len(errorLines(res.Diagnostics)); got != tt.want {
+				t.Errorf("got %d errors, want %d", got, tt.want)
+			}
+			if res.KRB != nil {
+				t.Error("got KRB output from a failed compilation")
+			}
+		})
+	}
+}
+
+func TestCompileMinimalTarget(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	tests := []struct {
+		name string
+		src  string
+		line int
+		want string // Error message
+	}{
+		{
+			name: "long element string",
+			src:  "App {\n    Text { text: \"" + long + "\" }\n}\n",
+			line: 2,
+			want: "error processing property 'text: \"" + long[:39] + "...' for element 'Text': failed adding string for property 0x8 ('" + long[:40] +
+				"...'): string '" + long[:40] + "...' is 300 bytes long; target 'minimal' limits strings to 255 bytes",
+		},
+		{
+			name: "long style string",
+			src:  "style \"s\" {\n    text: \"" + long + "\"\n}\nApp { style: \"s\" }\n",
+			line: 2,
+			want: "error processing property 'text: \"" + long[:39] + "...' in style 's': failed to add string '" + long[:40] +
+				"...' to table: string '" + long[:40] + "...' is 300 bytes long; target 'minimal' limits strings to 255 bytes",
+		},
+		{
+			name: "too many children",
+			src:  "App {\n" + strings.Repeat("    Text {}\n", 256) + "}\n",
+			line: 257,
+			want: "max children (255) for parent 'App' on target 'minimal'",
+		},
+		{
+			name: "too many elements",
+			src:  "App {\n" + strings.Repeat("    Container {\n"+strings.Repeat("        Text {}\n", 200)+"    }\n", 6) + "}\n",
+			line: 1030,
+			want: "maximum elements (1024) for target 'minimal' exceeded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Compile(context.Background(), Options{
+				Filename: "main.kry",
+				Sources:  map[string][]byte{"main.kry": []byte(tt.src)},
+				Target:   "minimal",
+			})
+			if err == nil {
+				t.Fatal("compile succeeded, want an error")
+			}
+			var errs []Diagnostic
+			for _, d := range res.Diagnostics {
+				if d.Severity == SeverityError {
+					errs = append(errs, d)
+				}
+			}
+			if len(errs) != 1 || errs[0].Line != tt.line || errs[0].Message != tt.want {
+				t.Errorf("got %v\nwant one error on line %d: %s", errs, tt.line, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileCompositeStyles(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string // Style names in table order
+	}{
+		{
+			name: "shared",
+			src:  "App {\n    Text { style: [\"a\", \"b\"] }\n    Button { style: [\"a\", \"b\"] }\n}\n",
+			want: []string{"a", "b", "a+b"},
+		},
+		{
+			name: "only with state",
+			src:  "App {\n    Button {\n        style: [\"a\", \"b\"]\n        state hover { opacity: 0.5 }\n    }\n}\n",
+			want: []string{"a", "b", "a+b~1"},
+		},
+		{
+			name: "with and without state",
+			src:  "App {\n    Button {\n        style: [\"a\", \"b\"]\n        state hover { opacity: 0.5 }\n    }\n    Text { style: [\"a\", \"b\"] }\n    Button {\n        style: [\"a\", \"b\"]\n        state pressed { opacity: 0.2 }\n    }\n}\n",
+			want: []string{"a", "b", "a+b~1", "a+b", "a+b~2"},
+		},
+	}
+	const styles = "style \"a\" { padding: 4 }\nstyle \"b\" { font_size: 12 }\n"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := krb.Decode(compileSources(t, map[string][]byte{"main.kry": []byte(styles + tt.src)}, false))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			var got []string
+			for _, s := range f.Styles {
+				name, _ := f.String(s.NameIndex)
+				got = append(got, name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got styles %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileElementVariantSizes(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string // Errors, each followed by its related locations
+	}{
+		{
+			name: "pixel width",
+			src:  "App {\n    Container {\n        width: 240\n        @media (max_width: 599) { width: 0 }\n        state hover { height: 10; width: 200 }\n    }\n}\n",
+			want: []string{
+				"main.kry:5:35: error[E0402]: 'width' in state 'hover' cannot override the width of element 'Container', which is set in pixels; set it in a style instead",
+				"main.kry:3:9: note: width of 'Container' set here",
+				"main.kry:4:35: error[E0402]: 'width' in @media (max_width: 599) cannot override the width of element 'Container', which is set in pixels; set it in a style instead",
+				"main.kry:3:9: note: width of 'Container' set here",
+			},
+		},
+		{
+			name: "width from style or percentage",
+			src:  "style \"s\" { width: 240 }\nApp {\n    Container {\n        style: \"s\"\n        @media (max_width: 599) { width: 0 }\n    }\n    Container {\n        width: 50%\n        height: 20\n        @media (max_width: 599) { width: 0 }\n    }\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range diagnostics(t, map[string]string{"main.kry": tt.src}) {
+				if d.Severity == SeverityError {
+					got = append(got, d.String())
+					for _, r := range d.Related {
+						got = append(got, r.String())
+					}
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
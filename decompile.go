@@ -0,0 +1,1283 @@
+// decompile.go
+package kryc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/waozixyz/kryc/krb"
+	"github.com/waozixyz/kryc/syntax"
+)
+
+// Decompile renders a decoded KRB file back into KRY source. Styles become
+// `style` blocks, animations `@animation` blocks, named resources
+// `@resources` blocks, component definitions
+// become `Define` blocks and the main tree is rebuilt from its elements. Properties are emitted in an order that
+// reproduces the original string table, so compiling the result of a file
+// produced by kryc yields the same bytes.
+//
+// Anything KRY cannot express is written as a comment and reported as a
+// warning diagnostic.
+func Decompile(file *krb.File) ([]byte, []Diagnostic, error) {
+	if file == nil {
+		return nil, nil, errors.New("kryc: nil KRB file")
+	}
+	d := &decompiler{
+		file:       file,
+		introduced: make([]bool, len(file.Strings)),
+		defs:       make(map[string]*krb.ComponentDef, len(file.ComponentDefs)),
+		resources:  make(map[string]bool),
+		embedded:   make(map[string]bool),
+	}
+	for _, res := range file.Resources {
+		if name, ok := declaredResource(file, res); ok && res.Format == ResFormatInline {
+			d.embedded[name] = true
+		} else if ok {
+			d.resources[name] = true
+		}
+	}
+	for _, def := range file.ComponentDefs {
+		if name, ok := file.String(def.NameIndex); ok {
+			d.defs[name] = def
+		}
+	}
+	d.decompile()
+	return d.buf.Bytes(), d.diagnostics, nil
+}
+
+// decompiler holds the state of a single Decompile call.
+type decompiler struct {
+	file        *krb.File
+	defs        map[string]*krb.ComponentDef // Component definitions by name
+	resources   map[string]bool              // Names of resources declared in @resources
+	embedded    map[string]bool              // Names of declared resources embedded without their path
+	buf         bytes.Buffer
+	diagnostics []Diagnostic
+
+	// introduced tracks which string table entries the compiler would already
+	// have added at the current point of the output. The compiler numbers
+	// strings by first use, so properties are ordered to introduce new
+	// strings in ascending index order.
+	introduced []bool
+}
+
+// topLevelBlock is a Define or a main tree root, in output order.
+type topLevelBlock struct {
+	def  *krb.ComponentDef
+	root *krb.Element
+	key  int // Lowest string index first added by the block; orders the blocks
+}
+
+func (d *decompiler) warnf(format string, args ...interface{}) {
+	d.diagnostics = append(d.diagnostics, Diagnostic{Severity: SeverityWarning, Code: CodeDecompileLossy, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *decompiler) line(indent int, format string, args ...interface{}) {
+	d.buf.WriteString(strings.Repeat("    ", indent))
+	fmt.Fprintf(&d.buf, format, args...)
+	d.buf.WriteByte('\n')
+}
+
+// unsupported records a construct that cannot be written as KRY and leaves
+// a comment in its place.
+func (d *decompiler) unsupported(indent int, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	d.warnf("%s", msg)
+	d.line(indent, "# kryc: cannot express %s", msg)
+}
+
+func (d *decompiler) decompile() {
+	f := d.file
+
+	// Strings added while parsing and resolving styles, animations and
+	// resources precede everything added for elements (Pass 1.5) and
+	// component definitions (Pass 2).
+	d.markIntroduced(0)
+	var resources []krb.Resource
+	for _, res := range f.Resources {
+		if _, ok := declaredResource(f, res); ok {
+			resources = append(resources, res)
+			d.markIntroduced(res.NameIndex)
+			if res.Format == ResFormatExternal {
+				d.markIntroduced(res.DataStringIndex)
+			}
+		}
+	}
+	var styles []*krb.Style
+	for _, s := range f.Styles {
+		if _, _, ok := variantStyleBase(f, s); ok || compositeStyleNames(f, s) != nil {
+			continue // Named when an element first uses it
+		}
+		styles = append(styles, s)
+		d.markIntroduced(s.NameIndex)
+		for _, p := range s.Properties {
+			d.markIntroduced(propertyStrings(f, p)...)
+		}
+		for _, v := range s.Variants {
+			for _, p := range v.Properties {
+				d.markIntroduced(propertyStrings(f, p)...)
+			}
+		}
+		for _, v := range s.Media {
+			for _, p := range v.Properties {
+				d.markIntroduced(propertyStrings(f, p)...)
+			}
+		}
+	}
+	for _, a := range f.Animations {
+		d.markIntroduced(a.NameIndex)
+		for _, kf := range a.Keyframes {
+			for _, p := range kf.Properties {
+				d.markIntroduced(propertyStrings(f, p)...)
+			}
+		}
+	}
+	visit := func(el *krb.Element) {
+		if el.Type >= ElemTypeCustomBase {
+			d.markIntroduced(el.IDStringIndex)
+		}
+	}
+	for _, el := range f.Elements {
+		visit(el)
+	}
+	for _, def := range f.ComponentDefs {
+		for _, el := range def.Template {
+			visit(el)
+		}
+	}
+
+	// Order the Defines and the main tree the way their element strings were
+	// first used. Defines that add no strings keep their place before the App.
+	// Roots keep their order, the App first: one that adds no strings moves
+	// up to the next root that does.
+	var blocks []topLevelBlock
+	for _, def := range f.ComponentDefs {
+		if def.Root != nil {
+			blocks = append(blocks, topLevelBlock{def: def, key: d.firstNewString(def.Root, -1)})
+		}
+	}
+	next := len(f.Strings)
+	for i := len(f.Roots) - 1; i >= 0; i-- {
+		next = min(next, d.firstNewString(f.Roots[i], len(f.Strings)))
+		blocks = append(blocks, topLevelBlock{root: f.Roots[i], key: next})
+	}
+	slices.Reverse(blocks[len(blocks)-len(f.Roots):])
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].key < blocks[j].key })
+
+	// Styles, animations and resources are written in the order their names
+	// were added, with consecutive resources sharing one @resources block.
+	s, a, r := styles, f.Animations, resources
+	for len(s) > 0 || len(a) > 0 || len(r) > 0 {
+		sk, ak, rk := math.MaxInt, math.MaxInt, math.MaxInt
+		if len(s) > 0 {
+			sk = int(s[0].NameIndex)
+		}
+		if len(a) > 0 {
+			ak = int(a[0].NameIndex)
+		}
+		if len(r) > 0 {
+			rk = int(r[0].NameIndex)
+		}
+		switch {
+		case rk < sk && rk < ak:
+			n := 1
+			for n < len(r) && int(r[n].NameIndex) < min(sk, ak) {
+				n++
+			}
+			d.resourceBlock(r[:n])
+			r = r[n:]
+		case sk < ak:
+			d.style(s[0])
+			s = s[1:]
+		default:
+			d.animation(a[0])
+			a = a[1:]
+		}
+		d.buf.WriteByte('\n')
+	}
+	for i, b := range blocks {
+		if i > 0 {
+			d.buf.WriteByte('\n')
+		}
+		if b.def != nil {
+			d.define(b.def)
+		} else {
+			d.element(b.root, 0)
+		}
+	}
+	if len(f.Roots) > 1 && f.Roots[0].Type != krb.ElemTypeApp {
+		d.warnf("file has %d root elements and the first is not App; KRY only allows other roots after the App", len(f.Roots))
+	}
+
+	// Component definition names, property names and defaults come last.
+	for _, def := range f.ComponentDefs {
+		d.markIntroduced(def.NameIndex)
+		for _, pd := range def.Properties {
+			d.markIntroduced(pd.NameIndex)
+			if idx, ok := krb.Index(pd.DefaultValue); ok && krb.HintValueType(pd.ValueTypeHint) == ValTypeString {
+				d.markIntroduced(idx)
+			}
+		}
+	}
+	for i, ok := range d.introduced {
+		if !ok {
+			d.warnf("string %d (%q) is not referenced by any element, style or component", i, f.Strings[i])
+		}
+	}
+}
+
+// --- String Order ---
+
+func (d *decompiler) markIntroduced(indices ...uint16) {
+	for _, idx := range indices {
+		if int(idx) < len(d.introduced) {
+			d.introduced[idx] = true
+		}
+	}
+}
+
+// firstNew returns the lowest index in strs that has not been introduced,
+// or -1 if every string is already known.
+func (d *decompiler) firstNew(strs []uint16) int {
+	first := -1
+	for _, idx := range strs {
+		if int(idx) < len(d.introduced) && !d.introduced[idx] && (first < 0 || int(idx) < first) {
+			first = int(idx)
+		}
+	}
+	return first
+}
+
+// nextString returns the index the compiler would assign to the next new string.
+func (d *decompiler) nextString() int {
+	for i, ok := range d.introduced {
+		if !ok {
+			return i
+		}
+	}
+	return len(d.introduced)
+}
+
+// firstNewString returns the lowest not yet introduced string index used by
+// the element tree rooted at el, or fallback if there is none.
+func (d *decompiler) firstNewString(el *krb.Element, fallback int) int {
+	first := d.firstNew(elementStrings(d.file, el))
+	for _, child := range el.Children {
+		if c := d.firstNewString(child, -1); c >= 0 && (first < 0 || c < first) {
+			first = c
+		}
+	}
+	if first < 0 {
+		return fallback
+	}
+	return first
+}
+
+// elementStrings lists every string index referenced by el itself.
+func elementStrings(f *krb.File, el *krb.Element) []uint16 {
+	strs := []uint16{el.IDStringIndex}
+	style := f.StyleByID(el.StyleID)
+	if base, _, ok := variantStyleBase(f, style); ok {
+		for _, v := range style.Variants {
+			for _, p := range v.Properties {
+				strs = append(strs, propertyStrings(f, p)...)
+			}
+		}
+		for _, v := range style.Media {
+			for _, p := range v.Properties {
+				strs = append(strs, propertyStrings(f, p)...)
+			}
+		}
+		strs = append(strs, style.NameIndex)
+		style = base
+	}
+	if style != nil && compositeStyleNames(f, style) != nil {
+		strs = append(strs, style.NameIndex)
+	}
+	for _, p := range el.Properties {
+		strs = append(strs, propertyStrings(f, p)...)
+	}
+	for _, cp := range el.CustomProperties {
+		strs = append(strs, customPropertyStrings(cp)...)
+	}
+	for _, ev := range el.Events {
+		strs = append(strs, ev.CallbackIndex)
+	}
+	return strs
+}
+
+// propertyStrings returns the string indices a standard property refers to.
+func propertyStrings(f *krb.File, p krb.Property) []uint16 {
+	idx, ok := krb.Index(p.Value)
+	if !ok {
+		return nil
+	}
+	switch p.ValueType {
+	case ValTypeString:
+		return []uint16{idx}
+	case ValTypeResource:
+		if int(idx) < len(f.Resources) {
+			return []uint16{f.Resources[idx].NameIndex}
+		}
+	}
+	return nil
+}
+
+// customPropertyStrings returns the key and, for strings, value indices of cp
+// in the order the compiler adds them.
+func customPropertyStrings(cp krb.CustomProperty) []uint16 {
+	if idx, ok := krb.Index(cp.Value); ok && cp.ValueType == ValTypeString {
+		return []uint16{cp.KeyIndex, idx}
+	}
+	return []uint16{cp.KeyIndex}
+}
+
+// --- Styles ---
+
+func (d *decompiler) style(s *krb.Style) {
+	name, _ := d.file.String(s.NameIndex)
+	d.line(0, "style %s {", quoteKry(name))
+
+	d.styleProperties(s.Properties, 1, fmt.Sprintf("style %q", name))
+	for _, v := range s.Variants {
+		d.stateBlock(v.State, v.Properties, 1, fmt.Sprintf("style %q", name))
+	}
+	for _, v := range s.Media {
+		d.mediaBlock(v.Conditions, v.Properties, 1, fmt.Sprintf("style %q", name))
+	}
+	d.line(0, "}")
+}
+
+// styleProperties writes style properties, as found in a style block or a
+// state or @media block. where describes the block for unsupported properties.
+func (d *decompiler) styleProperties(props []krb.Property, indent int, where string) {
+	// Styles are stored sorted by PropID, so only the relative order of the
+	// string-valued properties needs restoring.
+	props = append([]krb.Property(nil), props...)
+	var slots []int
+	var strProps []krb.Property
+	for i, p := range props {
+		if len(propertyStrings(d.file, p)) > 0 {
+			slots = append(slots, i)
+			strProps = append(strProps, p)
+		}
+	}
+	sort.SliceStable(strProps, func(i, j int) bool {
+		return propertyStrings(d.file, strProps[i])[0] < propertyStrings(d.file, strProps[j])[0]
+	})
+	for i, slot := range slots {
+		props[slot] = strProps[i]
+	}
+
+	used := make(map[string]bool)
+	for _, p := range props {
+		key, value, ok := d.propertyKeyValue(p, nil, used)
+		if !ok {
+			d.unsupported(indent, "%s = %s in %s", krb.PropertyName(p.ID), krb.FormatValue(d.file, p.ValueType, p.Value), where)
+			continue
+		}
+		d.line(indent, "%s: %s", key, value)
+		d.markIntroduced(propertyStrings(d.file, p)...)
+	}
+}
+
+// stateBlock writes a `state hover { ... }` block.
+func (d *decompiler) stateBlock(st uint8, props []krb.Property, indent int, where string) {
+	name := krb.StateName(st)
+	if _, ok := krb.StateByName(name); !ok {
+		d.unsupported(indent, "variant for unknown state 0x%02X in %s", st, where)
+		return
+	}
+	d.line(indent, "state %s {", name)
+	d.styleProperties(props, indent+1, fmt.Sprintf("state %s of %s", name, where))
+	d.line(indent, "}")
+}
+
+// mediaBlock writes an `@media (min_width: 600) { ... }` block.
+func (d *decompiler) mediaBlock(conds []krb.MediaCondition, props []krb.Property, indent int, where string) {
+	query := krb.FormatMediaQuery(conds)
+	for _, c := range conds {
+		if _, ok := krb.MediaFeatureByName(krb.MediaFeatureName(c.Feature)); !ok || (c.Feature == krb.MediaOrientation && c.Value > krb.OrientationLandscape) {
+			d.unsupported(indent, "media variant %s in %s", query, where)
+			return
+		}
+	}
+	if len(conds) == 0 {
+		d.unsupported(indent, "media variant without conditions in %s", where)
+		return
+	}
+	d.line(indent, "@media %s {", query)
+	d.styleProperties(props, indent+1, fmt.Sprintf("@media %s of %s", query, where))
+	d.line(indent, "}")
+}
+
+// --- Resources ---
+
+// declaredResource returns the name of a resource declared in @resources.
+// Resources referenced by path are named by their path; a declared external
+// resource has a name that differs from its path, and a declared inline one
+// has an identifier as its name.
+func declaredResource(f *krb.File, res krb.Resource) (string, bool) {
+	name, ok := f.String(res.NameIndex)
+	if !ok || !isValidIdentifier(name) || name == resourceNamespace {
+		return "", false
+	}
+	if _, ok := krb.ResourceTypeByName(krb.ResourceTypeName(res.Type)); !ok {
+		return "", false
+	}
+	switch res.Format {
+	case ResFormatExternal:
+		_, ok := f.String(res.DataStringIndex)
+		return name, ok && res.DataStringIndex != res.NameIndex
+	case ResFormatInline:
+		return name, true
+	}
+	return "", false
+}
+
+// resourceBlock writes declared resources as an @resources block. The path
+// of an embedded file is not stored, so embedded ones cannot be declared
+// again and are written as comments, as are the properties that use them.
+func (d *decompiler) resourceBlock(resources []krb.Resource) {
+	d.line(0, "@resources {")
+	for _, res := range resources {
+		name, _ := d.file.String(res.NameIndex)
+		if res.Format == ResFormatInline {
+			d.unsupported(1, "embedded %s resource '%s' (%d bytes) without its file path", krb.ResourceTypeName(res.Type), name, len(res.Data))
+			continue
+		}
+		path, _ := d.file.String(res.DataStringIndex)
+		d.line(1, "%s: %s %s", name, krb.ResourceTypeName(res.Type), d.quoteString(path))
+	}
+	d.line(0, "}")
+}
+
+// compositeStyleNames returns the styles a composite style merges, or nil if
+// s is not one. The compiler names composites after their styles joined
+// with '+' and gives them exactly the merged properties of those styles.
+func compositeStyleNames(f *krb.File, s *krb.Style) []string {
+	name, _ := f.String(s.NameIndex)
+	merged := mergedStyle(compositeParts(f, name, s.ID))
+	if merged == nil || len(merged.Properties) != len(s.Properties) {
+		return nil
+	}
+	for _, p := range s.Properties {
+		m, ok := findProperty(merged.Properties, p.ID)
+		if !ok || m.ValueType != p.ValueType || !bytes.Equal(m.Value, p.Value) {
+			return nil
+		}
+	}
+	return strings.Split(name, "+")
+}
+
+// compositeParts returns the styles named by a composite style name such as
+// "base+primary", or nil if name is not one. Only styles before the style
+// with ID before count.
+func compositeParts(f *krb.File, name string, before uint16) []*krb.Style {
+	names := strings.Split(name, "+")
+	if len(names) < 2 {
+		return nil
+	}
+	parts := make([]*krb.Style, len(names))
+	for i, n := range names {
+		for _, b := range f.Styles {
+			if bn, _ := f.String(b.NameIndex); bn == n && b.ID < before {
+				parts[i] = b
+			}
+		}
+		if parts[i] == nil || compositeStyleNames(f, parts[i]) != nil {
+			return nil
+		}
+	}
+	return parts
+}
+
+// mergedStyle returns the properties and variants of parts merged in order,
+// later styles overriding earlier ones, as the compiler resolves a composite
+// style. It returns nil if parts is empty.
+func mergedStyle(parts []*krb.Style) *krb.Style {
+	if len(parts) == 0 {
+		return nil
+	}
+	props := make(map[uint8]krb.Property)
+	states := make(map[uint8]map[uint8]krb.Property)
+	var conds [][]krb.MediaCondition
+	var media []map[uint8]krb.Property
+	for _, s := range parts {
+		for _, p := range s.Properties {
+			props[p.ID] = p
+		}
+		for _, v := range s.Variants {
+			if states[v.State] == nil {
+				states[v.State] = make(map[uint8]krb.Property)
+			}
+			for _, p := range v.Properties {
+				states[v.State][p.ID] = p
+			}
+		}
+		for _, v := range s.Media {
+			i := slices.IndexFunc(conds, func(c []krb.MediaCondition) bool { return slices.Equal(c, v.Conditions) })
+			if i < 0 {
+				i = len(conds)
+				conds = append(conds, v.Conditions)
+				media = append(media, make(map[uint8]krb.Property))
+			}
+			for _, p := range v.Properties {
+				media[i][p.ID] = p
+			}
+		}
+	}
+	merged := &krb.Style{Properties: sortedByID(props)}
+	for _, st := range slices.Sorted(maps.Keys(states)) {
+		merged.Variants = append(merged.Variants, krb.StyleVariant{State: st, Properties: sortedByID(states[st])})
+	}
+	for i, c := range conds {
+		merged.Media = append(merged.Media, krb.MediaVariant{Conditions: c, Properties: sortedByID(media[i])})
+	}
+	return merged
+}
+
+// sortedByID returns the properties of props ordered by ID.
+func sortedByID(props map[uint8]krb.Property) []krb.Property {
+	out := make([]krb.Property, 0, len(props))
+	for _, id := range slices.Sorted(maps.Keys(props)) {
+		out = append(out, props[id])
+	}
+	return out
+}
+
+// findProperty returns the property with the given ID in props.
+func findProperty(props []krb.Property, id uint8) (krb.Property, bool) {
+	for _, p := range props {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return krb.Property{}, false
+}
+
+// variantStyleBase returns the style that s refines if s was synthesized for
+// an element with state or @media blocks, and whether it was. The compiler
+// names such styles after their base style and a counter ("button~1", or "~1"
+// without a base) and gives them the base's properties and a superset of its
+// variants. A composite base ("base+primary~1") that no other element uses
+// has no style of its own; it is then returned merged from its styles, with
+// their names.
+func variantStyleBase(f *krb.File, s *krb.Style) (*krb.Style, []string, bool) {
+	if s == nil || (len(s.Variants) == 0 && len(s.Media) == 0) {
+		return nil, nil, false
+	}
+	name, _ := f.String(s.NameIndex)
+	i := strings.LastIndexByte(name, '~')
+	if i < 0 {
+		return nil, nil, false
+	}
+	if _, err := strconv.ParseUint(name[i+1:], 10, 16); err != nil {
+		return nil, nil, false
+	}
+	var base *krb.Style
+	var names []string
+	if i > 0 {
+		for _, b := range f.Styles {
+			if bn, _ := f.String(b.NameIndex); bn == name[:i] && b.ID < s.ID {
+				base = b
+			}
+		}
+		if base == nil {
+			if base = mergedStyle(compositeParts(f, name[:i], s.ID)); base == nil {
+				return nil, nil, false
+			}
+			names = strings.Split(name[:i], "+")
+		} else if _, _, ok := variantStyleBase(f, base); ok {
+			return nil, nil, false
+		}
+	}
+	var props []krb.Property
+	var variants []krb.StyleVariant
+	var media []krb.MediaVariant
+	if base != nil {
+		props, variants, media = base.Properties, base.Variants, base.Media
+	}
+	if !sameProperties(props, s.Properties) {
+		return nil, nil, false
+	}
+	for _, v := range variants {
+		for _, p := range v.Properties {
+			if _, ok := variantProperty(s, v.State, p.ID); !ok {
+				return nil, nil, false
+			}
+		}
+	}
+	for i, v := range media {
+		// Inherited queries keep their place ahead of the element's own.
+		if i >= len(s.Media) || !slices.Equal(s.Media[i].Conditions, v.Conditions) {
+			return nil, nil, false
+		}
+		for _, p := range v.Properties {
+			if _, ok := mediaProperty(s, v.Conditions, p.ID); !ok {
+				return nil, nil, false
+			}
+		}
+	}
+	return base, names, true
+}
+
+// variantProperty returns the property with the given ID in s's variant for st.
+func variantProperty(s *krb.Style, st, id uint8) (krb.Property, bool) {
+	if s != nil {
+		for _, v := range s.Variants {
+			if v.State != st {
+				continue
+			}
+			for _, p := range v.Properties {
+				if p.ID == id {
+					return p, true
+				}
+			}
+		}
+	}
+	return krb.Property{}, false
+}
+
+// mediaProperty returns the property with the given ID in s's media variant
+// for conds.
+func mediaProperty(s *krb.Style, conds []krb.MediaCondition, id uint8) (krb.Property, bool) {
+	if s != nil {
+		for _, v := range s.Media {
+			if !slices.Equal(v.Conditions, conds) {
+				continue
+			}
+			for _, p := range v.Properties {
+				if p.ID == id {
+					return p, true
+				}
+			}
+		}
+	}
+	return krb.Property{}, false
+}
+
+// sameProperties reports whether a and b hold the same properties, in any order.
+func sameProperties(a, b []krb.Property) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, p := range a {
+		found := false
+		for _, q := range b {
+			if p.ID == q.ID && p.ValueType == q.ValueType && bytes.Equal(p.Value, q.Value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// --- Animations ---
+
+func (d *decompiler) animation(a *krb.Animation) {
+	name, _ := d.file.String(a.NameIndex)
+	d.line(0, "@animation %s {", quoteKry(name))
+	d.line(1, "duration: %dms", a.DurationMs)
+	if a.Easing != EasingLinear {
+		d.line(1, "easing: %s", krb.EasingName(a.Easing))
+	}
+	switch a.Iterations {
+	case 1:
+	case AnimIterationsInfinite:
+		d.line(1, "iterations: infinite")
+	default:
+		d.line(1, "iterations: %d", a.Iterations)
+	}
+	for _, kf := range a.Keyframes {
+		d.line(1, "%d%% {", kf.Offset)
+		used := make(map[string]bool)
+		for _, p := range kf.Properties {
+			key, value, ok := d.propertyKeyValue(p, nil, used)
+			if !ok {
+				d.unsupported(2, "%s = %s in keyframe %d%% of animation %q", krb.PropertyName(p.ID), krb.FormatValue(d.file, p.ValueType, p.Value), kf.Offset, name)
+				continue
+			}
+			d.line(2, "%s: %s", key, value)
+		}
+		d.line(1, "}")
+	}
+	d.line(0, "}")
+}
+
+// animationRefs formats the value of an `animation` property.
+func (d *decompiler) animationRefs(refs []krb.AnimationRef) string {
+	parts := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		name, _ := d.file.String(d.file.Animations[ref.AnimationIndex].NameIndex)
+		part := quoteKry(name)
+		if ref.Trigger != AnimTriggerLoad {
+			part += " " + krb.AnimationTriggerName(ref.Trigger)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// --- Component Definitions ---
+
+var hintNames = map[uint8]string{
+	ValTypeString:   "String",
+	ValTypeInt:      "Int",
+	ValTypeBool:     "Bool",
+	ValTypeColor:    "Color",
+	ValTypeStyleID:  "StyleID",
+	ValTypeResource: "Resource",
+	ValTypeFloat:    "Float",
+	ValTypeEnum:     "Enum()",
+}
+
+func (d *decompiler) define(def *krb.ComponentDef) {
+	name, _ := d.file.String(def.NameIndex)
+	d.line(0, "Define %s {", name)
+	if len(def.Properties) > 0 {
+		d.line(1, "Properties {")
+		for _, pd := range def.Properties {
+			d.propertyDef(name, pd)
+		}
+		d.line(1, "}")
+	}
+	d.element(def.Root, 1)
+	d.line(0, "}")
+}
+
+func (d *decompiler) propertyDef(defName string, pd krb.PropertyDef) {
+	propName, _ := d.file.String(pd.NameIndex)
+	hint, ok := hintNames[pd.ValueTypeHint]
+	if !ok {
+		// Unknown type names are stored as custom hints.
+		hint = "Custom"
+	}
+	if len(pd.DefaultValue) == 0 {
+		d.line(2, "%s: %s", propName, hint)
+		return
+	}
+	value, ok := d.customValue(krb.HintValueType(pd.ValueTypeHint), pd.ValueTypeHint, pd.DefaultValue)
+	if !ok {
+		d.line(2, "%s: %s", propName, hint)
+		d.unsupported(2, "default %s for %s.%s", krb.FormatValue(d.file, krb.HintValueType(pd.ValueTypeHint), pd.DefaultValue), defName, propName)
+		return
+	}
+	d.line(2, "%s: %s = %s", propName, hint, value)
+}
+
+// --- Elements ---
+
+// elementItem is a property, custom property or event of an element.
+type elementItem struct {
+	prop   *krb.Property
+	custom *krb.CustomProperty
+	event  *krb.Event
+	strs   []uint16
+}
+
+func (d *decompiler) element(el *krb.Element, indent int) {
+	f := d.file
+	name := krb.ElementTypeName(el.Type)
+	var def *krb.ComponentDef
+	var custom []krb.CustomProperty
+
+	// Component instances carry their Define's name in _componentName.
+	for _, cp := range el.CustomProperties {
+		key, _ := f.String(cp.KeyIndex)
+		idx, ok := krb.Index(cp.Value)
+		if key == componentNameConventionKey && cp.ValueType == ValTypeString && ok && def == nil {
+			defName, _ := f.String(idx)
+			if def = d.defs[defName]; def != nil {
+				name = defName
+				d.markIntroduced(cp.KeyIndex, idx)
+				continue
+			}
+		}
+		custom = append(custom, cp)
+	}
+
+	idIndex := el.IDStringIndex
+	if def == nil && el.Type >= ElemTypeCustomBase {
+		// Custom element types store their KRY name in the ID slot.
+		// An `id` on a custom element replaces its name, which is then lost.
+		customName, _ := f.String(el.IDStringIndex)
+		if customName == "" || !unicode.IsUpper(rune(customName[0])) {
+			d.warnf("custom element type 0x%02X has no recoverable name; written as Custom", el.Type)
+			name = "Custom"
+		} else {
+			name, idIndex = customName, 0
+		}
+	} else if def == nil {
+		if _, ok := krb.ElementTypeByName(name); !ok {
+			d.warnf("unknown element type 0x%02X written as Container", el.Type)
+			name = "Container"
+		}
+	}
+
+	d.line(indent, "%s {", name)
+	used := make(map[string]bool)
+	if idIndex != 0 {
+		id, _ := f.String(idIndex)
+		d.line(indent+1, "id: %s", quoteKry(id))
+		d.markIntroduced(idIndex)
+		used["id"] = true
+	}
+	for _, hf := range []struct {
+		key   string
+		value uint16
+	}{{"pos_x", el.PosX}, {"pos_y", el.PosY}, {"width", el.Width}, {"height", el.Height}} {
+		if hf.value != 0 {
+			d.line(indent+1, "%s: %d", hf.key, hf.value)
+			used[hf.key] = true
+		}
+	}
+
+	var style, variantStyle *krb.Style
+	if el.StyleID != 0 {
+		style = f.StyleByID(el.StyleID)
+		var names []string
+		if style != nil {
+			names = compositeStyleNames(f, style)
+		}
+		if base, baseNames, ok := variantStyleBase(f, style); ok {
+			variantStyle, style = style, base // Written as state and @media blocks after the properties
+			names = baseNames
+			if names == nil && base != nil {
+				names = compositeStyleNames(f, base)
+			}
+		}
+		switch {
+		case style == nil && variantStyle == nil:
+			d.unsupported(indent+1, "reference to missing style %d", el.StyleID)
+		case style == nil:
+			// Only the element's state and @media blocks style it
+		case names != nil:
+			quoted := make([]string, len(names))
+			for i, n := range names {
+				quoted[i] = quoteKry(n)
+			}
+			d.line(indent+1, "style: [%s]", strings.Join(quoted, ", "))
+			if style.NameIndex != 0 {
+				d.markIntroduced(style.NameIndex) // A composite of its own
+			}
+		default:
+			styleName, _ := f.String(style.NameIndex)
+			d.line(indent+1, "style: %s", quoteKry(styleName))
+		}
+	}
+	d.layout(el, style, indent+1)
+
+	for _, item := range d.orderItems(el, custom) {
+		switch {
+		case item.prop != nil:
+			p := *item.prop
+			key, value, ok := d.propertyKeyValue(p, el, used)
+			if !ok {
+				d.unsupported(indent+1, "%s = %s on %s", krb.PropertyName(p.ID), krb.FormatValue(f, p.ValueType, p.Value), name)
+				continue
+			}
+			d.line(indent+1, "%s: %s", key, value)
+		case item.custom != nil:
+			cp := *item.custom
+			key, _ := f.String(cp.KeyIndex)
+			hint := cp.ValueType
+			if pd := findPropertyDef(def, cp.KeyIndex); pd != nil {
+				hint = pd.ValueTypeHint
+			} else {
+				d.warnf("custom property %q on %s is not declared by a component definition", key, name)
+			}
+			value, ok := d.customValue(cp.ValueType, hint, cp.Value)
+			if !ok {
+				d.unsupported(indent+1, "custom property %s = %s on %s", key, krb.FormatValue(f, cp.ValueType, cp.Value), name)
+				continue
+			}
+			d.line(indent+1, "%s: %s", key, value)
+		case item.event != nil:
+			ev := *item.event
+			callback, _ := f.String(ev.CallbackIndex)
+			keys, ok := kryEventKeys[ev.Type]
+			if !ok {
+				d.unsupported(indent+1, "%s event handler %q on %s", krb.EventTypeName(ev.Type), callback, name)
+				continue
+			}
+			d.line(indent+1, "%s: %s", keys[0], quoteKry(callback))
+		}
+	}
+	if len(el.AnimationRefs) > 0 {
+		d.line(indent+1, "animation: %s", d.animationRefs(el.AnimationRefs))
+	}
+	if variantStyle != nil {
+		d.elementVariants(variantStyle, style, indent+1, name)
+		d.markIntroduced(variantStyle.NameIndex)
+	}
+
+	for _, child := range el.Children {
+		d.element(child, indent+1)
+	}
+	d.line(indent, "}")
+}
+
+// elementVariants writes the state and @media blocks of an element whose
+// variant style s refines base. Only properties that differ from base's
+// variants are written, unless that leaves nothing to write.
+func (d *decompiler) elementVariants(s, base *krb.Style, indent int, name string) {
+	inherited := func(bp krb.Property, ok bool, p krb.Property) bool {
+		return ok && bp.ValueType == p.ValueType && bytes.Equal(bp.Value, p.Value)
+	}
+	stateDiff := make([][]krb.Property, len(s.Variants))
+	mediaDiff := make([][]krb.Property, len(s.Media))
+	changed := false
+	for i, v := range s.Variants {
+		for _, p := range v.Properties {
+			if bp, ok := variantProperty(base, v.State, p.ID); !inherited(bp, ok, p) {
+				stateDiff[i] = append(stateDiff[i], p)
+				changed = true
+			}
+		}
+	}
+	for i, v := range s.Media {
+		for _, p := range v.Properties {
+			if bp, ok := mediaProperty(base, v.Conditions, p.ID); !inherited(bp, ok, p) {
+				mediaDiff[i] = append(mediaDiff[i], p)
+				changed = true
+			}
+		}
+	}
+	for i, v := range s.Variants {
+		props := stateDiff[i]
+		if !changed {
+			props = v.Properties
+		}
+		if len(props) > 0 {
+			d.stateBlock(v.State, props, indent, name)
+		}
+	}
+	for i, v := range s.Media {
+		props := mediaDiff[i]
+		if !changed {
+			props = v.Properties
+		}
+		if len(props) > 0 {
+			d.mediaBlock(v.Conditions, props, indent, name)
+		}
+	}
+}
+
+// layout writes the element's layout when it differs from what the
+// resolver would derive from its style or the column/start default.
+func (d *decompiler) layout(el *krb.Element, style *krb.Style, indent int) {
+	inherited := uint8(LayoutDirectionColumn | LayoutAlignmentStart)
+	if style != nil {
+		for _, p := range style.Properties {
+			if p.ID == PropIDLayoutFlags && p.ValueType == ValTypeByte && len(p.Value) == 1 {
+				inherited = p.Value[0]
+			}
+		}
+	}
+	if el.Layout == inherited {
+		return
+	}
+	if el.Layout == 0 {
+		// An explicit layout of 0 (row start) is indistinguishable from none.
+		d.unsupported(indent, "layout %q without a style providing it", krb.LayoutString(el.Layout))
+		return
+	}
+	d.line(indent, "layout: %s", krb.LayoutString(el.Layout))
+}
+
+// orderItems interleaves standard properties, custom properties and events
+// so that each new string is introduced in string table order. The three
+// lists keep their own order, which the encoder preserves from the source.
+func (d *decompiler) orderItems(el *krb.Element, custom []krb.CustomProperty) []elementItem {
+	var lists [3][]elementItem
+	for i := range el.Properties {
+		p := &el.Properties[i]
+		lists[0] = append(lists[0], elementItem{prop: p, strs: propertyStrings(d.file, *p)})
+	}
+	for i := range custom {
+		cp := &custom[i]
+		lists[1] = append(lists[1], elementItem{custom: cp, strs: customPropertyStrings(*cp)})
+	}
+	for i := range el.Events {
+		ev := &el.Events[i]
+		lists[2] = append(lists[2], elementItem{event: ev, strs: []uint16{ev.CallbackIndex}})
+	}
+
+	var ordered []elementItem
+	for {
+		pick, pickFirst := -1, -1
+		next := d.nextString()
+		for i, list := range lists {
+			if len(list) == 0 {
+				continue
+			}
+			first := d.firstNew(list[0].strs)
+			if first < 0 || first == next {
+				pick = i
+				break
+			}
+			if pick < 0 || first < pickFirst {
+				pick, pickFirst = i, first
+			}
+		}
+		if pick < 0 {
+			return ordered
+		}
+		item := lists[pick][0]
+		lists[pick] = lists[pick][1:]
+		d.markIntroduced(item.strs...)
+		ordered = append(ordered, item)
+	}
+}
+
+func findPropertyDef(def *krb.ComponentDef, keyIndex uint16) *krb.PropertyDef {
+	if def == nil {
+		return nil
+	}
+	for i := range def.Properties {
+		if def.Properties[i].NameIndex == keyIndex {
+			return &def.Properties[i]
+		}
+	}
+	return nil
+}
+
+// --- Values ---
+
+// propertyKeyValue returns the KRY key and value text for a standard
+// property. el is nil for style properties. used tracks the keys already
+// written to the block so repeated properties fall back to an alias.
+func (d *decompiler) propertyKeyValue(p krb.Property, el *krb.Element, used map[string]bool) (string, string, bool) {
+	if el != nil {
+		if appOnlyProperties[p.ID] && el.Type != ElemTypeApp {
+			return "", "", false
+		}
+		if p.ID == PropIDImageSource && el.Type != ElemTypeImage && el.Type != ElemTypeButton {
+			return "", "", false
+		}
+		if p.ID == PropIDLayoutFlags {
+			return "", "", false
+		}
+	} else if appOnlyProperties[p.ID] || p.ID == PropIDImageSource {
+		return "", "", false
+	}
+
+	value, ok := d.propertyValue(p, el == nil)
+	if !ok {
+		return "", "", false
+	}
+	for _, key := range kryPropertyKeys[p.ID] {
+		if used[key] {
+			continue
+		}
+		if el != nil && (key == "width" || key == "height") && p.ValueType != ValTypePercentage {
+			continue // Plain element width/height values are header fields
+		}
+		used[key] = true
+		return key, value, true
+	}
+	return "", "", false
+}
+
+// transitionValue renders a transition list in the form parseTransition
+// accepts.
+func transitionValue(ts []krb.Transition) (string, bool) {
+	if len(ts) == 0 {
+		return "none", true
+	}
+	items := make([]string, len(ts))
+	for i, t := range ts {
+		keys := kryPropertyKeys[t.PropertyID]
+		if !animatableProperties[t.PropertyID] || len(keys) == 0 || t.Easing > EasingEaseInOut {
+			return "", false
+		}
+		items[i] = fmt.Sprintf("%s %dms", keys[0], t.DurationMs)
+		if t.Easing != EasingLinear {
+			items[i] += " " + krb.EasingName(t.Easing)
+		}
+	}
+	return strings.Join(items, ", "), true
+}
+
+// propertyValue formats the value of a standard property the way the
+// resolvers parse it back.
+func (d *decompiler) propertyValue(p krb.Property, inStyle bool) (string, bool) {
+	v := p.Value
+	switch p.ID {
+	case PropIDBgColor, PropIDFgColor, PropIDBorderColor:
+		if p.ValueType == ValTypeColor && len(v) == 4 {
+			return quoteKry(fmt.Sprintf("#%02X%02X%02X%02X", v[0], v[1], v[2], v[3])), true
+		}
+	case PropIDBorderWidth, PropIDBorderRadius:
+		if p.ValueType == ValTypeByte && len(v) == 1 {
+			return strconv.Itoa(int(v[0])), true
+		}
+	case PropIDPadding, PropIDMargin:
+		if p.ValueType != ValTypeEdgeInsets || len(v) != 4 {
+			break
+		}
+		if v[0] == v[1] && v[1] == v[2] && v[2] == v[3] {
+			return strconv.Itoa(int(v[0])), true
+		}
+		if p.ID == PropIDMargin && !inStyle {
+			break // Element margins only take a single value
+		}
+		return quoteKry(fmt.Sprintf("%d %d %d %d", v[0], v[1], v[2], v[3])), true
+	case PropIDTextContent, PropIDTransform, PropIDShadow, PropIDWindowTitle, PropIDVersion, PropIDAuthor:
+		if idx, ok := krb.Index(v); ok && p.ValueType == ValTypeString {
+			if s, ok := d.file.String(idx); ok {
+				return d.quoteString(s), true
+			}
+		}
+	case PropIDImageSource, PropIDIcon:
+		if idx, ok := krb.Index(v); ok && p.ValueType == ValTypeResource && int(idx) < len(d.file.Resources) {
+			res := d.file.Resources[idx]
+			if name, ok := declaredResource(d.file, res); ok && d.embedded[name] {
+				break
+			}
+			if name, ok := declaredResource(d.file, res); ok && res.Type == ResTypeImage {
+				return "$" + resourceNamespace + "." + name, true
+			}
+			if s, ok := d.file.String(res.DataStringIndex); ok && res.Type == ResTypeImage && res.Format == ResFormatExternal {
+				return d.quoteString(s), true
+			}
+			if s, ok := d.file.String(res.NameIndex); ok && res.Type == ResTypeImage && res.Format == ResFormatInline {
+				return d.quoteString(s) + " embed", true
+			}
+		}
+	case PropIDFontSize, PropIDGap, PropIDWindowWidth, PropIDWindowHeight:
+		if p.ValueType == ValTypeShort && len(v) == 2 {
+			n := binary.LittleEndian.Uint16(v)
+			if p.ID == PropIDFontSize && inStyle && n == 0 {
+				break // Style font sizes must be positive
+			}
+			return strconv.Itoa(int(n)), true
+		}
+	case PropIDZindex:
+		if p.ValueType == ValTypeShort && len(v) == 2 {
+			return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(v)))), true
+		}
+	case PropIDFontWeight:
+		if p.ValueType == ValTypeEnum && len(v) == 1 && v[0] <= 1 {
+			return [...]string{"normal", "bold"}[v[0]], true
+		}
+	case PropIDTextAlignment:
+		if p.ValueType == ValTypeEnum && len(v) == 1 && v[0] <= 2 {
+			return [...]string{"start", "center", "end"}[v[0]], true
+		}
+	case PropIDOverflow:
+		if p.ValueType == ValTypeEnum && len(v) == 1 && v[0] <= 2 {
+			return [...]string{"visible", "hidden", "scroll"}[v[0]], true
+		}
+	case PropIDVisibility, PropIDResizable, PropIDKeepAspect:
+		if p.ValueType == ValTypeByte && len(v) == 1 && v[0] <= 1 {
+			return strconv.FormatBool(v[0] == 1), true
+		}
+	case PropIDOpacity, PropIDAspectRatio, PropIDScaleFactor:
+		if p.ValueType == ValTypePercentage && len(v) == 2 {
+			n := binary.LittleEndian.Uint16(v)
+			if p.ID == PropIDOpacity && n > 256 {
+				break // Opacity is clamped to 1.0
+			}
+			return formatFixedPoint(n, 1), true
+		}
+	case PropIDMinWidth, PropIDMinHeight, PropIDMaxWidth, PropIDMaxHeight:
+		if len(v) != 2 {
+			break
+		}
+		switch p.ValueType {
+		case ValTypeShort:
+			return strconv.Itoa(int(binary.LittleEndian.Uint16(v))), true
+		case ValTypePercentage:
+			return formatFixedPoint(binary.LittleEndian.Uint16(v), 100) + "%", true
+		}
+	case PropIDTransition:
+		if ts, ok := krb.Transitions(v); ok && p.ValueType == ValTypeTransition {
+			return transitionValue(ts)
+		}
+	case PropIDLayoutFlags:
+		if inStyle && p.ValueType == ValTypeByte && len(v) == 1 && krb.LayoutString(v[0]) != "" {
+			if parseLayoutString(krb.LayoutString(v[0])) == v[0] {
+				return krb.LayoutString(v[0]), true
+			}
+		}
+	}
+	return "", false
+}
+
+// customValue formats a component property value stored with valueType for
+// a property declared with hint.
+func (d *decompiler) customValue(valueType, hint uint8, v []byte) (string, bool) {
+	switch valueType {
+	case ValTypeString:
+		if idx, ok := krb.Index(v); ok {
+			if s, ok := d.file.String(idx); ok && hint == ValTypeResource && d.resources[s] {
+				return "$" + resourceNamespace + "." + s, true
+			}
+			if s, ok := d.file.String(idx); ok && hint == ValTypeResource && d.embedded[s] {
+				break
+			}
+			if s, ok := d.file.String(idx); ok {
+				return d.quoteString(s), true
+			}
+		}
+	case ValTypeShort:
+		if len(v) == 2 {
+			return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(v)))), true
+		}
+	case ValTypeByte:
+		if len(v) == 1 && v[0] <= 1 {
+			return strconv.FormatBool(v[0] == 1), true
+		}
+	case ValTypePercentage:
+		if len(v) == 2 {
+			return formatFixedPoint(binary.LittleEndian.Uint16(v), 1), true
+		}
+	case ValTypeColor:
+		if len(v) == 4 && hint == ValTypeColor {
+			return quoteKry(fmt.Sprintf("#%02X%02X%02X%02X", v[0], v[1], v[2], v[3])), true
+		}
+	}
+	return "", false
+}
+
+// formatFixedPoint renders an 8.8 fixed-point value multiplied by scale
+// (100 for percentages) as the shortest decimal that rounds back to v.
+func formatFixedPoint(v uint16, scale float64) string {
+	f := float64(v) / 256 * scale
+	for prec := 0; prec < 6; prec++ {
+		s := strconv.FormatFloat(f, 'f', prec, 64)
+		if parsed, err := strconv.ParseFloat(s, 64); err == nil && math.Round(parsed/scale*256) == float64(v) {
+			return s
+		}
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// quoteString quotes a string table entry, warning about text the variable
+// pass would substitute when the KRY is compiled again.
+func (d *decompiler) quoteString(s string) string {
+	if varUsageRegex.MatchString(s) {
+		d.warnf("string %q cannot be written exactly in KRY", s)
+	}
+	return quoteKry(s)
+}
+
+// quoteKry returns s as a KRY string literal.
+func quoteKry(s string) string {
+	return syntax.Quote(s)
+}
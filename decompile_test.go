@@ -0,0 +1,299 @@
+// decompile_test.go
+package kryc
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/waozixyz/kryc/krb"
+)
+
+// compileSources compiles main.kry from files and fails the test on error.
+func compileSources(t *testing.T, files map[string][]byte, compress bool) []byte {
+	t.Helper()
+	res, err := Compile(context.Background(), Options{
+		Filename: "main.kry",
+		Sources:  files,
+		Compress: compress,
+	})
+	if err != nil {
+		for _, d := range res.Diagnostics {
+			t.Log(d)
+		}
+		t.Fatalf("compile: %v", err)
+	}
+	return res.KRB
+}
+
+func TestDecompileRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		files    map[string]string // Resource files next to main.kry
+		compress bool
+		lost     []string // Expected decompiler warnings; the recompiled file then only has to compile
+	}{
+		{name: "empty app", src: "App {}\n"},
+		{
+			name: "styles",
+			src: `style "base" {
+    background_color: "#112233FF"
+    padding: 4
+    font_size: 14
+}
+style "primary" {
+    extends: "base"
+    text_color: "#FFFFFFFF"
+    border_radius: 4
+    layout: row center
+}
+App {
+    window_title: "Styles"
+    Button { style: "primary"; text: "One" }
+    Text { style: "base"; text: "Two" }
+}
+`,
+		},
+		{
+			name: "style lists",
+			src: `style "base" {
+    background_color: "#112233FF"
+    padding: 4
+}
+style "primary" {
+    text_color: "#FFFFFFFF"
+    padding: 8
+    state hover { opacity: 0.8 }
+}
+App {
+    Button {
+        style: ["base", "primary"]
+        text: "Only with state"
+        state pressed { opacity: 0.5 }
+    }
+    Text { style: ["primary", "base"]; text: "Plain" }
+    Button {
+        style: ["primary", "base"]
+        text: "Shared"
+        state focused { border_width: 2 }
+    }
+}
+`,
+		},
+		{
+			name: "component defs",
+			src: `Define Card {
+    Properties {
+        title: String = "Untitled"
+        accent: Color
+        background: Color = "#00FF00FF"
+        count: Int = 3
+    }
+    Container {
+        padding: 4
+        Text { text: "card" }
+    }
+}
+App {
+    Card { title: "First"; count: 5 }
+    Card { }
+}
+`,
+		},
+		{
+			name: "animations",
+			src: `@animation "fade_in" {
+    duration: 300ms
+    easing: ease-out
+    iterations: 1
+    0% { opacity: 0.0 }
+    100% { opacity: 1.0 }
+}
+style "btn" {
+    background_color: "#202020FF"
+    transition: background_color 150ms ease-out, opacity 0.3s
+}
+App {
+    Container {
+        style: "btn"
+        animation: "fade_in" hover, "fade_in"
+    }
+}
+`,
+		},
+		{
+			name: "resources",
+			src: `App {
+    Image { source: "img/logo.png" }
+    Image { source: "img/a.png" embed }
+    Image { source: "img/b.png" embed }
+}
+`,
+			// b.png has the contents of a.png, so it reuses a.png's entry.
+			files: map[string]string{"img/logo.png": "logo", "img/a.png": "image", "img/b.png": "image"},
+		},
+		{
+			name: "state variants",
+			src: `style "btn" {
+    background_color: "#202020FF"
+    state hover {
+        background_color: "#303030FF"
+    }
+    state pressed {
+        padding: { top: 2 }
+    }
+}
+App {
+    Button {
+        style: "btn"
+        text: "OK"
+        state focused {
+            border_width: 2
+        }
+        state hover {
+            text_color: "#FFFFFFFF"
+        }
+    }
+    Button {
+        state disabled { opacity: 0.5 }
+    }
+}
+`,
+		},
+		{
+			name: "media variants",
+			src: `style "sidebar" {
+    width: 240
+    @media (max_width: 599) {
+        width: 0
+    }
+    @media (min_width: 1200) and (orientation: landscape) {
+        width: 320
+    }
+}
+App {
+    Container {
+        style: "sidebar"
+        @media (max_width: 599) {
+            height: 40
+        }
+        @media (min_height: 700) {
+            background_color: "#00FF00FF"
+            width: 50%
+        }
+    }
+    Container {
+        height: 20
+        @media (orientation: portrait) { width: 100 }
+    }
+}
+`,
+		},
+		{
+			name: "declared resources",
+			src: `@resources {
+    logo: image "img/logo.png"
+}
+App {
+    icon: $res.logo
+    Image { source: $res.logo }
+    Image { source: "img/logo.png" }
+}
+`,
+			files: map[string]string{"img/logo.png": "logo"},
+		},
+		{
+			name: "named embedded resource",
+			src: `@resources {
+    logo: image "img/logo.png" embed
+}
+App {
+    Image { source: $res.logo }
+    Text { text: "logo" }
+}
+`,
+			files: map[string]string{"img/logo.png": "logo"},
+			lost: []string{
+				"embedded image resource 'logo' (4 bytes) without its file path",
+				`image_source = resource[0] "logo" (inline, 4 bytes) on Image`,
+			},
+		},
+		{
+			name: "events",
+			src: `App {
+    onKeyDown: "shortcut"
+    Button { onClick: "save"; onHover: "hint"; onLeave: "unhint"; onLongPress: "menu" }
+    Input { onChange: "edit"; onSubmit: "save"; onFocus: "focus"; onBlur: "blur" }
+    Scrollable { onScroll: "scrolled" }
+}
+`,
+		},
+		{
+			name: "callback manifest",
+			src: `@callbacks {
+    handleSave: click, press
+}
+App {
+    Button { onClick: "handleSave" }
+    Button { onPress: "handleSave" }
+}
+`,
+		},
+		{
+			name: "roots after app",
+			src: `App {
+    Text { text: "main" }
+}
+Container {
+    Text { text: "overlay" }
+}
+Text { text: "toast" }
+`,
+		},
+		{
+			name: "compressed",
+			src: `style "base" {
+    background_color: "#112233FF"
+}
+App {
+    window_title: "Compressed"
+    Container { style: "base"; Text { text: "hello" } }
+}
+`,
+			compress: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string][]byte{"main.kry": []byte(tt.src)}
+			for name, data := range tt.files {
+				files[name] = []byte(data)
+			}
+			want := compileSources(t, files, tt.compress)
+
+			f, err := krb.Decode(want)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			src, diags, err := Decompile(f)
+			if err != nil {
+				t.Fatalf("Decompile: %v", err)
+			}
+			var lost []string
+			for _, d := range diags {
+				lost = append(lost, d.Message)
+			}
+			if !slices.Equal(lost, tt.lost) {
+				t.Errorf("got decompiler warnings %q, want %q", lost, tt.lost)
+			}
+
+			files["main.kry"] = src
+			got := compileSources(t, files, tt.compress)
+			if len(tt.lost) == 0 && !bytes.Equal(got, want) {
+				t.Errorf("recompiled KRB differs from the original (%d bytes, want %d)\ndecompiled source:\n%s", len(got), len(want), src)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+// diagnostics.go
+package kryc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/waozixyz/kryc/syntax"
+)
+
+// Severity classifies a Diagnostic.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// --- Diagnostic Codes ---
+// Error codes start with E, warning codes with W. The first two digits group
+// codes by compiler area: 00 general, 01 syntax, 02 preprocessing, 03 styles,
+// 04 elements and properties, 05 components, 06 decompiling, 07 animations,
+// 08 resources, 09 encoding.
+
+const (
+	CodeInternal = "E0001" // A compiler invariant was violated
+	CodeLimit    = "E0002" // A KRB format limit was exceeded
+	CodeIO       = "E0003" // A source file could not be read
+
+	CodeSyntax         = "E0101" // Malformed line or block
+	CodeMisplacedBlock = "E0102" // Block or property in the wrong context
+	CodeRedefinition   = "E0103" // Style, component or App defined twice
+
+	CodeInclude  = "E0201" // @include target missing or nested too deeply
+	CodeVariable = "E0202" // Invalid, undefined or cyclic @variables entry
+
+	CodeStyle = "E0301" // Invalid style definition or inheritance
+	CodeMedia = "E0302" // Invalid @media query
+
+	CodeElement       = "E0401" // Invalid element tree structure
+	CodePropertyValue = "E0402" // Property value cannot be parsed
+	CodeEvent         = "E0403" // Unknown event handler key
+	CodeCallback      = "E0404" // Invalid @callbacks entry or undeclared callback
+
+	CodeComponent = "E0501" // Invalid component definition or usage
+
+	CodeAnimation = "E0701" // Invalid @animation definition
+
+	CodeResource = "E0801" // Invalid @resources entry or $res reference
+
+	CodeLineTooLong         = "W0101" // Line exceeds MaxLineLength
+	CodeIgnoredSyntax       = "W0102" // Malformed or misplaced line ignored
+	CodeIncludeSyntax       = "W0201" // Malformed @include ignored
+	CodeVariableRedefined   = "W0202" // @variables entry defined twice
+	CodeStyleNotFound       = "W0301" // Referenced style does not exist
+	CodeStyleProperty       = "W0302" // Style property unknown or unsupported
+	CodeMediaUnreachable    = "W0303" // @media block can never match the fixed App window
+	CodeInvalidValue        = "W0401" // Invalid value replaced by a default
+	CodeUnhandledProperty   = "W0402" // Element property not recognised
+	CodeUnknownElement      = "W0403" // Unknown element type treated as custom
+	CodeIgnoredEvent        = "W0404" // Event handler dropped
+	CodeEventElement        = "W0405" // Event handler on an element that does not raise it
+	CodeCallbackUnused      = "W0406" // Declared callback not used by any event handler
+	CodeComponentProperty   = "W0501" // Component property undeclared or of unknown type
+	CodeDecompileLossy      = "W0601" // KRB content that KRY cannot express
+	CodeResourceMissing     = "W0801" // Declared resource file not found
+	CodeEncodingConsistency = "W0901" // Encoder self-check failed
+)
+
+// Diagnostic is a message reported by the compiler about the KRY source.
+type Diagnostic struct {
+	Severity Severity
+	Code     string // One of the Code constants, e.g. "E0101"
+	File     string // Source file; empty if the diagnostic has no location
+	Line     int    // 1-based line; 0 if unknown
+	Column   int    // 1-based column; 0 if unknown
+	Message  string
+	Snippet  string            // Source line the diagnostic points at, if known
+	Related  []RelatedLocation // Other locations that explain the diagnostic
+}
+
+// RelatedLocation points at a second place in the source involved in a
+// Diagnostic, such as the previous definition of a redefined name.
+type RelatedLocation struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+// String formats the location as "file:line:col: note: message".
+func (r RelatedLocation) String() string {
+	return Diagnostic{File: r.File, Line: r.Line, Column: r.Column, Message: r.Message}.location() + "note: " + r.Message
+}
+
+// String formats the diagnostic as "file:line:col: severity[code]: message".
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	b.WriteString(d.location())
+	b.WriteString(d.Severity.String())
+	if d.Code != "" {
+		fmt.Fprintf(&b, "[%s]", d.Code)
+	}
+	b.WriteString(": ")
+	b.WriteString(d.Message)
+	return b.String()
+}
+
+// location formats the "file:line:col: " prefix, omitting unknown parts.
+func (d Diagnostic) location() string {
+	if d.File == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(d.File)
+	if d.Line > 0 {
+		fmt.Fprintf(&b, ":%d", d.Line)
+		if d.Column > 0 {
+			fmt.Fprintf(&b, ":%d", d.Column)
+		}
+	}
+	b.WriteString(": ")
+	return b.String()
+}
+
+// Excerpt returns the source snippet followed by a caret under the
+// diagnostic's column, or "" if there is no snippet.
+func (d Diagnostic) Excerpt() string {
+	if d.Snippet == "" {
+		return ""
+	}
+	gutter := fmt.Sprintf("%5d | ", d.Line)
+	var b strings.Builder
+	b.WriteString(gutter)
+	b.WriteString(d.Snippet)
+	b.WriteByte('\n')
+	b.WriteString(strings.Repeat(" ", len(gutter)-2))
+	b.WriteString("| ")
+	if d.Column > 0 {
+		// Keep tabs so the caret lines up with the snippet.
+		for _, r := range d.Snippet[:min(d.Column-1, len(d.Snippet))] {
+			if r == '\t' {
+				b.WriteByte('\t')
+			} else {
+				b.WriteByte(' ')
+			}
+		}
+	}
+	b.WriteByte('^')
+	return b.String()
+}
+
+// DiagnosticError is an error described by a Diagnostic. Compile returns
+// errors wrapping it for failures that can be located in the source.
+type DiagnosticError struct {
+	Diagnostic Diagnostic
+	err        error
+}
+
+func (e *DiagnosticError) Error() string { return e.Diagnostic.String() }
+
+func (e *DiagnosticError) Unwrap() error { return errors.Unwrap(e.err) }
+
+// newDiagnostic locates a diagnostic on line (1-based) of text in file. col
+// is the 1-based column of the offending token when it is known. Otherwise
+// the column is the first occurrence of token in the line, or its first
+// non-blank character if token is empty or absent.
+func newDiagnostic(severity Severity, code, file string, line, col int, text, token, msg string) Diagnostic {
+	d := Diagnostic{Severity: severity, Code: code, File: file, Line: line, Message: msg}
+	if line <= 0 {
+		return d
+	}
+	d.Snippet = strings.TrimRight(text, " \t\r")
+	if d.Snippet == "" {
+		return d
+	}
+	if col > 0 && col <= len(d.Snippet) {
+		d.Column = col
+		return d
+	}
+	col = -1
+	if token != "" {
+		col = strings.Index(d.Snippet, token)
+	}
+	if col < 0 {
+		col = len(d.Snippet) - len(strings.TrimLeft(d.Snippet, " \t"))
+	}
+	d.Column = col + 1
+	return d
+}
+
+// diagnosticAt locates a diagnostic on a line of the include-expanded source,
+// reporting it at the file and line that line originally came from. col is
+// the token's column in the source the passes read, or 0 to search for token.
+func (state *CompilerState) diagnosticAt(severity Severity, code string, line, col int, token, msg string) Diagnostic {
+	if line > 0 && line <= len(state.lineOrigins) {
+		origin := state.lineOrigins[line-1]
+		return newDiagnostic(severity, code, origin.File, origin.Line, state.originalColumn(line, col), origin.Text, token, msg)
+	}
+	return newDiagnostic(severity, code, state.CurrentFilePath, line, col, "", token, msg)
+}
+
+// columnShift records that variable substitution replaced Width bytes at
+// Column of a line with the OriginalWidth bytes of a `$name` at
+// OriginalColumn. Columns are 1-based.
+type columnShift struct {
+	Column, Width                 int
+	OriginalColumn, OriginalWidth int
+}
+
+// originalColumn maps a column of a line after variable substitution back to
+// the line as written. A column within a substituted value maps to its `$`.
+func (state *CompilerState) originalColumn(line, col int) int {
+	orig := col
+	for _, s := range state.columnShifts[line] {
+		if col < s.Column {
+			break
+		}
+		if col < s.Column+s.Width {
+			return s.OriginalColumn
+		}
+		orig = col + (s.OriginalColumn + s.OriginalWidth) - (s.Column + s.Width)
+	}
+	return orig
+}
+
+// textPos returns the position of the text of tok, after the opening quote
+// of a string.
+func textPos(tok syntax.Token) syntax.Pos {
+	pos := tok.Pos
+	if tok.Kind == syntax.STRING && strings.HasPrefix(tok.Text, "\"") && !strings.HasPrefix(tok.Text, `"""`) {
+		pos.Offset++
+		pos.Column++
+	}
+	return pos
+}
+
+// advancePos returns the position of text[i:] when text starts at pos.
+func advancePos(pos syntax.Pos, text string, i int) syntax.Pos {
+	pos.Offset += i
+	if nl := strings.LastIndexByte(text[:i], '\n'); nl >= 0 {
+		pos.Line += strings.Count(text[:i], "\n")
+		pos.Column = i - nl
+	} else {
+		pos.Column += i
+	}
+	return pos
+}
+
+// textPosIn returns the position of the first text in value, which starts at
+// pos, or pos if value does not contain it.
+func textPosIn(pos syntax.Pos, value, text string) syntax.Pos {
+	return advancePos(pos, value, max(strings.Index(value, text), 0))
+}
+
+// relatedAt returns a RelatedLocation for a line of the include-expanded
+// source, with its column on token.
+func (state *CompilerState) relatedAt(line int, token, msg string) RelatedLocation {
+	d := state.diagnosticAt(SeverityInfo, "", line, 0, token, msg)
+	return RelatedLocation{File: d.File, Line: d.Line, Column: d.Column, Message: msg}
+}
+
+// withRelated attaches related locations to the diagnostic carried by err.
+func withRelated(err error, related ...RelatedLocation) error {
+	var de *DiagnosticError
+	if errors.As(err, &de) {
+		de.Diagnostic.Related = append(de.Diagnostic.Related, related...)
+	}
+	return err
+}
+
+// report records d. Diagnostics are returned to the caller in Result rather
+// than logged, so they can be emitted together once compilation ends.
+func (state *CompilerState) report(d Diagnostic) {
+	state.diagnostics = append(state.diagnostics, d)
+}
+
+// logf writes a progress message to the compilation logger, if any.
+func (state *CompilerState) logf(format string, args ...interface{}) {
+	if state.logger != nil {
+		state.logger.Printf(format, args...)
+	}
+}
+
+// warnf records a warning at line of the source, with its column on token.
+func (state *CompilerState) warnf(code string, line int, token string, format string, args ...interface{}) {
+	msg := strings.TrimRight(fmt.Sprintf(format, args...), "\n")
+	state.report(state.diagnosticAt(SeverityWarning, code, line, 0, token, msg))
+}
+
+// warnAt records a warning at pos, the position of a token in the source the
+// passes read, such as one from the syntax tree or a SourceProperty.
+func (state *CompilerState) warnAt(code string, pos syntax.Pos, format string, args ...interface{}) {
+	msg := strings.TrimRight(fmt.Sprintf(format, args...), "\n")
+	state.report(state.diagnosticAt(SeverityWarning, code, pos.Line, pos.Column, "", msg))
+}
+
+// errorf returns an error located at line of the source, with its column on
+// token. Like fmt.Errorf, a %w verb wraps its operand. The diagnostic is
+// recorded once the error reaches Compile.
+func (state *CompilerState) errorf(code string, line int, token string, format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	return &DiagnosticError{Diagnostic: state.diagnosticAt(SeverityError, code, line, 0, token, err.Error()), err: err}
+}
+
+// errorAt is errorf for a token whose position is known: the diagnostic
+// points at pos rather than at the first match of the token on its line.
+func (state *CompilerState) errorAt(code string, pos syntax.Pos, format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	return &DiagnosticError{Diagnostic: state.diagnosticAt(SeverityError, code, pos.Line, pos.Column, "", err.Error()), err: err}
+}
+
+// fileErrorf is errorf for a line of a specific file rather than of the
+// source the current pass reads; text is that line's content.
+func fileErrorf(code, file string, line int, text, token string, format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	return &DiagnosticError{Diagnostic: newDiagnostic(SeverityError, code, file, line, 0, text, token, err.Error()), err: err}
+}
+
+// errCompilationFailed is wrapped by the error Compile returns once the errors
+// behind it have already been recorded as diagnostics.
+var errCompilationFailed = errors.New("compilation failed")
+
+// recordError records err as an error diagnostic so that the current pass
+// can carry on past it. It returns a non-nil error, which the pass should
+// return, once the configured error limit has been reached.
+func (state *CompilerState) recordError(err error) error {
+	if errors.Is(err, errCompilationFailed) {
+		return err // Already recorded; the limit was hit further down
+	}
+	state.diagnostics = append(state.diagnostics, state.errorDiagnostic(err))
+	state.errorCount++
+	if state.maxErrors > 0 && state.errorCount >= state.maxErrors {
+		return fmt.Errorf("%w: too many errors (stopped after %d)", errCompilationFailed, state.errorCount)
+	}
+	return nil
+}
+
+// limitReached records err, a target limit that every later element would
+// also exceed, and returns an error that stops compilation.
+func (state *CompilerState) limitReached(err error) error {
+	if stop := state.recordError(err); stop != nil {
+		return stop
+	}
+	return fmt.Errorf("%w: limit of target '%s' reached", errCompilationFailed, state.target.Name)
+}
+
+// recordedErrors returns an error summarising the errors recorded so far, or
+// nil if there are none.
+func (state *CompilerState) recordedErrors() error {
+	if state.errorCount == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w with %d errors", errCompilationFailed, state.errorCount)
+}
+
+// errorDiagnostic converts an error returned by a compiler pass into the
+// Diagnostic reported for it.
+func (state *CompilerState) errorDiagnostic(err error) Diagnostic {
+	var de *DiagnosticError
+	if errors.As(err, &de) {
+		return de.Diagnostic
+	}
+	return Diagnostic{Severity: SeverityError, Code: CodeInternal, File: state.CurrentFilePath, Message: err.Error()}
+}
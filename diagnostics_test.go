@@ -0,0 +1,118 @@
+// diagnostics_test.go
+package kryc
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// diagnostics compiles main.kry from files and returns every diagnostic,
+// whether or not compilation succeeded.
+func diagnostics(t *testing.T, files map[string]string) []Diagnostic {
+	t.Helper()
+	sources := make(map[string][]byte, len(files))
+	for name, src := range files {
+		sources[name] = []byte(src)
+	}
+	res, _ := Compile(context.Background(), Options{Filename: "main.kry", Sources: sources})
+	return res.Diagnostics
+}
+
+func TestDiagnosticLocation(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string // Start of String() of the first diagnostic: location, severity and code
+	}{
+		{
+			name:  "unknown property",
+			files: map[string]string{"main.kry": "App {\n    Container { id: \"bogus\"; bogus: 1 }\n}\n"},
+			want:  "main.kry:2:30: warning[W0402]:",
+		},
+		{
+			name:  "invalid value",
+			files: map[string]string{"main.kry": "App {\n    Text { font_size: 1; font_size: \"zz\" }\n}\n"},
+			want:  "main.kry:2:26: error[E0402]:",
+		},
+		{
+			name:  "after variable substitution",
+			files: map[string]string{"main.kry": "@variables {\n    pad: 12345\n}\nApp { padding: $pad; bogus: 1 }\n"},
+			want:  "main.kry:4:22: warning[W0402]:",
+		},
+		{
+			name:  "undefined variable",
+			files: map[string]string{"main.kry": "App {\n    Text { text: $nope }\n}\n"},
+			want:  "main.kry:2:18: error[E0202]:",
+		},
+		{
+			name:  "undefined variable in a variable",
+			files: map[string]string{"main.kry": "@variables {\n    ok: 1\n    bad: $nope\n}\nApp { window_width: $bad }\n"},
+			want:  "main.kry:3:10: error[E0202]:",
+		},
+		{
+			name:  "ignored margin",
+			files: map[string]string{"main.kry": "App {\n    Container { margin: zz }\n}\n"},
+			want:  "main.kry:2:17: warning[W0401]:",
+		},
+		{
+			name: "included file",
+			files: map[string]string{
+				"main.kry": "# header\n@include \"inc.kry\"\nApp {\n    Card {}\n}\n",
+				"inc.kry":  "Define Card {\n    Container {\n        bogus: 1\n    }\n}\n",
+			},
+			want: "inc.kry:3:9: warning[W0402]:",
+		},
+		{
+			name: "after included file",
+			files: map[string]string{
+				"main.kry": "@include \"inc.kry\"\nApp {\n    Text { bogus: 1 }\n}\n",
+				"inc.kry":  "style \"a\" {\n    padding: 1\n}\n",
+			},
+			want: "main.kry:3:12: warning[W0402]:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := diagnostics(t, tt.files)
+			if len(diags) == 0 {
+				t.Fatal("got no diagnostics")
+			}
+			if got := diags[0].String(); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("got  %s\nwant %s ...", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiagnosticExcerpt(t *testing.T) {
+	diags := diagnostics(t, map[string]string{"main.kry": "App {\n\tText { font_size: \"zz\" }\n}\n"})
+	if len(diags) == 0 {
+		t.Fatal("got no diagnostics")
+	}
+	want := "    2 | \tText { font_size: \"zz\" }\n" +
+		"      | \t       ^"
+	if got := diags[0].Excerpt(); got != want {
+		t.Errorf("got excerpt\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDiagnosticRelated(t *testing.T) {
+	diags := diagnostics(t, map[string]string{
+		"main.kry": "@include \"inc.kry\"\nstyle \"base\" {\n    padding: 2\n}\nApp {}\n",
+		"inc.kry":  "# styles\nstyle \"base\" {\n    padding: 1\n}\n",
+	})
+	if len(diags) == 0 {
+		t.Fatal("got no diagnostics")
+	}
+	d := diags[0]
+	if want := "main.kry:2:8: error[E0103]:"; !strings.HasPrefix(d.String(), want) {
+		t.Errorf("got  %s\nwant %s ...", d, want)
+	}
+	if len(d.Related) != 1 {
+		t.Fatalf("got %d related locations, want 1", len(d.Related))
+	}
+	if got, want := d.Related[0].String(), "inc.kry:2:8: note: previous definition is here"; got != want {
+		t.Errorf("got related %q, want %q", got, want)
+	}
+}
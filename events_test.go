@@ -0,0 +1,147 @@
+// events_test.go
+package kryc
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/waozixyz/kryc/krb"
+)
+
+// eventDiagnostics returns String() of the event and callback diagnostics
+// (codes E0403, E0404 and W0404 to W0406) of compiling main.kry.
+func eventDiagnostics(t *testing.T, src string) []string {
+	t.Helper()
+	var got []string
+	for _, d := range diagnostics(t, map[string]string{"main.kry": src}) {
+		switch d.Code {
+		case CodeEvent, CodeCallback, CodeIgnoredEvent, CodeEventElement, CodeCallbackUnused:
+			got = append(got, d.String())
+		}
+	}
+	return got
+}
+
+func TestEventHandlerKeys(t *testing.T) {
+	for evType, keys := range kryEventKeys {
+		for _, key := range keys {
+			t.Run(key, func(t *testing.T) {
+				src := fmt.Sprintf("App {\n    Input { %s: \"handler\" }\n}\n", key)
+				if evType == EventTypeScroll {
+					src = strings.Replace(src, "Input", "Scrollable", 1)
+				}
+				f, err := krb.Decode(compileSources(t, map[string][]byte{"main.kry": []byte(src)}, false))
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				events := f.Elements[1].Events
+				if len(events) != 1 || events[0].Type != evType {
+					t.Fatalf("got events %+v, want one %s event", events, krb.EventTypeName(evType))
+				}
+				if name, _ := f.String(events[0].CallbackIndex); name != "handler" {
+					t.Errorf("got callback %q, want %q", name, "handler")
+				}
+			})
+		}
+	}
+}
+
+func TestEventHandlerDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "unknown key",
+			src:  "App {\n    Button { onClick: \"a\"; onBogus: \"b\" }\n}\n",
+			want: []string{"main.kry:2:28: error[E0403]: unknown event handler 'onBogus' on element 'Button' (expected one of " + eventKeyList() + ")"},
+		},
+		{
+			name: "element does not raise the event",
+			src:  "App {\n    Text { onChange: \"c\" }\n    Container { onScroll: \"s\" }\n    Scrollable { onScroll: \"s\" }\n}\n",
+			want: []string{
+				"main.kry:2:12: warning[W0405]: 'onChange' has no effect on element 'Text': only Input elements raise change events",
+				"main.kry:3:17: warning[W0405]: 'onScroll' has no effect on element 'Container': only List, Grid or Scrollable elements raise scroll events",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eventDiagnostics(t, tt.src); !slices.Equal(got, tt.want) {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestCallbackManifest(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "valid",
+			src: `@callbacks {
+    save: click, press
+    log: any
+}
+App {
+    Button { onClick: "save"; onPress: "save"; onHover: "log" }
+}
+`,
+		},
+		{
+			name: "invalid declarations",
+			src: `@callbacks {
+    save: click, bogus
+    log: any, click
+    edit: [click]
+    close: click press
+    open: click
+    open: press
+}
+App { Button { onClick: "open" } }
+`,
+			want: []string{
+				"main.kry:2:18: error[E0404]: unknown event 'bogus' for callback 'save' (expected any or one of " + strings.Join(krb.EventTypeNames(), ", ") + ")",
+				"main.kry:3:10: error[E0404]: 'any' cannot be combined with other events for callback 'log'",
+				"main.kry:4:5: error[E0404]: invalid callback declaration 'edit: [click]' (expected e.g. 'handleSave: click' or 'validate: change, submit')",
+				"main.kry:5:5: error[E0404]: invalid callback declaration 'close: click press' (expected a comma-separated list of events)",
+			},
+		},
+		{
+			name: "handlers",
+			src: `@callbacks {
+    save: click
+    unused: click
+}
+App {
+    Button { onClick: "save" }
+    Button { onPress: "save" }
+    Button { onClick: "nope" }
+}
+`,
+			want: []string{
+				"main.kry:7:24: error[E0404]: callback 'save' does not handle press events (it is declared for click)",
+				"main.kry:8:24: error[E0404]: callback 'nope' of 'onClick' is not declared in @callbacks",
+				"main.kry:3:5: warning[W0406]: callback 'unused' is declared but not used by any event handler",
+			},
+		},
+		{
+			name: "empty manifest",
+			src:  "@callbacks {}\nApp { Button { onClick: \"save\" } }\n",
+			want: []string{"main.kry:2:26: error[E0404]: callback 'save' of 'onClick' is not declared in @callbacks"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eventDiagnostics(t, tt.src); !slices.Equal(got, tt.want) {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// compress.go
+package krb
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// --- Compression ---
+// A file with FlagCompressed keeps its header uncompressed and stores
+// everything after it as a single DEFLATE stream. The section offsets and
+// TotalSize in the header refer to the uncompressed image (header followed by
+// the inflated payload), so they mean the same as in an uncompressed file.
+
+// maxDeflateRatio is the most DEFLATE can inflate its input: at best a
+// 258-byte match costs about two bits, or 1032 bytes per compressed byte.
+const maxDeflateRatio = 1032
+
+// Compress returns the compressed form of an encoded KRB file whose header
+// already has FlagCompressed set.
+func Compress(data []byte) ([]byte, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("header: %w (have %d bytes, need %d)", ErrTruncated, len(data), HeaderSize)
+	}
+	if binary.LittleEndian.Uint16(data[6:8])&FlagCompressed == 0 {
+		return nil, fmt.Errorf("krb: compressing a file without FlagCompressed set")
+	}
+	var buf bytes.Buffer
+	buf.Write(data[:HeaderSize])
+	zw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data[HeaderSize:]); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress returns the uncompressed image of an encoded KRB file: data
+// itself unless its header has FlagCompressed set. The flag is left set in
+// the returned header. Data too short to hold a header is returned as is.
+func Decompress(data []byte) ([]byte, error) {
+	if len(data) < HeaderSize || string(data[0:4]) != Magic || binary.LittleEndian.Uint16(data[6:8])&FlagCompressed == 0 {
+		return data, nil
+	}
+	totalSize := binary.LittleEndian.Uint32(data[44:48])
+	if totalSize < HeaderSize {
+		return nil, fmt.Errorf("header: total size %d smaller than header", totalSize)
+	}
+	// TotalSize is untrusted, so it only bounds reading and nothing is
+	// allocated from it up front.
+	compressed := data[HeaderSize:]
+	if uint64(totalSize)-HeaderSize > uint64(len(compressed))*maxDeflateRatio {
+		return nil, fmt.Errorf("header: total size %d too large for %d compressed bytes", totalSize, len(compressed))
+	}
+	zr := flate.NewReader(bytes.NewReader(compressed))
+	defer zr.Close()
+	// Read one byte past TotalSize so an oversized payload is detected.
+	payload, err := io.ReadAll(io.LimitReader(zr, int64(totalSize)-HeaderSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing: %w", err)
+	}
+	image := make([]byte, 0, HeaderSize+len(payload))
+	image = append(image, data[:HeaderSize]...)
+	image = append(image, payload...)
+	if len(image) != int(totalSize) {
+		return nil, fmt.Errorf("decompressing: payload inflates to %d bytes, header total size is %d", len(image), totalSize)
+	}
+	return image, nil
+}
@@ -0,0 +1,752 @@
+// decode.go
+package krb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidMagic       = errors.New("krb: invalid magic")
+	ErrUnsupportedVersion = errors.New("krb: unsupported version")
+	ErrTruncated          = errors.New("krb: unexpected end of data")
+)
+
+// ReadFile reads and decodes the KRB file at path.
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data)
+}
+
+// Read reads all of r and decodes it as a KRB file.
+func Read(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data)
+}
+
+// Decode parses an encoded KRB file, decompressing it first if it has
+// FlagCompressed set.
+func Decode(data []byte) (*File, error) {
+	data, err := Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{}
+	if err := decodeHeader(data, &f.Header); err != nil {
+		return nil, err
+	}
+	h := &f.Header
+
+	// Strings come first so later sections can be checked against the table.
+	if err := f.decodeStrings(data); err != nil {
+		return nil, fmt.Errorf("strings: %w", err)
+	}
+	if err := f.decodeElements(data); err != nil {
+		return nil, fmt.Errorf("elements: %w", err)
+	}
+	if h.HasFlag(FlagHasStyles) {
+		if err := f.decodeStyles(data); err != nil {
+			return nil, fmt.Errorf("styles: %w", err)
+		}
+	}
+	if h.HasFlag(FlagHasComponentDefs) {
+		if err := f.decodeComponentDefs(data); err != nil {
+			return nil, fmt.Errorf("component defs: %w", err)
+		}
+	}
+	if h.HasFlag(FlagHasAnimations) {
+		if err := f.decodeAnimations(data); err != nil {
+			return nil, fmt.Errorf("animations: %w", err)
+		}
+	}
+	if h.HasFlag(FlagHasResources) && h.ResourceCount > 0 {
+		if err := f.decodeResources(data); err != nil {
+			return nil, fmt.Errorf("resources: %w", err)
+		}
+	}
+	if err := f.checkStringRefs(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// --- Header ---
+
+func decodeHeader(data []byte, h *Header) error {
+	if len(data) < HeaderSize {
+		return fmt.Errorf("header: %w (have %d bytes, need %d)", ErrTruncated, len(data), HeaderSize)
+	}
+	copy(h.Magic[:], data[0:4])
+	if string(h.Magic[:]) != Magic {
+		return fmt.Errorf("%w %q", ErrInvalidMagic, h.Magic[:])
+	}
+	version := binary.LittleEndian.Uint16(data[4:6])
+	h.VersionMajor = uint8(version)
+	h.VersionMinor = uint8(version >> 8)
+	if h.VersionMajor != VersionMajor || h.VersionMinor < VersionMinorNarrow || h.VersionMinor > VersionMinor {
+		return fmt.Errorf("%w %d.%d (want %d.%d to %d.%d)", ErrUnsupportedVersion, h.VersionMajor, h.VersionMinor, VersionMajor, VersionMinorNarrow, VersionMajor, VersionMinor)
+	}
+
+	r := &reader{data: data, pos: 6}
+	h.Flags, _ = r.u16()
+	counts := []*uint16{&h.ElementCount, &h.StyleCount, &h.ComponentDefCount, &h.AnimationCount, &h.StringCount, &h.ResourceCount}
+	for _, c := range counts {
+		*c, _ = r.u16()
+	}
+	offsets := []*uint32{&h.ElementOffset, &h.StyleOffset, &h.ComponentDefOffset, &h.AnimationOffset, &h.StringOffset, &h.ResourceOffset, &h.TotalSize}
+	for _, o := range offsets {
+		*o, _ = r.u32()
+	}
+
+	if int(h.TotalSize) != len(data) {
+		return fmt.Errorf("header: total size %d does not match data length %d", h.TotalSize, len(data))
+	}
+	// Sections are laid out in this order; each offset must fall inside the file.
+	ordered := []struct {
+		name   string
+		offset uint32
+	}{
+		{"element", h.ElementOffset},
+		{"style", h.StyleOffset},
+		{"component def", h.ComponentDefOffset},
+		{"animation", h.AnimationOffset},
+		{"string", h.StringOffset},
+		{"resource", h.ResourceOffset},
+	}
+	prev := uint32(HeaderSize)
+	for _, s := range ordered {
+		if s.offset < prev || s.offset > h.TotalSize {
+			return fmt.Errorf("header: %s offset %d out of range [%d, %d]", s.name, s.offset, prev, h.TotalSize)
+		}
+		prev = s.offset
+	}
+	return nil
+}
+
+// --- Sections ---
+
+func (f *File) decodeStrings(data []byte) error {
+	r := f.section(data, f.Header.StringOffset, f.Header.ResourceOffset)
+	count, err := r.u16()
+	if err != nil {
+		return err
+	}
+	if count != f.Header.StringCount {
+		return fmt.Errorf("table count %d does not match header count %d", count, f.Header.StringCount)
+	}
+	f.Strings = make([]string, 0, count)
+	for i := 0; i < int(count); i++ {
+		var length uint64
+		if f.Header.Flags&FlagLongStrings != 0 {
+			length, err = r.uvarint()
+		} else {
+			var b uint8
+			b, err = r.u8()
+			length = uint64(b)
+		}
+		if err != nil {
+			return fmt.Errorf("string %d length: %w", i, err)
+		}
+		if length > uint64(len(r.data)) {
+			return fmt.Errorf("string %d length %d exceeds the file size", i, length)
+		}
+		text, err := r.bytes(int(length))
+		if err != nil {
+			return fmt.Errorf("string %d data: %w", i, err)
+		}
+		if !utf8.Valid(text) {
+			return fmt.Errorf("string %d is not valid UTF-8", i)
+		}
+		f.Strings = append(f.Strings, string(text))
+	}
+	return nil
+}
+
+func (f *File) decodeElements(data []byte) error {
+	h := &f.Header
+	r := f.section(data, h.ElementOffset, h.StyleOffset)
+	byOffset := make(map[uint32]*Element, h.ElementCount)
+	f.Elements = make([]*Element, 0, h.ElementCount)
+	for i := 0; i < int(h.ElementCount); i++ {
+		el, err := readElement(r)
+		if err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+		f.Elements = append(f.Elements, el)
+		byOffset[el.Offset] = el
+	}
+	if h.ElementCount > 0 && h.HasFlag(FlagHasApp) && f.Elements[0].Type != ElemTypeApp {
+		return fmt.Errorf("FLAG_HAS_APP is set but first element has type 0x%02X", f.Elements[0].Type)
+	}
+
+	isChild, err := linkChildren(f.Elements, byOffset)
+	if err != nil {
+		return err
+	}
+	for _, el := range f.Elements {
+		if !isChild[el] {
+			f.Roots = append(f.Roots, el)
+		}
+	}
+	return nil
+}
+
+func (f *File) decodeStyles(data []byte) error {
+	h := &f.Header
+	r := f.section(data, h.StyleOffset, h.ComponentDefOffset)
+	f.Styles = make([]*Style, 0, h.StyleCount)
+	for i := 0; i < int(h.StyleCount); i++ {
+		s := &Style{}
+		var err error
+		if s.ID, err = r.index(); err != nil {
+			return fmt.Errorf("style %d id: %w", i, err)
+		}
+		if s.NameIndex, err = r.index(); err != nil {
+			return fmt.Errorf("style %d name index: %w", i, err)
+		}
+		propCount, err := r.u8()
+		if err != nil {
+			return fmt.Errorf("style %d property count: %w", i, err)
+		}
+		if s.Properties, err = readProperties(r, int(propCount)); err != nil {
+			return fmt.Errorf("style %d: %w", i, err)
+		}
+		f.Styles = append(f.Styles, s)
+	}
+	if h.HasFlag(FlagHasStyleVariants) {
+		if err := f.decodeStyleVariants(r); err != nil {
+			return err
+		}
+	}
+	if h.HasFlag(FlagHasMediaVariants) {
+		return f.decodeMediaVariants(r)
+	}
+	return nil
+}
+
+// decodeStyleVariants reads the style variant table that follows the last
+// style block: Count(2), then per variant StyleID(2), State(1), PropCount(1)
+// and the properties.
+func (f *File) decodeStyleVariants(r *reader) error {
+	count, err := r.u16()
+	if err != nil {
+		return fmt.Errorf("variant count: %w", err)
+	}
+	for i := 0; i < int(count); i++ {
+		id, err := r.index()
+		if err != nil {
+			return fmt.Errorf("variant %d style id: %w", i, err)
+		}
+		s := f.StyleByID(id)
+		if s == nil {
+			return fmt.Errorf("variant %d: style ID %d does not exist", i, id)
+		}
+		b, err := r.bytes(2)
+		if err != nil {
+			return fmt.Errorf("variant %d: %w", i, err)
+		}
+		v := StyleVariant{State: b[0]}
+		if v.Properties, err = readProperties(r, int(b[1])); err != nil {
+			return fmt.Errorf("variant %d: %w", i, err)
+		}
+		s.Variants = append(s.Variants, v)
+	}
+	return nil
+}
+
+// decodeMediaVariants reads the media variant table: Count(2), then per
+// variant StyleID(2), CondCount(1), the conditions as Feature(1) and
+// Value(2), PropCount(1) and the properties.
+func (f *File) decodeMediaVariants(r *reader) error {
+	count, err := r.u16()
+	if err != nil {
+		return fmt.Errorf("media variant count: %w", err)
+	}
+	for i := 0; i < int(count); i++ {
+		id, err := r.index()
+		if err != nil {
+			return fmt.Errorf("media variant %d style id: %w", i, err)
+		}
+		s := f.StyleByID(id)
+		if s == nil {
+			return fmt.Errorf("media variant %d: style ID %d does not exist", i, id)
+		}
+		condCount, err := r.u8()
+		if err != nil {
+			return fmt.Errorf("media variant %d condition count: %w", i, err)
+		}
+		var v MediaVariant
+		for j := 0; j < int(condCount); j++ {
+			var c MediaCondition
+			if c.Feature, err = r.u8(); err != nil {
+				return fmt.Errorf("media variant %d condition %d: %w", i, j, err)
+			}
+			if c.Value, err = r.u16(); err != nil {
+				return fmt.Errorf("media variant %d condition %d value: %w", i, j, err)
+			}
+			v.Conditions = append(v.Conditions, c)
+		}
+		propCount, err := r.u8()
+		if err != nil {
+			return fmt.Errorf("media variant %d property count: %w", i, err)
+		}
+		if v.Properties, err = readProperties(r, int(propCount)); err != nil {
+			return fmt.Errorf("media variant %d: %w", i, err)
+		}
+		s.Media = append(s.Media, v)
+	}
+	return nil
+}
+
+func (f *File) decodeComponentDefs(data []byte) error {
+	h := &f.Header
+	r := f.section(data, h.ComponentDefOffset, h.AnimationOffset)
+	f.ComponentDefs = make([]*ComponentDef, 0, h.ComponentDefCount)
+	for i := 0; i < int(h.ComponentDefCount); i++ {
+		def := &ComponentDef{}
+		var err error
+		if def.NameIndex, err = r.index(); err != nil {
+			return fmt.Errorf("def %d name index: %w", i, err)
+		}
+		propDefCount, err := r.u8()
+		if err != nil {
+			return fmt.Errorf("def %d property def count: %w", i, err)
+		}
+		for j := 0; j < int(propDefCount); j++ {
+			var pd PropertyDef
+			if pd.NameIndex, err = r.index(); err != nil {
+				return fmt.Errorf("def %d prop def %d name index: %w", i, j, err)
+			}
+			if pd.ValueTypeHint, err = r.u8(); err != nil {
+				return fmt.Errorf("def %d prop def %d type hint: %w", i, j, err)
+			}
+			size, err := r.u8()
+			if err != nil {
+				return fmt.Errorf("def %d prop def %d default size: %w", i, j, err)
+			}
+			if pd.DefaultValue, err = r.bytes(int(size)); err != nil {
+				return fmt.Errorf("def %d prop def %d default value: %w", i, j, err)
+			}
+			def.Properties = append(def.Properties, pd)
+		}
+		if err := readTemplate(r, def); err != nil {
+			return fmt.Errorf("def %d template: %w", i, err)
+		}
+		f.ComponentDefs = append(f.ComponentDefs, def)
+	}
+	return nil
+}
+
+func (f *File) decodeAnimations(data []byte) error {
+	h := &f.Header
+	r := f.section(data, h.AnimationOffset, h.StringOffset)
+	f.Animations = make([]*Animation, 0, h.AnimationCount)
+	for i := 0; i < int(h.AnimationCount); i++ {
+		a := &Animation{}
+		var err error
+		if a.NameIndex, err = r.index(); err != nil {
+			return fmt.Errorf("animation %d name index: %w", i, err)
+		}
+		if a.DurationMs, err = r.u16(); err != nil {
+			return fmt.Errorf("animation %d duration: %w", i, err)
+		}
+		b, err := r.bytes(3)
+		if err != nil {
+			return fmt.Errorf("animation %d: %w", i, err)
+		}
+		a.Easing, a.Iterations = b[0], b[1]
+		for j := 0; j < int(b[2]); j++ {
+			var kf Keyframe
+			if kf.Offset, err = r.u8(); err != nil {
+				return fmt.Errorf("animation %d keyframe %d: %w", i, j, err)
+			}
+			if kf.Offset > 100 {
+				return fmt.Errorf("animation %d keyframe %d: offset %d%% is out of range", i, j, kf.Offset)
+			}
+			propCount, err := r.u8()
+			if err != nil {
+				return fmt.Errorf("animation %d keyframe %d property count: %w", i, j, err)
+			}
+			if kf.Properties, err = readProperties(r, int(propCount)); err != nil {
+				return fmt.Errorf("animation %d keyframe %d: %w", i, j, err)
+			}
+			a.Keyframes = append(a.Keyframes, kf)
+		}
+		f.Animations = append(f.Animations, a)
+	}
+	return nil
+}
+
+func (f *File) decodeResources(data []byte) error {
+	h := &f.Header
+	r := f.section(data, h.ResourceOffset, h.TotalSize)
+	count, err := r.u16()
+	if err != nil {
+		return err
+	}
+	if count != h.ResourceCount {
+		return fmt.Errorf("table count %d does not match header count %d", count, h.ResourceCount)
+	}
+	f.Resources = make([]Resource, 0, count)
+	for i := 0; i < int(count); i++ {
+		var res Resource
+		if res.Type, err = r.u8(); err != nil {
+			return fmt.Errorf("resource %d: %w", i, err)
+		}
+		if res.NameIndex, err = r.index(); err != nil {
+			return fmt.Errorf("resource %d name index: %w", i, err)
+		}
+		if res.Format, err = r.u8(); err != nil {
+			return fmt.Errorf("resource %d format: %w", i, err)
+		}
+		switch res.Format {
+		case ResFormatExternal:
+			if res.DataStringIndex, err = r.index(); err != nil {
+				return fmt.Errorf("resource %d data index: %w", i, err)
+			}
+		case ResFormatInline:
+			size, err := r.u32()
+			if err != nil {
+				return fmt.Errorf("resource %d data size: %w", i, err)
+			}
+			if size > uint32(len(data)) {
+				return fmt.Errorf("resource %d: data size %d exceeds file size", i, size)
+			}
+			if res.Data, err = r.bytes(int(size)); err != nil {
+				return fmt.Errorf("resource %d data: %w", i, err)
+			}
+		default:
+			return fmt.Errorf("resource %d: unsupported format 0x%02X", i, res.Format)
+		}
+		f.Resources = append(f.Resources, res)
+	}
+	return nil
+}
+
+// checkStringRefs verifies that every string index used by the decoded
+// sections points into the string table, and every animation reference into
+// the animation table.
+func (f *File) checkStringRefs() error {
+	check := func(index uint16, what string, args ...any) error {
+		// With no strings, the compiler still writes index 0 for "none".
+		if int(index) >= len(f.Strings) && (index != 0 || len(f.Strings) != 0) {
+			return fmt.Errorf("%s: string index %d out of range (table has %d)", fmt.Sprintf(what, args...), index, len(f.Strings))
+		}
+		return nil
+	}
+	checkElement := func(el *Element, where string) error {
+		if err := check(el.IDStringIndex, "%s element at %d id", where, el.Offset); err != nil {
+			return err
+		}
+		for i, cp := range el.CustomProperties {
+			if err := check(cp.KeyIndex, "%s element at %d custom property %d", where, el.Offset, i); err != nil {
+				return err
+			}
+		}
+		for i, ev := range el.Events {
+			if err := check(ev.CallbackIndex, "%s element at %d event %d", where, el.Offset, i); err != nil {
+				return err
+			}
+		}
+		for i, ref := range el.AnimationRefs {
+			if int(ref.AnimationIndex) >= len(f.Animations) {
+				return fmt.Errorf("%s element at %d animation ref %d: index %d out of range (table has %d)", where, el.Offset, i, ref.AnimationIndex, len(f.Animations))
+			}
+		}
+		return nil
+	}
+
+	for _, el := range f.Elements {
+		if err := checkElement(el, "main"); err != nil {
+			return err
+		}
+	}
+	for i, s := range f.Styles {
+		if err := check(s.NameIndex, "style %d name", i); err != nil {
+			return err
+		}
+	}
+	for i, def := range f.ComponentDefs {
+		if err := check(def.NameIndex, "def %d name", i); err != nil {
+			return err
+		}
+		for j, pd := range def.Properties {
+			if err := check(pd.NameIndex, "def %d prop def %d name", i, j); err != nil {
+				return err
+			}
+		}
+		for _, el := range def.Template {
+			if err := checkElement(el, fmt.Sprintf("def %d template", i)); err != nil {
+				return err
+			}
+		}
+	}
+	for i, a := range f.Animations {
+		if err := check(a.NameIndex, "animation %d name", i); err != nil {
+			return err
+		}
+	}
+	for i, res := range f.Resources {
+		if err := check(res.NameIndex, "resource %d name", i); err != nil {
+			return err
+		}
+		if res.Format == ResFormatExternal {
+			if err := check(res.DataStringIndex, "resource %d data", i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// section returns a reader bounded to data[start:end], with positions
+// reported relative to the start of the file.
+func (f *File) section(data []byte, start, end uint32) *reader {
+	return &reader{data: data[:end], pos: int(start), wide: f.Header.WideIndices(), wideElements: f.Header.HasFlag(FlagWideElements)}
+}
+
+// --- Elements ---
+
+// readElement reads one element block at the reader's position. Template
+// elements carry no custom properties or events, but their counts are still
+// honoured so malformed input is reported rather than misread.
+func readElement(r *reader) (*Element, error) {
+	el := &Element{Offset: uint32(r.pos)}
+	size := ElementHeaderSize
+	switch {
+	case r.wideElements:
+		size = ElementHeaderSizeWide
+	case !r.wide:
+		size = ElementHeaderSizeNarrow
+	}
+	if _, err := r.bytes(size); err != nil {
+		return nil, fmt.Errorf("header at %d: %w", el.Offset, err)
+	}
+	r.pos = int(el.Offset) // The header is in bounds, so the reads below cannot fail
+	el.Type, _ = r.u8()
+	el.IDStringIndex, _ = r.index()
+	el.PosX, _ = r.u16()
+	el.PosY, _ = r.u16()
+	el.Width, _ = r.u16()
+	el.Height, _ = r.u16()
+	el.Layout, _ = r.u8()
+	el.StyleID, _ = r.index()
+	propCount, _ := r.u8()
+	childCount := 0
+	if r.wideElements {
+		n, _ := r.u16()
+		childCount = int(n)
+	} else {
+		n, _ := r.u8()
+		childCount = int(n)
+	}
+	counts, _ := r.bytes(3)
+	eventCount, animCount, customCount := counts[0], counts[1], counts[2]
+	var err error
+
+	if el.Properties, err = readProperties(r, int(propCount)); err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(customCount); i++ {
+		key, err := r.index()
+		if err != nil {
+			return nil, fmt.Errorf("custom property %d: %w", i, err)
+		}
+		b, err := r.bytes(2)
+		if err != nil {
+			return nil, fmt.Errorf("custom property %d: %w", i, err)
+		}
+		value, err := r.bytes(int(b[1]))
+		if err != nil {
+			return nil, fmt.Errorf("custom property %d value: %w", i, err)
+		}
+		el.CustomProperties = append(el.CustomProperties, CustomProperty{KeyIndex: key, ValueType: b[0], Value: value})
+	}
+	for i := 0; i < int(eventCount); i++ {
+		typ, err := r.u8()
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", i, err)
+		}
+		callback, err := r.index()
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", i, err)
+		}
+		el.Events = append(el.Events, Event{Type: typ, CallbackIndex: callback})
+	}
+	for i := 0; i < int(animCount); i++ {
+		index, err := r.index()
+		if err != nil {
+			return nil, fmt.Errorf("animation ref %d: %w", i, err)
+		}
+		trigger, err := r.u8()
+		if err != nil {
+			return nil, fmt.Errorf("animation ref %d: %w", i, err)
+		}
+		el.AnimationRefs = append(el.AnimationRefs, AnimationRef{AnimationIndex: index, Trigger: trigger})
+	}
+	for i := 0; i < childCount; i++ {
+		off, err := r.childOffset()
+		if err != nil {
+			return nil, fmt.Errorf("child offset %d: %w", i, err)
+		}
+		if off == 0 {
+			return nil, fmt.Errorf("child offset %d is zero", i)
+		}
+		el.ChildOffsets = append(el.ChildOffsets, off)
+	}
+	return el, nil
+}
+
+func readProperties(r *reader, count int) ([]Property, error) {
+	props := make([]Property, 0, count)
+	for i := 0; i < count; i++ {
+		b, err := r.bytes(3)
+		if err != nil {
+			return nil, fmt.Errorf("property %d: %w", i, err)
+		}
+		value, err := r.bytes(int(b[2]))
+		if err != nil {
+			return nil, fmt.Errorf("property %d (0x%02X) value: %w", i, b[0], err)
+		}
+		props = append(props, Property{ID: b[0], ValueType: b[1], Value: value})
+	}
+	return props, nil
+}
+
+// readTemplate reads a component definition's element template. Templates
+// have no explicit size, so elements are read sequentially until every child
+// offset reachable from the root has been read.
+func readTemplate(r *reader, def *ComponentDef) error {
+	base := uint32(r.pos)
+	byOffset := make(map[uint32]*Element)
+	pending := 0 // Child offsets pointing past the last element read
+	for {
+		el, err := readElement(r)
+		if err != nil {
+			return fmt.Errorf("element %d: %w", len(def.Template), err)
+		}
+		el.Offset -= base
+		def.Template = append(def.Template, el)
+		byOffset[el.Offset] = el
+
+		end := uint32(r.pos) - base
+		pending = 0
+		for _, t := range def.Template {
+			for _, c := range t.ChildOffsets {
+				if t.Offset+c >= end {
+					pending++
+				}
+			}
+		}
+		if pending == 0 {
+			break
+		}
+	}
+	def.Root = def.Template[0]
+	if _, err := linkChildren(def.Template, byOffset); err != nil {
+		return err
+	}
+	return nil
+}
+
+// linkChildren resolves each element's ChildOffsets against byOffset and
+// returns the set of elements that were referenced as someone's child.
+func linkChildren(elements []*Element, byOffset map[uint32]*Element) (map[*Element]bool, error) {
+	isChild := make(map[*Element]bool, len(elements))
+	for _, el := range elements {
+		for i, rel := range el.ChildOffsets {
+			child, ok := byOffset[el.Offset+rel]
+			if !ok {
+				return nil, fmt.Errorf("element at %d: child %d offset +%d does not point at an element", el.Offset, i, rel)
+			}
+			el.Children = append(el.Children, child)
+			isChild[child] = true
+		}
+	}
+	return isChild, nil
+}
+
+// --- Reader ---
+
+// reader is a bounds-checked little-endian cursor over a byte slice.
+type reader struct {
+	data []byte
+	pos  int
+	wide bool // String, resource and style references are 16-bit (v0.5 on)
+
+	wideElements bool // Child counts are 16-bit and child offsets 32-bit (FlagWideElements)
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, fmt.Errorf("%w at offset %d (need %d bytes)", ErrTruncated, r.pos, n)
+	}
+	b := r.data[r.pos : r.pos+n : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *reader) u8() (uint8, error) {
+	b, err := r.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *reader) u16() (uint16, error) {
+	b, err := r.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(b), nil
+}
+
+func (r *reader) u32() (uint32, error) {
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+// uvarint reads an unsigned LEB128 varint.
+func (r *reader) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	switch {
+	case n == 0:
+		return 0, fmt.Errorf("%w at offset %d (incomplete varint)", ErrTruncated, r.pos)
+	case n < 0:
+		return 0, fmt.Errorf("varint at offset %d overflows 64 bits", r.pos)
+	}
+	r.pos += n
+	return v, nil
+}
+
+// childOffset reads an element's offset to one of its children.
+func (r *reader) childOffset() (uint32, error) {
+	if r.wideElements {
+		return r.u32()
+	}
+	off, err := r.u16()
+	return uint32(off), err
+}
+
+// index reads a string, resource or style reference.
+func (r *reader) index() (uint16, error) {
+	if r.wide {
+		return r.u16()
+	}
+	b, err := r.u8()
+	return uint16(b), err
+}
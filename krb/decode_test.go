@@ -0,0 +1,265 @@
+// decode_test.go
+package krb_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/waozixyz/kryc"
+	"github.com/waozixyz/kryc/krb"
+)
+
+// compile compiles src with the default target and fails the test on error.
+func compile(t *testing.T, src string) []byte {
+	t.Helper()
+	res, err := kryc.Compile(context.Background(), kryc.Options{
+		Filename: "test.kry",
+		Sources:  map[string][]byte{"test.kry": []byte(src)},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	return res.KRB
+}
+
+func TestDecodeWithoutStrings(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		props int
+	}{
+		{"empty app", "App {}\n", 0},
+		{"window size", "App { window_width: 800 }\n", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := krb.Decode(compile(t, tt.src))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if len(f.Strings) != 0 {
+				t.Fatalf("got %d strings, want none", len(f.Strings))
+			}
+			if len(f.Elements) != 1 {
+				t.Fatalf("got %d elements, want 1", len(f.Elements))
+			}
+			el := f.Elements[0]
+			if el.Type != krb.ElemTypeApp || el.IDStringIndex != 0 {
+				t.Errorf("got element type 0x%02X id %d, want App with id 0", el.Type, el.IDStringIndex)
+			}
+			if len(el.Properties) != tt.props {
+				t.Errorf("got %d properties, want %d", len(el.Properties), tt.props)
+			}
+		})
+	}
+}
+
+// narrowFile returns a hand-built v0.4 file, in which string and style
+// references are single bytes: an App with a title, a style and a click
+// event, holding one Text element.
+func narrowFile() []byte {
+	strs := []string{"Hello", "main", "onTap", "base"}
+	elements := []byte{
+		krb.ElemTypeApp, 1, 0, 0, 0, 0, 0, 0, 0, 0, krb.LayoutDirectionColumn, 1, 1, 1, 1, 0, 0, // id "main", style 1, 1 property, 1 child, 1 event
+		krb.PropIDWindowTitle, krb.ValTypeString, 1, 0,
+		krb.EventTypeClick, 2,
+		25, 0, // The Text element follows this 25-byte block
+		krb.ElemTypeText, 0, 0, 0, 0, 0, 0, 0, 0, 0, krb.LayoutDirectionColumn, 0, 1, 0, 0, 0, 0,
+		krb.PropIDTextContent, krb.ValTypeString, 1, 0,
+	}
+	styles := []byte{1, 3, 1, krb.PropIDBgColor, krb.ValTypeColor, 4, 0x11, 0x22, 0x33, 0xFF}
+	stringTable := binary.LittleEndian.AppendUint16(nil, uint16(len(strs)))
+	for _, s := range strs {
+		stringTable = append(append(stringTable, byte(len(s))), s...)
+	}
+
+	elementOffset := uint32(krb.HeaderSize)
+	styleOffset := elementOffset + uint32(len(elements))
+	stringOffset := styleOffset + uint32(len(styles))
+	total := stringOffset + uint32(len(stringTable))
+
+	data := []byte(krb.Magic)
+	data = binary.LittleEndian.AppendUint16(data, uint16(krb.VersionMinorNarrow)<<8|krb.VersionMajor)
+	data = binary.LittleEndian.AppendUint16(data, krb.FlagHasApp|krb.FlagHasStyles)
+	for _, n := range []uint16{2, 1, 0, 0, uint16(len(strs)), 0} {
+		data = binary.LittleEndian.AppendUint16(data, n)
+	}
+	for _, off := range []uint32{elementOffset, styleOffset, stringOffset, stringOffset, stringOffset, total, total} {
+		data = binary.LittleEndian.AppendUint32(data, off)
+	}
+	data = append(data, elements...)
+	data = append(data, styles...)
+	return append(data, stringTable...)
+}
+
+func TestDecodeNarrowIndices(t *testing.T) {
+	f, err := krb.Decode(narrowFile())
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if f.Header.WideIndices() {
+		t.Errorf("v0.%d file reports wide indices", f.Header.VersionMinor)
+	}
+	if len(f.Roots) != 1 || len(f.Elements) != 2 {
+		t.Fatalf("got %d roots and %d elements, want 1 and 2", len(f.Roots), len(f.Elements))
+	}
+	app, text := f.Elements[0], f.Elements[1]
+	if app.IDStringIndex != 1 || app.StyleID != 1 {
+		t.Errorf("got App id %d style %d, want id 1 style 1", app.IDStringIndex, app.StyleID)
+	}
+	if len(app.Events) != 1 || app.Events[0].CallbackIndex != 2 {
+		t.Errorf("got App events %+v, want one with callback 2", app.Events)
+	}
+	if len(app.Children) != 1 || app.Children[0] != text || text.Type != krb.ElemTypeText {
+		t.Errorf("App children do not link to the Text element")
+	}
+	if len(f.Styles) != 1 || f.Styles[0].ID != 1 || f.Styles[0].NameIndex != 3 {
+		t.Errorf("got styles %+v, want style 1 named by string 3", f.Styles)
+	}
+
+	src, diags, err := kryc.Decompile(f)
+	if err != nil {
+		t.Fatalf("Decompile: %v", err)
+	}
+	for _, d := range diags {
+		t.Errorf("Decompile: %s", d.Message)
+	}
+	compile(t, string(src))
+}
+
+// TestDecodeManyStrings checks string and style references past 255, which
+// v0.5 widened to 16 bits.
+func TestDecodeManyStrings(t *testing.T) {
+	const n = 300
+	var src strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&src, "style \"s%d\" { font_size: %d }\n", i, i+1)
+	}
+	src.WriteString("App {\n")
+	for i := 0; i < n; i++ {
+		if i%100 == 0 {
+			src.WriteString("    Container {\n")
+		}
+		fmt.Fprintf(&src, "        Text { id: \"t%d\"; style: \"s%d\"; text: \"v%d\" }\n", i, i, i)
+		if i%100 == 99 {
+			src.WriteString("    }\n")
+		}
+	}
+	src.WriteString("}\n")
+
+	f, err := krb.Decode(compile(t, src.String()))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(f.Strings) <= 255 || len(f.Styles) != n {
+		t.Fatalf("got %d strings and %d styles, want over 255 and %d", len(f.Strings), len(f.Styles), n)
+	}
+	styles := make(map[uint16]string, len(f.Styles))
+	for _, s := range f.Styles {
+		styles[s.ID], _ = f.String(s.NameIndex)
+	}
+	var texts []*krb.Element
+	for _, el := range f.Elements {
+		if el.Type == krb.ElemTypeText {
+			texts = append(texts, el)
+		}
+	}
+	if len(texts) != n {
+		t.Fatalf("got %d Text elements, want %d", len(texts), n)
+	}
+	for i, el := range texts {
+		if id, _ := f.String(el.IDStringIndex); id != fmt.Sprintf("t%d", i) {
+			t.Errorf("element %d: got id %q", i, id)
+		}
+		if name := styles[el.StyleID]; name != fmt.Sprintf("s%d", i) {
+			t.Errorf("element %d: got style %q", i, name)
+		}
+		if len(el.Properties) != 1 || el.Properties[0].ValueType != krb.ValTypeString || len(el.Properties[0].Value) != 2 {
+			t.Fatalf("element %d: got properties %+v, want one 16-bit string index", i, el.Properties)
+		}
+		text, _ := f.String(binary.LittleEndian.Uint16(el.Properties[0].Value))
+		if text != fmt.Sprintf("v%d", i) {
+			t.Errorf("element %d: got text %q", i, text)
+		}
+	}
+}
+
+func TestDecodeLongStrings(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		long bool // Whether FlagLongStrings is expected
+	}{
+		{"short", 255, false},
+		{"long", 256, true},
+		{"three byte length", 70000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := strings.Repeat("é", tt.size/2) + strings.Repeat("x", tt.size%2)
+			f, err := krb.Decode(compile(t, fmt.Sprintf("App { Text { text: %q } }\n", text)))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if got := f.Header.HasFlag(krb.FlagLongStrings); got != tt.long {
+				t.Errorf("got FlagLongStrings %v, want %v", got, tt.long)
+			}
+			if len(f.Elements) != 2 || len(f.Elements[1].Properties) != 1 {
+				t.Fatalf("got %d elements, want App and Text with one property", len(f.Elements))
+			}
+			got, _ := f.String(binary.LittleEndian.Uint16(f.Elements[1].Properties[0].Value))
+			if got != text {
+				t.Errorf("got a %d byte string, want the %d byte text", len(got), len(text))
+			}
+		})
+	}
+}
+
+// TestDecodeWideElements checks child counts above 255 and child offsets
+// above 64 KiB, which need FlagWideElements.
+func TestDecodeWideElements(t *testing.T) {
+	const n = 3000
+	var src strings.Builder
+	src.WriteString("App {\n    Container {\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&src, "        Text { text: \"child %d\" }\n", i)
+	}
+	src.WriteString("    }\n    Text { text: \"last\" }\n}\n")
+
+	f, err := krb.Decode(compile(t, src.String()))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !f.Header.HasFlag(krb.FlagWideElements) {
+		t.Error("FlagWideElements is not set")
+	}
+	text := func(el *krb.Element) string {
+		if len(el.Properties) != 1 {
+			return ""
+		}
+		s, _ := f.String(binary.LittleEndian.Uint16(el.Properties[0].Value))
+		return s
+	}
+	app := f.Elements[0]
+	if len(app.Children) != 2 {
+		t.Fatalf("got %d App children, want 2", len(app.Children))
+	}
+	if off := app.ChildOffsets[1]; off <= 0xFFFF {
+		t.Errorf("got offset %d for the last child, want it above 64 KiB", off)
+	}
+	if got := text(app.Children[1]); got != "last" {
+		t.Errorf("got last child text %q", got)
+	}
+	children := app.Children[0].Children
+	if len(children) != n {
+		t.Fatalf("got %d Container children, want %d", len(children), n)
+	}
+	for i, c := range children {
+		if got, want := text(c), fmt.Sprintf("child %d", i); got != want {
+			t.Fatalf("child %d: got text %q, want %q", i, got, want)
+		}
+	}
+}
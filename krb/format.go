@@ -0,0 +1,207 @@
+// format.go
+package krb
+
+// --- KRB v0.5 Constants ---
+// v0.5 widens string, resource and style references from 8 to 16 bits. The
+// decoder still reads v0.4 files, where they are single bytes.
+const (
+	Magic                 = "KRB1"
+	VersionMajor          = 0
+	VersionMinor          = 5
+	HeaderSize            = 48 // Corresponds to KRB v0.5 File Header specification
+	ElementHeaderSize     = 19 // 16-bit ID string index and StyleID since v0.5
+	ElementHeaderSizeWide = 20 // With FlagWideElements, the child count is 16-bit
+
+	VersionMinorNarrow      = 4  // Last version with 8-bit string, resource and style references
+	ElementHeaderSizeNarrow = 17 // Element header size up to v0.4
+)
+
+// Header Flags (Bit 0-11)
+const (
+	FlagHasStyles        uint16 = 1 << 0
+	FlagHasComponentDefs uint16 = 1 << 1
+	FlagHasAnimations    uint16 = 1 << 2
+	FlagHasResources     uint16 = 1 << 3
+	FlagCompressed       uint16 = 1 << 4
+	FlagFixedPoint       uint16 = 1 << 5
+	FlagExtendedColor    uint16 = 1 << 6
+	FlagHasApp           uint16 = 1 << 7
+	FlagLongStrings      uint16 = 1 << 8 // String lengths are unsigned LEB128 varints instead of one byte
+	FlagWideElements     uint16 = 1 << 9 // Element child counts are uint16 and child offsets uint32
+
+	FlagHasStyleVariants uint16 = 1 << 10 // A style variant table follows the last style block
+	FlagHasMediaVariants uint16 = 1 << 11 // A media variant table follows the style variant table, if any
+)
+
+// Element Types
+const (
+	ElemTypeApp        uint8 = 0x00
+	ElemTypeContainer  uint8 = 0x01
+	ElemTypeText       uint8 = 0x02
+	ElemTypeImage      uint8 = 0x03
+	ElemTypeCanvas     uint8 = 0x04
+	ElemTypeButton     uint8 = 0x10
+	ElemTypeInput      uint8 = 0x11
+	ElemTypeList       uint8 = 0x20
+	ElemTypeGrid       uint8 = 0x21
+	ElemTypeScrollable uint8 = 0x22
+	ElemTypeVideo      uint8 = 0x30
+	ElemTypeCustomBase uint8 = 0x31 // KRB: Base for custom types (0x31-0xFF)
+)
+
+// Standard KRB Property IDs
+const (
+	PropIDInvalid        uint8 = 0x00
+	PropIDBgColor        uint8 = 0x01
+	PropIDFgColor        uint8 = 0x02 // Also text_color
+	PropIDBorderColor    uint8 = 0x03
+	PropIDBorderWidth    uint8 = 0x04
+	PropIDBorderRadius   uint8 = 0x05
+	PropIDPadding        uint8 = 0x06
+	PropIDMargin         uint8 = 0x07
+	PropIDTextContent    uint8 = 0x08
+	PropIDFontSize       uint8 = 0x09
+	PropIDFontWeight     uint8 = 0x0A
+	PropIDTextAlignment  uint8 = 0x0B
+	PropIDImageSource    uint8 = 0x0C
+	PropIDOpacity        uint8 = 0x0D
+	PropIDZindex         uint8 = 0x0E
+	PropIDVisibility     uint8 = 0x0F
+	PropIDGap            uint8 = 0x10
+	PropIDMinWidth       uint8 = 0x11
+	PropIDMinHeight      uint8 = 0x12
+	PropIDMaxWidth       uint8 = 0x13 // KRY 'width' often maps here
+	PropIDMaxHeight      uint8 = 0x14 // KRY 'height' often maps here
+	PropIDAspectRatio    uint8 = 0x15
+	PropIDTransform      uint8 = 0x16
+	PropIDShadow         uint8 = 0x17
+	PropIDOverflow       uint8 = 0x18
+	PropIDCustomDataBlob uint8 = 0x19
+	PropIDLayoutFlags    uint8 = 0x1A // KRY 'layout' property effect is encoded in Element Header, not usually written as a KRB prop.
+	PropIDTransition     uint8 = 0x1B // Properties interpolated on change (ValTypeTransition)
+	// App-Specific Properties (on ELEM_TYPE_APP)
+	PropIDWindowWidth  uint8 = 0x20
+	PropIDWindowHeight uint8 = 0x21
+	PropIDWindowTitle  uint8 = 0x22
+	PropIDResizable    uint8 = 0x23
+	PropIDKeepAspect   uint8 = 0x24
+	PropIDScaleFactor  uint8 = 0x25
+	PropIDIcon         uint8 = 0x26
+	PropIDVersion      uint8 = 0x27
+	PropIDAuthor       uint8 = 0x28
+)
+
+// KRB Value Types
+const (
+	ValTypeNone       uint8 = 0x00
+	ValTypeByte       uint8 = 0x01 // Also used for Bool in KRB
+	ValTypeShort      uint8 = 0x02 // Also used for Int in KRB
+	ValTypeColor      uint8 = 0x03 // 1 byte (palette index) or 4 bytes (RGBA)
+	ValTypeString     uint8 = 0x04 // Represents String Table Index (uint16; 1 byte up to v0.4)
+	ValTypeResource   uint8 = 0x05 // Represents Resource Table Index (uint16; 1 byte up to v0.4)
+	ValTypePercentage uint8 = 0x06 // Represents 8.8 Fixed Point (uint16)
+	ValTypeRect       uint8 = 0x07 // Example: 4 shorts (x,y,w,h) -> 8 bytes
+	ValTypeEdgeInsets uint8 = 0x08 // Example: 4 bytes (t,r,b,l) or 4 shorts
+	ValTypeEnum       uint8 = 0x09 // Typically 1 byte, meaning depends on PropID
+	ValTypeVector     uint8 = 0x0A // Example: 2 shorts (x,y) -> 4 bytes
+	ValTypeCustom     uint8 = 0x0B // Application-specific binary data, often with PROP_ID_CUSTOM_DATA_BLOB
+
+	// --- Compiler Hint Types (only written as Component Definition property hints) ---
+	// These guide the KRY parser/resolver for KRY source property values.
+	ValTypeStyleID uint8 = 0x0C // KRY source: "style_name_string" -> KRB: StyleID in Element Header
+	ValTypeFloat   uint8 = 0x0D // KRY source: "0.5" -> KRB: ValTypePercentage (8.8 fixed point)
+	ValTypeInt     uint8 = 0x0E // KRY source: "100" -> KRB: ValTypeShort (or Byte if small enough)
+	ValTypeBool    uint8 = 0x0F // KRY source: "true" -> KRB: ValTypeByte (0 or 1)
+
+	ValTypeTransition uint8 = 0x10 // Count(1) + Count * (PropID(1), DurationMs(2), Easing(1))
+)
+
+// Event Types
+const (
+	EventTypeClick     uint8 = 0x01
+	EventTypePress     uint8 = 0x02 // Pointer pressed on the element
+	EventTypeRelease   uint8 = 0x03 // Pointer released on the element
+	EventTypeHover     uint8 = 0x04 // Pointer entered the element
+	EventTypeLeave     uint8 = 0x05 // Pointer left the element
+	EventTypeFocus     uint8 = 0x06
+	EventTypeBlur      uint8 = 0x07
+	EventTypeChange    uint8 = 0x08 // Input value changed
+	EventTypeSubmit    uint8 = 0x09 // Input submitted (e.g. Enter pressed)
+	EventTypeScroll    uint8 = 0x0A
+	EventTypeKeyDown   uint8 = 0x0B
+	EventTypeLongPress uint8 = 0x0C
+)
+
+// Interaction States, the states a style variant applies in
+const (
+	StateHover    uint8 = 0x01 // Pointer is over the element
+	StatePressed  uint8 = 0x02 // Pointer is held down on the element
+	StateFocused  uint8 = 0x03
+	StateDisabled uint8 = 0x04
+)
+
+// Media Features, the window conditions of a media variant. Each condition
+// compares the window with a uint16 value.
+const (
+	MediaMinWidth    uint8 = 0x01 // Window width >= value (pixels)
+	MediaMaxWidth    uint8 = 0x02 // Window width <= value
+	MediaMinHeight   uint8 = 0x03 // Window height >= value
+	MediaMaxHeight   uint8 = 0x04 // Window height <= value
+	MediaOrientation uint8 = 0x05 // Value is an Orientation*
+)
+
+// Window Orientations, compared by MediaOrientation
+const (
+	OrientationPortrait  uint16 = 0 // Height >= width
+	OrientationLandscape uint16 = 1 // Width > height
+)
+
+// Animation Easing Functions
+const (
+	EasingLinear    uint8 = 0x00
+	EasingEase      uint8 = 0x01
+	EasingEaseIn    uint8 = 0x02
+	EasingEaseOut   uint8 = 0x03
+	EasingEaseInOut uint8 = 0x04
+)
+
+// Animation Triggers, stored in each element's animation references
+const (
+	AnimTriggerLoad  uint8 = 0x00 // Plays once the element is shown
+	AnimTriggerHover uint8 = 0x01
+	AnimTriggerPress uint8 = 0x02
+	AnimTriggerFocus uint8 = 0x03
+)
+
+// AnimIterationsInfinite is the iteration count of an animation that repeats
+// forever.
+const AnimIterationsInfinite uint8 = 0
+
+// Layout Byte Bit Definitions
+const (
+	LayoutDirectionMask     uint8 = 0x03 // Bits 0-1
+	LayoutDirectionRow      uint8 = 0
+	LayoutDirectionColumn   uint8 = 1
+	LayoutDirectionRowRev   uint8 = 2
+	LayoutDirectionColRev   uint8 = 3
+	LayoutAlignmentMask     uint8 = 0x0C // Bits 2-3
+	LayoutAlignmentStart    uint8 = (0 << 2)
+	LayoutAlignmentCenter   uint8 = (1 << 2)
+	LayoutAlignmentEnd      uint8 = (2 << 2)
+	LayoutAlignmentSpaceBtn uint8 = (3 << 2)
+	LayoutWrapBit           uint8 = (1 << 4) // Bit 4
+	LayoutGrowBit           uint8 = (1 << 5) // Bit 5
+	LayoutAbsoluteBit       uint8 = (1 << 6) // Bit 6
+	// Bit 7: Reserved
+)
+
+// Resource Types & Formats
+const (
+	ResTypeImage      uint8 = 0x01
+	ResTypeFont       uint8 = 0x02
+	ResTypeSound      uint8 = 0x03
+	ResTypeVideo      uint8 = 0x04
+	ResTypeCustom     uint8 = 0x05
+	ResFormatExternal uint8 = 0x00 // Data is string index to path
+	ResFormatInline   uint8 = 0x01 // Data is size (uint32) + raw bytes
+)
@@ -0,0 +1,277 @@
+// krb.go
+// Package krb describes the KRB binary format produced by kryc and provides a
+// decoder that rebuilds a typed object model from encoded KRB files.
+package krb
+
+import "encoding/binary"
+
+// --- Object Model ---
+
+// Header mirrors the fixed-size KRB file header.
+type Header struct {
+	Magic        [4]byte
+	VersionMajor uint8
+	VersionMinor uint8
+	Flags        uint16
+
+	ElementCount      uint16 // Main UI tree elements only; template elements live in ComponentDefs
+	StyleCount        uint16
+	ComponentDefCount uint16
+	AnimationCount    uint16
+	StringCount       uint16
+	ResourceCount     uint16
+
+	ElementOffset      uint32
+	StyleOffset        uint32
+	ComponentDefOffset uint32
+	AnimationOffset    uint32
+	StringOffset       uint32
+	ResourceOffset     uint32
+	TotalSize          uint32
+}
+
+// WideIndices reports whether string, resource and style references are
+// 16-bit, as they are from v0.5 on.
+func (h *Header) WideIndices() bool {
+	return h.VersionMajor > 0 || h.VersionMinor > VersionMinorNarrow
+}
+
+// HasFlag reports whether every bit in flag is set in the header flags.
+func (h *Header) HasFlag(flag uint16) bool {
+	return h.Flags&flag == flag
+}
+
+// Property is a standard property attached to an element or style.
+type Property struct {
+	ID        uint8
+	ValueType uint8
+	Value     []byte
+}
+
+// CustomProperty is a property keyed by a string table index instead of a PropID.
+type CustomProperty struct {
+	KeyIndex  uint16 // String table index of the property name
+	ValueType uint8
+	Value     []byte
+}
+
+// Event binds an event type to a callback name in the string table.
+type Event struct {
+	Type          uint8
+	CallbackIndex uint16 // String table index of the callback name
+}
+
+// AnimationRef links an element to an entry of the animation table.
+type AnimationRef struct {
+	AnimationIndex uint16
+	Trigger        uint8
+}
+
+// Element is a decoded element block.
+type Element struct {
+	// Offset is the position of the element header. For main tree elements it
+	// is an absolute file offset; for template elements it is relative to the
+	// start of the component definition's root template element.
+	Offset uint32
+
+	Type          uint8
+	IDStringIndex uint16
+	PosX          uint16
+	PosY          uint16
+	Width         uint16
+	Height        uint16
+	Layout        uint8
+	StyleID       uint16
+
+	Properties       []Property
+	CustomProperties []CustomProperty
+	Events           []Event
+	AnimationRefs    []AnimationRef
+	ChildOffsets     []uint32 // Raw child offsets, relative to Offset
+
+	Children []*Element // Children resolved from ChildOffsets
+}
+
+// Property returns the first standard property with the given ID.
+func (e *Element) Property(id uint8) (Property, bool) {
+	for _, p := range e.Properties {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Property{}, false
+}
+
+// Style is a decoded style block. IDs are 1-based; 0 means "no style".
+type Style struct {
+	ID         uint16
+	NameIndex  uint16
+	Properties []Property
+	Variants   []StyleVariant // From the style variant table, in state order
+	Media      []MediaVariant // From the media variant table, in table order
+}
+
+// StyleVariant holds the properties a style overrides while its element is in
+// an interaction state. Runtimes apply them on top of the style's properties
+// when the state is entered and revert them when it is left.
+type StyleVariant struct {
+	State      uint8
+	Properties []Property
+}
+
+// MediaCondition is one window condition of a media variant.
+type MediaCondition struct {
+	Feature uint8 // Media*
+	Value   uint16
+}
+
+// MediaVariant holds the properties a style overrides while the window meets
+// all of its conditions. Runtimes evaluate the conditions whenever the window
+// is resized and apply the properties of every matching variant on top of
+// the style's, in table order, so later variants win.
+type MediaVariant struct {
+	Conditions []MediaCondition
+	Properties []Property
+}
+
+// Matches reports whether a window of the given size meets every condition.
+func (v MediaVariant) Matches(width, height uint16) bool {
+	for _, c := range v.Conditions {
+		var ok bool
+		switch c.Feature {
+		case MediaMinWidth:
+			ok = width >= c.Value
+		case MediaMaxWidth:
+			ok = width <= c.Value
+		case MediaMinHeight:
+			ok = height >= c.Value
+		case MediaMaxHeight:
+			ok = height <= c.Value
+		case MediaOrientation:
+			ok = (width > height) == (c.Value == OrientationLandscape)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Keyframe is one step of an animation. Offset is the position within the
+// animation in percent (0-100).
+type Keyframe struct {
+	Offset     uint8
+	Properties []Property
+}
+
+// Animation is an entry of the animation table.
+type Animation struct {
+	NameIndex  uint16
+	DurationMs uint16
+	Easing     uint8
+	Iterations uint8 // AnimIterationsInfinite repeats forever
+	Keyframes  []Keyframe
+}
+
+// PropertyDef is a property declared in a component definition.
+type PropertyDef struct {
+	NameIndex     uint16
+	ValueTypeHint uint8
+	DefaultValue  []byte // Encoded default value; empty if none was given
+}
+
+// ComponentDef is a decoded component definition with its element template.
+type ComponentDef struct {
+	NameIndex  uint16
+	Properties []PropertyDef
+	Root       *Element
+	Template   []*Element // Every template element in encoding order, Root first
+}
+
+// Resource is an entry of the resource table.
+type Resource struct {
+	Type            uint8
+	NameIndex       uint16
+	Format          uint8
+	DataStringIndex uint16 // For ResFormatExternal: string table index of the path
+	Data            []byte // For ResFormatInline: the embedded bytes
+}
+
+// File is a fully decoded KRB file.
+type File struct {
+	Header        Header
+	Elements      []*Element // Main UI tree elements in encoding order
+	Roots         []*Element // Main tree elements that are nobody's child
+	Styles        []*Style
+	ComponentDefs []*ComponentDef
+	Animations    []*Animation
+	Strings       []string
+	Resources     []Resource
+}
+
+// String returns the string table entry at index.
+func (f *File) String(index uint16) (string, bool) {
+	if int(index) >= len(f.Strings) {
+		return "", false
+	}
+	return f.Strings[index], true
+}
+
+// Index decodes a string or resource table index stored as a property value:
+// one byte up to v0.4 and a little-endian uint16 from v0.5.
+func Index(value []byte) (uint16, bool) {
+	switch len(value) {
+	case 1:
+		return uint16(value[0]), true
+	case 2:
+		return binary.LittleEndian.Uint16(value), true
+	}
+	return 0, false
+}
+
+// Transition is one entry of a transition property value: the property to
+// interpolate when it changes, over DurationMs with the given easing.
+type Transition struct {
+	PropertyID uint8
+	DurationMs uint16
+	Easing     uint8
+}
+
+// TransitionSize is the encoded size of one Transition.
+const TransitionSize = 4
+
+// Transitions decodes a ValTypeTransition value: a count byte followed by
+// PropID(1), DurationMs(2) and Easing(1) per entry.
+func Transitions(value []byte) ([]Transition, bool) {
+	if len(value) == 0 || len(value) != 1+int(value[0])*TransitionSize {
+		return nil, false
+	}
+	ts := make([]Transition, value[0])
+	for i := range ts {
+		b := value[1+i*TransitionSize:]
+		ts[i] = Transition{PropertyID: b[0], DurationMs: binary.LittleEndian.Uint16(b[1:]), Easing: b[3]}
+	}
+	return ts, true
+}
+
+// EncodeTransitions encodes ts as a ValTypeTransition value.
+func EncodeTransitions(ts []Transition) []byte {
+	value := make([]byte, 1, 1+len(ts)*TransitionSize)
+	value[0] = uint8(len(ts))
+	for _, t := range ts {
+		value = append(value, t.PropertyID)
+		value = binary.LittleEndian.AppendUint16(value, t.DurationMs)
+		value = append(value, t.Easing)
+	}
+	return value
+}
+
+// StyleByID returns the style with the given 1-based ID, or nil.
+func (f *File) StyleByID(id uint16) *Style {
+	for _, s := range f.Styles {
+		if s.ID == id {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,443 @@
+// names.go
+package krb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// --- Symbolic Names ---
+
+var elementTypeNames = map[uint8]string{
+	ElemTypeApp:        "App",
+	ElemTypeContainer:  "Container",
+	ElemTypeText:       "Text",
+	ElemTypeImage:      "Image",
+	ElemTypeCanvas:     "Canvas",
+	ElemTypeButton:     "Button",
+	ElemTypeInput:      "Input",
+	ElemTypeList:       "List",
+	ElemTypeGrid:       "Grid",
+	ElemTypeScrollable: "Scrollable",
+	ElemTypeVideo:      "Video",
+}
+
+var propertyNames = map[uint8]string{
+	PropIDBgColor:        "bg_color",
+	PropIDFgColor:        "fg_color",
+	PropIDBorderColor:    "border_color",
+	PropIDBorderWidth:    "border_width",
+	PropIDBorderRadius:   "border_radius",
+	PropIDPadding:        "padding",
+	PropIDMargin:         "margin",
+	PropIDTextContent:    "text_content",
+	PropIDFontSize:       "font_size",
+	PropIDFontWeight:     "font_weight",
+	PropIDTextAlignment:  "text_alignment",
+	PropIDImageSource:    "image_source",
+	PropIDOpacity:        "opacity",
+	PropIDZindex:         "z_index",
+	PropIDVisibility:     "visibility",
+	PropIDGap:            "gap",
+	PropIDMinWidth:       "min_width",
+	PropIDMinHeight:      "min_height",
+	PropIDMaxWidth:       "max_width",
+	PropIDMaxHeight:      "max_height",
+	PropIDAspectRatio:    "aspect_ratio",
+	PropIDTransform:      "transform",
+	PropIDShadow:         "shadow",
+	PropIDOverflow:       "overflow",
+	PropIDCustomDataBlob: "custom_data_blob",
+	PropIDLayoutFlags:    "layout_flags",
+	PropIDTransition:     "transition",
+	PropIDWindowWidth:    "window_width",
+	PropIDWindowHeight:   "window_height",
+	PropIDWindowTitle:    "window_title",
+	PropIDResizable:      "resizable",
+	PropIDKeepAspect:     "keep_aspect",
+	PropIDScaleFactor:    "scale_factor",
+	PropIDIcon:           "icon",
+	PropIDVersion:        "version",
+	PropIDAuthor:         "author",
+}
+
+var valueTypeNames = map[uint8]string{
+	ValTypeNone:       "none",
+	ValTypeByte:       "byte",
+	ValTypeShort:      "short",
+	ValTypeColor:      "color",
+	ValTypeString:     "string",
+	ValTypeResource:   "resource",
+	ValTypePercentage: "percentage",
+	ValTypeRect:       "rect",
+	ValTypeEdgeInsets: "edge_insets",
+	ValTypeEnum:       "enum",
+	ValTypeVector:     "vector",
+	ValTypeCustom:     "custom",
+	ValTypeStyleID:    "style_id",
+	ValTypeFloat:      "float",
+	ValTypeInt:        "int",
+	ValTypeBool:       "bool",
+	ValTypeTransition: "transition",
+}
+
+var eventTypeNames = map[uint8]string{
+	EventTypeClick:     "click",
+	EventTypePress:     "press",
+	EventTypeRelease:   "release",
+	EventTypeHover:     "hover",
+	EventTypeLeave:     "leave",
+	EventTypeFocus:     "focus",
+	EventTypeBlur:      "blur",
+	EventTypeChange:    "change",
+	EventTypeSubmit:    "submit",
+	EventTypeScroll:    "scroll",
+	EventTypeKeyDown:   "key_down",
+	EventTypeLongPress: "long_press",
+}
+
+var easingNames = map[uint8]string{
+	EasingLinear:    "linear",
+	EasingEase:      "ease",
+	EasingEaseIn:    "ease_in",
+	EasingEaseOut:   "ease_out",
+	EasingEaseInOut: "ease_in_out",
+}
+
+var animTriggerNames = map[uint8]string{
+	AnimTriggerLoad:  "load",
+	AnimTriggerHover: "hover",
+	AnimTriggerPress: "press",
+	AnimTriggerFocus: "focus",
+}
+
+var stateNames = map[uint8]string{
+	StateHover:    "hover",
+	StatePressed:  "pressed",
+	StateFocused:  "focused",
+	StateDisabled: "disabled",
+}
+
+var mediaFeatureNames = map[uint8]string{
+	MediaMinWidth:    "min_width",
+	MediaMaxWidth:    "max_width",
+	MediaMinHeight:   "min_height",
+	MediaMaxHeight:   "max_height",
+	MediaOrientation: "orientation",
+}
+
+var orientationNames = map[uint16]string{
+	OrientationPortrait:  "portrait",
+	OrientationLandscape: "landscape",
+}
+
+var resourceTypeNames = map[uint8]string{
+	ResTypeImage:  "image",
+	ResTypeFont:   "font",
+	ResTypeSound:  "sound",
+	ResTypeVideo:  "video",
+	ResTypeCustom: "custom",
+}
+
+func nameOr(names map[uint8]string, v uint8) string {
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02X", v)
+}
+
+// ElementTypeName returns the KRY element name for t, "Custom(0xNN)" for
+// custom types, or the hex value if t is unknown.
+func ElementTypeName(t uint8) string {
+	if name, ok := elementTypeNames[t]; ok {
+		return name
+	}
+	if t >= ElemTypeCustomBase {
+		return fmt.Sprintf("Custom(0x%02X)", t)
+	}
+	return fmt.Sprintf("0x%02X", t)
+}
+
+// ElementTypeByName returns the element type for a standard KRY element name.
+func ElementTypeByName(name string) (uint8, bool) {
+	for t, n := range elementTypeNames {
+		if n == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// ElementNames returns the standard KRY element names in sorted order.
+func ElementNames() []string {
+	names := make([]string, 0, len(elementTypeNames))
+	for _, n := range elementTypeNames {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PropertyName returns the name of a standard property ID.
+func PropertyName(id uint8) string { return nameOr(propertyNames, id) }
+
+// ValueTypeName returns the name of a value type.
+func ValueTypeName(t uint8) string { return nameOr(valueTypeNames, t) }
+
+// EventTypeName returns the name of an event type.
+func EventTypeName(t uint8) string { return nameOr(eventTypeNames, t) }
+
+// EventTypeByName returns the event type with the given name.
+func EventTypeByName(name string) (uint8, bool) { return valueByName(eventTypeNames, name) }
+
+// ResourceTypeName returns the name of a resource type.
+func ResourceTypeName(t uint8) string { return nameOr(resourceTypeNames, t) }
+
+// ResourceTypeByName returns the resource type with the given name.
+func ResourceTypeByName(name string) (uint8, bool) { return valueByName(resourceTypeNames, name) }
+
+// EasingName returns the KRY name of an easing function.
+func EasingName(e uint8) string { return nameOr(easingNames, e) }
+
+// AnimationTriggerName returns the KRY name of an animation trigger.
+func AnimationTriggerName(t uint8) string { return nameOr(animTriggerNames, t) }
+
+// EasingByName returns the easing function with the given KRY name.
+func EasingByName(name string) (uint8, bool) { return valueByName(easingNames, name) }
+
+// AnimationTriggerByName returns the animation trigger with the given KRY name.
+func AnimationTriggerByName(name string) (uint8, bool) { return valueByName(animTriggerNames, name) }
+
+// EventTypeNames returns the event type names in sorted order.
+func EventTypeNames() []string {
+	names := make([]string, 0, len(eventTypeNames))
+	for _, n := range eventTypeNames {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StateName returns the KRY name of an interaction state.
+func StateName(s uint8) string { return nameOr(stateNames, s) }
+
+// StateByName returns the interaction state with the given KRY name.
+func StateByName(name string) (uint8, bool) { return valueByName(stateNames, name) }
+
+// StateNames returns the KRY interaction state names in sorted order.
+func StateNames() []string {
+	names := make([]string, 0, len(stateNames))
+	for _, n := range stateNames {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MediaFeatureName returns the KRY name of a media feature.
+func MediaFeatureName(m uint8) string { return nameOr(mediaFeatureNames, m) }
+
+// MediaFeatureByName returns the media feature with the given KRY name.
+func MediaFeatureByName(name string) (uint8, bool) { return valueByName(mediaFeatureNames, name) }
+
+// MediaFeatureNames returns the KRY media feature names in sorted order.
+func MediaFeatureNames() []string {
+	names := make([]string, 0, len(mediaFeatureNames))
+	for _, n := range mediaFeatureNames {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OrientationByName returns the window orientation with the given KRY name.
+func OrientationByName(name string) (uint16, bool) {
+	for v, n := range orientationNames {
+		if n == name {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// OrientationNames returns the KRY window orientation names in sorted order.
+func OrientationNames() []string {
+	names := make([]string, 0, len(orientationNames))
+	for _, n := range orientationNames {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FormatMediaQuery renders conditions as a KRY @media query, such as
+// "(min_width: 600) and (orientation: landscape)".
+func FormatMediaQuery(conds []MediaCondition) string {
+	parts := make([]string, len(conds))
+	for i, c := range conds {
+		value := fmt.Sprint(c.Value)
+		if c.Feature == MediaOrientation {
+			if name, ok := orientationNames[c.Value]; ok {
+				value = name
+			}
+		}
+		parts[i] = fmt.Sprintf("(%s: %s)", MediaFeatureName(c.Feature), value)
+	}
+	return strings.Join(parts, " and ")
+}
+
+// AnimationTriggerNames returns the KRY animation trigger names in sorted order.
+func AnimationTriggerNames() []string {
+	names := make([]string, 0, len(animTriggerNames))
+	for _, n := range animTriggerNames {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func valueByName(names map[uint8]string, name string) (uint8, bool) {
+	for v, n := range names {
+		if n == name {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// LayoutString decodes a layout byte into the words accepted by the KRY
+// `layout` property, e.g. "row center wrap".
+func LayoutString(layout uint8) string {
+	var parts []string
+	switch layout & LayoutDirectionMask {
+	case LayoutDirectionRow:
+		parts = append(parts, "row")
+	case LayoutDirectionColumn:
+		parts = append(parts, "column")
+	case LayoutDirectionRowRev:
+		parts = append(parts, "row_rev")
+	case LayoutDirectionColRev:
+		parts = append(parts, "col_rev")
+	}
+	switch layout & LayoutAlignmentMask {
+	case LayoutAlignmentStart:
+		parts = append(parts, "start")
+	case LayoutAlignmentCenter:
+		parts = append(parts, "center")
+	case LayoutAlignmentEnd:
+		parts = append(parts, "end")
+	case LayoutAlignmentSpaceBtn:
+		parts = append(parts, "space_between")
+	}
+	if layout&LayoutWrapBit != 0 {
+		parts = append(parts, "wrap")
+	}
+	if layout&LayoutGrowBit != 0 {
+		parts = append(parts, "grow")
+	}
+	if layout&LayoutAbsoluteBit != 0 {
+		parts = append(parts, "absolute")
+	}
+	return strings.Join(parts, " ")
+}
+
+// --- Value Formatting ---
+
+// HintValueType returns the value type used to encode values declared with a
+// component property hint (e.g. Int values are stored as shorts).
+func HintValueType(hint uint8) uint8 {
+	switch hint {
+	case ValTypeString, ValTypeStyleID, ValTypeResource, ValTypeEnum:
+		return ValTypeString
+	case ValTypeInt:
+		return ValTypeShort
+	case ValTypeBool:
+		return ValTypeByte
+	case ValTypeFloat:
+		return ValTypePercentage
+	}
+	return hint
+}
+
+// FormatValue renders an encoded value as text. String and resource indices
+// are resolved against f when it is non-nil.
+func FormatValue(f *File, valueType uint8, value []byte) string {
+	switch valueType {
+	case ValTypeNone:
+		return ""
+	case ValTypeByte, ValTypeEnum:
+		if len(value) == 1 {
+			return fmt.Sprintf("%d", value[0])
+		}
+	case ValTypeShort:
+		if len(value) == 2 {
+			return fmt.Sprintf("%d", binary.LittleEndian.Uint16(value))
+		}
+	case ValTypeColor:
+		if len(value) == 4 {
+			return fmt.Sprintf("#%02X%02X%02X%02X", value[0], value[1], value[2], value[3])
+		}
+		if len(value) == 1 {
+			return fmt.Sprintf("palette(%d)", value[0])
+		}
+	case ValTypeString:
+		if index, ok := Index(value); ok {
+			if s, ok := f.stringAt(index); ok {
+				return fmt.Sprintf("%q", s)
+			}
+			return fmt.Sprintf("string[%d]", index)
+		}
+	case ValTypeResource:
+		if index, ok := Index(value); ok {
+			if f != nil && int(index) < len(f.Resources) {
+				res := f.Resources[index]
+				if s, ok := f.stringAt(res.DataStringIndex); ok && res.Format == ResFormatExternal {
+					return fmt.Sprintf("resource[%d] %q", index, s)
+				}
+				if s, ok := f.stringAt(res.NameIndex); ok && res.Format == ResFormatInline {
+					return fmt.Sprintf("resource[%d] %q (inline, %d bytes)", index, s, len(res.Data))
+				}
+			}
+			return fmt.Sprintf("resource[%d]", index)
+		}
+	case ValTypePercentage:
+		if len(value) == 2 {
+			return fmt.Sprintf("%g", float64(binary.LittleEndian.Uint16(value))/256)
+		}
+	case ValTypeEdgeInsets:
+		if len(value) == 4 {
+			return fmt.Sprintf("%d %d %d %d", value[0], value[1], value[2], value[3])
+		}
+	case ValTypeRect:
+		if len(value) == 8 {
+			return fmt.Sprintf("%d %d %d %d", binary.LittleEndian.Uint16(value[0:]), binary.LittleEndian.Uint16(value[2:]),
+				binary.LittleEndian.Uint16(value[4:]), binary.LittleEndian.Uint16(value[6:]))
+		}
+	case ValTypeVector:
+		if len(value) == 4 {
+			return fmt.Sprintf("%d %d", binary.LittleEndian.Uint16(value[0:]), binary.LittleEndian.Uint16(value[2:]))
+		}
+	case ValTypeTransition:
+		if ts, ok := Transitions(value); ok {
+			if len(ts) == 0 {
+				return "none"
+			}
+			items := make([]string, len(ts))
+			for i, t := range ts {
+				items[i] = fmt.Sprintf("%s %dms %s", PropertyName(t.PropertyID), t.DurationMs, EasingName(t.Easing))
+			}
+			return strings.Join(items, ", ")
+		}
+	}
+	return fmt.Sprintf("% X", value)
+}
+
+// stringAt is String that tolerates a nil File.
+func (f *File) stringAt(index uint16) (string, bool) {
+	if f == nil {
+		return "", false
+	}
+	return f.String(index)
+}
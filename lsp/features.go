@@ -0,0 +1,355 @@
+// features.go
+package lsp
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/waozixyz/kryc"
+	"github.com/waozixyz/kryc/krb"
+)
+
+// --- Documents ---
+
+func (doc *document) setText(text string) {
+	doc.text = text
+	doc.lines = strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
+
+// line returns the text of a 0-based line, or "" past the end.
+func (doc *document) line(n int) string {
+	if n < 0 || n >= len(doc.lines) {
+		return ""
+	}
+	return doc.lines[n]
+}
+
+// symbolsOf returns the document's symbols of one kind, first definition wins.
+func (doc *document) symbolsOf(kind kryc.SymbolKind) []kryc.Symbol {
+	var out []kryc.Symbol
+	seen := make(map[string]bool)
+	for _, sym := range doc.symbols {
+		if sym.Kind == kind && !seen[sym.Name] {
+			seen[sym.Name] = true
+			out = append(out, sym)
+		}
+	}
+	return out
+}
+
+// lookup returns the last definition of name, matching the compiler where a
+// later style or variable overrides an earlier one.
+func (doc *document) lookup(kind kryc.SymbolKind, name string) (kryc.Symbol, bool) {
+	for i := len(doc.symbols) - 1; i >= 0; i-- {
+		if sym := doc.symbols[i]; sym.Kind == kind && sym.Name == name {
+			return sym, true
+		}
+	}
+	return kryc.Symbol{}, false
+}
+
+// --- Completion ---
+
+var (
+	variablePrefix  = regexp.MustCompile(`\$([A-Za-z0-9_]*)$`)
+	resourcePrefix  = regexp.MustCompile(`\$res\.([A-Za-z0-9_]*)$`)
+	styleValueLine  = regexp.MustCompile(`(?:^|[{;])\s*(?:style|extends|bar_style)\s*:\s*[^:;{}]*$`)
+	animValueLine   = regexp.MustCompile(`(?:^|[{;])\s*animation\s*:\s*[^:;{}]*$`)
+	eventValueLine  = regexp.MustCompile(`(?:^|[{;])\s*on[A-Z_][A-Za-z_]*\s*:\s*[^:;{}]*$`)
+	stateHeadLine   = regexp.MustCompile(`(?:^|[{;])\s*state\s+[a-z]*$`)
+	mediaQueryLine  = regexp.MustCompile(`(?:^|[{;])\s*@media\b[^{}]*\(\s*[a-z_]*$`)
+	mediaValueLine  = regexp.MustCompile(`(?:^|[{;])\s*@media\b[^{}]*\(\s*orientation\s*:\s*[a-z]*$`)
+	propertyKeyLine = regexp.MustCompile(`:\s*[^;{}]*$`)
+)
+
+// completion suggests variables after '$', resources after '$res.', style names in style values,
+// animation names and triggers in animation values, callbacks in event
+// handler values, states after 'state', media features and orientations in
+// @media queries, element and component names where a block may start, and
+// property keys.
+func (doc *document) completion(pos position) []completionItem {
+	text := doc.line(pos.Line)
+	prefix := text[:byteOffset(text, pos.Character)]
+
+	items := []completionItem{}
+	if resourcePrefix.MatchString(prefix) {
+		for _, sym := range doc.symbolsOf(kryc.SymbolResource) {
+			items = append(items, completionItem{Label: sym.Name, Kind: completionVariable, Detail: sym.Detail})
+		}
+		return items
+	}
+	if variablePrefix.MatchString(prefix) {
+		for _, sym := range doc.symbolsOf(kryc.SymbolVariable) {
+			items = append(items, completionItem{Label: sym.Name, Kind: completionVariable, Detail: sym.Detail})
+		}
+		return items
+	}
+	if styleValueLine.MatchString(prefix) {
+		for _, sym := range doc.symbolsOf(kryc.SymbolStyle) {
+			items = append(items, completionItem{Label: sym.Name, Kind: completionClass, Detail: "style"})
+		}
+		return items
+	}
+	if animValueLine.MatchString(prefix) {
+		for _, sym := range doc.symbolsOf(kryc.SymbolAnimation) {
+			items = append(items, completionItem{Label: sym.Name, Kind: completionClass, Detail: "animation"})
+		}
+		for _, name := range krb.AnimationTriggerNames() {
+			items = append(items, completionItem{Label: name, Kind: completionKeyword, Detail: "animation trigger"})
+		}
+		return items
+	}
+	if eventValueLine.MatchString(prefix) {
+		for _, sym := range doc.symbolsOf(kryc.SymbolCallback) {
+			items = append(items, completionItem{Label: sym.Name, Kind: completionFunction, Detail: "callback (" + sym.Detail + ")"})
+		}
+		return items
+	}
+	if stateHeadLine.MatchString(prefix) {
+		for _, name := range krb.StateNames() {
+			items = append(items, completionItem{Label: name, Kind: completionKeyword, Detail: "interaction state"})
+		}
+		return items
+	}
+	if mediaQueryLine.MatchString(prefix) {
+		for _, name := range krb.MediaFeatureNames() {
+			items = append(items, completionItem{Label: name, Kind: completionKeyword, Detail: "media feature"})
+		}
+		return items
+	}
+	if mediaValueLine.MatchString(prefix) {
+		for _, name := range krb.OrientationNames() {
+			items = append(items, completionItem{Label: name, Kind: completionKeyword, Detail: "window orientation"})
+		}
+		return items
+	}
+	if propertyKeyLine.MatchString(prefix) {
+		return items // Other property values have no completions
+	}
+
+	word, ok := wordBefore(prefix)
+	if !ok {
+		return items
+	}
+	if word == "" || unicode.IsUpper(rune(word[0])) {
+		for _, name := range krb.ElementNames() {
+			typ, _ := krb.ElementTypeByName(name)
+			items = append(items, completionItem{Label: name, Kind: completionClass, Detail: fmt.Sprintf("element 0x%02X", typ)})
+		}
+		for _, sym := range doc.symbolsOf(kryc.SymbolComponent) {
+			items = append(items, completionItem{Label: sym.Name, Kind: completionClass, Detail: "component"})
+		}
+	}
+	if word == "" || !unicode.IsUpper(rune(word[0])) {
+		for _, info := range kryc.Properties() {
+			item := completionItem{Label: info.Key, Kind: completionProperty, Detail: propertyDetail(info), InsertText: info.Key + ": "}
+			if info.Event {
+				item.Kind = completionEvent
+			}
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// propertyDetail describes how a property key is encoded.
+func propertyDetail(info kryc.PropertyInfo) string {
+	switch {
+	case info.Event:
+		return fmt.Sprintf("event handler (callback name), event type 0x%02X (%s)", info.EventType, krb.EventTypeName(info.EventType))
+	case info.Animation:
+		return "animation references (@animation names, each with an optional trigger)"
+	case info.PropID == 0:
+		return "element header field"
+	}
+	detail := fmt.Sprintf("PropID 0x%02X (%s), value type %s", info.PropID, krb.PropertyName(info.PropID), krb.ValueTypeName(info.ValueType))
+	if info.AppOnly {
+		detail += ", App only"
+	}
+	return detail
+}
+
+// --- Definition and Hover ---
+
+// reference is the identifier under the cursor and what it may refer to.
+type reference struct {
+	word     string
+	start    int  // Byte offset of word within its line
+	variable bool // Preceded by '$'
+	resource bool // Preceded by '$res.'
+	quoted   bool // Inside a string on a style/extends/bar_style line
+	anim     bool // Inside a string on an animation line
+	callback bool // Inside a string on an event handler line
+	key      bool // Followed by ':' outside a string
+}
+
+func (doc *document) referenceAt(pos position) (reference, bool) {
+	text := doc.line(pos.Line)
+	off := byteOffset(text, pos.Character)
+	start, end := off, off
+	for start > 0 && isWordByte(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isWordByte(text[end]) {
+		end++
+	}
+	if start == end {
+		return reference{}, false
+	}
+	ref := reference{word: text[start:end], start: start}
+	ref.variable = start > 0 && text[start-1] == '$'
+	ref.resource = strings.HasSuffix(text[:start], "$res.")
+	inString := strings.Count(text[:start], `"`)%2 == 1
+	ref.quoted = inString && styleValueLine.MatchString(text[:start])
+	ref.anim = inString && animValueLine.MatchString(text[:start])
+	ref.callback = inString && eventValueLine.MatchString(text[:start])
+	ref.key = !inString && strings.HasPrefix(strings.TrimSpace(text[end:]), ":")
+	return ref, true
+}
+
+// definition resolves the variable, resource, style, animation, callback or
+// component under the cursor.
+func (doc *document) definition(pos position) *location {
+	ref, ok := doc.referenceAt(pos)
+	if !ok {
+		return nil
+	}
+	sym, ok := doc.resolve(ref)
+	if !ok {
+		return nil
+	}
+	return &location{URI: pathToURI(sym.File), Range: doc.symbolRange(sym)}
+}
+
+// symbolRange locates a symbol's name. Symbols in other files are assumed to
+// have ASCII text before the name since only this document's text is known.
+func (doc *document) symbolRange(sym kryc.Symbol) lspRange {
+	text := strings.Repeat(" ", max(sym.Column-1, 0)) + sym.Name
+	if filepath.Clean(sym.File) == filepath.Clean(doc.path) {
+		text = doc.line(sym.Line - 1)
+	}
+	return tokenRange(sym.Line, sym.Column, text)
+}
+
+func (doc *document) resolve(ref reference) (kryc.Symbol, bool) {
+	switch {
+	case ref.variable:
+		return doc.lookup(kryc.SymbolVariable, ref.word)
+	case ref.resource:
+		return doc.lookup(kryc.SymbolResource, ref.word)
+	case ref.quoted:
+		return doc.lookup(kryc.SymbolStyle, ref.word)
+	case ref.anim:
+		return doc.lookup(kryc.SymbolAnimation, ref.word)
+	case ref.callback:
+		return doc.lookup(kryc.SymbolCallback, ref.word)
+	case ref.key:
+		return kryc.Symbol{}, false
+	}
+	return doc.lookup(kryc.SymbolComponent, ref.word)
+}
+
+// hover documents property keys, element names and user definitions.
+func (doc *document) hover(pos position) *hover {
+	ref, ok := doc.referenceAt(pos)
+	if !ok {
+		return nil
+	}
+	var value string
+	if sym, ok := doc.resolve(ref); ok {
+		value = fmt.Sprintf("%s `%s`", sym.Kind, sym.Name)
+		if sym.Kind == kryc.SymbolVariable {
+			value = fmt.Sprintf("variable `$%s` = `%s`", sym.Name, sym.Detail)
+		} else if sym.Kind == kryc.SymbolResource {
+			value = fmt.Sprintf("resource `$res.%s`: `%s`", sym.Name, sym.Detail)
+		} else if sym.Kind == kryc.SymbolCallback {
+			value = fmt.Sprintf("callback `%s` for `%s` events", sym.Name, sym.Detail)
+		}
+		value += fmt.Sprintf("\n\nDefined at %s:%d", filepath.Base(sym.File), sym.Line)
+	} else if info, ok := kryc.LookupProperty(ref.word); ok && ref.key {
+		value = fmt.Sprintf("property `%s`\n\n%s", info.Key, propertyDetail(info))
+	} else if typ, ok := krb.ElementTypeByName(ref.word); ok && !ref.key && !ref.quoted && !ref.anim && !ref.callback {
+		value = fmt.Sprintf("element `%s`\n\nType 0x%02X", ref.word, typ)
+	} else {
+		return nil
+	}
+
+	text := doc.line(pos.Line)
+	r := lspRange{
+		Start: position{Line: pos.Line, Character: utf16Len(text[:ref.start])},
+		End:   position{Line: pos.Line, Character: utf16Len(text[:ref.start+len(ref.word)])},
+	}
+	return &hover{Contents: markupContent{Kind: "markdown", Value: value}, Range: &r}
+}
+
+// --- Positions ---
+// The compiler reports 1-based lines and byte columns; LSP positions are
+// 0-based with characters counted in UTF-16 code units.
+
+// tokenRange converts a 1-based line and byte column to a range covering the
+// identifier starting there, or the rest of text if there is none.
+func tokenRange(line, column int, text string) lspRange {
+	if line < 1 {
+		return lspRange{}
+	}
+	start := column - 1
+	if start < 0 || start > len(text) {
+		start = 0
+	}
+	end := start
+	for end < len(text) && isWordByte(text[end]) {
+		end++
+	}
+	if end == start {
+		end = len(text)
+	}
+	return lspRange{
+		Start: position{Line: line - 1, Character: utf16Len(text[:start])},
+		End:   position{Line: line - 1, Character: utf16Len(text[:end])},
+	}
+}
+
+// byteOffset converts a UTF-16 character offset within s to a byte offset.
+func byteOffset(s string, character int) int {
+	units := 0
+	for i, r := range s {
+		if units >= character {
+			return i
+		}
+		units += utf16.RuneLen(r)
+	}
+	return len(s)
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		n += utf16.RuneLen(r)
+		s = s[size:]
+	}
+	return n
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b == '-' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// wordBefore returns the identifier ending at the end of prefix and whether
+// it is in key position: first on the line or following '{' or ';'.
+func wordBefore(prefix string) (string, bool) {
+	start := len(prefix)
+	for start > 0 && isWordByte(prefix[start-1]) {
+		start--
+	}
+	before := strings.TrimSpace(prefix[:start])
+	if before != "" && !strings.HasSuffix(before, "{") && !strings.HasSuffix(before, ";") {
+		return "", false
+	}
+	return prefix[start:], true
+}
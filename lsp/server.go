@@ -0,0 +1,336 @@
+// server.go
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/waozixyz/kryc"
+)
+
+// --- Server ---
+
+// Server is a KRY language server speaking LSP over a pair of streams.
+type Server struct {
+	in     *bufio.Reader
+	out    io.Writer
+	logger *log.Logger // Destination for server errors; nil discards them
+
+	docs        map[string]*document // Open documents keyed by URI
+	initialized bool
+	shutdown    bool
+}
+
+// document is an open KRY file and the results of its last compilation.
+type document struct {
+	uri     string
+	path    string
+	text    string
+	lines   []string
+	symbols []kryc.Symbol
+	related []string // Paths of other files that received diagnostics from this document
+}
+
+// NewServer returns a server reading requests from in and writing responses
+// and notifications to out.
+func NewServer(in io.Reader, out io.Writer, logger *log.Logger) *Server {
+	return &Server{
+		in:     bufio.NewReader(in),
+		out:    out,
+		logger: logger,
+		docs:   make(map[string]*document),
+	}
+}
+
+// Serve handles messages until the client sends "exit", in closes or ctx is
+// cancelled.
+func (s *Server) Serve(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		body, err := readMessage(s.in)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("reading message: %w", err)
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit received before shutdown")
+			}
+			return nil
+		}
+		result, rerr := s.handle(ctx, &msg)
+		if msg.ID != nil { // Requests get a response; notifications do not
+			s.reply(msg.ID, result, rerr)
+		} else if rerr != nil {
+			s.logf("%s: %s", msg.Method, rerr.Message)
+		}
+	}
+}
+
+// handle dispatches one request or notification.
+func (s *Server) handle(ctx context.Context, msg *message) (interface{}, *responseError) {
+	if !s.initialized && msg.Method != "initialize" {
+		if msg.ID == nil {
+			return nil, nil // Notifications before initialize are dropped
+		}
+		return nil, &responseError{Code: codeServerNotInitialized, Message: "server not initialized"}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		s.initialized = true
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // Full document text on every change
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{"$", "\""}},
+				"definitionProvider": true,
+				"hoverProvider":      true,
+			},
+			"serverInfo": map[string]string{"name": "kryc"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc := &document{uri: p.TextDocument.URI, path: uriToPath(p.TextDocument.URI)}
+		doc.setText(p.TextDocument.Text)
+		s.docs[doc.uri] = doc
+		s.check(ctx, doc)
+		return nil, nil
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc, ok := s.docs[p.TextDocument.URI]
+		if !ok || len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		doc.setText(p.ContentChanges[len(p.ContentChanges)-1].Text)
+		s.check(ctx, doc)
+		return nil, nil
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		if doc, ok := s.docs[p.TextDocument.URI]; ok {
+			delete(s.docs, doc.uri)
+			s.publish(doc.uri, nil)
+			for _, path := range doc.related {
+				s.publish(pathToURI(path), nil)
+			}
+		}
+		return nil, nil
+	case "textDocument/didSave":
+		return nil, nil
+
+	case "textDocument/completion":
+		doc, pos, rerr := s.positionParams(msg.Params)
+		if rerr != nil {
+			return nil, rerr
+		}
+		return doc.completion(pos), nil
+	case "textDocument/definition":
+		doc, pos, rerr := s.positionParams(msg.Params)
+		if rerr != nil {
+			return nil, rerr
+		}
+		if loc := doc.definition(pos); loc != nil {
+			return loc, nil
+		}
+		return nil, nil
+	case "textDocument/hover":
+		doc, pos, rerr := s.positionParams(msg.Params)
+		if rerr != nil {
+			return nil, rerr
+		}
+		if h := doc.hover(pos); h != nil {
+			return h, nil
+		}
+		return nil, nil
+	}
+
+	if msg.ID == nil || strings.HasPrefix(msg.Method, "$/") {
+		return nil, nil // Unknown notifications and optional requests are ignored
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+// positionParams decodes the document and position of a request.
+func (s *Server) positionParams(params json.RawMessage) (*document, position, *responseError) {
+	var p textDocumentPositionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, position{}, invalidParams(err)
+	}
+	doc, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, position{}, &responseError{Code: codeInvalidParams, Message: "document not open: " + p.TextDocument.URI}
+	}
+	return doc, p.Position, nil
+}
+
+// --- Diagnostics ---
+
+// check compiles doc, with every open document available to @include, and
+// publishes the resulting diagnostics.
+func (s *Server) check(ctx context.Context, doc *document) {
+	sources := make(map[string][]byte, len(s.docs))
+	for _, d := range s.docs {
+		sources[d.path] = []byte(d.text)
+	}
+	result, err := kryc.Compile(ctx, kryc.Options{Filename: doc.path, Sources: sources, MaxErrors: -1})
+	if result == nil {
+		s.logf("compiling %s: %v", doc.path, err)
+		return
+	}
+	doc.symbols = result.Symbols
+
+	byPath := map[string][]diagnostic{filepath.Clean(doc.path): {}}
+	for _, d := range result.Diagnostics {
+		path := doc.path
+		if d.File != "" {
+			path = d.File
+		}
+		path = filepath.Clean(path)
+		byPath[path] = append(byPath[path], s.toDiagnostic(d))
+	}
+
+	// Clear files that had diagnostics from the previous run but not this one.
+	for _, path := range doc.related {
+		if _, ok := byPath[path]; !ok {
+			s.publish(pathToURI(path), nil)
+		}
+	}
+	doc.related = doc.related[:0]
+	for path, diags := range byPath {
+		uri := pathToURI(path)
+		if path == filepath.Clean(doc.path) {
+			uri = doc.uri
+		} else {
+			doc.related = append(doc.related, path)
+		}
+		s.publish(uri, diags)
+	}
+}
+
+// toDiagnostic converts a compiler diagnostic to its LSP form.
+func (s *Server) toDiagnostic(d kryc.Diagnostic) diagnostic {
+	out := diagnostic{
+		Range:    tokenRange(d.Line, d.Column, d.Snippet),
+		Severity: severityInformation,
+		Code:     d.Code,
+		Source:   "kryc",
+		Message:  d.Message,
+	}
+	switch d.Severity {
+	case kryc.SeverityError:
+		out.Severity = severityError
+	case kryc.SeverityWarning:
+		out.Severity = severityWarning
+	}
+	for _, r := range d.Related {
+		out.RelatedInformation = append(out.RelatedInformation, diagnosticRelatedInformation{
+			Location: location{URI: pathToURI(r.File), Range: tokenRange(r.Line, r.Column, s.lineText(r.File, r.Line))},
+			Message:  r.Message,
+		})
+	}
+	return out
+}
+
+// lineText returns a 1-based line of an open document, or "" if the file is
+// not open.
+func (s *Server) lineText(path string, line int) string {
+	for _, d := range s.docs {
+		if filepath.Clean(d.path) == filepath.Clean(path) && line > 0 && line <= len(d.lines) {
+			return d.lines[line-1]
+		}
+	}
+	return ""
+}
+
+func (s *Server) publish(uri string, diags []diagnostic) {
+	if diags == nil {
+		diags = []diagnostic{}
+	}
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diags})
+}
+
+// --- Output ---
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rerr *responseError) {
+	msg := &message{ID: id, Error: rerr}
+	if rerr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			msg.Error = &responseError{Code: codeInvalidParams, Message: err.Error()}
+		} else {
+			msg.Result = data
+		}
+	}
+	if err := writeMessage(s.out, msg); err != nil {
+		s.logf("writing response: %v", err)
+	}
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		s.logf("encoding %s: %v", method, err)
+		return
+	}
+	if err := writeMessage(s.out, &message{Method: method, Params: data}); err != nil {
+		s.logf("writing %s: %v", method, err)
+	}
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Printf(format, args...)
+	}
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+// --- URIs ---
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
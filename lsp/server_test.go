@@ -0,0 +1,215 @@
+// server_test.go
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+const testURI = "file:///work/main.kry"
+
+const testSource = `@variables {
+    pad: 8
+}
+style "base" {
+    padding: $pad
+}
+App {
+    Container {
+        style: "base"
+        font_size: "zz"
+    }
+}
+`
+
+// request is a client message; requests have an ID, notifications do not.
+type request struct {
+	id     int
+	method string
+	params interface{}
+}
+
+// session sends msgs to a server and returns the messages it wrote. The
+// server stops at the end of msgs.
+func session(t *testing.T, msgs ...request) []message {
+	t.Helper()
+	var in bytes.Buffer
+	for _, m := range msgs {
+		msg := &message{Method: m.method}
+		if m.id != 0 {
+			id := json.RawMessage(fmt.Sprint(m.id))
+			msg.ID = &id
+		}
+		if m.params != nil {
+			data, err := json.Marshal(m.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg.Params = data
+		}
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	if err := NewServer(&in, &out, nil).Serve(context.Background()); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+
+	var replies []message
+	r := bufio.NewReader(&out)
+	for {
+		body, err := readMessage(r)
+		if errors.Is(err, io.EOF) {
+			return replies
+		}
+		if err != nil {
+			t.Fatalf("reading reply: %v", err)
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("decoding reply: %v", err)
+		}
+		replies = append(replies, msg)
+	}
+}
+
+// open runs a session that initializes the server, opens testSource, sends
+// msgs and shuts the server down.
+func open(t *testing.T, msgs ...request) []message {
+	t.Helper()
+	all := []request{
+		{id: 1, method: "initialize", params: map[string]interface{}{}},
+		{method: "initialized", params: map[string]interface{}{}},
+		{method: "textDocument/didOpen", params: didOpenParams{TextDocument: textDocumentItem{URI: testURI, Text: testSource}}},
+	}
+	all = append(all, msgs...)
+	return session(t, append(all, request{id: 1000, method: "shutdown"}, request{method: "exit"})...)
+}
+
+// result decodes the result of the reply to request id into v.
+func result(t *testing.T, replies []message, id int, v interface{}) {
+	t.Helper()
+	for _, msg := range replies {
+		if msg.ID == nil || string(*msg.ID) != fmt.Sprint(id) {
+			continue
+		}
+		if msg.Error != nil {
+			t.Fatalf("request %d failed: %s", id, msg.Error.Message)
+		}
+		if err := json.Unmarshal(msg.Result, v); err != nil {
+			t.Fatalf("decoding result of request %d: %v", id, err)
+		}
+		return
+	}
+	t.Fatalf("no reply to request %d", id)
+}
+
+func at(line, character int) textDocumentPositionParams {
+	return textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: testURI}, Position: position{Line: line, Character: character}}
+}
+
+func TestServerDiagnostics(t *testing.T) {
+	var published []publishDiagnosticsParams
+	for _, msg := range open(t) {
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var p publishDiagnosticsParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			t.Fatal(err)
+		}
+		published = append(published, p)
+	}
+	if len(published) != 1 || published[0].URI != testURI {
+		t.Fatalf("got diagnostics %+v, want one set for %s", published, testURI)
+	}
+	diags := published[0].Diagnostics
+	if len(diags) != 1 {
+		t.Fatalf("got %d diagnostics, want 1: %+v", len(diags), diags)
+	}
+	d := diags[0]
+	want := lspRange{Start: position{Line: 9, Character: 8}, End: position{Line: 9, Character: 17}}
+	if d.Code != "E0402" || d.Severity != severityError || d.Range != want {
+		t.Errorf("got %s severity %d at %+v, want E0402 severity %d at %+v", d.Code, d.Severity, d.Range, severityError, want)
+	}
+}
+
+func TestServerDefinition(t *testing.T) {
+	replies := open(t,
+		request{id: 2, method: "textDocument/definition", params: at(8, 17)}, // "base"
+		request{id: 3, method: "textDocument/definition", params: at(4, 19)}, // $pad
+	)
+	tests := []struct {
+		id   int
+		want lspRange
+	}{
+		{2, lspRange{Start: position{Line: 3, Character: 7}, End: position{Line: 3, Character: 11}}},
+		{3, lspRange{Start: position{Line: 1, Character: 4}, End: position{Line: 1, Character: 7}}},
+	}
+	for _, tt := range tests {
+		var loc location
+		result(t, replies, tt.id, &loc)
+		if loc.URI != testURI || loc.Range != tt.want {
+			t.Errorf("request %d: got %s %+v, want %s %+v", tt.id, loc.URI, loc.Range, testURI, tt.want)
+		}
+	}
+}
+
+func TestServerHover(t *testing.T) {
+	replies := open(t,
+		request{id: 2, method: "textDocument/hover", params: at(4, 19)}, // $pad
+		request{id: 3, method: "textDocument/hover", params: at(9, 10)}, // font_size
+		request{id: 4, method: "textDocument/hover", params: at(7, 6)},  // Container
+	)
+	tests := []struct {
+		id   int
+		want string
+	}{
+		{2, "variable `$pad` = `8`"},
+		{3, "property `font_size`"},
+		{4, "element `Container`"},
+	}
+	for _, tt := range tests {
+		var h hover
+		result(t, replies, tt.id, &h)
+		if !strings.HasPrefix(h.Contents.Value, tt.want) {
+			t.Errorf("request %d: got hover %q, want it to start with %q", tt.id, h.Contents.Value, tt.want)
+		}
+	}
+}
+
+func TestServerCompletion(t *testing.T) {
+	replies := open(t,
+		request{id: 2, method: "textDocument/completion", params: at(4, 18)}, // After '$'
+		request{id: 3, method: "textDocument/completion", params: at(8, 16)}, // Inside the style value
+	)
+	tests := []struct {
+		id   int
+		want string
+	}{
+		{2, "pad"},
+		{3, "base"},
+	}
+	for _, tt := range tests {
+		var items []completionItem
+		result(t, replies, tt.id, &items)
+		if len(items) != 1 || items[0].Label != tt.want {
+			t.Errorf("request %d: got %+v, want only %q", tt.id, items, tt.want)
+		}
+	}
+}
+
+func TestServerNotInitialized(t *testing.T) {
+	replies := session(t, request{id: 1, method: "textDocument/hover", params: at(0, 0)})
+	if len(replies) == 0 || replies[0].Error == nil || replies[0].Error.Code != codeServerNotInitialized {
+		t.Errorf("got %+v, want a server not initialized error", replies)
+	}
+}
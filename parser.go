@@ -1,528 +1,69 @@
 // parser.go
-package main
+package kryc
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
-	"log"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
+
+	"github.com/waozixyz/kryc/krb"
+	"github.com/waozixyz/kryc/syntax"
 )
 
 // parseKrySource parses the preprocessed KRY source string.
 func (state *CompilerState) parseKrySource(sourceBuffer string) error {
-	scanner := bufio.NewScanner(strings.NewReader(sourceBuffer))
-	currentLineNum := 0
-	blockStack := make([]BlockStackEntry, 0, MaxBlockDepth)
-
-	getCurrentContext := func() (indent int, context interface{}, ctxType BlockContextType) {
-		if len(blockStack) > 0 {
-			top := blockStack[len(blockStack)-1]
-			return top.Indent, top.Context, top.Type
-		}
-		return -1, nil, CtxNone
+	file, err := syntax.Parse([]byte(sourceBuffer))
+	var syntaxErrs syntax.ErrorList
+	if errors.As(err, &syntaxErrs) {
+		for _, e := range syntaxErrs {
+			if stop := state.recordError(state.errorAt(CodeSyntax, e.Pos, "%s", e.Msg)); stop != nil {
+				return stop
+			}
+		}
+	}
+
+	// --- Top-Level Blocks ---
+	// Statements that failed to parse are missing from the tree; the rest is
+	// still checked so that one run reports as many errors as possible.
+	err = state.parseNodes(file.Nodes, func(n syntax.Node) error {
+		switch n := n.(type) {
+		case *syntax.Include, *syntax.Variables:
+			return nil // Expanded or blanked by the preprocessing passes; invalid @include lines were reported there
+		case *syntax.Style:
+			return state.parseStyle(n)
+		case *syntax.Animation:
+			return state.parseAnimation(n)
+		case *syntax.Resources:
+			return state.parseResources(n)
+		case *syntax.Callbacks:
+			return state.parseCallbacks(n)
+		case *syntax.Define:
+			return state.parseDefine(n)
+		case *syntax.Element:
+			return state.parseElement(n, -1, nil, 1)
+		}
+		return state.misplaced(n, CtxNone)
+	})
+	if err != nil {
+		return err
 	}
 
-	for scanner.Scan() {
-		currentLineNum++
-		state.CurrentLineNum = currentLineNum
-		rawLine := scanner.Text()
-
-		trimmedForIndent, indent := trimLeadingWhitespaceAndGetIndent(rawLine)
-		trimmedLine := stripCommentAndTrim(trimmedForIndent)
-
-		if trimmedLine == "" {
-			continue
-		}
-
-		if len(rawLine) > MaxLineLength {
-			log.Printf("L%d: Warning: Line exceeds MaxLineLength (%d)\n", currentLineNum, MaxLineLength)
-		}
-
-		_, currentContext, currentCtxType := getCurrentContext()
-
-		// --- 1. Handle Block End ---
-		if trimmedLine == "}" {
-			if len(blockStack) == 0 {
-				return fmt.Errorf("L%d: mismatched '}'", currentLineNum)
-			}
-
-			poppedEntry := blockStack[len(blockStack)-1]
-			// We defer popping from blockStack until after potential processing
-			// to ensure context is still available if needed.
-
-			if poppedEntry.Type == CtxEdgeInsetProperty {
-				edgeState, ok := poppedEntry.Context.(*EdgeInsetParseState)
-				if !ok || edgeState == nil {
-					return fmt.Errorf("L%d: internal error: invalid context found when closing edge inset block", currentLineNum)
-				}
-
-				var addPropErr error
-				baseKey := edgeState.ParentKey
-
-				processEdgeProp := func(keySuffix string, value *string) error {
-					if value != nil {
-						if edgeState.ParentCtxType == CtxElement {
-							if parentEl, ok := edgeState.ParentCtx.(*Element); ok && parentEl != nil {
-								return parentEl.addSourceProperty(baseKey+keySuffix, *value, edgeState.StartLine)
-							}
-							log.Printf("L%d: Warning: Invalid parent element context for edge inset prop '%s%s'.", currentLineNum, baseKey, keySuffix)
-							return nil // Non-fatal, just log
-						} else if edgeState.ParentCtxType == CtxStyle {
-							if parentStyle, ok := edgeState.ParentCtx.(*StyleEntry); ok && parentStyle != nil {
-								return parentStyle.addSourceProperty(baseKey+keySuffix, *value, edgeState.StartLine)
-							}
-							log.Printf("L%d: Warning: Invalid parent style context for edge inset prop '%s%s'.", currentLineNum, baseKey, keySuffix)
-							return nil // Non-fatal, just log
-						} else {
-							return fmt.Errorf("internal error: unexpected parent context type (%v) for edge inset block at L%d", edgeState.ParentCtxType, edgeState.StartLine)
-						}
-					}
-					return nil
-				}
-
-				addPropErr = processEdgeProp("_top", edgeState.Top)
-				if addPropErr != nil {
-					return fmt.Errorf("L%d: error adding converted edge inset property for '%s_top': %w", edgeState.StartLine, baseKey, addPropErr)
-				}
-				addPropErr = processEdgeProp("_right", edgeState.Right)
-				if addPropErr != nil {
-					return fmt.Errorf("L%d: error adding converted edge inset property for '%s_right': %w", edgeState.StartLine, baseKey, addPropErr)
-				}
-				addPropErr = processEdgeProp("_bottom", edgeState.Bottom)
-				if addPropErr != nil {
-					return fmt.Errorf("L%d: error adding converted edge inset property for '%s_bottom': %w", edgeState.StartLine, baseKey, addPropErr)
-				}
-				addPropErr = processEdgeProp("_left", edgeState.Left)
-				if addPropErr != nil {
-					return fmt.Errorf("L%d: error adding converted edge inset property for '%s_left': %w", edgeState.StartLine, baseKey, addPropErr)
-				}
-			}
-			blockStack = blockStack[:len(blockStack)-1] // Pop the stack
-			continue
-		}
-
-		// --- 2. Process Line: Block Start or Properties ---
-		firstWord, restOfLineAfterWord := splitFirstWord(trimmedLine)
-
-		// --- 2a. Define Block ---
-		if firstWord == "Define" && strings.HasSuffix(restOfLineAfterWord, "{") {
-			if currentCtxType != CtxNone {
-				return fmt.Errorf("L%d: 'Define' must be at the top level", currentLineNum)
-			}
-			parts := strings.Fields(strings.TrimSuffix(restOfLineAfterWord, "{"))
-			if len(parts) == 1 {
-				name := parts[0]
-				if state.findComponentDef(name) != nil {
-					return fmt.Errorf("L%d: component '%s' redefined", currentLineNum, name)
-				}
-				if len(state.ComponentDefs) >= MaxComponentDefs {
-					return fmt.Errorf("L%d: maximum component definitions (%d) exceeded", currentLineNum, MaxComponentDefs)
-				}
-				def := ComponentDefinition{
-					Name:                       name,
-					DefinitionStartLine:        currentLineNum,
-					Properties:                 make([]ComponentPropertyDef, 0, 4),
-					DefinitionRootElementIndex: -1,
-				}
-				state.ComponentDefs = append(state.ComponentDefs, def)
-				state.HeaderFlags |= FlagHasComponentDefs
-				currentComponentDef := &state.ComponentDefs[len(state.ComponentDefs)-1]
-				if len(blockStack) >= MaxBlockDepth {
-					return fmt.Errorf("L%d: max block depth exceeded", currentLineNum)
-				}
-				blockStack = append(blockStack, BlockStackEntry{indent, currentComponentDef, CtxComponentDef})
-				log.Printf("   Def: %s\n", name)
-			} else {
-				return fmt.Errorf("L%d: invalid Define syntax: '%s'", currentLineNum, trimmedLine)
-			}
-			continue
-		}
-
-		// --- 2b. Style Block ---
-		if firstWord == "style" && strings.Contains(restOfLineAfterWord, "\"") && strings.HasSuffix(restOfLineAfterWord, "{") {
-			if currentCtxType != CtxNone {
-				return fmt.Errorf("L%d: 'style' must be at the top level", currentLineNum)
-			}
-			nameContent := strings.TrimSpace(strings.TrimSuffix(restOfLineAfterWord, "{"))
-			if strings.HasPrefix(nameContent, "\"") && strings.HasSuffix(nameContent, "\"") && len(nameContent) > 1 {
-				name := nameContent[1 : len(nameContent)-1]
-				if name == "" {
-					return fmt.Errorf("L%d: style name cannot be empty", currentLineNum)
-				}
-				if state.findStyleByName(name) != nil {
-					return fmt.Errorf("L%d: style '%s' redefined", currentLineNum, name)
-				}
-				if len(state.Styles) >= MaxStyles {
-					return fmt.Errorf("L%d: maximum styles (%d) exceeded", currentLineNum, MaxStyles)
-				}
-				styleID := uint8(len(state.Styles) + 1)
-				nameIdx, err := state.addString(name)
-				if err != nil {
-					return fmt.Errorf("L%d: failed adding style name '%s': %w", currentLineNum, name, err)
-				}
-				styleEntry := StyleEntry{
-					ID:                styleID,
-					SourceName:        name,
-					NameIndex:         nameIdx,
-					Properties:        make([]KrbProperty, 0, 4),
-					SourceProperties:  make([]SourceProperty, 0, 8),
-					CalculatedSize:    3, // Base size for StyleHeader (ID, NameIdx, PropCount)
-					ExtendsStyleNames: make([]string, 0, 1),
-				}
-				state.Styles = append(state.Styles, styleEntry)
-				currentStyle := &state.Styles[len(state.Styles)-1]
-				if len(blockStack) >= MaxBlockDepth {
-					return fmt.Errorf("L%d: max block depth exceeded", currentLineNum)
-				}
-				blockStack = append(blockStack, BlockStackEntry{indent, currentStyle, CtxStyle})
-				state.HeaderFlags |= FlagHasStyles
-			} else {
-				return fmt.Errorf("L%d: invalid style syntax: '%s', use 'style \"name\" {'", currentLineNum, trimmedLine)
-			}
-			continue
-		}
-
-		// --- 2c. Properties Block (inside Define) ---
-		if (firstWord == "Properties" && restOfLineAfterWord == "{") || trimmedLine == "Properties {" {
-			if currentCtxType != CtxComponentDef {
-				return fmt.Errorf("L%d: 'Properties' block must be directly inside a 'Define' block", currentLineNum)
-			}
-			def, ok := currentContext.(*ComponentDefinition)
-			if !ok {
-				return fmt.Errorf("L%d: internal error: context for Properties block is not *ComponentDefinition", currentLineNum)
-			}
-			if def.DefinitionRootElementIndex != -1 {
-				return fmt.Errorf("L%d: 'Properties' block must come before the root element definition within 'Define %s'", currentLineNum, def.Name)
-			}
-			for _, entry := range blockStack {
-				if entry.Type == CtxProperties && entry.Context == currentContext {
-					return fmt.Errorf("L%d: multiple 'Properties' blocks are invalid within 'Define %s'", currentLineNum, def.Name)
-				}
-			}
-			if len(blockStack) >= MaxBlockDepth {
-				return fmt.Errorf("L%d: max block depth exceeded", currentLineNum)
-			}
-			blockStack = append(blockStack, BlockStackEntry{indent, currentContext, CtxProperties})
-			continue
-		}
-
-		// --- 2d. Element/Component Block Start or Inline Properties ---
-		isPotentialElementStart := len(firstWord) > 0 && unicode.IsUpper(rune(firstWord[0])) && strings.Contains(restOfLineAfterWord, "{")
-
-		if isPotentialElementStart {
-			elementName := firstWord
-			contentAfterElementName := restOfLineAfterWord
-
-			parentIndex := -1
-			var parentElement *Element
-			var componentDefContext *ComponentDefinition
-			isDefinitionRoot := false
-
-			switch currentCtxType {
-			case CtxNone:
-			case CtxElement:
-				parentElement = currentContext.(*Element)
-				parentIndex = parentElement.SelfIndex
-			case CtxComponentDef:
-				def := currentContext.(*ComponentDefinition)
-				if def.DefinitionRootElementIndex != -1 {
-					return fmt.Errorf("L%d: multiple root elements defined for 'Define %s'. Previous was at index %d.", currentLineNum, def.Name, def.DefinitionRootElementIndex)
-				}
-				isDefinitionRoot = true
-				componentDefContext = def
-			case CtxProperties, CtxStyle, CtxEdgeInsetProperty:
-				return fmt.Errorf("L%d: cannot define element '%s' directly inside a '%v' block", currentLineNum, elementName, currentCtxType)
-			default:
-				return fmt.Errorf("L%d: internal error: unexpected context type %v when starting element '%s'", currentLineNum, currentCtxType, elementName)
-			}
-
-			if len(state.Elements) >= MaxElements {
-				return fmt.Errorf("L%d: maximum elements (%d) exceeded", currentLineNum, MaxElements)
-			}
-			elementIndex := len(state.Elements)
-			el := Element{
-				SelfIndex:             elementIndex,
-				ParentIndex:           parentIndex,
-				SourceElementName:     elementName,
-				SourceLineNum:         currentLineNum,
-				CalculatedSize:        KRBElementHeaderSize, // Base size, props/children will add to it
-				SourceProperties:      make([]SourceProperty, 0, 8),
-				KrbProperties:         make([]KrbProperty, 0, 8),
-				KrbCustomProperties:   make([]KrbCustomProperty, 0, 2),
-				KrbEvents:             make([]KrbEvent, 0, 2),
-				SourceChildrenIndices: make([]int, 0, 4),
-				Children:              make([]*Element, 0, 4),
-				IsDefinitionRoot:      isDefinitionRoot,
-			}
-			if parentElement != nil && parentElement.IsDefinitionRoot {
-				el.IsDefinitionRoot = true // Propagate template context
-			}
-
-			if compDef := state.findComponentDef(elementName); compDef != nil {
-				if isDefinitionRoot {
-					return fmt.Errorf("L%d: cannot use component '%s' as the root element definition for 'Define %s'. Root must be a standard element type.", currentLineNum, elementName, componentDefContext.Name)
-				}
-				el.Type = ElemTypeInternalComponentUsage
-				el.ComponentDef = compDef
-				el.IsComponentInstance = true
-			} else {
-				el.Type = getElementTypeFromName(elementName)
-				if el.Type == ElemTypeUnknown {
-					el.Type = ElemTypeCustomBase
-					nameIdx, err := state.addString(elementName)
-					if err != nil {
-						return err
-					}
-					el.IDStringIndex = nameIdx
-					log.Printf("L%d: Warn: Unknown element type '%s', treating as custom (type 0x%X with name index %d)\n", currentLineNum, elementName, el.Type, nameIdx)
-				}
-				if !isDefinitionRoot {
-					if el.Type == ElemTypeApp {
-						if state.HasApp || parentElement != nil {
-							return fmt.Errorf("L%d: 'App' element must be the single root element", currentLineNum)
-						}
-						state.HasApp = true
-						state.HeaderFlags |= FlagHasApp
-					} else if parentElement == nil && !state.HasApp && !el.IsComponentInstance {
-						return fmt.Errorf("L%d: root element must be 'App' or a component usage, found standard element '%s'", currentLineNum, elementName)
-					}
-				}
-			}
-			state.Elements = append(state.Elements, el)
-			currentElement := &state.Elements[elementIndex]
-
-			if parentElement != nil {
-				if len(parentElement.SourceChildrenIndices) >= MaxChildren {
-					return fmt.Errorf("L%d: max children (%d) for parent '%s'", currentLineNum, MaxChildren, parentElement.SourceElementName)
-				}
-				parentElement.SourceChildrenIndices = append(parentElement.SourceChildrenIndices, currentElement.SelfIndex)
-			}
-			if isDefinitionRoot && componentDefContext != nil {
-				componentDefContext.DefinitionRootElementIndex = currentElement.SelfIndex
-			}
-
-			inlinePropsStr, childBlockFollows, isSelfClosedOnLine := extractContentOfFirstBlockOnLine(strings.TrimSpace(contentAfterElementName))
-
-			if inlinePropsStr != "" {
-				err := state.parseAndAddPropertiesToElement(currentElement, inlinePropsStr, currentLineNum)
-				if err != nil {
-					return err
-				}
-			}
-
-			if !isSelfClosedOnLine { // True if "Elem {" OR "Elem {props} {" (child block) OR "Elem {props...NO_CLOSING_BRACE_YET"
-				if len(blockStack) >= MaxBlockDepth {
-					return fmt.Errorf("L%d: max block depth exceeded for element '%s'", currentLineNum, elementName)
-				}
-				blockStack = append(blockStack, BlockStackEntry{indent, currentElement, CtxElement})
-			} else if childBlockFollows { // Case: "Elem {props} {child_block_start}"
-				// The first block self-closed, but an explicit child block follows.
-				// Need to push context for the child block.
-				if len(blockStack) >= MaxBlockDepth {
-					return fmt.Errorf("L%d: max block depth exceeded before child block for element '%s'", currentLineNum, elementName)
-				}
-				blockStack = append(blockStack, BlockStackEntry{indent, currentElement, CtxElement})
-			}
-			// If isSelfClosedOnLine is true AND childBlockFollows is false, the element is fully defined on this line.
-			// Example: Image { source:"..." }
-			// No push to stack needed.
-			continue
-		}
-
-		// --- 2e. Edge Inset Block Start (e.g., padding: {) ---
-		// This specific check must come after general element parsing because an element could be named "padding" or "margin".
-		// The distinction is "padding: {" vs "Padding {".
-		partsForEdgeInset := strings.SplitN(trimmedLine, ":", 2)
-		if len(partsForEdgeInset) == 2 {
-			key := strings.TrimSpace(partsForEdgeInset[0])
-			val := strings.TrimSpace(partsForEdgeInset[1])
-			if (key == "padding" || key == "margin") && val == "{" {
-				if currentCtxType != CtxElement && currentCtxType != CtxStyle {
-					return fmt.Errorf("L%d: '%s: {' block must be inside an Element or Style block (current: %v)", currentLineNum, key, currentCtxType)
-				}
-				if len(blockStack) >= MaxBlockDepth {
-					return fmt.Errorf("L%d: max block depth for '%s: {'", currentLineNum, key)
-				}
-				edgeState := &EdgeInsetParseState{
-					ParentKey:     key,
-					ParentCtx:     currentContext,
-					ParentCtxType: currentCtxType,
-					Indent:        indent,
-					StartLine:     currentLineNum,
-				}
-				blockStack = append(blockStack, BlockStackEntry{Indent: indent, Context: edgeState, Type: CtxEdgeInsetProperty})
-				continue
-			}
-		}
-
-		// --- 3. Process Non-Block-Starting Lines (Properties or invalid syntax) ---
-		if len(blockStack) == 0 {
-			return fmt.Errorf("L%d: unexpected syntax at top level: '%s' (expected block definition or @directive)", currentLineNum, trimmedLine)
-		}
-		// Heuristic: if a line is not indented further than its block opener, it might be an error.
-		// This needs careful consideration with how `indent` is calculated and compared to `blockStack[len(blockStack)-1].Indent`.
-		// For now, rely on context type.
-
-		switch currentCtxType {
-		case CtxElement:
-			currentElement, ok := currentContext.(*Element)
-			if !ok {
-				return fmt.Errorf("L%d: internal: CtxElement context error", currentLineNum)
-			}
-			err := state.parseAndAddPropertiesToElement(currentElement, trimmedLine, currentLineNum)
-			if err != nil {
-				return err
-			}
-		case CtxStyle:
-			currentStyle, ok := currentContext.(*StyleEntry)
-			if !ok {
-				return fmt.Errorf("L%d: internal: CtxStyle context error", currentLineNum)
-			}
-			err := state.parseAndAddPropertiesToStyle(currentStyle, trimmedLine, currentLineNum)
-			if err != nil {
+	for i := range state.ComponentDefs {
+		if state.ComponentDefs[i].DefinitionRootElementIndex == -1 {
+			err := state.errorf(CodeComponent, state.ComponentDefs[i].DefinitionStartLine, "", "component definition 'Define %s' is missing its root element template (e.g., Container { ... })", state.ComponentDefs[i].Name)
+			if err := state.recordError(err); err != nil {
 				return err
 			}
-		case CtxProperties:
-			if strings.Contains(trimmedLine, ";") {
-				return fmt.Errorf("L%d: semicolons not allowed in 'Properties' definitions line: '%s'", currentLineNum, trimmedLine)
-			}
-			propParts := strings.SplitN(trimmedLine, ":", 2)
-			if len(propParts) != 2 {
-				return fmt.Errorf("L%d: invalid syntax in Properties (expected 'key: Type [= Default]'): '%s'", currentLineNum, trimmedLine)
-			}
-			key := strings.TrimSpace(propParts[0])
-			valueStr := strings.TrimSpace(propParts[1])
-			parentComponentDef, _ := currentContext.(*ComponentDefinition)
-
-			valTypeAndDefault := strings.SplitN(valueStr, "=", 2)
-			propTypeStr := strings.TrimSpace(valTypeAndDefault[0])
-			propDefaultStr := ""
-			if len(valTypeAndDefault) == 2 {
-				propDefaultStr = strings.TrimSpace(valTypeAndDefault[1])
-			}
-
-			if len(parentComponentDef.Properties) >= MaxProperties {
-				return fmt.Errorf("L%d: max props (%d) for component '%s'", currentLineNum, MaxProperties, parentComponentDef.Name)
-			}
-			pd := ComponentPropertyDef{Name: key, DefaultValueStr: propDefaultStr}
-			switch propTypeStr {
-			case "String":
-				pd.ValueTypeHint = ValTypeString
-			case "Int":
-				pd.ValueTypeHint = ValTypeInt
-			case "Bool":
-				pd.ValueTypeHint = ValTypeBool
-			case "Color":
-				pd.ValueTypeHint = ValTypeColor
-			case "StyleID":
-				pd.ValueTypeHint = ValTypeStyleID
-			case "Resource":
-				pd.ValueTypeHint = ValTypeResource
-			case "Float":
-				pd.ValueTypeHint = ValTypeFloat
-			default:
-				if strings.HasPrefix(propTypeStr, "Enum(") && strings.HasSuffix(propTypeStr, ")") {
-					pd.ValueTypeHint = ValTypeEnum
-				} else {
-					log.Printf("L%d: Warn: Unknown property type '%s' for '%s'. Treating as custom hint.", currentLineNum, propTypeStr, key)
-					pd.ValueTypeHint = ValTypeCustom
-				}
-			}
-			parentComponentDef.Properties = append(parentComponentDef.Properties, pd)
-		case CtxEdgeInsetProperty:
-			if strings.Contains(trimmedLine, ";") {
-				return fmt.Errorf("L%d: semicolons not allowed in edge inset definitions line: '%s'", currentLineNum, trimmedLine)
-			}
-			propParts := strings.SplitN(trimmedLine, ":", 2)
-			if len(propParts) != 2 {
-				log.Printf("L%d: Warn: Invalid syntax in edge inset block: '%s'. Expected 'side: value'. Ignored.", currentLineNum, trimmedLine)
-				continue
-			}
-			key := strings.TrimSpace(propParts[0])
-			valueStr := strings.TrimSpace(propParts[1])
-			edgeState, _ := currentContext.(*EdgeInsetParseState)
-			switch key {
-			case "top":
-				if edgeState.Top != nil {
-					log.Printf("L%d: Warn: duplicate 'top' in '%s'. Overwriting.", currentLineNum, edgeState.ParentKey)
-				}
-				edgeState.Top = &valueStr
-			case "right":
-				if edgeState.Right != nil {
-					log.Printf("L%d: Warn: duplicate 'right' in '%s'. Overwriting.", currentLineNum, edgeState.ParentKey)
-				}
-				edgeState.Right = &valueStr
-			case "bottom":
-				if edgeState.Bottom != nil {
-					log.Printf("L%d: Warn: duplicate 'bottom' in '%s'. Overwriting.", currentLineNum, edgeState.ParentKey)
-				}
-				edgeState.Bottom = &valueStr
-			case "left":
-				if edgeState.Left != nil {
-					log.Printf("L%d: Warn: duplicate 'left' in '%s'. Overwriting.", currentLineNum, edgeState.ParentKey)
-				}
-				edgeState.Left = &valueStr
-			case "all":
-				if edgeState.Top != nil || edgeState.Right != nil || edgeState.Bottom != nil || edgeState.Left != nil {
-					log.Printf("L%d: Warn: 'all' specified after individual sides in '%s'. 'all' will overwrite.", currentLineNum, edgeState.ParentKey)
-				}
-				edgeState.Top = &valueStr
-				edgeState.Right = &valueStr
-				edgeState.Bottom = &valueStr
-				edgeState.Left = &valueStr
-			case "horizontal":
-				if edgeState.Left != nil || edgeState.Right != nil {
-					log.Printf("L%d: Warn: 'horizontal' specified after 'left' or 'right' in '%s'. 'horizontal' will overwrite.", currentLineNum, edgeState.ParentKey)
-				}
-				edgeState.Left = &valueStr
-				edgeState.Right = &valueStr
-			case "vertical":
-				if edgeState.Top != nil || edgeState.Bottom != nil {
-					log.Printf("L%d: Warn: 'vertical' specified after 'top' or 'bottom' in '%s'. 'vertical' will overwrite.", currentLineNum, edgeState.ParentKey)
-				}
-				edgeState.Top = &valueStr
-				edgeState.Bottom = &valueStr
-			default:
-				log.Printf("L%d: Warn: Unexpected key '%s' in '%s: {}' block. Ignored.", currentLineNum, key, edgeState.ParentKey)
-			}
-		case CtxComponentDef:
-			log.Printf("L%d: Warning: Property-like syntax '%s' directly under Define block. Ignored. Use 'Properties {}' or define on root element.", currentLineNum, trimmedLine)
-		default:
-			return fmt.Errorf("L%d: internal error: unexpected context %v for property line '%s'", currentLineNum, currentCtxType, trimmedLine)
 		}
-		continue
 	}
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading source buffer: %w", err)
-	}
-
-	if len(blockStack) != 0 {
-		lastEntry := blockStack[len(blockStack)-1]
-		contextStr := fmt.Sprintf("%v", lastEntry.Type)
-		switch lastEntry.Type {
-		case CtxElement:
-			if el, ok := lastEntry.Context.(*Element); ok {
-				contextStr = fmt.Sprintf("Element '%s' L%d", el.SourceElementName, el.SourceLineNum)
-			}
-		case CtxStyle:
-			if st, ok := lastEntry.Context.(*StyleEntry); ok {
-				contextStr = fmt.Sprintf("Style '%s'", st.SourceName)
-			}
-		case CtxComponentDef:
-			if def, ok := lastEntry.Context.(*ComponentDefinition); ok {
-				contextStr = fmt.Sprintf("Define '%s' L%d", def.Name, def.DefinitionStartLine)
-			}
-		case CtxProperties:
-			contextStr = "Properties block"
-		case CtxEdgeInsetProperty:
-			if es, ok := lastEntry.Context.(*EdgeInsetParseState); ok {
-				contextStr = fmt.Sprintf("'%s: {}' L%d", es.ParentKey, es.StartLine)
-			}
-		}
-		return fmt.Errorf("unclosed block at end of file (last open: %s)", contextStr)
+	if state.errorCount > 0 {
+		return nil // The checks below would only report follow-on errors of skipped blocks
 	}
 
 	rootElementIndex := -1
@@ -534,7 +75,7 @@ func (state *CompilerState) parseKrySource(sourceBuffer string) error {
 	}
 	if rootElementIndex == -1 {
 		if len(state.Elements) == 0 && len(state.ComponentDefs) == 0 && len(state.Styles) == 0 { // Check styles too
-			return errors.New("no content found: define 'App', components, or styles")
+			return state.errorf(CodeElement, 0, "", "no content found: define 'App', components, or styles")
 		}
 		allAreTemplatesOrStyles := true
 		if len(state.Elements) > 0 {
@@ -546,339 +87,680 @@ func (state *CompilerState) parseKrySource(sourceBuffer string) error {
 			}
 		}
 		if allAreTemplatesOrStyles && (len(state.ComponentDefs) > 0 || len(state.Styles) > 0) {
-			log.Println("Info: Only component definitions and/or styles found. No main 'App' element or root component instance.")
+			state.logf("Info: Only component definitions and/or styles found. No main 'App' element or root component instance.")
 		} else if len(state.Elements) > 0 { // Elements exist, but not a valid root structure
-			return errors.New("internal error: elements present but no main UI tree root identified, or it's not an App/Component instance")
+			return state.errorf(CodeInternal, 0, "", "internal error: elements present but no main UI tree root identified, or it's not an App/Component instance")
 		}
 	} else {
 		rootElement := state.Elements[rootElementIndex]
 		if rootElement.Type != ElemTypeApp && !rootElement.IsComponentInstance {
-			return fmt.Errorf("main UI tree root element must be 'App' or a component instance, but found '%s' (type 0x%X) at L%d", rootElement.SourceElementName, rootElement.Type, rootElement.SourceLineNum)
+			return state.errorf(CodeElement, rootElement.SourceLineNum, "", "main UI tree root element must be 'App' or a component instance, but found '%s' (type 0x%X)", rootElement.SourceElementName, rootElement.Type)
 		}
 		if rootElement.Type == ElemTypeApp && !state.HasApp {
 			state.HasApp = true
 			state.HeaderFlags |= FlagHasApp
 		}
 		if rootElement.IsComponentInstance && !state.HasApp {
-			log.Println("Info: Root element is a component instance. Assuming 'App' container behavior.")
+			state.logf("Info: Root element is a component instance. Assuming 'App' container behavior.")
 			state.HasApp = true
 		}
 	}
 
-	for i := range state.ComponentDefs {
-		if state.ComponentDefs[i].DefinitionRootElementIndex == -1 {
-			return fmt.Errorf("component definition 'Define %s' (L%d) is missing its root element template (e.g., Container { ... })", state.ComponentDefs[i].Name, state.ComponentDefs[i].DefinitionStartLine)
+	return nil
+}
+
+// parseNodes calls parse for each statement of a block. A statement that
+// fails is recorded and skipped, along with any block it opens, and parsing
+// carries on with the next one.
+func (state *CompilerState) parseNodes(nodes []syntax.Node, parse func(syntax.Node) error) error {
+	for _, n := range nodes {
+		state.CurrentLineNum = n.Pos().Line
+		if err := parse(n); err != nil {
+			if stop := state.recordError(err); stop != nil {
+				return stop
+			}
 		}
 	}
-
 	return nil
 }
 
-// parseAndAddPropertiesToElement parses a string of semicolon-separated properties
-// and adds them to the given Element.
-func (state *CompilerState) parseAndAddPropertiesToElement(el *Element, propsStr string, lineNum int) error {
-	individualPropStrings := splitPropertiesStringBySemicolon(propsStr)
+// misplaced returns the error for a statement that is not allowed in a block
+// of type ctx.
+func (state *CompilerState) misplaced(n syntax.Node, ctx BlockContextType) error {
+	pos := n.Pos()
+	switch n := n.(type) {
+	case *syntax.Style:
+		return state.errorAt(CodeMisplacedBlock, pos, "'style' must be at the top level")
+	case *syntax.Define:
+		return state.errorAt(CodeMisplacedBlock, pos, "'Define' must be at the top level")
+	case *syntax.Animation:
+		return state.errorAt(CodeMisplacedBlock, pos, "'@animation' must be at the top level")
+	case *syntax.Resources:
+		return state.errorAt(CodeMisplacedBlock, pos, "'@resources' must be at the top level")
+	case *syntax.Callbacks:
+		return state.errorAt(CodeMisplacedBlock, pos, "'@callbacks' must be at the top level")
+	case *syntax.State:
+		return state.errorAt(CodeMisplacedBlock, pos, "'state %s' block must be directly inside a style or Element block", n.Name.Text)
+	case *syntax.Media:
+		return state.errorAt(CodeMisplacedBlock, pos, "'@media' block must be directly inside a style or Element block")
+	case *syntax.Keyframe:
+		return state.errorAt(CodeMisplacedBlock, pos, "keyframe '%s' must be directly inside an '@animation' block", n.Offset.Text)
+	case *syntax.Properties:
+		return state.errorAt(CodeMisplacedBlock, pos, "'Properties' block must be directly inside a 'Define' block")
+	case *syntax.Element:
+		return state.errorAt(CodeMisplacedBlock, pos, "cannot define element '%s' directly inside a '%v' block", n.Name.Text, ctx)
+	case *syntax.Property:
+		if n.Body != nil {
+			return state.errorAt(CodeMisplacedBlock, pos, "'%s: {' block must be inside an Element or Style block (current: %v)", n.Key.Text, ctx)
+		}
+		return state.errorAt(CodeSyntax, pos, "unexpected syntax at top level: '%s' (expected block definition or @directive)", propertyText(n))
+	}
+	return state.errorAt(CodeInternal, pos, "internal error: unexpected %T in %v", n, ctx)
+}
 
-	for _, propPairStr := range individualPropStrings {
-		trimmedPair := strings.TrimSpace(propPairStr)
-		if trimmedPair == "" {
-			continue
-		}
-		parts := strings.SplitN(trimmedPair, ":", 2)
-		if len(parts) != 2 {
-			return fmt.Errorf("L%d: invalid property format '%s' (from full string '%s') for element '%s'", lineNum, trimmedPair, propsStr, el.SourceElementName)
-		}
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
+// --- Styles ---
 
-		if err := el.addSourceProperty(key, value, lineNum); err != nil {
-			return fmt.Errorf("L%d: %w", lineNum, err) // Error from addSourceProperty
-		}
+func (state *CompilerState) parseStyle(n *syntax.Style) error {
+	name, _ := cleanAndQuoteValue(n.Name.Text)
+	if name == "" {
+		return state.errorAt(CodeSyntax, n.At, "style name cannot be empty")
 	}
-	return nil
+	if existing := state.findStyleByName(name); existing != nil {
+		return withRelated(state.errorAt(CodeRedefinition, textPos(n.Name), "style '%s' redefined", name),
+			state.relatedAt(existing.DefLine, name+`"`, "previous definition is here"))
+	}
+	if len(state.Styles) >= MaxStyles {
+		return state.errorAt(CodeLimit, n.At, "maximum styles (%d) exceeded", MaxStyles)
+	}
+	styleID := uint16(len(state.Styles) + 1)
+	nameIdx, err := state.addString(name)
+	if err != nil {
+		return state.errorAt(CodeLimit, textPos(n.Name), "failed adding style name '%s': %w", name, err)
+	}
+	state.Styles = append(state.Styles, StyleEntry{
+		ID:                styleID,
+		SourceName:        name,
+		NameIndex:         nameIdx,
+		DefLine:           n.At.Line,
+		Properties:        make([]KrbProperty, 0, 4),
+		SourceProperties:  make([]SourceProperty, 0, 8),
+		CalculatedSize:    styleHeaderSize,
+		ExtendsStyleNames: make([]string, 0, 1),
+	})
+	style := &state.Styles[len(state.Styles)-1] // No styles are added while parsing its body
+	state.HeaderFlags |= FlagHasStyles
+	state.addSymbol(SymbolStyle, name, textPos(n.Name), "")
+
+	return state.parseNodes(n.Body.Nodes, func(child syntax.Node) error {
+		switch block := child.(type) {
+		case *syntax.State:
+			return state.parseStateBlock(block, &style.StateBlocks, fmt.Sprintf("style '%s'", name))
+		case *syntax.Media:
+			return state.parseMediaBlock(block, &style.MediaBlocks, fmt.Sprintf("style '%s'", name))
+		}
+		prop, ok := child.(*syntax.Property)
+		switch {
+		case !ok:
+			return state.misplaced(child, CtxStyle)
+		case prop.Body != nil:
+			return state.parseEdgeInsets(prop, style.addSourceProperty)
+		}
+		return state.addStyleProperty(style, prop)
+	})
 }
 
-// parseAndAddPropertiesToStyle parses semicolon-separated properties for a StyleEntry.
+// addStyleProperty adds one property to a style, handling 'extends'.
+func (state *CompilerState) addStyleProperty(style *StyleEntry, prop *syntax.Property) error {
+	key, valueRaw := prop.Key.Text, prop.Value.Raw
+	keyPos, valPos := prop.Key.Pos, valuePos(prop)
+	if key != "extends" {
+		if err := style.addSourceProperty(key, valueRaw, keyPos, valPos); err != nil {
+			return state.errorAt(CodeLimit, keyPos, "adding style property '%s': %w", key, err)
+		}
+		return nil
+	}
 
-func (state *CompilerState) parseAndAddPropertiesToStyle(style *StyleEntry, propsStr string, lineNum int) error {
-	individualPropStrings := splitPropertiesStringBySemicolon(propsStr)
+	if n := len(style.SourceProperties); n > 0 {
+		prev := style.SourceProperties[n-1]
+		return state.errorAt(CodeStyle, keyPos, "'extends' must be the first property in style '%s', found after '%s: %s'", style.SourceName, prev.Key, prev.ValueStr)
+	}
 
-	for i, propPairStr := range individualPropStrings {
-		trimmedPair := strings.TrimSpace(propPairStr)
-		if trimmedPair == "" {
-			continue
-		}
+	// Check if valueRaw is an array like ["style1", "style2"]
+	if strings.HasPrefix(valueRaw, "[") && strings.HasSuffix(valueRaw, "]") {
+		// Attempt to parse as an array of strings
+		arrayContent := valueRaw[1 : len(valueRaw)-1] // Remove brackets
 
-		parts := strings.SplitN(trimmedPair, ":", 2)
-		if len(parts) != 2 {
-			return fmt.Errorf("L%d: invalid property format '%s' (from full string '%s') for style '%s'", lineNum, trimmedPair, propsStr, style.SourceName)
+		if strings.TrimSpace(arrayContent) == "" { // Handle empty array extends: []
+			style.ExtendsStyleNames = []string{} // No base styles, this is valid.
+			// Add the raw "[]" as a source property for completeness
+			if err := style.addSourceProperty(key, valueRaw, keyPos, valPos); err != nil {
+				return state.errorAt(CodeLimit, keyPos, "adding empty 'extends' array source property: %w", err)
+			}
+			return nil
 		}
 
-		key := strings.TrimSpace(parts[0])
-		valueRaw := strings.TrimSpace(parts[1])
+		baseStyleNamesRaw := strings.Split(arrayContent, ",")
+		var parsedBaseNames []string
+		for _, nameRaw := range baseStyleNamesRaw {
+			trimmedNameRaw := strings.TrimSpace(nameRaw)
+			// cleanAndQuoteValue also removes the quotes around each individual style name
+			cleanedName, wasQuoted := cleanAndQuoteValue(trimmedNameRaw)
 
-		if key == "extends" {
-			if i > 0 {
-				return fmt.Errorf("L%d: 'extends' must be the first property in style '%s', found after '%s'", lineNum, style.SourceName, individualPropStrings[i-1])
+			if !wasQuoted || cleanedName == "" {
+				return state.errorAt(CodeStyle, valPos, "'extends' array for style '%s' contains non-quoted or empty style name: '%s'. All names in the array must be quoted strings.", style.SourceName, trimmedNameRaw)
 			}
-
-			// Check if 'extends' was already processed from a previous line in the same style block.
-			// This check is a bit more robust than just looking at SourceProperties because
-			// SourceProperties might not yet include the 'extends' from this specific line if it's a multi-line definition.
-			// The core logic is that ExtendsStyleNames should only be populated once.
-			if len(style.ExtendsStyleNames) > 0 && style.SourcePropertiesContainsKey("extends") {
-				// If ExtendsStyleNames is already populated AND we've already recorded an "extends" source property,
-				// it implies 'extends' was defined on a previous line.
-				return fmt.Errorf("L%d: style '%s' 'extends' property defined multiple times. Consolidate into one 'extends' (possibly with an array).", lineNum, style.SourceName)
+			if cleanedName == style.SourceName {
+				return state.errorAt(CodeStyle, keyPos, "style '%s' cannot extend itself (found in extends array)", style.SourceName)
 			}
+			parsedBaseNames = append(parsedBaseNames, cleanedName)
+		}
 
-			// Check if valueRaw is an array like ["style1", "style2"]
-			if strings.HasPrefix(valueRaw, "[") && strings.HasSuffix(valueRaw, "]") {
-				// Attempt to parse as an array of strings
-				arrayContent := valueRaw[1 : len(valueRaw)-1] // Remove brackets
-
-				if strings.TrimSpace(arrayContent) == "" { // Handle empty array extends: []
-					style.ExtendsStyleNames = []string{} // No base styles, this is valid.
-					// Add the raw "[]" as a source property for completeness
-					if err := style.addSourceProperty(key, valueRaw, lineNum); err != nil {
-						return fmt.Errorf("L%d adding empty 'extends' array source property: %w", lineNum, err)
-					}
-					continue
-				}
-
-				baseStyleNamesRaw := strings.Split(arrayContent, ",")
-				var parsedBaseNames []string
-				for _, nameRaw := range baseStyleNamesRaw {
-					trimmedNameRaw := strings.TrimSpace(nameRaw)
-					// cleanAndQuoteValue also removes the quotes around each individual style name
-					cleanedName, wasQuoted := cleanAndQuoteValue(trimmedNameRaw)
-
-					if !wasQuoted || cleanedName == "" {
-						return fmt.Errorf("L%d: 'extends' array for style '%s' contains non-quoted or empty style name: '%s'. All names in the array must be quoted strings.", lineNum, style.SourceName, trimmedNameRaw)
-					}
-					if cleanedName == style.SourceName {
-						return fmt.Errorf("L%d: style '%s' cannot extend itself (found in extends array)", lineNum, style.SourceName)
-					}
-					parsedBaseNames = append(parsedBaseNames, cleanedName)
-				}
+		if len(parsedBaseNames) == 0 && strings.TrimSpace(arrayContent) != "" {
+			// This case can happen if arrayContent was e.g. "," or " , " but no valid names
+			return state.errorAt(CodeStyle, keyPos, "'extends' array for style '%s' resulted in no valid style names from content: '%s'", style.SourceName, arrayContent)
+		}
 
-				if len(parsedBaseNames) == 0 && strings.TrimSpace(arrayContent) != "" {
-					// This case can happen if arrayContent was e.g. "," or " , " but no valid names
-					return fmt.Errorf("L%d: 'extends' array for style '%s' resulted in no valid style names from content: '%s'", lineNum, style.SourceName, arrayContent)
-				}
+		style.ExtendsStyleNames = parsedBaseNames
+		// Add the raw array string as a source property for completeness
+		if err := style.addSourceProperty(key, valueRaw, keyPos, valPos); err != nil {
+			return state.errorAt(CodeLimit, keyPos, "adding 'extends' array source property: %w", err)
+		}
+		return nil
+	}
 
-				style.ExtendsStyleNames = parsedBaseNames
-				// Add the raw array string as a source property for completeness
-				if err := style.addSourceProperty(key, valueRaw, lineNum); err != nil {
-					return fmt.Errorf("L%d adding 'extends' array source property: %w", lineNum, err)
-				}
+	// Attempt to parse as a single quoted string
+	cleanedValue, wasQuoted := cleanAndQuoteValue(valueRaw)
+	if !wasQuoted {
+		return state.errorAt(CodeStyle, valPos, "'extends' value '%s' for style '%s' must be a quoted string or an array of quoted strings.", valueRaw, style.SourceName)
+	}
+	if cleanedValue == "" {
+		return state.errorAt(CodeStyle, keyPos, "'extends' value is an empty string for style '%s'", style.SourceName)
+	}
+	if cleanedValue == style.SourceName {
+		return state.errorAt(CodeStyle, keyPos, "style '%s' cannot extend itself", style.SourceName)
+	}
+	style.ExtendsStyleNames = []string{cleanedValue}
+	// Add the single string as a source property
+	if err := style.addSourceProperty(key, valueRaw, keyPos, valPos); err != nil {
+		return state.errorAt(CodeLimit, keyPos, "adding single 'extends' source property: %w", err)
+	}
+	return nil
+}
 
-			} else {
-				// Attempt to parse as a single quoted string
-				cleanedValue, wasQuoted := cleanAndQuoteValue(valueRaw)
-				if !wasQuoted {
-					return fmt.Errorf("L%d: 'extends' value '%s' for style '%s' must be a quoted string or an array of quoted strings.", lineNum, valueRaw, style.SourceName)
-				}
-				if cleanedValue == "" {
-					return fmt.Errorf("L%d: 'extends' value is an empty string for style '%s'", lineNum, style.SourceName)
-				}
-				if cleanedValue == style.SourceName {
-					return fmt.Errorf("L%d: style '%s' cannot extend itself", lineNum, style.SourceName)
-				}
-				style.ExtendsStyleNames = []string{cleanedValue}
-				// Add the single string as a source property
-				if err := style.addSourceProperty(key, valueRaw, lineNum); err != nil {
-					return fmt.Errorf("L%d adding single 'extends' source property: %w", lineNum, err)
-				}
+// --- Component Definitions ---
+
+func (state *CompilerState) parseDefine(n *syntax.Define) error {
+	line := n.At.Line
+	name := n.Name.Text
+	if existing := state.findComponentDef(name); existing != nil {
+		return withRelated(state.errorAt(CodeRedefinition, n.Name.Pos, "component '%s' redefined", name),
+			state.relatedAt(existing.DefinitionStartLine, name, "previous definition is here"))
+	}
+	if len(state.ComponentDefs) >= MaxComponentDefs {
+		return state.errorAt(CodeLimit, n.At, "maximum component definitions (%d) exceeded", MaxComponentDefs)
+	}
+	state.ComponentDefs = append(state.ComponentDefs, ComponentDefinition{
+		Name:                       name,
+		DefinitionStartLine:        line,
+		Properties:                 make([]ComponentPropertyDef, 0, 4),
+		DefinitionRootElementIndex: -1,
+	})
+	state.HeaderFlags |= FlagHasComponentDefs
+	def := &state.ComponentDefs[len(state.ComponentDefs)-1] // No definitions are added while parsing its body
+	state.addSymbol(SymbolComponent, name, n.Name.Pos, "")
+	state.logf("   Def: %s\n", name)
+
+	hasProperties := false
+	return state.parseNodes(n.Body.Nodes, func(child syntax.Node) error {
+		switch child := child.(type) {
+		case *syntax.Properties:
+			if def.DefinitionRootElementIndex != -1 {
+				return state.errorAt(CodeMisplacedBlock, child.At, "'Properties' block must come before the root element definition within 'Define %s'", def.Name)
 			}
-		} else { // Not an 'extends' key, handle as a normal style property
-			if err := style.addSourceProperty(key, valueRaw, lineNum); err != nil {
-				return fmt.Errorf("L%d adding style property '%s': %w", lineNum, key, err)
+			if hasProperties {
+				return state.errorAt(CodeRedefinition, child.At, "multiple 'Properties' blocks are invalid within 'Define %s'", def.Name)
+			}
+			hasProperties = true
+			return state.parseNodes(child.Body.Nodes, func(decl syntax.Node) error {
+				return state.parseComponentProperty(def, decl)
+			})
+		case *syntax.Element:
+			return state.parseElement(child, -1, def, 2)
+		case *syntax.Property:
+			if child.Body == nil {
+				state.warnAt(CodeIgnoredSyntax, child.Key.Pos, "Property-like syntax '%s' directly under Define block. Ignored. Use 'Properties {}' or define on root element.", propertyText(child))
+				return nil
 			}
 		}
-	}
-	return nil
+		return state.misplaced(child, CtxComponentDef)
+	})
 }
 
-func trimLeadingWhitespaceAndGetIndent(line string) (trimmed string, indent int) {
-	for i, r := range line {
-		if r == ' ' {
-			indent++
-		} else if r == '\t' {
-			indent += 4 // Standard tab width assumption
+// parseComponentProperty parses a `key: Type [= Default]` declaration.
+func (state *CompilerState) parseComponentProperty(def *ComponentDefinition, n syntax.Node) error {
+	decl, ok := n.(*syntax.Property)
+	if !ok {
+		return state.misplaced(n, CtxProperties)
+	}
+	if decl.Body != nil {
+		return state.errorAt(CodeSyntax, decl.Key.Pos, "invalid syntax in Properties (expected 'key: Type [= Default]'): '%s: { ... }'", decl.Key.Text)
+	}
+	key := decl.Key.Text
+	valueStr := decl.Value.Raw
+
+	valTypeAndDefault := strings.SplitN(valueStr, "=", 2)
+	propTypeStr := strings.TrimSpace(valTypeAndDefault[0])
+	propDefaultStr := ""
+	if len(valTypeAndDefault) == 2 {
+		propDefaultStr = strings.TrimSpace(valTypeAndDefault[1])
+	}
+
+	if len(def.Properties) >= MaxProperties {
+		return state.errorAt(CodeLimit, decl.Key.Pos, "max props (%d) for component '%s'", MaxProperties, def.Name)
+	}
+	pd := ComponentPropertyDef{Name: key, DefaultValueStr: propDefaultStr}
+	switch propTypeStr {
+	case "String":
+		pd.ValueTypeHint = ValTypeString
+	case "Int":
+		pd.ValueTypeHint = ValTypeInt
+	case "Bool":
+		pd.ValueTypeHint = ValTypeBool
+	case "Color":
+		pd.ValueTypeHint = ValTypeColor
+	case "StyleID":
+		pd.ValueTypeHint = ValTypeStyleID
+	case "Resource":
+		pd.ValueTypeHint = ValTypeResource
+	case "Float":
+		pd.ValueTypeHint = ValTypeFloat
+	default:
+		if strings.HasPrefix(propTypeStr, "Enum(") && strings.HasSuffix(propTypeStr, ")") {
+			pd.ValueTypeHint = ValTypeEnum
 		} else {
-			return line[i:], indent
+			state.warnAt(CodeComponentProperty, valuePos(decl), "Unknown property type '%s' for '%s'. Treating as custom hint.", propTypeStr, key)
+			pd.ValueTypeHint = ValTypeCustom
 		}
 	}
-	return "", indent
+	def.Properties = append(def.Properties, pd)
+	return nil
 }
 
-func stripCommentAndTrim(line string) string {
-	commentIdx := -1
-	inString := false
-	var prevRune rune
-	for i, char := range line {
-		if char == '"' && prevRune != '\\' {
-			inString = !inString
+// --- Elements ---
+
+// parseElement adds an element and its subtree. parentIndex is the index of
+// the parent element or -1; def is set for the root of a component template.
+// Elements are referred to by index because adding children can move them.
+func (state *CompilerState) parseElement(n *syntax.Element, parentIndex int, def *ComponentDefinition, depth int) error {
+	line := n.Name.Pos.Line
+	elementName := n.Name.Text
+	if !unicode.IsUpper(rune(elementName[0])) {
+		return state.errorAt(CodeSyntax, n.Name.Pos, "invalid element name '%s': element names start with an uppercase letter", elementName)
+	}
+	if depth > MaxBlockDepth {
+		return state.errorAt(CodeLimit, n.Name.Pos, "max block depth exceeded for element '%s'", elementName)
+	}
+
+	isDefinitionRoot := def != nil
+	if isDefinitionRoot && def.DefinitionRootElementIndex != -1 {
+		prevRoot := &state.Elements[def.DefinitionRootElementIndex]
+		return withRelated(state.errorAt(CodeComponent, n.Name.Pos, "multiple root elements defined for 'Define %s'", def.Name),
+			state.relatedAt(prevRoot.SourceLineNum, prevRoot.SourceElementName, "previous root element is here"))
+	}
+	if len(state.Elements) >= state.target.MaxElements {
+		return state.limitReached(state.errorAt(CodeLimit, n.Name.Pos, "maximum elements (%d) for target '%s' exceeded", state.target.MaxElements, state.target.Name))
+	}
+
+	elementIndex := len(state.Elements)
+	el := Element{
+		SelfIndex:             elementIndex,
+		ParentIndex:           parentIndex,
+		SourceElementName:     elementName,
+		SourceLineNum:         line,
+		CalculatedSize:        KRBElementHeaderSize, // Base size, props/children will add to it
+		SourceProperties:      make([]SourceProperty, 0, 8),
+		KrbProperties:         make([]KrbProperty, 0, 8),
+		KrbCustomProperties:   make([]KrbCustomProperty, 0, 2),
+		KrbEvents:             make([]KrbEvent, 0, 2),
+		SourceChildrenIndices: make([]int, 0, 4),
+		Children:              make([]*Element, 0, 4),
+		IsDefinitionRoot:      isDefinitionRoot,
+	}
+	if parentIndex != -1 && state.Elements[parentIndex].IsDefinitionRoot {
+		el.IsDefinitionRoot = true // Propagate template context
+	}
+
+	if compDef := state.findComponentDef(elementName); compDef != nil {
+		if isDefinitionRoot {
+			return state.errorAt(CodeComponent, n.Name.Pos, "cannot use component '%s' as the root element definition for 'Define %s'. Root must be a standard element type.", elementName, def.Name)
+		}
+		el.Type = ElemTypeInternalComponentUsage
+		el.ComponentDef = compDef
+		el.IsComponentInstance = true
+	} else {
+		el.Type = getElementTypeFromName(elementName)
+		if el.Type == ElemTypeUnknown {
+			el.Type = ElemTypeCustomBase
+			nameIdx, err := state.addString(elementName)
+			if err != nil {
+				return state.errorAt(CodeLimit, n.Name.Pos, "%w", err)
+			}
+			el.IDStringIndex = nameIdx
+			state.warnAt(CodeUnknownElement, n.Name.Pos, "Unknown element type '%s', treating as custom (type 0x%X with name index %d)", elementName, el.Type, nameIdx)
 		}
-		if char == '#' && !inString {
-			commentIdx = i
-			break
+		if !isDefinitionRoot {
+			if el.Type == ElemTypeApp {
+				if state.HasApp || parentIndex != -1 {
+					return state.errorAt(CodeElement, n.Name.Pos, "'App' element must be the single root element")
+				}
+				state.HasApp = true
+				state.HeaderFlags |= FlagHasApp
+			} else if parentIndex == -1 && !state.HasApp && !el.IsComponentInstance {
+				return state.errorAt(CodeElement, n.Name.Pos, "root element must be 'App' or a component usage, found standard element '%s'", elementName)
+			}
+		}
+	}
+
+	if parentIndex != -1 {
+		parent := &state.Elements[parentIndex]
+		if len(parent.SourceChildrenIndices) >= state.target.MaxChildren {
+			return state.limitReached(state.errorAt(CodeLimit, n.Name.Pos, "max children (%d) for parent '%s' on target '%s'", state.target.MaxChildren, parent.SourceElementName, state.target.Name))
 		}
-		prevRune = char
+		parent.SourceChildrenIndices = append(parent.SourceChildrenIndices, elementIndex)
 	}
-	if commentIdx != -1 {
-		line = line[:commentIdx]
+	state.Elements = append(state.Elements, el)
+	if isDefinitionRoot {
+		def.DefinitionRootElementIndex = elementIndex
 	}
-	return strings.TrimSpace(line)
+
+	return state.parseNodes(n.Body.Nodes, func(child syntax.Node) error {
+		current := &state.Elements[elementIndex]
+		switch child := child.(type) {
+		case *syntax.Property:
+			if child.Body != nil {
+				return state.parseEdgeInsets(child, current.addSourceProperty)
+			}
+			if err := current.addSourceProperty(child.Key.Text, child.Value.Raw, child.Key.Pos, valuePos(child)); err != nil {
+				return state.errorAt(CodeLimit, child.Key.Pos, "%w", err) // Error from addSourceProperty
+			}
+			return nil
+		case *syntax.Element:
+			return state.parseElement(child, elementIndex, nil, depth+1)
+		case *syntax.State:
+			return state.parseStateBlock(child, &current.StateBlocks, fmt.Sprintf("element '%s'", elementName))
+		case *syntax.Media:
+			return state.parseMediaBlock(child, &current.MediaBlocks, fmt.Sprintf("element '%s'", elementName))
+		}
+		return state.misplaced(child, CtxElement)
+	})
 }
 
-func splitFirstWord(line string) (firstWord, rest string) {
-	trimmed := strings.TrimSpace(line)
-	spaceIdx := strings.IndexFunc(trimmed, unicode.IsSpace)
-	if spaceIdx == -1 {
-		return trimmed, ""
+// --- State and Media Blocks ---
+
+// parseStateBlock adds a `state hover { ... }` block to blocks. Its properties
+// are style properties, converted when the style or element is resolved.
+// owner names the enclosing style or element for messages.
+func (state *CompilerState) parseStateBlock(n *syntax.State, blocks *[]StateBlock, owner string) error {
+	line, name := n.At.Line, n.Name.Text
+	if !state.target.StateStyles {
+		return state.errorAt(CodeStyle, n.At, "state blocks need style variants, which target '%s' does not support", state.target.Name)
+	}
+	st, ok := krb.StateByName(name)
+	if !ok {
+		return state.errorAt(CodeStyle, n.Name.Pos, "unknown state '%s' in %s (expected one of %s)", name, owner, strings.Join(krb.StateNames(), ", "))
 	}
-	return trimmed[:spaceIdx], strings.TrimSpace(trimmed[spaceIdx+1:])
+	for _, prev := range *blocks {
+		if prev.State == st {
+			return withRelated(state.errorAt(CodeRedefinition, n.Name.Pos, "state '%s' redefined in %s", name, owner),
+				state.relatedAt(prev.LineNum, "state", "previous definition is here"))
+		}
+	}
+	*blocks = append(*blocks, StateBlock{State: st, propertyBlock: propertyBlock{LineNum: line}})
+	block := &(*blocks)[len(*blocks)-1] // Nothing else is added to blocks while parsing the body
+	return state.parseBlockProperties(&block.propertyBlock, n.Body, CtxState, fmt.Sprintf("state '%s' of %s", name, owner))
 }
 
-func extractContentOfFirstBlockOnLine(lineSegmentStartingWithBrace string) (contentString string, childBlockFollows bool, isSelfClosed bool) {
-	trimmedSegment := strings.TrimSpace(lineSegmentStartingWithBrace)
-	if !strings.HasPrefix(trimmedSegment, "{") {
-		return "", false, false
+// parseMediaBlock adds an `@media (min_width: 600) { ... }` block to blocks.
+// Like a state block, it holds style properties.
+func (state *CompilerState) parseMediaBlock(n *syntax.Media, blocks *[]MediaBlock, owner string) error {
+	line := n.At.Line
+	if !state.target.MediaQueries {
+		return state.errorAt(CodeMedia, n.At, "@media blocks need media variants, which target '%s' does not support", state.target.Name)
 	}
+	conds, err := state.parseMediaQuery(n.Query, n.At)
+	if err != nil {
+		return err
+	}
+	query := krb.FormatMediaQuery(conds)
+	for _, prev := range *blocks {
+		if slices.Equal(prev.Conditions, conds) {
+			return withRelated(state.errorAt(CodeRedefinition, n.At, "@media %s redefined in %s", query, owner),
+				state.relatedAt(prev.LineNum, "@media", "previous definition is here"))
+		}
+	}
+	*blocks = append(*blocks, MediaBlock{Conditions: conds, propertyBlock: propertyBlock{LineNum: line}})
+	block := &(*blocks)[len(*blocks)-1]
+	return state.parseBlockProperties(&block.propertyBlock, n.Body, CtxMedia, fmt.Sprintf("@media %s of %s", query, owner))
+}
 
-	balance := 0
-	firstBraceContentEnd := -1
-	inString := false
-	var prevRune rune
-
-	for i, r := range trimmedSegment {
-		if r == '"' && prevRune != '\\' {
-			inString = !inString
+// parseBlockProperties adds the properties of a state or @media body to
+// block. where describes the block for messages.
+func (state *CompilerState) parseBlockProperties(block *propertyBlock, body *syntax.Block, ctx BlockContextType, where string) error {
+	return state.parseNodes(body.Nodes, func(child syntax.Node) error {
+		prop, ok := child.(*syntax.Property)
+		switch {
+		case !ok:
+			return state.misplaced(child, ctx)
+		case prop.Body != nil:
+			return state.parseEdgeInsets(prop, block.addSourceProperty)
+		}
+		key, keyPos := prop.Key.Text, prop.Key.Pos
+		switch {
+		case key == "extends" || key == "animation" || key == "style":
+			return state.errorAt(CodeStyle, keyPos, "'%s' is not allowed in %s", key, where)
+		case isEventKey(key):
+			return state.errorAt(CodeStyle, keyPos, "event handler '%s' is not allowed in %s", key, where)
+		}
+		if err := block.addSourceProperty(key, prop.Value.Raw, keyPos, valuePos(prop)); err != nil {
+			return state.errorAt(CodeLimit, keyPos, "%w", err)
 		}
-		prevRune = r
+		return nil
+	})
+}
 
-		if r == '{' && !inString {
-			balance++
-		} else if r == '}' && !inString {
-			balance--
-			if balance == 0 {
-				firstBraceContentEnd = i
-				break
+// parseMediaQuery parses `(feature: value) and ...` into conditions sorted
+// by feature. Sizes are in pixels; orientation is portrait or landscape. at is
+// the position of the @media keyword.
+func (state *CompilerState) parseMediaQuery(q syntax.Value, at syntax.Pos) ([]krb.MediaCondition, error) {
+	toks := q.Tokens
+	var conds []krb.MediaCondition
+	for i := 0; ; {
+		if i+5 > len(toks) || toks[i].Kind != syntax.LPAREN || toks[i+1].Kind != syntax.WORD || toks[i+2].Kind != syntax.COLON ||
+			toks[i+3].Kind != syntax.WORD || toks[i+4].Kind != syntax.RPAREN {
+			pos := at
+			if i < len(toks) {
+				pos = toks[i].Pos
+			}
+			return nil, state.errorAt(CodeMedia, pos, "invalid @media query '%s' (expected conditions such as '(min_width: 600) and (orientation: landscape)')", q.Raw)
+		}
+		name, value := toks[i+1].Text, toks[i+3].Text
+		feature, ok := krb.MediaFeatureByName(name)
+		if !ok {
+			return nil, state.errorAt(CodeMedia, toks[i+1].Pos, "unknown @media feature '%s' (expected one of %s)", name, strings.Join(krb.MediaFeatureNames(), ", "))
+		}
+		if slices.ContainsFunc(conds, func(c krb.MediaCondition) bool { return c.Feature == feature }) {
+			return nil, state.errorAt(CodeMedia, toks[i+1].Pos, "@media feature '%s' appears more than once in '%s'", name, q.Raw)
+		}
+		c := krb.MediaCondition{Feature: feature}
+		if feature == krb.MediaOrientation {
+			if c.Value, ok = krb.OrientationByName(value); !ok {
+				return nil, state.errorAt(CodeMedia, toks[i+3].Pos, "invalid orientation '%s' in @media (expected portrait or landscape)", value)
+			}
+		} else {
+			v, err := strconv.ParseUint(value, 10, 16)
+			if err != nil {
+				return nil, state.errorAt(CodeMedia, toks[i+3].Pos, "invalid %s '%s' in @media (expected 0-%d pixels)", name, value, math.MaxUint16)
 			}
+			c.Value = uint16(v)
 		}
-	}
+		conds = append(conds, c)
 
-	if firstBraceContentEnd != -1 {
-		contentString = strings.TrimSpace(trimmedSegment[1:firstBraceContentEnd])
-		isSelfClosed = true
+		if i += 5; i == len(toks) {
+			break
+		}
+		if toks[i].Kind != syntax.WORD || toks[i].Text != "and" || i+1 == len(toks) {
+			return nil, state.errorAt(CodeMedia, toks[i].Pos, "invalid @media query '%s' (join conditions with 'and')", q.Raw)
+		}
+		i++
+	}
+	sort.Slice(conds, func(i, j int) bool { return conds[i].Feature < conds[j].Feature })
 
-		remainingAfterFirstBlock := strings.TrimSpace(trimmedSegment[firstBraceContentEnd+1:])
-		if strings.HasPrefix(remainingAfterFirstBlock, "{") {
-			childBlockFollows = true
-			isSelfClosed = false
-		} else if remainingAfterFirstBlock != "" {
-			// This is an error condition, e.g., "Element {props} garbage"
-			// The parser calling this should probably error out.
-			// For this function, we report what we found structurally.
+	value := func(feature uint8) (uint16, bool) {
+		for _, c := range conds {
+			if c.Feature == feature {
+				return c.Value, true
+			}
 		}
-		return contentString, childBlockFollows, isSelfClosed
+		return 0, false
 	}
-	return "", false, false
+	for _, r := range [][2]uint8{{krb.MediaMinWidth, krb.MediaMaxWidth}, {krb.MediaMinHeight, krb.MediaMaxHeight}} {
+		lo, hasLo := value(r[0])
+		hi, hasHi := value(r[1])
+		if hasLo && hasHi && lo > hi {
+			return nil, state.errorAt(CodeMedia, at, "@media '%s' can never match: %s %d is greater than %s %d",
+				q.Raw, krb.MediaFeatureName(r[0]), lo, krb.MediaFeatureName(r[1]), hi)
+		}
+	}
+	return conds, nil
+}
+
+// --- Edge Insets ---
+
+// edgeInsets collects the sides set in a `padding: { ... }` or `margin: { ... }`
+// block. Pointers differentiate not-set from explicitly "0".
+type edgeInsets struct {
+	Top, Right, Bottom, Left *syntax.Property
 }
 
-func splitPropertiesStringBySemicolon(propsStr string) []string {
-	var props []string
-	var currentProp strings.Builder
-	inQuotes := false
-	var prevRune rune
-	runes := []rune(strings.TrimSpace(propsStr)) // Trim overall string first
+// parseEdgeInsets converts a `padding: { top: N ... }` block into
+// padding_top, padding_right... properties passed to add.
+func (state *CompilerState) parseEdgeInsets(prop *syntax.Property, add func(key, value string, keyPos, valuePos syntax.Pos) error) error {
+	baseKey := prop.Key.Text
+	if baseKey != "padding" && baseKey != "margin" {
+		return state.errorAt(CodeSyntax, prop.Key.Pos, "'%s: {' blocks are only supported for padding and margin", baseKey)
+	}
 
-	for i := 0; i < len(runes); i++ {
-		r := runes[i]
-		if r == '"' && prevRune != '\\' { // Basic quote handling
-			inQuotes = !inQuotes
+	var edges edgeInsets
+	for _, n := range prop.Body.Nodes {
+		side, ok := n.(*syntax.Property)
+		if !ok || side.Body != nil {
+			state.warnAt(CodeIgnoredSyntax, n.Pos(), "Invalid syntax in '%s: {}' block. Expected 'side: value'. Ignored.", baseKey)
+			continue
+		}
+		key := side.Key.Text
+		switch key {
+		case "top":
+			if edges.Top != nil {
+				state.warnAt(CodeIgnoredSyntax, side.Key.Pos, "duplicate 'top' in '%s'. Overwriting.", baseKey)
+			}
+			edges.Top = side
+		case "right":
+			if edges.Right != nil {
+				state.warnAt(CodeIgnoredSyntax, side.Key.Pos, "duplicate 'right' in '%s'. Overwriting.", baseKey)
+			}
+			edges.Right = side
+		case "bottom":
+			if edges.Bottom != nil {
+				state.warnAt(CodeIgnoredSyntax, side.Key.Pos, "duplicate 'bottom' in '%s'. Overwriting.", baseKey)
+			}
+			edges.Bottom = side
+		case "left":
+			if edges.Left != nil {
+				state.warnAt(CodeIgnoredSyntax, side.Key.Pos, "duplicate 'left' in '%s'. Overwriting.", baseKey)
+			}
+			edges.Left = side
+		case "all":
+			if edges.Top != nil || edges.Right != nil || edges.Bottom != nil || edges.Left != nil {
+				state.warnAt(CodeIgnoredSyntax, side.Key.Pos, "'all' specified after individual sides in '%s'. 'all' will overwrite.", baseKey)
+			}
+			edges.Top, edges.Right, edges.Bottom, edges.Left = side, side, side, side
+		case "horizontal":
+			if edges.Left != nil || edges.Right != nil {
+				state.warnAt(CodeIgnoredSyntax, side.Key.Pos, "'horizontal' specified after 'left' or 'right' in '%s'. 'horizontal' will overwrite.", baseKey)
+			}
+			edges.Left, edges.Right = side, side
+		case "vertical":
+			if edges.Top != nil || edges.Bottom != nil {
+				state.warnAt(CodeIgnoredSyntax, side.Key.Pos, "'vertical' specified after 'top' or 'bottom' in '%s'. 'vertical' will overwrite.", baseKey)
+			}
+			edges.Top, edges.Bottom = side, side
+		default:
+			state.warnAt(CodeIgnoredSyntax, side.Key.Pos, "Unexpected key '%s' in '%s: {}' block. Ignored.", key, baseKey)
 		}
-		prevRune = r
+	}
 
-		if r == ';' && !inQuotes {
-			propCandidate := strings.TrimSpace(currentProp.String())
-			if propCandidate != "" { // Add only if non-empty after trim
-				props = append(props, propCandidate)
-			}
-			currentProp.Reset()
+	for _, side := range []struct {
+		suffix string
+		prop   *syntax.Property
+	}{{"_top", edges.Top}, {"_right", edges.Right}, {"_bottom", edges.Bottom}, {"_left", edges.Left}} {
+		if side.prop == nil {
 			continue
 		}
-		currentProp.WriteRune(r)
+		if err := add(baseKey+side.suffix, side.prop.Value.Raw, prop.Key.Pos, valuePos(side.prop)); err != nil {
+			return state.errorAt(CodeLimit, prop.Key.Pos, "error adding converted edge inset property for '%s%s': %w", baseKey, side.suffix, err)
+		}
 	}
+	return nil
+}
 
-	lastPropCandidate := strings.TrimSpace(currentProp.String())
-	if lastPropCandidate != "" { // Add the last property if any content remains
-		props = append(props, lastPropCandidate)
+// --- Helpers ---
+
+// valuePos returns the position of a property's value, or of its key if the
+// value is empty.
+func valuePos(prop *syntax.Property) syntax.Pos {
+	if len(prop.Value.Tokens) > 0 {
+		return prop.Value.Tokens[0].Pos
 	}
-	return props
+	return prop.Key.Pos
+}
+
+// propertyText renders a property for messages as "key: value".
+func propertyText(prop *syntax.Property) string {
+	return prop.Key.Text + ": " + prop.Value.Raw
 }
 
-func (state *CompilerState) addString(text string) (uint8, error) {
+// addString returns the string table index of text, adding it if needed.
+// text is stored exactly as given, already unquoted and decoded.
+func (state *CompilerState) addString(text string) (uint16, error) {
 	if text == "" {
 		if len(state.Strings) == 0 {
 			state.Strings = append(state.Strings, StringEntry{Text: "", Length: 0, Index: 0})
 		}
 		return 0, nil
 	}
-	cleaned := trimQuotes(strings.TrimSpace(text))
-	if cleaned == "" {
-		if len(state.Strings) == 0 {
-			state.Strings = append(state.Strings, StringEntry{Text: "", Length: 0, Index: 0})
-		}
-		return 0, nil
-	}
 	for i := 1; i < len(state.Strings); i++ {
-		if state.Strings[i].Text == cleaned {
+		if state.Strings[i].Text == text {
 			return state.Strings[i].Index, nil
 		}
 	}
 	if len(state.Strings) >= MaxStrings {
-		return 0, fmt.Errorf("maximum string limit (%d) exceeded when adding '%s'", MaxStrings, cleaned)
+		return 0, fmt.Errorf("maximum string limit (%d) exceeded when adding '%s'", MaxStrings, shortValue(text))
+	}
+	if !utf8.ValidString(text) {
+		return 0, fmt.Errorf("string %q is not valid UTF-8", text)
+	}
+	if len(text) > MaxShortStringLength && !state.target.LongStrings {
+		return 0, fmt.Errorf("string '%s' is %d bytes long; target '%s' limits strings to %d bytes", shortValue(text), len(text), state.target.Name, MaxShortStringLength)
 	}
 	if len(state.Strings) == 0 {
 		state.Strings = append(state.Strings, StringEntry{Text: "", Length: 0, Index: 0})
 	}
-	idx := uint8(len(state.Strings))
-	entry := StringEntry{Text: cleaned, Length: len(cleaned), Index: idx}
+	idx := uint16(len(state.Strings))
+	entry := StringEntry{Text: text, Length: len(text), Index: idx}
 	state.Strings = append(state.Strings, entry)
 	return idx, nil
 }
 
-func (state *CompilerState) addResource(resType uint8, pathStr string) (uint8, error) {
-	pathIdx, err := state.addString(pathStr)
-	if err != nil {
-		return 0, fmt.Errorf("failed to add resource path '%s' to string table: %w", pathStr, err)
-	}
-	if pathIdx == 0 && strings.TrimSpace(pathStr) != "" {
-		return 0, fmt.Errorf("resource path '%s' resolved to empty string index", pathStr)
-	}
-	if pathIdx == 0 && strings.TrimSpace(pathStr) == "" {
-		return 0, fmt.Errorf("resource path cannot be empty or whitespace only")
-	}
-
-	format := ResFormatExternal
-	for i := 0; i < len(state.Resources); i++ {
-		if state.Resources[i].Type == resType && state.Resources[i].Format == format && state.Resources[i].DataStringIndex == pathIdx {
-			return state.Resources[i].Index, nil
-		}
-	}
-	if len(state.Resources) >= MaxResources {
-		return 0, fmt.Errorf("maximum resource limit (%d) exceeded", MaxResources)
-	}
-	idx := uint8(len(state.Resources))
-	entry := ResourceEntry{Type: resType, NameIndex: pathIdx, Format: format, DataStringIndex: pathIdx, Index: idx, CalculatedSize: 4}
-	state.Resources = append(state.Resources, entry)
-	state.HeaderFlags |= FlagHasResources
-	return idx, nil
-}
-
 func (state *CompilerState) findComponentDef(name string) *ComponentDefinition {
 	if name == "" {
 		return nil
@@ -891,18 +773,19 @@ func (state *CompilerState) findComponentDef(name string) *ComponentDefinition {
 	return nil
 }
 
-func (el *Element) addSourceProperty(key, value string, lineNum int) error {
+func (el *Element) addSourceProperty(key, value string, keyPos, valuePos syntax.Pos) error {
 	for i := range el.SourceProperties {
 		if el.SourceProperties[i].Key == key {
 			el.SourceProperties[i].ValueStr = value
-			el.SourceProperties[i].LineNum = lineNum
+			el.SourceProperties[i].LineNum = keyPos.Line
+			el.SourceProperties[i].KeyPos, el.SourceProperties[i].ValuePos = keyPos, valuePos
 			return nil
 		}
 	}
 	if len(el.SourceProperties) >= MaxProperties {
 		return fmt.Errorf("maximum source properties (%d) exceeded for element '%s' when adding '%s'", MaxProperties, el.SourceElementName, key)
 	}
-	prop := SourceProperty{Key: key, ValueStr: value, LineNum: lineNum}
+	prop := SourceProperty{Key: key, ValueStr: value, LineNum: keyPos.Line, KeyPos: keyPos, ValuePos: valuePos}
 	el.SourceProperties = append(el.SourceProperties, prop)
 	return nil
 }
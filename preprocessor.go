@@ -1,35 +1,39 @@
 // includes.go (Corrected Include Parsing Logic)
-package main
+package kryc
 
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"unicode" // Need unicode for IsSpace
+
+	"github.com/waozixyz/kryc/syntax"
 )
 
 // readAndProcessIncludes recursively reads a file, processes @include directives, and returns the combined content.
-func readAndProcessIncludes(filePath string, depth int, totalLinesProcessed *int, stateForErrors *CompilerState) (string, error) {
+// The origin of every line written to the result is appended to state.lineOrigins.
+func (state *CompilerState) readAndProcessIncludes(filePath string, depth int, totalLinesProcessed *int) (string, error) {
 	if depth > MaxIncludeDepth {
 		return "", fmt.Errorf("maximum include depth (%d) exceeded: processing '%s'", MaxIncludeDepth, filePath)
 	}
 
-	file, err := os.Open(filePath)
+	content, err := state.readSource(filePath)
 	if err != nil {
 		return "", fmt.Errorf("cannot open include file '%s': %w", filePath, err)
 	}
-	defer file.Close()
 
 	basePath := filepath.Dir(filePath)
+	includeLines := directiveLines(content, "@include")
 	var resultBuffer bytes.Buffer
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1) // A line may be as long as the file, e.g. a long string
 	lineInThisFile := 0
 
-	log.Printf("DEBUG Include: Reading file: %s (Depth: %d)\n", filePath, depth)
+	state.logf("DEBUG Include: Reading file: %s (Depth: %d)\n", filePath, depth)
 
 	for scanner.Scan() {
 		lineInThisFile++
@@ -39,8 +43,8 @@ func readAndProcessIncludes(filePath string, depth int, totalLinesProcessed *int
 		// 1. Trim leading whitespace first
 		trimmedLeading := strings.TrimLeftFunc(line, unicode.IsSpace)
 
-		// 2. Check for @include prefix
-		if strings.HasPrefix(trimmedLeading, "@include") {
+		// 2. Check for @include prefix, outside block comments and """ strings
+		if includeLines[lineInThisFile] {
 			// 3. Extract the part after "@include" and trim space
 			includeDirectivePart := strings.TrimSpace(trimmedLeading[len("@include"):])
 
@@ -54,11 +58,11 @@ func readAndProcessIncludes(filePath string, depth int, totalLinesProcessed *int
 
 					// Check if anything comes AFTER the closing quote (should be whitespace or comment)
 					restOfLine := strings.TrimSpace(includeDirectivePart[1+closingQuoteIndex+1:])
-					isComment := strings.HasPrefix(restOfLine, "#")
+					isComment := strings.HasPrefix(restOfLine, "#") || strings.HasPrefix(restOfLine, "/*")
 
 					if restOfLine == "" || isComment {
 						// Valid Include Found!
-						log.Printf("DEBUG Include (%s L%d): Parsed valid include. Path: '%s'\n", filepath.Base(filePath), lineInThisFile, includePathRaw)
+						state.logf("DEBUG Include (%s L%d): Parsed valid include. Path: '%s'\n", filepath.Base(filePath), lineInThisFile, includePathRaw)
 
 						fullIncludePath := includePathRaw
 						if !filepath.IsAbs(includePathRaw) && !(len(includePathRaw) > 1 && includePathRaw[1] == ':') {
@@ -66,11 +70,15 @@ func readAndProcessIncludes(filePath string, depth int, totalLinesProcessed *int
 						}
 						fullIncludePath = filepath.Clean(fullIncludePath)
 
-						log.Printf("DEBUG Include (%s L%d): Processing include for path: '%s' -> '%s'\n", filepath.Base(filePath), lineInThisFile, includePathRaw, fullIncludePath)
+						state.logf("DEBUG Include (%s L%d): Processing include for path: '%s' -> '%s'\n", filepath.Base(filePath), lineInThisFile, includePathRaw, fullIncludePath)
 
-						includedContent, errInc := readAndProcessIncludes(fullIncludePath, depth+1, totalLinesProcessed, stateForErrors)
+						includedContent, errInc := state.readAndProcessIncludes(fullIncludePath, depth+1, totalLinesProcessed)
 						if errInc != nil {
-							return "", fmt.Errorf("error in included file '%s' (from %s L%d): %w", fullIncludePath, filepath.Base(filePath), lineInThisFile, errInc)
+							var de *DiagnosticError
+							if errors.As(errInc, &de) {
+								return "", errInc // Already located inside the included file
+							}
+							return "", fileErrorf(CodeInclude, filePath, lineInThisFile, line, includePathRaw, "%w", errInc)
 						}
 						resultBuffer.WriteString(includedContent)
 						if !strings.HasSuffix(includedContent, "\n") && len(includedContent) > 0 {
@@ -78,13 +86,16 @@ func readAndProcessIncludes(filePath string, depth int, totalLinesProcessed *int
 						}
 						continue // Skip writing the original @include line
 					} else {
-						log.Printf("Warning (%s L%d): Invalid @include syntax. Found extra characters after closing quote: '%s'. Line ignored.\n", filepath.Base(filePath), lineInThisFile, restOfLine)
+						state.report(newDiagnostic(SeverityWarning, CodeIncludeSyntax, filePath, lineInThisFile, 0, line, restOfLine,
+							fmt.Sprintf("invalid @include syntax. Found extra characters after closing quote: '%s'. Line ignored.", restOfLine)))
 					}
 				} else {
-					log.Printf("Warning (%s L%d): Invalid @include syntax. Missing closing quote. Line ignored.\n", filepath.Base(filePath), lineInThisFile)
+					state.report(newDiagnostic(SeverityWarning, CodeIncludeSyntax, filePath, lineInThisFile, 0, line, "\"",
+						"invalid @include syntax. Missing closing quote. Line ignored."))
 				}
 			} else {
-				log.Printf("Warning (%s L%d): Invalid @include syntax. Path not enclosed in quotes. Line ignored.\n", filepath.Base(filePath), lineInThisFile)
+				state.report(newDiagnostic(SeverityWarning, CodeIncludeSyntax, filePath, lineInThisFile, 0, line, "@include",
+					"invalid @include syntax. Path not enclosed in quotes. Line ignored."))
 			}
 			// If any check above failed, we fall through and treat the line as normal content (effectively ignoring the faulty include)
 		}
@@ -93,28 +104,57 @@ func readAndProcessIncludes(filePath string, depth int, totalLinesProcessed *int
 		// Write the original line to preserve comments and indentation for the parser
 		resultBuffer.WriteString(originalLineForLog)
 		resultBuffer.WriteString("\n")
+		state.lineOrigins = append(state.lineOrigins, lineOrigin{File: filePath, Line: lineInThisFile, Text: line})
 		*totalLinesProcessed++
 
 		if len(line) > MaxLineLength {
-			log.Printf("Warning (%s L%d): Line exceeds MaxLineLength (%d).\n", filepath.Base(filePath), lineInThisFile, MaxLineLength)
+			state.report(newDiagnostic(SeverityWarning, CodeLineTooLong, filePath, lineInThisFile, 0, line, "",
+				fmt.Sprintf("line exceeds MaxLineLength (%d)", MaxLineLength)))
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("error reading file '%s': %w", filePath, err)
+		return "", fileErrorf(CodeIO, filePath, 0, "", "", "error reading file '%s': %w", filePath, err)
 	}
 
 	return resultBuffer.String(), nil
 }
 
+// directiveLines returns the lines of content that start with a word
+// beginning with directive.
+func directiveLines(content []byte, directive string) map[int]bool {
+	lines := make(map[int]bool)
+	toks, _ := syntax.Tokenize(content) // Errors are reported by the parse pass
+	for i, tok := range toks {
+		first := i == 0 || toks[i-1].Kind == syntax.NEWLINE
+		if first && tok.Kind == syntax.WORD && strings.HasPrefix(tok.Text, directive) {
+			lines[tok.Pos.Line] = true
+		}
+	}
+	return lines
+}
+
 // preprocessIncludes is the entry point for include processing.
-func preprocessIncludes(mainFilePath string) (string, int, error) {
+func (state *CompilerState) preprocessIncludes(mainFilePath string) (string, int, error) {
 	totalLines := 0
-	// Pass dummy state, real state not needed until parsing
-	dummyState := &CompilerState{}
-	content, err := readAndProcessIncludes(mainFilePath, 0, &totalLines, dummyState)
+	state.lineOrigins = state.lineOrigins[:0]
+	content, err := state.readAndProcessIncludes(mainFilePath, 0, &totalLines)
 	if err != nil {
+		var de *DiagnosticError
+		if !errors.As(err, &de) {
+			err = fileErrorf(CodeIO, mainFilePath, 0, "", "", "%w", err) // The main file itself could not be read
+		}
 		return "", 0, err
 	}
 	return content, totalLines, nil
 }
+
+// readSource returns the contents of a KRY source or resource file.
+// In-memory sources supplied through Options.Sources take precedence over the
+// file system.
+func (state *CompilerState) readSource(filePath string) ([]byte, error) {
+	if content, ok := state.sources[filepath.Clean(filePath)]; ok {
+		return content, nil
+	}
+	return os.ReadFile(filePath)
+}
@@ -0,0 +1,275 @@
+// properties.go
+package kryc
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/waozixyz/kryc/krb"
+)
+
+// --- KRY Property Keys ---
+
+// kryPropertyKeys lists the KRY keys that resolve to each standard KRB
+// property, preferred spelling first. It mirrors the key switches in the
+// element and style resolvers, which properties_test.go checks, and is used
+// to map PropIDs back to KRY keys. padding_top and the other sides set one
+// side of an element's padding.
+var kryPropertyKeys = map[uint8][]string{
+	PropIDBgColor:       {"background_color"},
+	PropIDFgColor:       {"text_color", "foreground_color"},
+	PropIDBorderColor:   {"border_color"},
+	PropIDBorderWidth:   {"border_width"},
+	PropIDBorderRadius:  {"border_radius"},
+	PropIDPadding:       {"padding", "padding_top", "padding_right", "padding_bottom", "padding_left"},
+	PropIDMargin:        {"margin"},
+	PropIDTextContent:   {"text", "content"},
+	PropIDFontSize:      {"font_size"},
+	PropIDFontWeight:    {"font_weight"},
+	PropIDTextAlignment: {"text_alignment"},
+	PropIDImageSource:   {"source", "image_source"},
+	PropIDOpacity:       {"opacity"},
+	PropIDZindex:        {"z_index"},
+	PropIDVisibility:    {"visibility", "visible"},
+	PropIDGap:           {"gap"},
+	PropIDMinWidth:      {"min_width"},
+	PropIDMinHeight:     {"min_height"},
+	PropIDMaxWidth:      {"max_width", "width"},
+	PropIDMaxHeight:     {"max_height", "height"},
+	PropIDAspectRatio:   {"aspect_ratio"},
+	PropIDTransform:     {"transform"},
+	PropIDShadow:        {"shadow"},
+	PropIDOverflow:      {"overflow"},
+	PropIDLayoutFlags:   {"layout"},
+	PropIDTransition:    {"transition"},
+	PropIDWindowWidth:   {"window_width"},
+	PropIDWindowHeight:  {"window_height"},
+	PropIDWindowTitle:   {"window_title"},
+	PropIDResizable:     {"resizable"},
+	PropIDKeepAspect:    {"keep_aspect"},
+	PropIDScaleFactor:   {"scale_factor"},
+	PropIDIcon:          {"icon"},
+	PropIDVersion:       {"version"},
+	PropIDAuthor:        {"author"},
+}
+
+// kryPropertyValueTypes gives the value type each standard property is
+// encoded with. Size properties also accept percentages (ValTypePercentage).
+var kryPropertyValueTypes = map[uint8]uint8{
+	PropIDBgColor:       ValTypeColor,
+	PropIDFgColor:       ValTypeColor,
+	PropIDBorderColor:   ValTypeColor,
+	PropIDBorderWidth:   ValTypeByte,
+	PropIDBorderRadius:  ValTypeByte,
+	PropIDPadding:       ValTypeEdgeInsets,
+	PropIDMargin:        ValTypeEdgeInsets,
+	PropIDTextContent:   ValTypeString,
+	PropIDFontSize:      ValTypeShort,
+	PropIDFontWeight:    ValTypeEnum,
+	PropIDTextAlignment: ValTypeEnum,
+	PropIDImageSource:   ValTypeResource,
+	PropIDOpacity:       ValTypePercentage,
+	PropIDZindex:        ValTypeShort,
+	PropIDVisibility:    ValTypeByte,
+	PropIDGap:           ValTypeShort,
+	PropIDMinWidth:      ValTypeShort,
+	PropIDMinHeight:     ValTypeShort,
+	PropIDMaxWidth:      ValTypeShort,
+	PropIDMaxHeight:     ValTypeShort,
+	PropIDAspectRatio:   ValTypePercentage,
+	PropIDTransform:     ValTypeString,
+	PropIDShadow:        ValTypeString,
+	PropIDOverflow:      ValTypeEnum,
+	PropIDLayoutFlags:   ValTypeByte,
+	PropIDTransition:    ValTypeTransition,
+	PropIDWindowWidth:   ValTypeShort,
+	PropIDWindowHeight:  ValTypeShort,
+	PropIDWindowTitle:   ValTypeString,
+	PropIDResizable:     ValTypeByte,
+	PropIDKeepAspect:    ValTypeByte,
+	PropIDScaleFactor:   ValTypePercentage,
+	PropIDIcon:          ValTypeResource,
+	PropIDVersion:       ValTypeString,
+	PropIDAuthor:        ValTypeString,
+}
+
+// appOnlyProperties are only resolved on the App element.
+var appOnlyProperties = map[uint8]bool{
+	PropIDWindowWidth: true, PropIDWindowHeight: true, PropIDWindowTitle: true, PropIDResizable: true,
+	PropIDKeepAspect: true, PropIDScaleFactor: true, PropIDIcon: true, PropIDVersion: true, PropIDAuthor: true,
+}
+
+// animatableProperties can be interpolated by the runtime and may be named
+// in a transition.
+var animatableProperties = map[uint8]bool{
+	PropIDBgColor: true, PropIDFgColor: true, PropIDBorderColor: true, PropIDBorderWidth: true,
+	PropIDBorderRadius: true, PropIDPadding: true, PropIDMargin: true, PropIDFontSize: true,
+	PropIDOpacity: true, PropIDGap: true, PropIDMinWidth: true, PropIDMinHeight: true,
+	PropIDMaxWidth: true, PropIDMaxHeight: true, PropIDAspectRatio: true,
+}
+
+// --- Event Keys ---
+
+// kryEventKeys lists the KRY keys of each event handler, preferred spelling
+// first.
+var kryEventKeys = map[uint8][]string{
+	EventTypeClick:     {"onClick", "on_click"},
+	EventTypePress:     {"onPress", "on_press"},
+	EventTypeRelease:   {"onRelease", "on_release"},
+	EventTypeHover:     {"onHover", "on_hover"},
+	EventTypeLeave:     {"onLeave", "on_leave"},
+	EventTypeFocus:     {"onFocus", "on_focus"},
+	EventTypeBlur:      {"onBlur", "on_blur"},
+	EventTypeChange:    {"onChange", "on_change"},
+	EventTypeSubmit:    {"onSubmit", "on_submit"},
+	EventTypeScroll:    {"onScroll", "on_scroll"},
+	EventTypeKeyDown:   {"onKeyDown", "on_key_down"},
+	EventTypeLongPress: {"onLongPress", "on_long_press"},
+}
+
+// eventElements lists the element types that raise each event. Events not
+// listed are raised by every element. Custom elements and component
+// instances are not checked.
+var eventElements = map[uint8][]uint8{
+	EventTypeFocus:   {ElemTypeButton, ElemTypeInput},
+	EventTypeBlur:    {ElemTypeButton, ElemTypeInput},
+	EventTypeKeyDown: {ElemTypeApp, ElemTypeButton, ElemTypeInput},
+	EventTypeChange:  {ElemTypeInput},
+	EventTypeSubmit:  {ElemTypeInput},
+	EventTypeScroll:  {ElemTypeList, ElemTypeGrid, ElemTypeScrollable},
+}
+
+// eventTypeOf returns the event type of an event handler key.
+func eventTypeOf(key string) (uint8, bool) {
+	for t, keys := range kryEventKeys {
+		for _, k := range keys {
+			if k == key {
+				return t, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// isEventKey reports whether key is an event handler.
+func isEventKey(key string) bool {
+	_, ok := eventTypeOf(key)
+	return ok
+}
+
+// looksLikeEventKey reports whether key is spelled like an event handler:
+// "on" followed by an upper case letter or an underscore.
+func looksLikeEventKey(key string) bool {
+	rest, ok := strings.CutPrefix(key, "on")
+	return ok && rest != "" && (rest[0] == '_' || unicode.IsUpper(rune(rest[0])))
+}
+
+// eventKeyList lists the preferred key of every event handler.
+func eventKeyList() string {
+	var keys []string
+	for _, k := range kryEventKeys {
+		keys = append(keys, k[0])
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+// eventSupported reports whether elements of elemType raise events of evType.
+func eventSupported(evType, elemType uint8) bool {
+	types, limited := eventElements[evType]
+	if !limited || elemType >= ElemTypeCustomBase {
+		return true
+	}
+	for _, t := range types {
+		if t == elemType {
+			return true
+		}
+	}
+	return false
+}
+
+// eventElementNames lists the elements that raise events of evType.
+func eventElementNames(evType uint8) string {
+	var names []string
+	for _, t := range eventElements[evType] {
+		names = append(names, krb.ElementTypeName(t))
+	}
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// isKnownKryKey reports whether key is handled by the element resolver as a
+// header field, standard property, event or component control property.
+func isKnownKryKey(key string) bool {
+	switch key {
+	case "id", "style", "pos_x", "pos_y", // Header/structural
+		"animation", // Animation references
+		// Component-specific control properties
+		"bar_style", "orientation", "position":
+		return true
+	}
+	if isEventKey(key) {
+		return true
+	}
+	for _, keys := range kryPropertyKeys {
+		for _, k := range keys {
+			if k == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// --- Property Reference ---
+
+// PropertyInfo describes a KRY property key accepted on elements.
+type PropertyInfo struct {
+	Key       string
+	PropID    uint8 // Standard KRB property ID; 0 for header fields and events
+	ValueType uint8 // KRB value type the value is encoded as; ValTypeNone if not a standard property
+	AppOnly   bool  // Only meaningful on the App element
+	Event     bool  // Event handler taking a callback name
+	EventType uint8 // KRB event type of an event handler
+	Animation bool  // Animation references by @animation name
+}
+
+// headerPropertyKeys are element keys stored in the element header rather
+// than as standard properties. width, height and layout also map to
+// standard properties and are listed with those.
+var headerPropertyKeys = []string{"id", "style", "pos_x", "pos_y"}
+
+// Properties returns every element property key the resolver understands,
+// sorted by key.
+func Properties() []PropertyInfo {
+	var infos []PropertyInfo
+	for _, key := range headerPropertyKeys {
+		infos = append(infos, PropertyInfo{Key: key})
+	}
+	for t, keys := range kryEventKeys {
+		for _, key := range keys {
+			infos = append(infos, PropertyInfo{Key: key, Event: true, EventType: t})
+		}
+	}
+	infos = append(infos, PropertyInfo{Key: "animation", Animation: true})
+	for id, keys := range kryPropertyKeys {
+		for _, key := range keys {
+			infos = append(infos, PropertyInfo{Key: key, PropID: id, ValueType: kryPropertyValueTypes[id], AppOnly: appOnlyProperties[id]})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos
+}
+
+// LookupProperty returns the PropertyInfo for key.
+func LookupProperty(key string) (PropertyInfo, bool) {
+	for _, info := range Properties() {
+		if info.Key == key {
+			return info, true
+		}
+	}
+	return PropertyInfo{}, false
+}
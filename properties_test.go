@@ -0,0 +1,73 @@
+// properties_test.go
+package kryc
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+)
+
+// switchKeys returns the string cases of the `switch key` statements in the
+// function fn of file.
+func switchKeys(t *testing.T, file, fn string) map[string]bool {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]bool)
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Name.Name != fn {
+			continue
+		}
+		ast.Inspect(fd, func(n ast.Node) bool {
+			sw, ok := n.(*ast.SwitchStmt)
+			if !ok {
+				return true
+			}
+			if tag, ok := sw.Tag.(*ast.Ident); !ok || tag.Name != "key" {
+				return true
+			}
+			for _, stmt := range sw.Body.List {
+				for _, expr := range stmt.(*ast.CaseClause).List {
+					if lit, ok := expr.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						key, _ := strconv.Unquote(lit.Value)
+						keys[key] = true
+					}
+				}
+			}
+			return true
+		})
+	}
+	if len(keys) == 0 {
+		t.Fatalf("no key switches found in %s %s", file, fn)
+	}
+	return keys
+}
+
+func TestPropertyKeysMatchResolvers(t *testing.T) {
+	element := switchKeys(t, "resolver.go", "resolveElementRecursive")
+	for key := range element {
+		if !isKnownKryKey(key) {
+			t.Errorf("element resolver handles '%s', which kryPropertyKeys does not list", key)
+		}
+	}
+	for key := range switchKeys(t, "style_resolver.go", "convertStyleProperty") {
+		if _, ok := kryPropertyID(key); !ok {
+			t.Errorf("style resolver handles '%s', which kryPropertyKeys does not list", key)
+		}
+	}
+	for _, keys := range kryPropertyKeys {
+		for _, key := range keys {
+			if !element[key] {
+				t.Errorf("kryPropertyKeys lists '%s', which the element resolver does not handle", key)
+			}
+			if _, ok := LookupProperty(key); !ok {
+				t.Errorf("LookupProperty(%q) failed", key)
+			}
+		}
+	}
+}
@@ -1,13 +1,15 @@
 // resolver.go
-package main
+package kryc
 
 import (
 	"encoding/binary"
 	"fmt"
-	"log"
 	"math"
 	"strconv"
 	"strings"
+
+	"github.com/waozixyz/kryc/krb"
+	"github.com/waozixyz/kryc/syntax"
 )
 
 // componentNameConventionKey is the key used for a KRB Custom Property
@@ -26,6 +28,17 @@ func (el *Element) getSourcePropertyValue(key string) (string, bool) {
 	return "", false
 }
 
+// getSourcePropertyPos returns the positions of the key and value of the last
+// property with the given key, or the element's own line if it has none.
+func (el *Element) getSourcePropertyPos(key string) (keyPos, valuePos syntax.Pos) {
+	for i := len(el.SourceProperties) - 1; i >= 0; i-- {
+		if el.SourceProperties[i].Key == key {
+			return el.SourceProperties[i].KeyPos, el.SourceProperties[i].ValuePos
+		}
+	}
+	return syntax.Pos{Line: el.SourceLineNum}, syntax.Pos{Line: el.SourceLineNum}
+}
+
 // isDeclaredProp checks if a property name is declared in a component definition's Properties block.
 func isDeclaredProp(propName string, declaredProps []ComponentPropertyDef) bool {
 	for _, dp := range declaredProps {
@@ -40,7 +53,7 @@ func isDeclaredProp(propName string, declaredProps []ComponentPropertyDef) bool
 // It iterates through all parsed elements (both main UI tree instances and
 // component template elements) and recursively resolves their properties.
 func (state *CompilerState) resolveComponentsAndProperties() error {
-	log.Println("Pass 1.5: Resolving properties for elements and component instances...")
+	state.logf("Pass 1.5: Resolving properties for elements and component instances...")
 
 	// Reset processed flag for all elements before starting this pass.
 	for i := range state.Elements {
@@ -49,14 +62,13 @@ func (state *CompilerState) resolveComponentsAndProperties() error {
 
 	// Resolve each element. The recursion handles dependencies.
 	// Both main tree instances and template definition elements need this pass.
+	// A failing tree is recorded and the remaining trees are still resolved.
 	for i := range state.Elements {
 		if !state.Elements[i].ProcessedInPass15 {
 			if err := state.resolveElementRecursive(i); err != nil {
-				elName := fmt.Sprintf("index %d", i)
-				if i >= 0 && i < len(state.Elements) {
-					elName = fmt.Sprintf("'%s' (index %d, L%d)", state.Elements[i].SourceElementName, i, state.Elements[i].SourceLineNum)
+				if stop := state.recordError(err); stop != nil {
+					return stop
 				}
-				return fmt.Errorf("error resolving element tree starting at %s: %w", elName, err)
 			}
 		}
 	}
@@ -76,7 +88,10 @@ func (state *CompilerState) resolveComponentsAndProperties() error {
 	// 	log.Printf("Warning: %d/%d elements processed in Pass 1.5. Unprocessed indices: %v...", processedCount, len(state.Elements), unprocessedIndices)
 	// }
 
-	log.Printf("   Property and Component Resolution Pass Complete. Total elements processed: %d\n", processedCount)
+	state.reportUnusedCallbacks()
+	state.reportUnreachableMedia()
+
+	state.logf("   Property and Component Resolution Pass Complete. Total elements processed: %d\n", processedCount)
 	return nil
 }
 
@@ -97,7 +112,8 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 	el.KrbProperties = el.KrbProperties[:0]
 	el.KrbCustomProperties = el.KrbCustomProperties[:0]
 	el.KrbEvents = el.KrbEvents[:0]
-	el.PropertyCount, el.CustomPropCount, el.EventCount = 0, 0, 0
+	el.KrbAnimationRefs = nil
+	el.PropertyCount, el.CustomPropCount, el.EventCount, el.AnimationCount = 0, 0, 0, 0
 	el.StyleID = 0 // Will be determined from source properties or component defaults
 
 	processedSourcePropKeys := make(map[string]bool)
@@ -105,12 +121,12 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 	// --- Step 1: Handle Component Instance Specifics (Placeholder Setup) ---
 	if el.IsComponentInstance {
 		if el.ComponentDef == nil {
-			return fmt.Errorf("L%d: internal: component instance '%s' (idx %d) has nil ComponentDef", el.SourceLineNum, el.SourceElementName, el.SelfIndex)
+			return state.errorf(CodeInternal, el.SourceLineNum, "", "internal: component instance '%s' (idx %d) has nil ComponentDef", el.SourceElementName, el.SelfIndex)
 		}
 		componentDef := el.ComponentDef
 
 		if componentDef.DefinitionRootElementIndex < 0 || componentDef.DefinitionRootElementIndex >= len(state.Elements) {
-			return fmt.Errorf("L%d: internal: component def '%s' has invalid root element index %d for template", el.SourceLineNum, componentDef.Name, componentDef.DefinitionRootElementIndex)
+			return state.errorf(CodeInternal, el.SourceLineNum, "", "internal: component def '%s' has invalid root element index %d for template", componentDef.Name, componentDef.DefinitionRootElementIndex)
 		}
 		// The placeholder element's Type should match the Type of the component definition's root element.
 		defRootTemplateElement := &state.Elements[componentDef.DefinitionRootElementIndex]
@@ -119,22 +135,22 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 		// Add the mandatory _componentName custom property
 		compNameKeyIdx, keyErr := state.addString(componentNameConventionKey)
 		if keyErr != nil {
-			return fmt.Errorf("L%d: error adding string for _componentName key '%s': %w", el.SourceLineNum, componentNameConventionKey, keyErr)
+			return state.errorf(CodeLimit, el.SourceLineNum, "", "error adding string for _componentName key '%s': %w", componentNameConventionKey, keyErr)
 		}
 		compNameValIdx, valErr := state.addString(componentDef.Name)
 		if valErr != nil {
-			return fmt.Errorf("L%d: error adding string for _componentName value '%s': %w", el.SourceLineNum, componentDef.Name, valErr)
+			return state.errorf(CodeLimit, el.SourceLineNum, "", "error adding string for _componentName value '%s': %w", componentDef.Name, valErr)
 		}
 
 		if len(el.KrbCustomProperties) < MaxCustomProperties {
 			el.KrbCustomProperties = append(el.KrbCustomProperties, KrbCustomProperty{
 				KeyIndex:  compNameKeyIdx,
 				ValueType: ValTypeString, // String index for the component name
-				Size:      1,             // Size of the string index (1 byte)
-				Value:     []byte{compNameValIdx},
+				Size:      indexSize,
+				Value:     indexBytes(compNameValIdx),
 			})
 		} else {
-			return fmt.Errorf("L%d: max custom KRB properties (%d) reached for '%s', cannot add _componentName", el.SourceLineNum, MaxCustomProperties, el.SourceElementName)
+			return state.errorf(CodeLimit, el.SourceLineNum, "", "max custom KRB properties (%d) reached for '%s', cannot add _componentName", MaxCustomProperties, el.SourceElementName)
 		}
 		// IMPORTANT: We DO NOT merge SourceProperties from the template into the instance here.
 		// The instance's `el.SourceProperties` are *only* from its KRY usage tag.
@@ -150,9 +166,10 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 	// instantiated component's root.
 	// For template elements, this sets the default style of that template part.
 	if directStyleStr, hasDirectStyle := el.getSourcePropertyValue("style"); hasDirectStyle {
-		err := state.applyStyleStringToElement(el, directStyleStr, el.SourceLineNum)
+		keyPos, valuePos := el.getSourcePropertyPos("style")
+		err := state.applyStyleStringToElement(el, directStyleStr, valuePos)
 		if err != nil {
-			return fmt.Errorf("L%d: error applying style string '%s' to element '%s': %w", el.SourceLineNum, directStyleStr, el.SourceElementName, err)
+			return state.errorAt(CodePropertyValue, keyPos, "error applying style string '%s' to element '%s': %w", directStyleStr, el.SourceElementName, err)
 		}
 		processedSourcePropKeys["style"] = true
 	}
@@ -167,7 +184,8 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 				if cleanedBarStyleName != "" { // User provided a value for bar_style
 					styleID := state.findStyleIDByName(cleanedBarStyleName)
 					if styleID == 0 && cleanedBarStyleName != "" { // Only warn if a non-empty name was not found
-						log.Printf("L%d: Warn: Style '%s' (for 'bar_style' property) on instance '%s' of component '%s' not found.\n", el.SourceLineNum, cleanedBarStyleName, el.SourceElementName, componentDef.Name)
+						_, valuePos := el.getSourcePropertyPos("bar_style")
+						state.warnAt(CodeStyleNotFound, textPosIn(valuePos, barStyleStr, cleanedBarStyleName), "Style '%s' (for 'bar_style' property) on instance '%s' of component '%s' not found.", cleanedBarStyleName, el.SourceElementName, componentDef.Name)
 					}
 					el.StyleID = styleID // This overrides any `style:` on the instance placeholder
 				} else if el.StyleID == 0 { // bar_style: "" was provided, and no `style:` was set, check for bar_style default from Define.Properties
@@ -175,7 +193,8 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 					if defaultStyleName != "" {
 						styleID := state.findStyleIDByName(defaultStyleName)
 						if styleID == 0 && defaultStyleName != "" {
-							log.Printf("L%d: Warn: Default style '%s' (from Define.Properties for 'bar_style') on instance '%s' of component '%s' not found.\n", el.SourceLineNum, defaultStyleName, el.SourceElementName, componentDef.Name)
+							keyPos, _ := el.getSourcePropertyPos("bar_style")
+							state.warnAt(CodeStyleNotFound, keyPos, "Default style '%s' (from Define.Properties for 'bar_style') on instance '%s' of component '%s' not found.", defaultStyleName, el.SourceElementName, componentDef.Name)
 						}
 						el.StyleID = styleID
 					}
@@ -186,7 +205,7 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 				if defaultStyleName != "" {
 					styleID := state.findStyleIDByName(defaultStyleName)
 					if styleID == 0 && defaultStyleName != "" {
-						log.Printf("L%d: Warn: Default style '%s' (from Define.Properties for bar_style) on instance '%s' of component '%s' not found.\n", el.SourceLineNum, defaultStyleName, el.SourceElementName, componentDef.Name)
+						state.warnf(CodeStyleNotFound, el.SourceLineNum, defaultStyleName, "Default style '%s' (from Define.Properties for bar_style) on instance '%s' of component '%s' not found.", defaultStyleName, el.SourceElementName, componentDef.Name)
 					}
 					el.StyleID = styleID
 				}
@@ -203,7 +222,7 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 				}
 				styleID := state.findStyleIDByName(baseStyleName)
 				if styleID == 0 && baseStyleName != "" {
-					log.Printf("L%d: Warn: TabBar fallback default style '%s' not found for instance '%s'.\n", el.SourceLineNum, baseStyleName, el.SourceElementName)
+					state.warnf(CodeStyleNotFound, el.SourceLineNum, "", "TabBar fallback default style '%s' not found for instance '%s'.", baseStyleName, el.SourceElementName)
 				}
 				el.StyleID = styleID
 			}
@@ -211,11 +230,21 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 		}
 	}
 
+	// State and @media blocks on the element apply through a style of its
+	// own that refines the style determined above.
+	if len(el.StateBlocks) > 0 || len(el.MediaBlocks) > 0 {
+		styleID, err := state.elementVariantStyleID(el)
+		if err != nil {
+			return err
+		}
+		el.StyleID = styleID
+	}
+
 	// Process KRY source properties that map to KRB Element Header fields
 	// `el.SourceProperties` here are from the KRY usage tag for instances,
 	// or from the KRY definition for template elements.
 	for _, sp := range el.SourceProperties {
-		key, valStr, lineNum := sp.Key, sp.ValueStr, sp.LineNum
+		key, valStr := sp.Key, sp.ValueStr
 		if processedSourcePropKeys[key] { // Skip if already handled (e.g., style, bar_style)
 			continue
 		}
@@ -286,7 +315,10 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 		}
 
 		if parseErr != nil {
-			return fmt.Errorf("L%d: error parsing header field '%s: %s' for element '%s': %w", lineNum, key, valStr, el.SourceElementName, parseErr)
+			err := state.errorAt(CodePropertyValue, sp.KeyPos, "error parsing header field '%s: %s' for element '%s': %w", key, valStr, el.SourceElementName, parseErr)
+			if stop := state.recordError(err); stop != nil {
+				return stop
+			}
 		}
 		if handledAsHeaderField {
 			processedSourcePropKeys[key] = true
@@ -309,31 +341,39 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 		var handleErr error
 
 		// A. Events
-		if isEventKey(key) { // isEventKey checks "onClick", "onSubmit", etc.
+		eventType, isEvent := eventTypeOf(key)
+		if !isEvent && looksLikeEventKey(key) && (el.ComponentDef == nil || findDeclaredProperty(key, el.ComponentDef.Properties) == nil) {
+			// Misspelled handlers would otherwise be dropped as unhandled properties
+			propProcessedThisIteration = true
+			err := state.errorAt(CodeEvent, sp.KeyPos, "unknown event handler '%s' on element '%s' (expected one of %s)", key, el.SourceElementName, eventKeyList())
+			if stop := state.recordError(err); stop != nil {
+				return stop
+			}
+		}
+		if isEvent {
 			propProcessedThisIteration = true
 			// For component instances, events are attached to the placeholder. Runtime may re-target.
 			// For template elements, events are generally NOT part of the static template definition.
 			if el.IsDefinitionRoot && !el.IsComponentInstance { // If it's an element *within* a Define block's template
-				log.Printf("L%d: Warn: Event handler '%s' defined on template element '%s'. Events are typically instance-specific and should be on the component usage or handled by runtime logic. Ignored for template element.", lineNum, key, el.SourceElementName)
+				state.warnAt(CodeIgnoredEvent, sp.KeyPos, "Event handler '%s' defined on template element '%s'. Events are typically instance-specific and should be on the component usage or handled by runtime logic. Ignored for template element.", key, el.SourceElementName)
 			} else { // Standard element or Component Instance Placeholder
 				if len(el.KrbEvents) < MaxEvents {
-					if cleanedString != "" { // Callback name should not be empty
+					if cleanedString == "" { // Callback name should not be empty
+						state.warnAt(CodeIgnoredEvent, sp.KeyPos, "Empty callback string for event '%s' on element '%s'. Ignored.", key, el.SourceElementName)
+					} else if cbErr := state.checkCallback(cleanedString, eventType, key, textPosIn(sp.ValuePos, valStr, cleanedString)); cbErr != nil {
+						if stop := state.recordError(cbErr); stop != nil {
+							return stop
+						}
+					} else {
 						cbIdx, addErr := state.addString(cleanedString)
 						if addErr == nil {
-							// Map KRY event key to KRB EventType
-							var eventType uint8 = EventTypeClick // Default
-							switch key {
-							case "onClick", "on_click":
-								eventType = EventTypeClick
-								// Add other mappings: onSubmit -> EventTypeSubmit, etc.
-								// case "onSubmit", "on_submit": eventType = EventTypeSubmit
+							if !el.IsComponentInstance && !eventSupported(eventType, el.Type) {
+								state.warnAt(CodeEventElement, sp.KeyPos, "'%s' has no effect on element '%s': only %s elements raise %s events", key, el.SourceElementName, eventElementNames(eventType), krb.EventTypeName(eventType))
 							}
 							el.KrbEvents = append(el.KrbEvents, KrbEvent{EventType: eventType, CallbackID: cbIdx})
 						} else {
 							handleErr = fmt.Errorf("adding event callback string '%s' for event '%s': %w", cleanedString, key, addErr)
 						}
-					} else {
-						log.Printf("L%d: Warn: Empty callback string for event '%s' on element '%s'. Ignored.\n", lineNum, key, el.SourceElementName)
 					}
 				} else { // Max events reached
 					handleErr = fmt.Errorf("maximum events (%d) reached for element '%s' when trying to add '%s'", MaxEvents, el.SourceElementName, key)
@@ -409,7 +449,7 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 				handleErr = addByteProp(el, PropIDBorderRadius, cleanedString)
 			case "opacity":
 				propProcessedThisIteration = true
-				handleErr = addFixedPointProp(el, PropIDOpacity, cleanedString, &state.HeaderFlags)
+				handleErr = addFixedPointProp(state, el, PropIDOpacity, cleanedString)
 			case "visibility", "visible":
 				propProcessedThisIteration = true
 				visVal := uint8(0) // Default to hidden/false
@@ -422,6 +462,15 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 				if handleErr == nil {
 					handleErr = el.addKrbProperty(PropIDVisibility, ValTypeByte, []byte{visVal})
 				}
+			case "animation":
+				propProcessedThisIteration = true
+				el.KrbAnimationRefs, handleErr = state.parseAnimationRefs(valStr)
+			case "transition":
+				propProcessedThisIteration = true
+				var prop *KrbProperty
+				if prop, handleErr = parseTransition(cleanedString); handleErr == nil {
+					handleErr = el.addKrbProperty(prop.PropertyID, prop.ValueType, prop.Value)
+				}
 			case "z_index":
 				propProcessedThisIteration = true
 				zIndexVal, e := strconv.ParseInt(cleanedString, 10, 16) // int16
@@ -451,7 +500,7 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 				if lc == "bold" || lc == "700" {
 					weightVal = 1
 				} else if lc != "normal" && lc != "400" && lc != "" {
-					log.Printf("L%d: Warn: Invalid font_weight '%s' for '%s'. Using 'normal'.", lineNum, cleanedString, el.SourceElementName)
+					state.warnAt(CodeInvalidValue, sp.ValuePos, "Invalid font_weight '%s' for '%s'. Using 'normal'.", cleanedString, el.SourceElementName)
 				}
 				handleErr = el.addKrbProperty(PropIDFontWeight, ValTypeEnum, []byte{weightVal})
 			case "text_alignment":
@@ -465,7 +514,7 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 				case "left", "start", "":
 					alignVal = 0
 				default:
-					log.Printf("L%d: Warn: Invalid text_alignment '%s' for '%s'. Using 'start'.", lineNum, cleanedString, el.SourceElementName)
+					state.warnAt(CodeInvalidValue, sp.ValuePos, "Invalid text_alignment '%s' for '%s'. Using 'start'.", cleanedString, el.SourceElementName)
 				}
 				handleErr = el.addKrbProperty(PropIDTextAlignment, ValTypeEnum, []byte{alignVal})
 			case "gap":
@@ -491,7 +540,7 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 				handleErr = addSizeDimensionProp(state, el, PropIDMaxHeight, cleanedString)
 			case "aspect_ratio":
 				propProcessedThisIteration = true
-				handleErr = addFixedPointProp(el, PropIDAspectRatio, cleanedString, &state.HeaderFlags)
+				handleErr = addFixedPointProp(state, el, PropIDAspectRatio, cleanedString)
 			case "overflow":
 				propProcessedThisIteration = true
 				overflowVal := uint8(0)
@@ -503,13 +552,13 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 				case "visible", "":
 					overflowVal = 0
 				default:
-					log.Printf("L%d: Warn: Invalid overflow '%s' for '%s'. Using 'visible'.", lineNum, cleanedString, el.SourceElementName)
+					state.warnAt(CodeInvalidValue, sp.ValuePos, "Invalid overflow '%s' for '%s'. Using 'visible'.", cleanedString, el.SourceElementName)
 				}
 				handleErr = el.addKrbProperty(PropIDOverflow, ValTypeEnum, []byte{overflowVal})
 			case "image_source", "source":
 				if el.Type == ElemTypeImage || el.Type == ElemTypeButton { // Or if el is a component placeholder whose root can take an image
 					propProcessedThisIteration = true
-					handleErr = state.addKrbResourceProperty(el, PropIDImageSource, ResTypeImage, cleanedString)
+					handleErr = state.addKrbResourceProperty(el, PropIDImageSource, ResTypeImage, valStr)
 				}
 				// If not handled here, it might be a custom property for a component instance.
 			// App-specific props (only apply if el.Type is ElemTypeApp)
@@ -540,7 +589,7 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 			case "icon":
 				if el.Type == ElemTypeApp {
 					propProcessedThisIteration = true
-					handleErr = state.addKrbResourceProperty(el, PropIDIcon, ResTypeImage, cleanedString)
+					handleErr = state.addKrbResourceProperty(el, PropIDIcon, ResTypeImage, valStr)
 				}
 			case "version":
 				if el.Type == ElemTypeApp {
@@ -564,7 +613,7 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 			case "scale_factor":
 				if el.Type == ElemTypeApp {
 					propProcessedThisIteration = true
-					handleErr = addFixedPointProp(el, PropIDScaleFactor, cleanedString, &state.HeaderFlags)
+					handleErr = addFixedPointProp(state, el, PropIDScaleFactor, cleanedString)
 				}
 			}
 		}
@@ -616,14 +665,17 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 			// This warning will trigger if a KRY property isn't an event,
 			// isn't a standard KRB property mapping, and (if it's a component instance)
 			// isn't a declared property in its Define.Properties block.
-			logUnhandledPropWarning(state, el, key, lineNum)
+			logUnhandledPropWarning(state, el, key, sp.KeyPos)
 		}
 
 		if handleErr != nil {
 			if isRecoverablePropError(key, handleErr) {
-				log.Printf("L%d: Recoverable error processing property '%s: %s' for element '%s': %v. Continuing.", lineNum, key, valStr, el.SourceElementName, handleErr)
+				state.warnAt(CodeInvalidValue, sp.KeyPos, "ignoring property '%s: %s' for element '%s': %v", key, shortValue(valStr), el.SourceElementName, handleErr)
 			} else {
-				return fmt.Errorf("L%d: error processing property '%s: %s' for element '%s': %w", lineNum, key, valStr, el.SourceElementName, handleErr)
+				err := state.errorAt(CodePropertyValue, sp.KeyPos, "error processing property '%s: %s' for element '%s': %w", key, shortValue(valStr), el.SourceElementName, handleErr)
+				if stop := state.recordError(err); stop != nil {
+					return stop
+				}
 			}
 		}
 		processedSourcePropKeys[key] = true // Mark this source property key as considered/attempted.
@@ -646,9 +698,6 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 			if parsedPaddingLeft != nil {
 				finalLeft = *parsedPaddingLeft
 			}
-			if foundPaddingShort {
-				log.Printf("L%d: Info: Padding shorthand for '%s' overridden by specific padding_* properties.", el.SourceLineNum, el.SourceElementName)
-			}
 		} else if foundPaddingShort { // Only shorthand 'padding: "v1 v2 v3 v4"' was used
 			parts := strings.Fields(parsedPaddingShort)
 			switch len(parts) {
@@ -678,21 +727,30 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 				if e1 == nil && e2 == nil && e3 == nil && e4 == nil {
 					finalTop, finalRight, finalBottom, finalLeft = uint8(v1), uint8(v2), uint8(v3), uint8(v4)
 				} else {
-					paddingErr = fmt.Errorf("parsing 4-value padding: e1=%v..e4=%v", e1, e2, e3, e4)
+					paddingErr = fmt.Errorf("parsing 4-value padding: e1=%v, e2=%v, e3=%v, e4=%v", e1, e2, e3, e4)
 				}
 			default:
 				paddingErr = fmt.Errorf("invalid number of values (%d) for 'padding' shorthand: '%s'. Expected 1, 2, or 4.", len(parts), parsedPaddingShort)
 			}
 		}
 		if paddingErr != nil {
-			return fmt.Errorf("L%d: error finalizing padding for element '%s': %w", el.SourceLineNum, el.SourceElementName, paddingErr)
+			return state.errorf(CodePropertyValue, el.SourceLineNum, "padding", "error finalizing padding for element '%s': %w", el.SourceElementName, paddingErr)
 		}
 		if addErr := el.addKrbProperty(PropIDPadding, ValTypeEdgeInsets, []byte{finalTop, finalRight, finalBottom, finalLeft}); addErr != nil {
-			return fmt.Errorf("L%d: error adding KRB padding property for element '%s': %w", el.SourceLineNum, el.SourceElementName, addErr)
+			return state.errorf(CodeLimit, el.SourceLineNum, "padding", "error adding KRB padding property for element '%s': %w", el.SourceElementName, addErr)
 		}
 	}
 	// (Similar finalization for margin if complex margin parsing is implemented)
 
+	// --- Step 3.2: Animations from Style ---
+	// KRB styles carry no animation references, so the element gets those of
+	// its style unless it has its own `animation` property.
+	if _, hasOwn := el.getSourcePropertyValue("animation"); !hasOwn && el.StyleID != 0 {
+		if style := state.findStyleByID(el.StyleID); style != nil {
+			el.KrbAnimationRefs = style.AnimationRefs
+		}
+	}
+
 	// --- Step 4: Finalize Layout Byte ---
 	// `el.LayoutFlagsSource` was set from the KRY `layout:` string earlier.
 	// Now, incorporate style's layout. Element's direct `layout:` wins over style's.
@@ -736,7 +794,7 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 	el.Children = make([]*Element, 0, len(el.SourceChildrenIndices)) // Reset for this resolution pass
 	for _, childIndexInState := range el.SourceChildrenIndices {
 		if childIndexInState < 0 || childIndexInState >= len(state.Elements) {
-			return fmt.Errorf("L%d: element '%s' (idx %d) has invalid child index %d in SourceChildrenIndices", el.SourceLineNum, el.SourceElementName, el.SelfIndex, childIndexInState)
+			return state.errorf(CodeInternal, el.SourceLineNum, "", "element '%s' (idx %d) has invalid child index %d in SourceChildrenIndices", el.SourceElementName, el.SelfIndex, childIndexInState)
 		}
 
 		childEl := &state.Elements[childIndexInState]
@@ -749,11 +807,10 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 		}
 
 		if err := state.resolveElementRecursive(childIndexInState); err != nil {
-			childName := fmt.Sprintf("index %d", childIndexInState)
-			if childIndexInState < len(state.Elements) {
-				childName = fmt.Sprintf("'%s'(idx %d L%d)", state.Elements[childIndexInState].SourceElementName, childIndexInState, state.Elements[childIndexInState].SourceLineNum)
+			// Record the failing child and carry on with its siblings.
+			if stop := state.recordError(err); stop != nil {
+				return stop
 			}
-			return fmt.Errorf("error resolving child %s of element '%s' (L%d): %w", childName, el.SourceElementName, el.SourceLineNum, err)
 		}
 		el.Children = append(el.Children, childEl)
 	}
@@ -764,8 +821,8 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 	el.EventCount = uint8(len(el.KrbEvents))
 	// el.ChildCount is based on the el.Children slice populated above,
 	// which reflects the correct context (instance children vs. template children).
-	el.ChildCount = uint8(len(el.Children))
-	el.AnimationCount = 0 // Not implemented
+	el.ChildCount = uint16(len(el.Children))
+	el.AnimationCount = uint8(len(el.KrbAnimationRefs))
 
 	return nil
 }
@@ -773,38 +830,49 @@ func (state *CompilerState) resolveElementRecursive(elementIndex int) error {
 // applyStyleStringToElement attempts to parse a style string (single or array)
 // and set the element's StyleID.
 // For KRB's single StyleID, if an array is given, it currently warns and uses the first valid one.
-func (state *CompilerState) applyStyleStringToElement(el *Element, styleStr string, lineNum int) error {
+// pos is the position of styleStr in the source.
+func (state *CompilerState) applyStyleStringToElement(el *Element, styleStr string, pos syntax.Pos) error {
 	cleanedFullStyleString, _ := cleanAndQuoteValue(styleStr) // Clean the whole string "value" part
 
 	if strings.HasPrefix(cleanedFullStyleString, "[") && strings.HasSuffix(cleanedFullStyleString, "]") {
 		// It's an array string, e.g., ["style1", "style2"]
 		content := cleanedFullStyleString[1 : len(cleanedFullStyleString)-1] // Remove brackets
-		parts := strings.Split(content, ",")
-		firstStyleNameFound := ""
-
-		if len(parts) > 0 {
-			for _, partStr := range parts {
-				// Each part inside the array should be a quoted string like "style_name"
-				individualName, wasQuoted := cleanAndQuoteValue(strings.TrimSpace(partStr))
-				if wasQuoted && individualName != "" {
-					firstStyleNameFound = individualName
-					break // Found the first valid style name in the array
-				}
+		var styleNames []string
+		for _, partStr := range strings.Split(content, ",") {
+			// Each part inside the array should be a quoted string like "style_name"
+			individualName, wasQuoted := cleanAndQuoteValue(strings.TrimSpace(partStr))
+			if !wasQuoted || individualName == "" {
+				continue
 			}
+			if state.findStyleByName(individualName) == nil {
+				namePos := textPosIn(pos, styleStr, `"`+individualName+`"`)
+				namePos.Column++ // Past the quote
+				state.warnAt(CodeStyleNotFound, namePos, "Style '%s' (from array style for element '%s') not found.", individualName, el.SourceElementName)
+				continue
+			}
+			styleNames = append(styleNames, individualName)
 		}
 
-		if firstStyleNameFound != "" {
-			if len(parts) > 1 { // Only log warning if there actually were multiple styles listed
-				log.Printf("L%d: Warn: Element '%s' uses array style '%s'. KRB supports only one StyleID per element. Applying first valid style '%s'. True multi-style application needs runtime support.", lineNum, el.SourceElementName, styleStr, firstStyleNameFound)
+		switch len(styleNames) {
+		case 0: // Array was empty "[]" or contained no valid quoted style names
+			state.warnAt(CodeStyleProperty, pos, "Element '%s' has empty or invalid array style definition: '%s'. No style applied from this definition.", el.SourceElementName, styleStr)
+			el.StyleID = 0 // Explicitly no style if array is invalid/empty
+		case 1:
+			el.StyleID = state.findStyleIDByName(styleNames[0])
+		default:
+			if state.findStyleByName(strings.Join(styleNames, "+")) == nil && (len(el.StateBlocks) > 0 || len(el.MediaBlocks) > 0) {
+				style, err := state.compositeStyle(styleNames)
+				if err != nil {
+					return err
+				}
+				el.VariantBase = style // Only the element's own variant style uses it
+				return nil
 			}
-			styleID := state.findStyleIDByName(firstStyleNameFound)
-			if styleID == 0 { // First style name from array not found
-				log.Printf("L%d: Warn: Style '%s' (from array style for element '%s') not found.", lineNum, firstStyleNameFound, el.SourceElementName)
+			styleID, err := state.compositeStyleID(styleNames)
+			if err != nil {
+				return err
 			}
 			el.StyleID = styleID
-		} else { // Array was empty "[]" or contained no valid quoted style names
-			log.Printf("L%d: Warn: Element '%s' has empty or invalid array style definition: '%s'. No style applied from this definition.", lineNum, el.SourceElementName, styleStr)
-			el.StyleID = 0 // Explicitly no style if array is invalid/empty
 		}
 		return nil
 	}
@@ -815,7 +883,7 @@ func (state *CompilerState) applyStyleStringToElement(el *Element, styleStr stri
 		if styleID == 0 {
 			// This is the warning for `style: "non_existent_style"`
 			// And also for the previous error `style: ["s1","s2"]` if it wasn't caught by the array check above
-			log.Printf("L%d: Warn: Style '%s' not found for element '%s'.\n", lineNum, cleanedFullStyleString, el.SourceElementName)
+			state.warnAt(CodeStyleNotFound, textPosIn(pos, styleStr, cleanedFullStyleString), "Style '%s' not found for element '%s'.", cleanedFullStyleString, el.SourceElementName)
 		}
 		el.StyleID = styleID
 	} else {
@@ -824,20 +892,6 @@ func (state *CompilerState) applyStyleStringToElement(el *Element, styleStr stri
 	return nil
 }
 
-// isEventKey checks if a KRY property key is an event handler.
-func isEventKey(key string) bool {
-	// Add more event keys as your KRY spec defines them
-	switch key {
-	case "onClick", "on_click",
-		"onSubmit", "on_submit",
-		"onChange", "on_change":
-		// Add more cases here: "onHover", "onFocus", etc.
-		return true
-	default:
-		return false
-	}
-}
-
 // --- Helper Functions ---
 
 func barStyleIsDeclared(def *ComponentDefinition) bool {
@@ -882,17 +936,25 @@ func parseKryValueToKrbBytes(state *CompilerState, valStr string, hint uint8, pr
 	// valStr is assumed to be already cleaned by the caller (via cleanAndQuoteValue)
 	switch hint {
 	case ValTypeString, ValTypeStyleID, ValTypeResource, ValTypeEnum: // These all become string indices in KRB Custom Props
+		if res, isRef, err := state.resourceRef(valStr); isRef && hint == ValTypeResource {
+			// Declared resources are stored by logical name, which is their NameIndex
+			if err != nil {
+				return nil, 0, 0, err
+			}
+			return indexBytes(res.NameIndex), ValTypeString, indexSize, nil
+		}
 		idx, e := state.addString(valStr)
 		if e != nil {
-			return nil, 0, 0, fmt.Errorf("adding string for custom prop '%s' ('%s'): %w", propKey, valStr, e)
+			return nil, 0, 0, fmt.Errorf("adding string for custom prop '%s' ('%s'): %w", propKey, shortValue(valStr), e)
 		}
 		if hint == ValTypeResource && valStr != "" {
-			// guessResourceType needs to be robust or replaced with more explicit KRY syntax for resource types
-			if _, resErr := state.addResource(guessResourceType(propKey), valStr); resErr != nil {
-				log.Printf("L%d: Warn: Failed to add resource '%s' (hinted for custom prop '%s'): %v. Storing as string index only.", lineNum, valStr, propKey, resErr)
+			// Undeclared resources get their type from the key; @resources declares it explicitly
+			resType, _ := guessResourceType(propKey) // Image unless the key says otherwise
+			if _, resErr := state.addResource(resType, valStr, false); resErr != nil {
+				state.warnf(CodeInvalidValue, lineNum, propKey, "Failed to add resource '%s' (hinted for custom prop '%s'): %v. Storing as string index only.", valStr, propKey, resErr)
 			}
 		}
-		return []byte{idx}, ValTypeString, 1, nil // KRB ValueType for custom prop is String Index
+		return indexBytes(idx), ValTypeString, indexSize, nil // KRB ValueType for custom prop is String Index
 
 	case ValTypeColor:
 		colBytes, ok := parseColor(valStr) // parseColor expects "#RRGGBBAA" etc.
@@ -929,7 +991,7 @@ func parseKryValueToKrbBytes(state *CompilerState, valStr string, hint uint8, pr
 			}
 		}
 		if !parsed { // If still not parsed (e.g. invalid bool/byte string)
-			log.Printf("L%d: Warn: Invalid Bool/Byte string '%s' for custom prop '%s'. Using default 0/false.", lineNum, valStr, propKey)
+			state.warnf(CodeInvalidValue, lineNum, propKey, "Invalid Bool/Byte string '%s' for custom prop '%s'. Using default 0/false.", valStr, propKey)
 			byteVal = 0 // Default to 0/false on parse error for custom prop
 		}
 		return []byte{byteVal}, ValTypeByte, 1, nil
@@ -957,12 +1019,11 @@ func parseKryValueToKrbBytes(state *CompilerState, valStr string, hint uint8, pr
 		return buf, ValTypePercentage, 2, nil // KRB ValueType is Percentage (which means 8.8 fixed point)
 
 	default: // ValTypeCustom hint from KRY or other unhandled KRY type hints for custom props
-		log.Printf("L%d: Info: Custom prop '%s' (KRY hint %d) storing raw value '%s' as KRB String Index.", lineNum, propKey, hint, valStr)
 		idx, e := state.addString(valStr)
 		if e != nil {
-			return nil, 0, 0, fmt.Errorf("adding string for custom prop '%s' (unknown KRY hint %d, value '%s'): %w", propKey, hint, valStr, e)
+			return nil, 0, 0, fmt.Errorf("adding string for custom prop '%s' (unknown KRY hint %d, value '%s'): %w", propKey, hint, shortValue(valStr), e)
 		}
-		return []byte{idx}, ValTypeString, 1, nil // Default to storing as a string index
+		return indexBytes(idx), ValTypeString, indexSize, nil // Default to storing as a string index
 	}
 }
 
@@ -976,7 +1037,7 @@ func addSizeDimensionProp(state *CompilerState, el *Element, propID uint8, valSt
 		}
 		if percentF < 0 { // Percentages should not be negative for dimensions
 			percentF = 0 // Clamp to 0
-			log.Printf("L%d: Warn: Negative percentage '%s' for prop ID 0x%X treated as 0%%.", el.SourceLineNum, valStr, propID)
+			state.warnf(CodeInvalidValue, el.SourceLineNum, valStr, "Negative percentage '%s' for prop ID 0x%X treated as 0%%.", valStr, propID)
 		}
 		// Convert 0-100 (or more for >100%) percent range to 0.0-1.0 float, then to 8.8 fixed point
 		// Example: "50%" -> 50.0 -> 0.5 -> 0.5 * 256 = 128
@@ -1031,7 +1092,7 @@ func addShortProp(el *Element, propID uint8, cleanValStr string) error {
 
 // addFixedPointProp handles KRY float "0.0-1.0" (e.g. opacity) or percentage strings "N%"
 // -> KRB 8.8 Percentage (uint16)
-func addFixedPointProp(el *Element, propID uint8, cleanValStr string, headerFlags *uint16) error {
+func addFixedPointProp(state *CompilerState, el *Element, propID uint8, cleanValStr string) error {
 	f, err := strconv.ParseFloat(cleanValStr, 64)
 	if err != nil { // If direct float parse failed, check for percentage string
 		if strings.HasSuffix(cleanValStr, "%") {
@@ -1059,7 +1120,7 @@ func addFixedPointProp(el *Element, propID uint8, cleanValStr string, headerFlag
 	// For aspect ratio, ensure non-negative
 	if propID == PropIDAspectRatio && f < 0.0 {
 		f = 0.0
-		log.Printf("L%d: Warn: Negative aspect_ratio '%s' treated as 0.0", el.SourceLineNum, cleanValStr)
+		state.warnf(CodeInvalidValue, el.SourceLineNum, cleanValStr, "Negative aspect_ratio '%s' treated as 0.0", cleanValStr)
 	}
 
 	fpVal := uint16(math.Round(f * 256.0)) // Convert to 8.8 fixed point
@@ -1067,7 +1128,7 @@ func addFixedPointProp(el *Element, propID uint8, cleanValStr string, headerFlag
 	binary.LittleEndian.PutUint16(buf, fpVal)
 	propErr := el.addKrbProperty(propID, ValTypePercentage, buf) // KRB ValTypePercentage is for 8.8
 	if propErr == nil {
-		*headerFlags |= FlagFixedPoint // Ensure global flag is set if fixed point values are used
+		state.HeaderFlags |= FlagFixedPoint // Ensure global flag is set if fixed point values are used
 	}
 	return propErr
 }
@@ -1082,27 +1143,9 @@ func handleSimpleMarginProperty(el *Element, propID uint8, cleanVal string) erro
 	return el.addKrbProperty(propID, ValTypeEdgeInsets, buf)
 }
 
-func logUnhandledPropWarning(state *CompilerState, el *Element, key string, lineNum int) {
-	// This map helps avoid warnings for properties that are handled elsewhere (e.g., header fields, style directives).
-	knownHandledKryKeys := map[string]bool{
-		"id": true, "style": true, "layout": true, "pos_x": true, "pos_y": true, "width": true, "height": true, // Header/structural
-		// Standard KRY properties that map to KRB standard properties:
-		"background_color": true, "text_color": true, "foreground_color": true, "border_color": true, "border_width": true,
-		"border_radius": true, "opacity": true, "visibility": true, "visible": true, "z_index": true, "transform": true,
-		"shadow": true, "text": true, "content": true, "font_size": true, "font_weight": true, "text_alignment": true,
-		"gap": true, "min_width": true, "min_height": true, "max_width": true, "max_height": true, "aspect_ratio": true,
-		"overflow": true, "image_source": true, "source": true, "padding": true, "padding_top": true, "padding_right": true,
-		"padding_bottom": true, "padding_left": true, "margin": true, // Add margin_* if handled separately
-		// Event handlers
-		"onClick": true, "on_click": true, // Add others like onChange
-		// App specific properties
-		"window_width": true, "window_height": true, "window_title": true, "resizable": true, "icon": true,
-		"version": true, "author": true, "keep_aspect": true, "scale_factor": true,
-		// Component-specific control properties that might be handled before custom prop stage
-		// or are known to become custom properties if declared.
-		"bar_style": true, "orientation": true, "position": true,
-	}
-	if knownHandledKryKeys[key] {
+func logUnhandledPropWarning(state *CompilerState, el *Element, key string, keyPos syntax.Pos) {
+	// Avoid warnings for properties that are handled elsewhere (e.g., header fields, style directives).
+	if isKnownKryKey(key) {
 		return // Property is known to be handled or is a direct field.
 	}
 
@@ -1120,10 +1163,10 @@ func logUnhandledPropWarning(state *CompilerState, el *Element, key string, line
 			if findDeclaredProperty(key, el.ComponentDef.Properties) != nil {
 				// This means it was declared in Define.Properties but the resolver logic
 				// for custom props didn't convert it. This could be an issue.
-				log.Printf("L%d: Info: Declared KRY property '%s' for component '%s' was not mapped to a KRB property. Review resolver logic. Ignored for KRB output.", lineNum, key, el.ComponentDef.Name)
+				state.warnAt(CodeComponentProperty, keyPos, "declared property '%s' of component '%s' was not mapped to a KRB property. Ignored", key, el.ComponentDef.Name)
 			} else {
 				// This is an undeclared property on a component instance.
-				log.Printf("L%d: Warn: Undeclared KRY property '%s' found on component instance of '%s'. Ignored.", lineNum, key, el.ComponentDef.Name)
+				state.warnAt(CodeComponentProperty, keyPos, "Undeclared KRY property '%s' found on component instance of '%s'. Ignored.", key, el.ComponentDef.Name)
 			}
 			return // Stop further warnings for this key on this instance
 		}
@@ -1131,11 +1174,11 @@ func logUnhandledPropWarning(state *CompilerState, el *Element, key string, line
 
 	// If it's not an instance, or it's an instance but not component-related,
 	// and not a standard KRY/KRB prop, then it's truly unhandled.
-	log.Printf("L%d: Warn: Unhandled KRY property '%s: ...' for standard element '%s' (type 0x%X). Ignored for KRB output.", lineNum, key, el.SourceElementName, el.Type)
+	state.warnAt(CodeUnhandledProperty, keyPos, "Unhandled KRY property '%s: ...' for standard element '%s' (type 0x%X). Ignored for KRB output.", key, el.SourceElementName, el.Type)
 }
 
 // findStyleByID finds a style entry by its 1-based KRB ID.
-func (state *CompilerState) findStyleByID(styleID uint8) *StyleEntry {
+func (state *CompilerState) findStyleByID(styleID uint16) *StyleEntry {
 	if styleID == 0 { // StyleID 0 means no style
 		return nil
 	}
@@ -1156,7 +1199,7 @@ func (state *CompilerState) findStyleByID(styleID uint8) *StyleEntry {
 	return nil
 }
 
-func (state *CompilerState) findStyleIDByName(name string) uint8 {
+func (state *CompilerState) findStyleIDByName(name string) uint16 {
 	if style := state.findStyleByName(name); style != nil {
 		return style.ID
 	}
@@ -1178,14 +1221,14 @@ func (state *CompilerState) findStyleByName(name string) *StyleEntry {
 
 // getStringIndex finds the 0-based index of a string in the compiler's string table.
 // Assumes cleanedText has already been processed by cleanAndQuoteValue if it came from source.
-func (state *CompilerState) getStringIndex(cleanedText string) (uint8, bool) {
+func (state *CompilerState) getStringIndex(cleanedText string) (uint16, bool) {
 	if cleanedText == "" {
 		// Ensure index 0 "" string exists. addString handles this.
 		if len(state.Strings) == 0 || state.Strings[0].Text != "" {
 			// This situation should ideally be prevented by addString always ensuring "" is at index 0.
 			// For robustness, if "" isn't at index 0, try adding it.
 			if _, err := state.addString(""); err != nil {
-				log.Printf("Critical: Failed to ensure empty string at index 0 of string table: %v", err)
+				state.logf("Critical: Failed to ensure empty string at index 0 of string table: %v", err)
 				return 0, false // Cannot proceed reliably
 			}
 		}
@@ -0,0 +1,234 @@
+// resources.go
+package kryc
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/waozixyz/kryc/krb"
+	"github.com/waozixyz/kryc/syntax"
+)
+
+// --- Resource Declarations ---
+// An `@resources { logo: image "img/logo.png" }` block declares resources
+// with an explicit type and a logical name, which becomes the entry's
+// NameIndex in the Resource Table. Properties refer to them as `$res.logo`.
+// Resources can also be referenced by path, in which case the path doubles
+// as the name and component properties guess the type from their key.
+
+// resourceNamespace is the reserved variable name that prefixes references
+// to declared resources, as in `$res.logo`.
+const resourceNamespace = "res"
+
+func (state *CompilerState) parseResources(n *syntax.Resources) error {
+	return state.parseNodes(n.Body.Nodes, func(child syntax.Node) error {
+		def, ok := child.(*syntax.Property)
+		if !ok || def.Body != nil {
+			return state.misplaced(child, CtxResources)
+		}
+		return state.parseResourceDecl(def)
+	})
+}
+
+// parseResourceDecl adds one `name: type "path" [embed]` declaration to the
+// Resource Table.
+func (state *CompilerState) parseResourceDecl(def *syntax.Property) error {
+	line, name := def.Key.Pos.Line, def.Key.Text
+	if !isValidIdentifier(name) {
+		return state.errorAt(CodeResource, def.Key.Pos, "invalid resource name '%s'", name)
+	}
+	if existing := state.findResourceByName(name); existing != nil {
+		return withRelated(state.errorAt(CodeRedefinition, def.Key.Pos, "resource '%s' redefined", name),
+			state.relatedAt(existing.DefLine, name, "previous definition is here"))
+	}
+
+	groups, err := valueList(def.Value.Raw)
+	if err != nil || len(groups) != 1 || len(groups[0]) < 2 || len(groups[0]) > 3 || groups[0][0].Kind != syntax.WORD {
+		return state.errorAt(CodeResource, def.Key.Pos, "invalid resource declaration '%s: %s' (expected e.g. 'logo: image \"img/logo.png\"', optionally followed by 'embed')", name, def.Value.Raw)
+	}
+	g := groups[0]
+	resType, ok := krb.ResourceTypeByName(g[0].Text)
+	if !ok {
+		return state.errorAt(CodeResource, valueTokenPos(def, g[0]), "unknown resource type '%s' for resource '%s' (expected image, font, sound, video or custom)", g[0].Text, name)
+	}
+	path, _ := cleanAndQuoteValue(g[1].Text)
+	if strings.TrimSpace(path) == "" {
+		return state.errorAt(CodeResource, def.Key.Pos, "resource '%s' has an empty path", name)
+	}
+	embed := state.embedAll
+	if len(g) == 3 {
+		if g[2].Kind != syntax.WORD || g[2].Text != "embed" {
+			return state.errorAt(CodeResource, valueTokenPos(def, g[2]), "unexpected '%s' after the path of resource '%s' (expected 'embed')", g[2].Text, name)
+		}
+		embed = true
+	}
+
+	nameIdx, err := state.addString(name)
+	if err != nil {
+		return state.errorAt(CodeLimit, def.Key.Pos, "failed adding resource name '%s': %w", name, err)
+	}
+	entry := ResourceEntry{Name: name, Type: resType, NameIndex: nameIdx, Format: ResFormatExternal, DefLine: line}
+	if embed {
+		entry.Format = ResFormatInline
+	} else {
+		if entry.DataStringIndex, err = state.addString(path); err != nil {
+			return state.errorAt(CodeLimit, def.Key.Pos, "failed adding path of resource '%s': %w", name, err)
+		}
+		if !strings.Contains(path, "://") && !state.resourceExists(path) {
+			state.warnAt(CodeResourceMissing, def.Key.Pos, "file '%s' of resource '%s' not found", path, name)
+		}
+	}
+	if _, err := state.appendResource(entry, path); err != nil {
+		return state.errorAt(CodeResource, def.Key.Pos, "%w", err)
+	}
+	state.addSymbol(SymbolResource, name, def.Key.Pos, def.Value.Raw)
+	return nil
+}
+
+// findResourceByName returns the resource declared in @resources with the
+// given name, or nil.
+func (state *CompilerState) findResourceByName(name string) *ResourceEntry {
+	for i := range state.Resources {
+		if state.Resources[i].Name == name {
+			return &state.Resources[i]
+		}
+	}
+	return nil
+}
+
+// resourceRef resolves a `$res.name` value to its declared resource. ok is
+// false if value is not a resource reference.
+func (state *CompilerState) resourceRef(value string) (res *ResourceEntry, ok bool, err error) {
+	name, ok := strings.CutPrefix(strings.TrimSpace(value), "$"+resourceNamespace+".")
+	if !ok {
+		return nil, false, nil
+	}
+	if res = state.findResourceByName(name); res == nil {
+		return nil, true, fmt.Errorf("resource '%s' is not declared in @resources", name)
+	}
+	return res, true, nil
+}
+
+// --- Resource Table ---
+
+// addResource returns the index of the resource of resType at pathStr,
+// adding it to the Resource Table if needed.
+func (state *CompilerState) addResource(resType uint8, pathStr string, embed bool) (uint16, error) {
+	if strings.TrimSpace(pathStr) == "" {
+		return 0, fmt.Errorf("resource path cannot be empty or whitespace only")
+	}
+
+	format := ResFormatExternal
+	if embed || state.embedAll {
+		format = ResFormatInline
+	}
+	if pathIdx, found := state.getStringIndex(pathStr); found {
+		for i := 0; i < len(state.Resources); i++ {
+			res := &state.Resources[i]
+			if res.Name == "" && res.Type == resType && res.Format == format && res.NameIndex == pathIdx {
+				return res.Index, nil
+			}
+		}
+	}
+	return state.appendResource(ResourceEntry{Type: resType, Format: format}, pathStr)
+}
+
+// appendResource adds entry to the Resource Table. Inline entries are read
+// from pathStr now; one referenced by path reuses an earlier inline entry
+// with identical contents. Entries referenced by path are named by it, and
+// the path is only added to the string table once an entry is created.
+func (state *CompilerState) appendResource(entry ResourceEntry, pathStr string) (uint16, error) {
+	if len(state.Resources) >= MaxResources {
+		return 0, fmt.Errorf("maximum resource limit (%d) exceeded", MaxResources)
+	}
+	entry.Index = uint16(len(state.Resources))
+	if entry.Format == ResFormatInline {
+		data, err := state.readResource(pathStr)
+		if err != nil {
+			return 0, err
+		}
+		hash := sha256.Sum256(data)
+		prev, seen := state.embedded[hash]
+		if seen && entry.Name == "" && state.Resources[prev].Type == entry.Type {
+			return prev, nil
+		}
+		if !seen {
+			if state.embedded == nil {
+				state.embedded = make(map[[sha256.Size]byte]uint16)
+			}
+			state.embedded[hash] = entry.Index
+		}
+		entry.Data = data
+		entry.CalculatedSize = inlineResourceHeader + uint32(len(data))
+	} else {
+		entry.CalculatedSize = externalResourceSize
+	}
+	if entry.Name == "" {
+		pathIdx, err := state.addString(pathStr)
+		if err != nil {
+			return 0, fmt.Errorf("failed to add resource path '%s' to string table: %w", shortValue(pathStr), err)
+		}
+		entry.NameIndex = pathIdx
+		if entry.Format == ResFormatExternal {
+			entry.DataStringIndex = pathIdx
+		}
+	}
+	state.Resources = append(state.Resources, entry)
+	state.HeaderFlags |= FlagHasResources
+	return entry.Index, nil
+}
+
+// --- Embedded Resources ---
+// Resources are written as paths (ResFormatExternal) unless they are
+// embedded, either all of them with Options.EmbedResources or one at a time
+// with the `embed` keyword after the path. Embedded files are read at compile
+// time and written inline (ResFormatInline) as their size and raw bytes.
+
+// resourceValue splits the raw value of a resource property into its path
+// and whether it is followed by the `embed` keyword.
+func resourceValue(value string) (path string, embed bool) {
+	if groups, err := valueList(value); err == nil && len(groups) == 1 && len(groups[0]) == 2 {
+		if g := groups[0]; g[1].Kind == syntax.WORD && g[1].Text == "embed" {
+			path, _ = cleanAndQuoteValue(g[0].Text)
+			return path, true
+		}
+	}
+	path, _ = cleanAndQuoteValue(value)
+	return path, false
+}
+
+// resourcePath resolves a resource path against the directory of the main
+// KRY file.
+func (state *CompilerState) resourcePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(state.CurrentFilePath), path)
+}
+
+// resourceExists reports whether the file of a resource can be found.
+func (state *CompilerState) resourceExists(path string) bool {
+	filePath := state.resourcePath(path)
+	if _, ok := state.sources[filepath.Clean(filePath)]; ok {
+		return true
+	}
+	_, err := os.Stat(filePath)
+	return !errors.Is(err, fs.ErrNotExist)
+}
+
+// readResource reads a resource file to embed.
+func (state *CompilerState) readResource(path string) ([]byte, error) {
+	data, err := state.readSource(state.resourcePath(path))
+	if err != nil {
+		return nil, fmt.Errorf("cannot embed resource '%s': %w", path, err)
+	}
+	if len(data) > state.maxEmbedSize {
+		return nil, fmt.Errorf("cannot embed resource '%s': %d bytes exceeds the embedded resource limit of %d bytes", path, len(data), state.maxEmbedSize)
+	}
+	return data, nil
+}
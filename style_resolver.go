@@ -1,93 +1,96 @@
 // style_resolver.go
-package main
+package kryc
 
 import (
 	"encoding/binary" // For number conversions (e.g., font_size)
+	"errors"
 	"fmt"
-	"log"
 	"math"    // For MaxUint16 etc.
+	"slices"  // For comparing media conditions
 	"sort"    // For sorting final properties by ID
 	"strconv" // For parsing numbers from strings
 	"strings" // For string manipulation (ToLower, Fields etc.)
+
+	"github.com/waozixyz/kryc/krb"
+	"github.com/waozixyz/kryc/syntax"
 )
 
 // --- resolveStyleInheritance ---
 // Pass 1.2: Resolves style inheritance (`extends`) and calculates the final
 // set of KRB properties for each style, detecting cycles.
 func (state *CompilerState) resolveStyleInheritance() error {
-	log.Println("Pass 1.2: Resolving style inheritance...")
+	state.logf("Pass 1.2: Resolving style inheritance...")
 
 	// Reset resolution state for all styles.
 	for i := range state.Styles {
 		state.Styles[i].IsResolved = false
 		state.Styles[i].IsResolving = false
+		state.Styles[i].resolveErr = nil
 		// Clear previously resolved KRB properties.
 		state.Styles[i].Properties = make([]KrbProperty, 0, len(state.Styles[i].SourceProperties))
+		state.Styles[i].Variants = nil
+		state.Styles[i].MediaVariants = nil
 	}
 
-	resolvedCount := 0
-	totalStyles := len(state.Styles)
-	maxIterations := totalStyles*2 + 1 // Generous iteration limit
-
-	// Iteratively resolve styles to handle dependencies.
-	for i := 0; i < maxIterations && resolvedCount < totalStyles; i++ {
-		madeProgress := false
-
-		for j := range state.Styles {
-			if !state.Styles[j].IsResolved {
-				err := state.resolveSingleStyle(&state.Styles[j])
-				if err == nil {
-					madeProgress = true
-					resolvedCount++
-				} else if strings.Contains(err.Error(), "cyclic style inheritance detected") {
-					return err // Fail fast on cycles
-				}
-				// Ignore other errors (like missing base) for now, might resolve later.
-			}
+	// Bases are resolved recursively, so one pass in order resolves every
+	// style that can be. A failing style is recorded and the rest are still
+	// resolved; styles that fail only because a base did are not recorded.
+	unresolvedCount := 0
+	for i := range state.Styles {
+		err := state.resolveSingleStyle(&state.Styles[i])
+		if err == nil {
+			continue
 		}
-		if !madeProgress {
-			break // Break if no progress made in an iteration (likely unresolvable)
+		unresolvedCount++
+		state.logf("       - Unresolved style: '%s' (Error: %v)", state.Styles[i].SourceName, err)
+		if errors.Is(err, errBaseStyleFailed) {
+			continue
 		}
-	}
-
-	// Final check for unresolved styles.
-	if resolvedCount != totalStyles {
-		log.Println("Warning: Style resolution finished but not all styles marked resolved.")
-		unresolvedCount := 0
-		for i := range state.Styles {
-			if !state.Styles[i].IsResolved {
-				// Attempt one last resolve to get the specific error.
-				err := state.resolveSingleStyle(&state.Styles[i])
-				log.Printf("       - Unresolved style: '%s' (Error: %v)", state.Styles[i].SourceName, err)
-				unresolvedCount++
-			}
+		if stop := state.recordError(err); stop != nil {
+			return stop
 		}
-		return fmt.Errorf("%d styles remain unresolved", unresolvedCount)
+	}
+	if unresolvedCount > 0 {
+		state.logf("   Style resolution finished with %d unresolved styles.", unresolvedCount)
+		return nil
 	}
 
-	log.Printf("   Style inheritance resolution complete. %d styles processed.\n", totalStyles)
+	state.logf("   Style inheritance resolution complete. %d styles processed.\n", len(state.Styles))
 	return nil
 }
 
 // --- resolveSingleStyle ---
-// Recursively resolves inheritance and properties for one style entry.
+// Recursively resolves inheritance and properties for one style entry. A
+// failure is kept on the style, so resolving it again returns the same error
+// without repeating its warnings.
 
-func (state *CompilerState) resolveSingleStyle(style *StyleEntry) error {
+// errBaseStyleFailed is wrapped by the error of a style whose base style
+// failed to resolve; the failure itself is reported on the base.
+var errBaseStyleFailed = errors.New("base style failed")
+
+func (state *CompilerState) resolveSingleStyle(style *StyleEntry) (err error) {
 	// Base cases for recursion
 	if style.IsResolved {
 		return nil
 	}
+	if style.resolveErr != nil {
+		return style.resolveErr
+	}
 	if style.IsResolving {
-		return fmt.Errorf("cyclic style inheritance detected involving style '%s'", style.SourceName)
+		return state.errorAt(CodeStyle, styleExtendsPos(style), "cyclic style inheritance detected involving style '%s'", style.SourceName)
 	}
 
 	style.IsResolving = true
 	defer func() {
 		style.IsResolving = false
+		style.resolveErr = err
 	}() // Ensure flag is reset
 
 	// Map to merge properties (KRB Prop ID -> KrbProperty)
 	mergedProps := make(map[uint8]KrbProperty)
+	variants := make(stateVariants)
+	media := new(mediaVariants)
+	style.AnimationRefs = nil
 
 	// --- Step 1: Resolve and Apply Base Style Properties ---
 	// If style.ExtendsStyleNames has multiple entries, they are processed in order.
@@ -97,27 +100,15 @@ func (state *CompilerState) resolveSingleStyle(style *StyleEntry) error {
 		for _, baseName := range style.ExtendsStyleNames { // Iterate in order
 			baseStyle := state.findStyleByName(baseName)
 			if baseStyle == nil {
-				extendsLine := 0 // Find line num for error context
-				// Look for the 'extends' source property to get its line number
-				for _, sp := range style.SourceProperties {
-					if sp.Key == "extends" {
-						extendsLine = sp.LineNum
-						break
-					}
-				}
-				// Fallback if 'extends' prop not found yet (e.g. during initial processing error)
-				if extendsLine == 0 && len(style.SourceProperties) > 0 {
-					extendsLine = style.SourceProperties[0].LineNum
-				} else if extendsLine == 0 {
-					extendsLine = 0 // Or some other indicator for "unknown line"
-				}
-
-				return fmt.Errorf("L%d: base style '%s' (part of 'extends' for '%s') not found", extendsLine, baseName, style.SourceName)
+				return state.errorf(CodeStyle, styleExtendsPos(style).Line, baseName, "base style '%s' (part of 'extends' for '%s') not found", baseName, style.SourceName)
 			}
 
 			// Recursively resolve the base style first.
 			err := state.resolveSingleStyle(baseStyle)
-			if err != nil {
+			if err != nil && baseStyle.resolveErr != nil {
+				return fmt.Errorf("error resolving base style '%s' (needed by '%s'): %w: %w", baseStyle.SourceName, style.SourceName, errBaseStyleFailed, err)
+			}
+			if err != nil { // A cycle back to a style still being resolved
 				return fmt.Errorf("error resolving base style '%s' (needed by '%s'): %w", baseStyle.SourceName, style.SourceName, err)
 			}
 
@@ -126,6 +117,11 @@ func (state *CompilerState) resolveSingleStyle(style *StyleEntry) error {
 			for _, baseProp := range baseStyle.Properties {
 				mergedProps[baseProp.PropertyID] = baseProp
 			}
+			variants.merge(baseStyle.Variants)
+			media.merge(baseStyle.MediaVariants)
+			if baseStyle.AnimationRefs != nil {
+				style.AnimationRefs = baseStyle.AnimationRefs
+			}
 		}
 	}
 
@@ -137,423 +133,773 @@ func (state *CompilerState) resolveSingleStyle(style *StyleEntry) error {
 	for _, sp := range style.SourceProperties {
 		key := sp.Key
 		valStr := sp.ValueStr
-		lineNum := sp.LineNum
 
 		if key == "extends" {
 			continue // Already handled
 		}
+		if key == "animation" {
+			refs, err := state.parseAnimationRefs(valStr)
+			if err != nil {
+				if stop := state.recordError(state.errorAt(CodePropertyValue, sp.KeyPos, "error processing property '%s: %s' in style '%s': %w", key, shortValue(valStr), style.SourceName, err)); stop != nil {
+					return stop
+				}
+				continue
+			}
+			style.AnimationRefs = refs // Replaces any inherited animations
+			continue
+		}
 
 		cleanedString, _ := cleanAndQuoteValue(valStr)
 
-		var krbProp *KrbProperty
-		var propErr error
-		propID := PropIDInvalid // Default to invalid, set on successful conversion
-		propAdded := false      // Flag to track if krbProp was successfully created
+		krbProp, propErr := state.convertStyleProperty(key, cleanedString, sp.KeyPos, sp.ValuePos, fmt.Sprintf("style '%s'", style.SourceName))
 
-		// --- Convert KRY key/value to KRB Property (same logic as before but formatted) ---
-		switch key {
-		case "background_color":
-			if col, ok := parseColor(cleanedString); ok {
-				krbProp = &KrbProperty{PropertyID: PropIDBgColor, ValueType: ValTypeColor, Size: 4, Value: col[:]}
-				state.HeaderFlags |= FlagExtendedColor
-				propID = PropIDBgColor
-				propAdded = true
-			} else {
-				propErr = fmt.Errorf("invalid color format '%s'", cleanedString)
+		// A property that cannot be converted is recorded and left out, so
+		// one run reports every invalid property of the style.
+		if propErr != nil {
+			if stop := state.recordError(state.errorAt(CodePropertyValue, sp.KeyPos, "error processing property '%s: %s' in style '%s': %w", key, shortValue(valStr), style.SourceName, propErr)); stop != nil {
+				return stop
 			}
+			continue
+		}
 
-		case "text_color", "foreground_color":
-			if col, ok := parseColor(cleanedString); ok {
-				krbProp = &KrbProperty{PropertyID: PropIDFgColor, ValueType: ValTypeColor, Size: 4, Value: col[:]}
-				state.HeaderFlags |= FlagExtendedColor
-				propID = PropIDFgColor
-				propAdded = true
+		// Merge the successfully converted KRB property
+		if krbProp != nil {
+			if _, exists := mergedProps[krbProp.PropertyID]; exists {
+				overrideCount++
 			} else {
-				propErr = fmt.Errorf("invalid color format '%s'", cleanedString)
+				addedCount++
 			}
+			mergedProps[krbProp.PropertyID] = *krbProp // Direct properties override anything inherited
+		}
+	} // End loop through source properties
 
-		case "border_color":
-			if col, ok := parseColor(cleanedString); ok {
-				krbProp = &KrbProperty{PropertyID: PropIDBorderColor, ValueType: ValTypeColor, Size: 4, Value: col[:]}
-				state.HeaderFlags |= FlagExtendedColor
-				propID = PropIDBorderColor
-				propAdded = true
-			} else {
-				propErr = fmt.Errorf("invalid color format '%s'", cleanedString)
-			}
+	// State and @media blocks override the variants inherited for the same
+	// state or query.
+	if err := state.convertVariantBlocks(variants, media, style.StateBlocks, style.MediaBlocks, fmt.Sprintf("style '%s'", style.SourceName)); err != nil {
+		style.IsResolved = false
+		return err
+	}
 
-		case "border_width":
-			if bw, e := strconv.ParseUint(cleanedString, 10, 8); e == nil {
-				krbProp = &KrbProperty{PropertyID: PropIDBorderWidth, ValueType: ValTypeByte, Size: 1, Value: []byte{uint8(bw)}}
-				propID = PropIDBorderWidth
-				propAdded = true
-			} else {
-				propErr = fmt.Errorf("invalid uint8 for border_width '%s': %w", cleanedString, e)
-			}
+	// --- Step 3: Finalize Resolved Properties and Calculate Size ---
+	style.Properties = make([]KrbProperty, 0, len(mergedProps))
+	propIDs := make([]uint8, 0, len(mergedProps))
+	for id := range mergedProps {
+		propIDs = append(propIDs, id)
+	}
+	// Sort properties by ID for canonical output and consistent sizing
+	sort.Slice(propIDs, func(i, j int) bool {
+		return propIDs[i] < propIDs[j]
+	})
 
-		case "border_radius":
-			if br, e := strconv.ParseUint(cleanedString, 10, 8); e == nil {
-				krbProp = &KrbProperty{PropertyID: PropIDBorderRadius, ValueType: ValTypeByte, Size: 1, Value: []byte{uint8(br)}}
-				propID = PropIDBorderRadius
-				propAdded = true
-			} else {
-				propErr = fmt.Errorf("invalid uint8 for border_radius '%s': %w", cleanedString, e)
-			}
+	finalSize := uint32(styleHeaderSize)
+	for _, propID := range propIDs {
+		prop := mergedProps[propID]
+		style.Properties = append(style.Properties, prop)
+		finalSize += 3 + uint32(prop.Size) // PropHeader: PropID(1) + ValType(1) + Size(1) + Data(prop.Size)
+	}
 
-		case "padding":
-			propID = PropIDPadding
-			propAdded = true // Assume success unless parsing fails
-			var finalTop, finalRight, finalBottom, finalLeft uint8 = 0, 0, 0, 0
-			parts := strings.Fields(cleanedString)
-
-			switch len(parts) {
-			case 1: // Single value: applies to all sides.
-				v, e := strconv.ParseUint(parts[0], 10, 8)
-				if e != nil {
-					propErr = fmt.Errorf("invalid uint8 value '%s' for single padding: %w", parts[0], e)
-					propAdded = false // Mark as failed
-				} else {
-					valByte := uint8(v)
-					finalTop, finalRight, finalBottom, finalLeft = valByte, valByte, valByte, valByte
-				}
-			case 2: // Two values: [vertical] [horizontal].
-				v1, e1 := strconv.ParseUint(parts[0], 10, 8) // Vertical (Top/Bottom)
-				v2, e2 := strconv.ParseUint(parts[1], 10, 8) // Horizontal (Right/Left)
-				if e1 != nil || e2 != nil {
-					propErr = fmt.Errorf("invalid uint8 values in '%s %s' for padding: %v / %v", parts[0], parts[1], e1, e2)
-					propAdded = false // Mark as failed
-				} else {
-					vert, horiz := uint8(v1), uint8(v2)
-					finalTop, finalBottom = vert, vert
-					finalRight, finalLeft = horiz, horiz
-				}
-			case 4: // Four values: [top] [right] [bottom] [left].
-				v1, e1 := strconv.ParseUint(parts[0], 10, 8) // Top
-				v2, e2 := strconv.ParseUint(parts[1], 10, 8) // Right
-				v3, e3 := strconv.ParseUint(parts[2], 10, 8) // Bottom
-				v4, e4 := strconv.ParseUint(parts[3], 10, 8) // Left
-				if e1 != nil || e2 != nil || e3 != nil || e4 != nil {
-					propErr = fmt.Errorf("invalid uint8 values in '%s %s %s %s' for padding: %v/%v/%v/%v", parts[0], parts[1], parts[2], parts[3], e1, e2, e3, e4)
-					propAdded = false // Mark as failed
-				} else {
-					finalTop, finalRight, finalBottom, finalLeft = uint8(v1), uint8(v2), uint8(v3), uint8(v4)
-				}
-			default: // Invalid number of values for shorthand.
-				propErr = fmt.Errorf("invalid number of values (%d) for padding shorthand '%s', expected 1, 2, or 4", len(parts), cleanedString)
-				propAdded = false // Mark as failed
+	style.CalculatedSize = finalSize
+	style.Variants = variants.sorted()
+	style.MediaVariants = media.sorted()
+	style.IsResolved = true // Mark as successfully resolved
+
+	return nil // Success
+}
+
+// --- Composite Styles ---
+// KRB elements have a single StyleID, so an element listing several styles,
+// as in `style: ["base", "primary"]`, gets a composite style that extends
+// them in order. Later styles override earlier ones, as with `extends`. The
+// composite is named after its styles joined with '+' ("base+primary") and
+// shared by every element listing the same styles in the same order. An
+// element with state or @media blocks only needs the merged properties for
+// its own variant style, so it does not add the composite.
+
+// compositeStyleID returns the ID of the composite style of names, adding
+// and resolving it on first use. Pass 1.5 calls it after every declared
+// style has been resolved.
+func (state *CompilerState) compositeStyleID(names []string) (uint16, error) {
+	name := strings.Join(names, "+")
+	if existing := state.findStyleByName(name); existing != nil {
+		if !existing.Composite {
+			return 0, fmt.Errorf("composite style '%s' conflicts with the declared style of the same name", name)
+		}
+		return existing.ID, nil
+	}
+	if len(state.Styles) >= MaxStyles {
+		return 0, fmt.Errorf("maximum styles (%d) exceeded adding composite style '%s'", MaxStyles, name)
+	}
+	nameIdx, err := state.addString(name)
+	if err != nil {
+		return 0, fmt.Errorf("failed adding composite style name '%s': %w", name, err)
+	}
+	style, err := state.compositeStyle(names)
+	if err != nil {
+		return 0, err
+	}
+	style.ID = uint16(len(state.Styles) + 1)
+	style.NameIndex = nameIdx
+	state.Styles = append(state.Styles, *style)
+	state.logf("   Composite style '%s' (ID %d) merges %d styles.", name, style.ID, len(names))
+	return style.ID, nil
+}
+
+// compositeStyle resolves the composite style of names without adding it to
+// the style table.
+func (state *CompilerState) compositeStyle(names []string) (*StyleEntry, error) {
+	style := &StyleEntry{SourceName: strings.Join(names, "+"), ExtendsStyleNames: names, Composite: true}
+	if err := state.resolveSingleStyle(style); err != nil && !errors.Is(err, errBaseStyleFailed) {
+		return nil, err // A failing base style is already reported on that style
+	}
+	return style, nil
+}
+
+// --- State and Media Variants ---
+// A `state hover { ... }` block lists the properties that change while the
+// element is hovered, pressed, focused or disabled; an `@media (...) { ... }`
+// block those that change while the window matches its conditions. A style's
+// variants are resolved like its properties: those of its base styles are
+// merged in order, then its own blocks override them property by property.
+// They are written to the style and media variant tables, which runtimes
+// apply on state changes and window resizes.
+
+// stateVariants maps a state to its properties by property ID while
+// variants are being merged.
+type stateVariants map[uint8]map[uint8]KrbProperty
+
+func (v stateVariants) set(st uint8, prop KrbProperty) {
+	if v[st] == nil {
+		v[st] = make(map[uint8]KrbProperty)
+	}
+	v[st][prop.PropertyID] = prop
+}
+
+// merge overrides v with resolved variants, such as those of a base style.
+func (v stateVariants) merge(variants []StyleVariant) {
+	for _, sv := range variants {
+		for _, prop := range sv.Properties {
+			v.set(sv.State, prop)
+		}
+	}
+}
+
+// sorted returns the variants ordered by state, with properties ordered by ID.
+func (v stateVariants) sorted() []StyleVariant {
+	if len(v) == 0 {
+		return nil
+	}
+	states := make([]uint8, 0, len(v))
+	for st := range v {
+		states = append(states, st)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+	out := make([]StyleVariant, 0, len(states))
+	for _, st := range states {
+		out = append(out, StyleVariant{State: st, Properties: sortedProperties(v[st])})
+	}
+	return out
+}
+
+// mediaVariants holds media variants while they are merged. Unlike states,
+// queries keep their order: inherited ones first, then new ones in source
+// order, since runtimes apply matching variants in table order.
+type mediaVariants struct {
+	conditions [][]krb.MediaCondition
+	props      []map[uint8]KrbProperty
+}
+
+func (v *mediaVariants) set(conds []krb.MediaCondition, prop KrbProperty) {
+	i := slices.IndexFunc(v.conditions, func(c []krb.MediaCondition) bool { return slices.Equal(c, conds) })
+	if i < 0 {
+		i = len(v.conditions)
+		v.conditions = append(v.conditions, conds)
+		v.props = append(v.props, make(map[uint8]KrbProperty))
+	}
+	v.props[i][prop.PropertyID] = prop
+}
+
+// merge overrides v with resolved variants, such as those of a base style.
+func (v *mediaVariants) merge(variants []MediaVariant) {
+	for _, mv := range variants {
+		for _, prop := range mv.Properties {
+			v.set(mv.Conditions, prop)
+		}
+	}
+}
+
+// sorted returns the variants in order, with properties ordered by ID.
+func (v *mediaVariants) sorted() []MediaVariant {
+	if len(v.conditions) == 0 {
+		return nil
+	}
+	out := make([]MediaVariant, 0, len(v.conditions))
+	for i, conds := range v.conditions {
+		out = append(out, MediaVariant{Conditions: conds, Properties: sortedProperties(v.props[i])})
+	}
+	return out
+}
+
+func sortedProperties(props map[uint8]KrbProperty) []KrbProperty {
+	out := make([]KrbProperty, 0, len(props))
+	for _, prop := range props {
+		out = append(out, prop)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].PropertyID < out[j].PropertyID })
+	return out
+}
+
+// convertVariantBlocks converts the properties of state and @media blocks and
+// merges them into states and media. owner names the style or element the
+// blocks belong to.
+func (state *CompilerState) convertVariantBlocks(states stateVariants, media *mediaVariants, stateBlocks []StateBlock, mediaBlocks []MediaBlock, owner string) error {
+	for i := range stateBlocks {
+		block := &stateBlocks[i]
+		props, err := state.convertBlock(&block.propertyBlock, fmt.Sprintf("state '%s' of %s", krb.StateName(block.State), owner))
+		if err != nil {
+			return err
+		}
+		for _, prop := range props {
+			states.set(block.State, prop)
+		}
+	}
+	for i := range mediaBlocks {
+		block := &mediaBlocks[i]
+		props, err := state.convertBlock(&block.propertyBlock, fmt.Sprintf("@media %s of %s", krb.FormatMediaQuery(block.Conditions), owner))
+		if err != nil {
+			return err
+		}
+		for _, prop := range props {
+			media.set(block.Conditions, prop)
+		}
+	}
+	return nil
+}
+
+// convertBlock converts the source properties of a state or @media block.
+// Invalid properties are recorded and left out; the error returned stops
+// compilation.
+func (state *CompilerState) convertBlock(block *propertyBlock, owner string) ([]KrbProperty, error) {
+	var props []KrbProperty
+	for _, sp := range block.SourceProperties {
+		cleanedString, _ := cleanAndQuoteValue(sp.ValueStr)
+		krbProp, err := state.convertStyleProperty(sp.Key, cleanedString, sp.KeyPos, sp.ValuePos, owner)
+		if err != nil {
+			if stop := state.recordError(state.errorAt(CodePropertyValue, sp.KeyPos, "error processing property '%s: %s' in %s: %w", sp.Key, shortValue(sp.ValueStr), owner, err)); stop != nil {
+				return nil, stop
 			}
+			continue
+		}
+		if krbProp != nil {
+			props = append(props, *krbProp)
+		}
+	}
+	return props, nil
+}
+
+// elementVariantStyleID returns the ID of a style for an element with state
+// or @media blocks: a copy of the element's style whose variants are
+// overridden by the element's own blocks. KRB elements have a single StyleID,
+// so each such element gets a style of its own, named after its base style
+// and a counter ("button~1", or "~1" without a base style). Pass 1.5 calls it
+// once the element's style is known.
+func (state *CompilerState) elementVariantStyleID(el *Element) (uint16, error) {
+	line, token := 0, "state"
+	if len(el.StateBlocks) > 0 {
+		line = el.StateBlocks[0].LineNum
+	}
+	if len(el.MediaBlocks) > 0 && (line == 0 || el.MediaBlocks[0].LineNum < line) {
+		line, token = el.MediaBlocks[0].LineNum, "@media"
+	}
+	entry := StyleEntry{ElementVariants: true, IsResolved: true}
+	states := make(stateVariants)
+	media := new(mediaVariants)
+	base := state.findStyleByID(el.StyleID)
+	if base == nil {
+		base = el.VariantBase
+	}
+	if base != nil {
+		entry.SourceName = base.SourceName
+		entry.ExtendsStyleNames = []string{base.SourceName}
+		entry.Properties = base.Properties
+		entry.AnimationRefs = base.AnimationRefs
+		states.merge(base.Variants)
+		media.merge(base.MediaVariants)
+	}
+	if err := state.checkVariantSizes(el); err != nil {
+		return 0, err
+	}
+	if err := state.convertVariantBlocks(states, media, el.StateBlocks, el.MediaBlocks, fmt.Sprintf("element '%s'", el.SourceElementName)); err != nil {
+		return 0, err
+	}
+
+	state.elementVariantStyles++
+	entry.SourceName = fmt.Sprintf("%s~%d", entry.SourceName, state.elementVariantStyles)
+	if state.findStyleByName(entry.SourceName) != nil {
+		return 0, state.errorf(CodeStyle, line, token, "variant style '%s' of element '%s' conflicts with the declared style of the same name", entry.SourceName, el.SourceElementName)
+	}
+	if len(state.Styles) >= MaxStyles {
+		return 0, state.errorf(CodeLimit, line, token, "maximum styles (%d) exceeded adding variant style '%s'", MaxStyles, entry.SourceName)
+	}
+	nameIdx, err := state.addString(entry.SourceName)
+	if err != nil {
+		return 0, state.errorf(CodeLimit, line, token, "failed adding variant style name '%s': %w", entry.SourceName, err)
+	}
+	entry.ID = uint16(len(state.Styles) + 1)
+	entry.NameIndex = nameIdx
+	entry.Variants = states.sorted()
+	entry.MediaVariants = media.sorted()
+	entry.CalculatedSize = styleHeaderSize
+	for _, prop := range entry.Properties {
+		entry.CalculatedSize += 3 + uint32(prop.Size)
+	}
+	state.Styles = append(state.Styles, entry)
+	state.HeaderFlags |= FlagHasStyles
+	state.logf("   Variant style '%s' (ID %d) for element '%s' has %d state and %d media variants.", entry.SourceName, entry.ID, el.SourceElementName, len(entry.Variants), len(entry.MediaVariants))
+	return entry.ID, nil
+}
 
-			if propAdded { // Only create the KRB property if parsing was successful
-				paddingBuf := []byte{finalTop, finalRight, finalBottom, finalLeft}
-				krbProp = &KrbProperty{PropertyID: PropIDPadding, ValueType: ValTypeEdgeInsets, Size: 4, Value: paddingBuf}
+// checkVariantSizes rejects width and height in the state and @media blocks
+// of an element that sets its own width or height in pixels. The element's
+// value is a header field, which variants cannot override; in a block the
+// key sets max_width or max_height, as it does in a style.
+func (state *CompilerState) checkVariantSizes(el *Element) error {
+	check := func(block *propertyBlock, where string) error {
+		for _, sp := range block.SourceProperties {
+			if sp.Key != "width" && sp.Key != "height" {
+				continue
+			}
+			value, ok := el.getSourcePropertyValue(sp.Key)
+			cleaned, _ := cleanAndQuoteValue(value)
+			if _, err := strconv.ParseUint(cleaned, 10, 16); !ok || err != nil {
+				continue // Set by the style or as a percentage, which blocks can override
+			}
+			keyPos, _ := el.getSourcePropertyPos(sp.Key)
+			err := withRelated(state.errorAt(CodePropertyValue, sp.KeyPos, "'%s' in %s cannot override the %s of element '%s', which is set in pixels; set it in a style instead", sp.Key, where, sp.Key, el.SourceElementName),
+				state.relatedAt(keyPos.Line, sp.Key, fmt.Sprintf("%s of '%s' set here", sp.Key, el.SourceElementName)))
+			if stop := state.recordError(err); stop != nil {
+				return stop
 			}
+		}
+		return nil
+	}
+	for i := range el.StateBlocks {
+		if err := check(&el.StateBlocks[i].propertyBlock, fmt.Sprintf("state '%s'", krb.StateName(el.StateBlocks[i].State))); err != nil {
+			return err
+		}
+	}
+	for i := range el.MediaBlocks {
+		if err := check(&el.MediaBlocks[i].propertyBlock, "@media "+krb.FormatMediaQuery(el.MediaBlocks[i].Conditions)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		case "margin":
-			propID = PropIDMargin
-			propAdded = true // Assume success unless parsing fails
-			var finalTop, finalRight, finalBottom, finalLeft uint8 = 0, 0, 0, 0
-			parts := strings.Fields(cleanedString)
-			switch len(parts) {
-			case 1:
-				v, e := strconv.ParseUint(parts[0], 10, 8)
-				if e != nil {
-					propErr = fmt.Errorf("invalid uint8 value '%s' for single margin: %w", parts[0], e)
-					propAdded = false
-				} else {
-					valByte := uint8(v)
-					finalTop, finalRight, finalBottom, finalLeft = valByte, valByte, valByte, valByte
-				}
-			case 2:
-				v1, e1 := strconv.ParseUint(parts[0], 10, 8)
-				v2, e2 := strconv.ParseUint(parts[1], 10, 8)
-				if e1 != nil || e2 != nil {
-					propErr = fmt.Errorf("invalid uint8 values in '%s %s' for margin: %v / %v", parts[0], parts[1], e1, e2)
-					propAdded = false
-				} else {
-					vert, horiz := uint8(v1), uint8(v2)
-					finalTop, finalBottom = vert, vert
-					finalRight, finalLeft = horiz, horiz
-				}
-			case 4:
-				v1, e1 := strconv.ParseUint(parts[0], 10, 8)
-				v2, e2 := strconv.ParseUint(parts[1], 10, 8)
-				v3, e3 := strconv.ParseUint(parts[2], 10, 8)
-				v4, e4 := strconv.ParseUint(parts[3], 10, 8)
-				if e1 != nil || e2 != nil || e3 != nil || e4 != nil {
-					propErr = fmt.Errorf("invalid uint8 values in '%s %s %s %s' for margin: %v/%v/%v/%v", parts[0], parts[1], parts[2], parts[3], e1, e2, e3, e4)
-					propAdded = false
-				} else {
-					finalTop, finalRight, finalBottom, finalLeft = uint8(v1), uint8(v2), uint8(v3), uint8(v4)
+// reportUnreachableMedia warns about @media blocks that can never match the
+// App window. Runtimes evaluate queries against the window size, starting
+// from the App's window_width and window_height; only with `resizable: false`
+// is that size fixed, so only then can a block be known to never apply. It
+// runs after every element has been resolved.
+func (state *CompilerState) reportUnreachableMedia() {
+	var app *Element
+	for i := range state.Elements {
+		if el := &state.Elements[i]; el.Type == ElemTypeApp && el.ParentIndex == -1 && !el.IsDefinitionRoot {
+			app = el
+			break
+		}
+	}
+	if app == nil {
+		return
+	}
+	var width, height uint16
+	var hasWidth, hasHeight, fixed bool
+	var known []string
+	for _, prop := range app.KrbProperties {
+		switch prop.PropertyID {
+		case PropIDWindowWidth:
+			width, hasWidth = binary.LittleEndian.Uint16(prop.Value), true
+			known = append(known, fmt.Sprintf("window_width %d", width))
+		case PropIDWindowHeight:
+			height, hasHeight = binary.LittleEndian.Uint16(prop.Value), true
+			known = append(known, fmt.Sprintf("window_height %d", height))
+		case PropIDResizable:
+			fixed = prop.Value[0] == 0
+		}
+	}
+	if !fixed || len(known) == 0 {
+		return
+	}
+	check := func(blocks []MediaBlock, owner string) {
+		for _, block := range blocks {
+			var conds []krb.MediaCondition
+			for _, c := range block.Conditions {
+				switch c.Feature {
+				case krb.MediaMinWidth, krb.MediaMaxWidth:
+					if hasWidth {
+						conds = append(conds, c)
+					}
+				case krb.MediaMinHeight, krb.MediaMaxHeight:
+					if hasHeight {
+						conds = append(conds, c)
+					}
+				case krb.MediaOrientation:
+					if hasWidth && hasHeight {
+						conds = append(conds, c)
+					}
 				}
-			default:
-				propErr = fmt.Errorf("invalid number of values (%d) for margin shorthand '%s', expected 1, 2, or 4", len(parts), cleanedString)
-				propAdded = false
 			}
-			if propAdded {
-				marginBuf := []byte{finalTop, finalRight, finalBottom, finalLeft}
-				krbProp = &KrbProperty{PropertyID: PropIDMargin, ValueType: ValTypeEdgeInsets, Size: 4, Value: marginBuf}
+			if !(krb.MediaVariant{Conditions: conds}).Matches(width, height) {
+				state.warnf(CodeMediaUnreachable, block.LineNum, "@media", "@media %s of %s never matches the fixed App window (%s)", krb.FormatMediaQuery(block.Conditions), owner, strings.Join(known, ", "))
 			}
+		}
+	}
+	for i := range state.Styles {
+		check(state.Styles[i].MediaBlocks, fmt.Sprintf("style '%s'", state.Styles[i].SourceName))
+	}
+	for i := range state.Elements {
+		check(state.Elements[i].MediaBlocks, fmt.Sprintf("element '%s'", state.Elements[i].SourceElementName))
+	}
+}
 
-		case "text", "content":
-			strIdx, err := state.addString(cleanedString)
-			if err != nil {
-				propErr = fmt.Errorf("failed to add string '%s' to table: %w", cleanedString, err)
-			} else {
-				krbProp = &KrbProperty{PropertyID: PropIDTextContent, ValueType: ValTypeString, Size: 1, Value: []byte{strIdx}}
-				propID = PropIDTextContent
-				propAdded = true
-			}
+// --- convertStyleProperty ---
+// Converts one KRY style property to its KRB form. owner names the block the
+// property belongs to (e.g. "style 'button'") and keyPos and valuePos locate
+// it for warnings. Unhandled keys are
+// warned about and yield a nil property.
+func (state *CompilerState) convertStyleProperty(key, cleanedString string, keyPos, valuePos syntax.Pos, owner string) (*KrbProperty, error) {
+	var krbProp *KrbProperty
+	var propErr error
+
+	switch key {
+	case "background_color":
+		if col, ok := parseColor(cleanedString); ok {
+			krbProp = &KrbProperty{PropertyID: PropIDBgColor, ValueType: ValTypeColor, Size: 4, Value: col[:]}
+			state.HeaderFlags |= FlagExtendedColor
+		} else {
+			propErr = fmt.Errorf("invalid color format '%s'", cleanedString)
+		}
 
-		case "font_size":
-			fs, e := strconv.ParseUint(cleanedString, 10, 16)
-			if e == nil && fs > 0 && fs <= math.MaxUint16 {
-				buf := make([]byte, 2)
-				binary.LittleEndian.PutUint16(buf, uint16(fs))
-				krbProp = &KrbProperty{PropertyID: PropIDFontSize, ValueType: ValTypeShort, Size: 2, Value: buf}
-				propID = PropIDFontSize
-				propAdded = true
-			} else if e != nil {
-				propErr = fmt.Errorf("invalid uint16 for font_size '%s': %w", cleanedString, e)
-			} else { // fs == 0 or fs > MaxUint16
-				propErr = fmt.Errorf("font_size value '%s' out of range (1-%d)", cleanedString, math.MaxUint16)
-			}
+	case "text_color", "foreground_color":
+		if col, ok := parseColor(cleanedString); ok {
+			krbProp = &KrbProperty{PropertyID: PropIDFgColor, ValueType: ValTypeColor, Size: 4, Value: col[:]}
+			state.HeaderFlags |= FlagExtendedColor
+		} else {
+			propErr = fmt.Errorf("invalid color format '%s'", cleanedString)
+		}
+
+	case "border_color":
+		if col, ok := parseColor(cleanedString); ok {
+			krbProp = &KrbProperty{PropertyID: PropIDBorderColor, ValueType: ValTypeColor, Size: 4, Value: col[:]}
+			state.HeaderFlags |= FlagExtendedColor
+		} else {
+			propErr = fmt.Errorf("invalid color format '%s'", cleanedString)
+		}
+
+	case "border_width":
+		if bw, e := strconv.ParseUint(cleanedString, 10, 8); e == nil {
+			krbProp = &KrbProperty{PropertyID: PropIDBorderWidth, ValueType: ValTypeByte, Size: 1, Value: []byte{uint8(bw)}}
+		} else {
+			propErr = fmt.Errorf("invalid uint8 for border_width '%s': %w", cleanedString, e)
+		}
 
-		case "font_weight":
-			weight := uint8(0) // Default Normal
-			switch strings.ToLower(cleanedString) {
-			case "normal", "400":
-				weight = 0
-			case "bold", "700":
-				weight = 1
-			default:
-				log.Printf("L%d: Warning: Invalid font_weight '%s' in style '%s', using 'normal'.", lineNum, cleanedString, style.SourceName)
+	case "border_radius":
+		if br, e := strconv.ParseUint(cleanedString, 10, 8); e == nil {
+			krbProp = &KrbProperty{PropertyID: PropIDBorderRadius, ValueType: ValTypeByte, Size: 1, Value: []byte{uint8(br)}}
+		} else {
+			propErr = fmt.Errorf("invalid uint8 for border_radius '%s': %w", cleanedString, e)
+		}
+
+	case "padding":
+		var finalTop, finalRight, finalBottom, finalLeft uint8 = 0, 0, 0, 0
+		parts := strings.Fields(cleanedString)
+
+		switch len(parts) {
+		case 1: // Single value: applies to all sides.
+			v, e := strconv.ParseUint(parts[0], 10, 8)
+			if e != nil {
+				propErr = fmt.Errorf("invalid uint8 value '%s' for single padding: %w", parts[0], e)
+			} else {
+				valByte := uint8(v)
+				finalTop, finalRight, finalBottom, finalLeft = valByte, valByte, valByte, valByte
 			}
-			krbProp = &KrbProperty{PropertyID: PropIDFontWeight, ValueType: ValTypeEnum, Size: 1, Value: []byte{weight}}
-			propID = PropIDFontWeight
-			propAdded = true
-
-		case "text_alignment":
-			align := uint8(0) // Default Start/Left
-			switch strings.ToLower(cleanedString) {
-			case "center", "centre":
-				align = 1
-			case "right", "end":
-				align = 2
-			case "left", "start":
-				align = 0
-			default:
-				log.Printf("L%d: Warning: Invalid text_alignment '%s' in style '%s', using 'start'.", lineNum, cleanedString, style.SourceName)
+		case 2: // Two values: [vertical] [horizontal].
+			v1, e1 := strconv.ParseUint(parts[0], 10, 8) // Vertical (Top/Bottom)
+			v2, e2 := strconv.ParseUint(parts[1], 10, 8) // Horizontal (Right/Left)
+			if e1 != nil || e2 != nil {
+				propErr = fmt.Errorf("invalid uint8 values in '%s %s' for padding: %v / %v", parts[0], parts[1], e1, e2)
+			} else {
+				vert, horiz := uint8(v1), uint8(v2)
+				finalTop, finalBottom = vert, vert
+				finalRight, finalLeft = horiz, horiz
 			}
-			krbProp = &KrbProperty{PropertyID: PropIDTextAlignment, ValueType: ValTypeEnum, Size: 1, Value: []byte{align}}
-			propID = PropIDTextAlignment
-			propAdded = true
-
-		case "layout":
-			layoutByte := parseLayoutString(cleanedString) // Assumes parseLayoutString is defined elsewhere
-			krbProp = &KrbProperty{PropertyID: PropIDLayoutFlags, ValueType: ValTypeByte, Size: 1, Value: []byte{layoutByte}}
-			propID = PropIDLayoutFlags
-			propAdded = true
-
-		case "gap":
-			g, e := strconv.ParseUint(cleanedString, 10, 16)
-			if e == nil && g <= math.MaxUint16 {
-				buf := make([]byte, 2)
-				binary.LittleEndian.PutUint16(buf, uint16(g))
-				krbProp = &KrbProperty{PropertyID: PropIDGap, ValueType: ValTypeShort, Size: 2, Value: buf}
-				propID = PropIDGap
-				propAdded = true
-			} else if e != nil {
-				propErr = fmt.Errorf("invalid uint16 for gap '%s': %w", cleanedString, e)
-			} else { // g > MaxUint16
-				propErr = fmt.Errorf("gap value '%s' out of range (0-%d)", cleanedString, math.MaxUint16)
+		case 4: // Four values: [top] [right] [bottom] [left].
+			v1, e1 := strconv.ParseUint(parts[0], 10, 8) // Top
+			v2, e2 := strconv.ParseUint(parts[1], 10, 8) // Right
+			v3, e3 := strconv.ParseUint(parts[2], 10, 8) // Bottom
+			v4, e4 := strconv.ParseUint(parts[3], 10, 8) // Left
+			if e1 != nil || e2 != nil || e3 != nil || e4 != nil {
+				propErr = fmt.Errorf("invalid uint8 values in '%s %s %s %s' for padding: %v/%v/%v/%v", parts[0], parts[1], parts[2], parts[3], e1, e2, e3, e4)
+			} else {
+				finalTop, finalRight, finalBottom, finalLeft = uint8(v1), uint8(v2), uint8(v3), uint8(v4)
 			}
+		default: // Invalid number of values for shorthand.
+			propErr = fmt.Errorf("invalid number of values (%d) for padding shorthand '%s', expected 1, 2, or 4", len(parts), cleanedString)
+		}
+
+		if propErr == nil { // Only create the KRB property if parsing was successful
+			paddingBuf := []byte{finalTop, finalRight, finalBottom, finalLeft}
+			krbProp = &KrbProperty{PropertyID: PropIDPadding, ValueType: ValTypeEdgeInsets, Size: 4, Value: paddingBuf}
+		}
 
-		case "overflow":
-			ovf := uint8(0) // Default Visible
-			switch strings.ToLower(cleanedString) {
-			case "visible":
-				ovf = 0
-			case "hidden":
-				ovf = 1
-			case "scroll":
-				ovf = 2
-			default:
-				log.Printf("L%d: Warning: Invalid overflow '%s' in style '%s', using 'visible'.", lineNum, cleanedString, style.SourceName)
+	case "margin":
+		var finalTop, finalRight, finalBottom, finalLeft uint8 = 0, 0, 0, 0
+		parts := strings.Fields(cleanedString)
+		switch len(parts) {
+		case 1:
+			v, e := strconv.ParseUint(parts[0], 10, 8)
+			if e != nil {
+				propErr = fmt.Errorf("invalid uint8 value '%s' for single margin: %w", parts[0], e)
+			} else {
+				valByte := uint8(v)
+				finalTop, finalRight, finalBottom, finalLeft = valByte, valByte, valByte, valByte
 			}
-			krbProp = &KrbProperty{PropertyID: PropIDOverflow, ValueType: ValTypeEnum, Size: 1, Value: []byte{ovf}}
-			propID = PropIDOverflow
-			propAdded = true
-
-		case "width", "min_width", "max_width", "height", "min_height", "max_height":
-			var targetPropID uint8
-			switch key {
-			case "width":
-				targetPropID = PropIDMaxWidth
-			case "min_width":
-				targetPropID = PropIDMinWidth
-			case "max_width":
-				targetPropID = PropIDMaxWidth
-			case "height":
-				targetPropID = PropIDMaxHeight
-			case "min_height":
-				targetPropID = PropIDMinHeight
-			case "max_height":
-				targetPropID = PropIDMaxHeight
+		case 2:
+			v1, e1 := strconv.ParseUint(parts[0], 10, 8)
+			v2, e2 := strconv.ParseUint(parts[1], 10, 8)
+			if e1 != nil || e2 != nil {
+				propErr = fmt.Errorf("invalid uint8 values in '%s %s' for margin: %v / %v", parts[0], parts[1], e1, e2)
+			} else {
+				vert, horiz := uint8(v1), uint8(v2)
+				finalTop, finalBottom = vert, vert
+				finalRight, finalLeft = horiz, horiz
 			}
-
-			if strings.HasSuffix(cleanedString, "%") {
-				percentStr := strings.TrimSuffix(cleanedString, "%")
-				percentF, e := strconv.ParseFloat(percentStr, 64)
-				if e == nil && percentF >= 0 {
-					fixedPointVal := uint16(math.Round(percentF / 100.0 * 256.0))
-					buf := make([]byte, 2)
-					binary.LittleEndian.PutUint16(buf, fixedPointVal)
-					krbProp = &KrbProperty{PropertyID: targetPropID, ValueType: ValTypePercentage, Size: 2, Value: buf}
-					propID = targetPropID
-					propAdded = true
-					state.HeaderFlags |= FlagFixedPoint
-				} else {
-					propErr = fmt.Errorf("invalid percentage float for %s '%s': %w", key, percentStr, e)
-				}
+		case 4:
+			v1, e1 := strconv.ParseUint(parts[0], 10, 8)
+			v2, e2 := strconv.ParseUint(parts[1], 10, 8)
+			v3, e3 := strconv.ParseUint(parts[2], 10, 8)
+			v4, e4 := strconv.ParseUint(parts[3], 10, 8)
+			if e1 != nil || e2 != nil || e3 != nil || e4 != nil {
+				propErr = fmt.Errorf("invalid uint8 values in '%s %s %s %s' for margin: %v/%v/%v/%v", parts[0], parts[1], parts[2], parts[3], e1, e2, e3, e4)
 			} else {
-				v, e := strconv.ParseUint(cleanedString, 10, 16)
-				if e == nil && v <= math.MaxUint16 {
-					buf := make([]byte, 2)
-					binary.LittleEndian.PutUint16(buf, uint16(v))
-					krbProp = &KrbProperty{PropertyID: targetPropID, ValueType: ValTypeShort, Size: 2, Value: buf}
-					propID = targetPropID
-					propAdded = true
-				} else if e != nil {
-					propErr = fmt.Errorf("invalid uint16 for %s '%s': %w", key, cleanedString, e)
-				} else {
-					propErr = fmt.Errorf("%s value '%s' out of range (0-%d)", key, cleanedString, math.MaxUint16)
-				}
+				finalTop, finalRight, finalBottom, finalLeft = uint8(v1), uint8(v2), uint8(v3), uint8(v4)
 			}
+		default:
+			propErr = fmt.Errorf("invalid number of values (%d) for margin shorthand '%s', expected 1, 2, or 4", len(parts), cleanedString)
+		}
+		if propErr == nil {
+			marginBuf := []byte{finalTop, finalRight, finalBottom, finalLeft}
+			krbProp = &KrbProperty{PropertyID: PropIDMargin, ValueType: ValTypeEdgeInsets, Size: 4, Value: marginBuf}
+		}
+
+	case "text", "content":
+		strIdx, err := state.addString(cleanedString)
+		if err != nil {
+			propErr = fmt.Errorf("failed to add string '%s' to table: %w", shortValue(cleanedString), err)
+		} else {
+			krbProp = &KrbProperty{PropertyID: PropIDTextContent, ValueType: ValTypeString, Size: indexSize, Value: indexBytes(strIdx)}
+		}
+
+	case "font_size":
+		fs, e := strconv.ParseUint(cleanedString, 10, 16)
+		if e == nil && fs > 0 && fs <= math.MaxUint16 {
+			buf := make([]byte, 2)
+			binary.LittleEndian.PutUint16(buf, uint16(fs))
+			krbProp = &KrbProperty{PropertyID: PropIDFontSize, ValueType: ValTypeShort, Size: 2, Value: buf}
+		} else if e != nil {
+			propErr = fmt.Errorf("invalid uint16 for font_size '%s': %w", cleanedString, e)
+		} else { // fs == 0 or fs > MaxUint16
+			propErr = fmt.Errorf("font_size value '%s' out of range (1-%d)", cleanedString, math.MaxUint16)
+		}
 
-		case "aspect_ratio":
-			arF, e := strconv.ParseFloat(cleanedString, 64)
-			if e == nil && arF >= 0 {
-				fixedPointVal := uint16(math.Round(arF * 256.0)) // 8.8 fixed point
+	case "font_weight":
+		weight := uint8(0) // Default Normal
+		switch strings.ToLower(cleanedString) {
+		case "normal", "400":
+			weight = 0
+		case "bold", "700":
+			weight = 1
+		default:
+			state.warnAt(CodeInvalidValue, valuePos, "Invalid font_weight '%s' in %s, using 'normal'.", cleanedString, owner)
+		}
+		krbProp = &KrbProperty{PropertyID: PropIDFontWeight, ValueType: ValTypeEnum, Size: 1, Value: []byte{weight}}
+
+	case "text_alignment":
+		align := uint8(0) // Default Start/Left
+		switch strings.ToLower(cleanedString) {
+		case "center", "centre":
+			align = 1
+		case "right", "end":
+			align = 2
+		case "left", "start":
+			align = 0
+		default:
+			state.warnAt(CodeInvalidValue, valuePos, "Invalid text_alignment '%s' in %s, using 'start'.", cleanedString, owner)
+		}
+		krbProp = &KrbProperty{PropertyID: PropIDTextAlignment, ValueType: ValTypeEnum, Size: 1, Value: []byte{align}}
+
+	case "layout":
+		layoutByte := parseLayoutString(cleanedString) // Assumes parseLayoutString is defined elsewhere
+		krbProp = &KrbProperty{PropertyID: PropIDLayoutFlags, ValueType: ValTypeByte, Size: 1, Value: []byte{layoutByte}}
+
+	case "gap":
+		g, e := strconv.ParseUint(cleanedString, 10, 16)
+		if e == nil && g <= math.MaxUint16 {
+			buf := make([]byte, 2)
+			binary.LittleEndian.PutUint16(buf, uint16(g))
+			krbProp = &KrbProperty{PropertyID: PropIDGap, ValueType: ValTypeShort, Size: 2, Value: buf}
+		} else if e != nil {
+			propErr = fmt.Errorf("invalid uint16 for gap '%s': %w", cleanedString, e)
+		} else { // g > MaxUint16
+			propErr = fmt.Errorf("gap value '%s' out of range (0-%d)", cleanedString, math.MaxUint16)
+		}
+
+	case "overflow":
+		ovf := uint8(0) // Default Visible
+		switch strings.ToLower(cleanedString) {
+		case "visible":
+			ovf = 0
+		case "hidden":
+			ovf = 1
+		case "scroll":
+			ovf = 2
+		default:
+			state.warnAt(CodeInvalidValue, valuePos, "Invalid overflow '%s' in %s, using 'visible'.", cleanedString, owner)
+		}
+		krbProp = &KrbProperty{PropertyID: PropIDOverflow, ValueType: ValTypeEnum, Size: 1, Value: []byte{ovf}}
+
+	case "width", "min_width", "max_width", "height", "min_height", "max_height":
+		var targetPropID uint8
+		switch key {
+		case "width":
+			targetPropID = PropIDMaxWidth
+		case "min_width":
+			targetPropID = PropIDMinWidth
+		case "max_width":
+			targetPropID = PropIDMaxWidth
+		case "height":
+			targetPropID = PropIDMaxHeight
+		case "min_height":
+			targetPropID = PropIDMinHeight
+		case "max_height":
+			targetPropID = PropIDMaxHeight
+		}
+
+		if strings.HasSuffix(cleanedString, "%") {
+			percentStr := strings.TrimSuffix(cleanedString, "%")
+			percentF, e := strconv.ParseFloat(percentStr, 64)
+			if e == nil && percentF >= 0 {
+				fixedPointVal := uint16(math.Round(percentF / 100.0 * 256.0))
 				buf := make([]byte, 2)
 				binary.LittleEndian.PutUint16(buf, fixedPointVal)
-				krbProp = &KrbProperty{PropertyID: PropIDAspectRatio, ValueType: ValTypePercentage, Size: 2, Value: buf}
+				krbProp = &KrbProperty{PropertyID: targetPropID, ValueType: ValTypePercentage, Size: 2, Value: buf}
 				state.HeaderFlags |= FlagFixedPoint
-				propID = PropIDAspectRatio
-				propAdded = true
 			} else {
-				propErr = fmt.Errorf("invalid positive float for aspect_ratio '%s': %w", cleanedString, e)
+				propErr = fmt.Errorf("invalid percentage float for %s '%s': %w", key, percentStr, e)
 			}
-
-		case "opacity":
-			f, e := strconv.ParseFloat(cleanedString, 64)
-			if e == nil && f >= 0.0 && f <= 1.0 {
-				fixedPointVal := uint16(math.Round(f * 256.0))
+		} else {
+			v, e := strconv.ParseUint(cleanedString, 10, 16)
+			if e == nil && v <= math.MaxUint16 {
 				buf := make([]byte, 2)
-				binary.LittleEndian.PutUint16(buf, fixedPointVal)
-				krbProp = &KrbProperty{PropertyID: PropIDOpacity, ValueType: ValTypePercentage, Size: 2, Value: buf}
-				propID = PropIDOpacity
-				propAdded = true
-				state.HeaderFlags |= FlagFixedPoint
+				binary.LittleEndian.PutUint16(buf, uint16(v))
+				krbProp = &KrbProperty{PropertyID: targetPropID, ValueType: ValTypeShort, Size: 2, Value: buf}
 			} else if e != nil {
-				propErr = fmt.Errorf("invalid float for opacity '%s': %w", cleanedString, e)
-			} else { // Out of range
-				propErr = fmt.Errorf("opacity value '%s' out of range (0.0-1.0)", cleanedString)
-			}
-
-		case "visibility", "visible":
-			visBool := false // Default to false if parsing fails
-			switch strings.ToLower(cleanedString) {
-			case "true", "visible", "1":
-				visBool = true
-			case "false", "hidden", "0":
-				visBool = false
-			default:
-				propErr = fmt.Errorf("invalid boolean value '%s' for visibility", cleanedString)
-			}
-			if propErr == nil {
-				valByte := uint8(0)
-				if visBool {
-					valByte = 1
-				}
-				krbProp = &KrbProperty{PropertyID: PropIDVisibility, ValueType: ValTypeByte, Size: 1, Value: []byte{valByte}}
-				propID = PropIDVisibility
-				propAdded = true
-			}
-
-		case "z_index":
-			zIntValue, eInt := strconv.ParseInt(cleanedString, 10, 16) // int16 for z-index
-			if eInt == nil {
-				buf := make([]byte, 2)
-				binary.LittleEndian.PutUint16(buf, uint16(zIntValue)) // Store as uint16 in KRB
-				krbProp = &KrbProperty{PropertyID: PropIDZindex, ValueType: ValTypeShort, Size: 2, Value: buf}
-				propID = PropIDZindex
-				propAdded = true
+				propErr = fmt.Errorf("invalid uint16 for %s '%s': %w", key, cleanedString, e)
 			} else {
-				propErr = fmt.Errorf("invalid int16 for z_index '%s': %w", cleanedString, eInt)
+				propErr = fmt.Errorf("%s value '%s' out of range (0-%d)", key, cleanedString, math.MaxUint16)
 			}
+		}
 
-		case "transform":
-			strIdx, err := state.addString(cleanedString)
-			if err != nil {
-				propErr = fmt.Errorf("failed to add transform string '%s': %w", cleanedString, err)
-			} else {
-				krbProp = &KrbProperty{PropertyID: PropIDTransform, ValueType: ValTypeString, Size: 1, Value: []byte{strIdx}}
-				propID = PropIDTransform
-				propAdded = true
-			}
+	case "aspect_ratio":
+		arF, e := strconv.ParseFloat(cleanedString, 64)
+		if e == nil && arF >= 0 {
+			fixedPointVal := uint16(math.Round(arF * 256.0)) // 8.8 fixed point
+			buf := make([]byte, 2)
+			binary.LittleEndian.PutUint16(buf, fixedPointVal)
+			krbProp = &KrbProperty{PropertyID: PropIDAspectRatio, ValueType: ValTypePercentage, Size: 2, Value: buf}
+			state.HeaderFlags |= FlagFixedPoint
+		} else {
+			propErr = fmt.Errorf("invalid positive float for aspect_ratio '%s': %w", cleanedString, e)
+		}
 
-		case "shadow":
-			strIdx, err := state.addString(cleanedString)
-			if err != nil {
-				propErr = fmt.Errorf("failed to add shadow string '%s': %w", cleanedString, err)
-			} else {
-				krbProp = &KrbProperty{PropertyID: PropIDShadow, ValueType: ValTypeString, Size: 1, Value: []byte{strIdx}}
-				propID = PropIDShadow
-				propAdded = true
-			}
+	case "opacity":
+		f, e := strconv.ParseFloat(cleanedString, 64)
+		if e == nil && f >= 0.0 && f <= 1.0 {
+			fixedPointVal := uint16(math.Round(f * 256.0))
+			buf := make([]byte, 2)
+			binary.LittleEndian.PutUint16(buf, fixedPointVal)
+			krbProp = &KrbProperty{PropertyID: PropIDOpacity, ValueType: ValTypePercentage, Size: 2, Value: buf}
+			state.HeaderFlags |= FlagFixedPoint
+		} else if e != nil {
+			propErr = fmt.Errorf("invalid float for opacity '%s': %w", cleanedString, e)
+		} else { // Out of range
+			propErr = fmt.Errorf("opacity value '%s' out of range (0.0-1.0)", cleanedString)
+		}
 
+	case "visibility", "visible":
+		visBool := false // Default to false if parsing fails
+		switch strings.ToLower(cleanedString) {
+		case "true", "visible", "1":
+			visBool = true
+		case "false", "hidden", "0":
+			visBool = false
 		default:
-			// Unhandled property key in styles
-			log.Printf("L%d: Warning: Unhandled property '%s' in style '%s'. Ignored.", lineNum, key, style.SourceName)
-		} // End switch key
+			propErr = fmt.Errorf("invalid boolean value '%s' for visibility", cleanedString)
+		}
+		if propErr == nil {
+			valByte := uint8(0)
+			if visBool {
+				valByte = 1
+			}
+			krbProp = &KrbProperty{PropertyID: PropIDVisibility, ValueType: ValTypeByte, Size: 1, Value: []byte{valByte}}
+		}
 
-		// Handle any error during conversion
-		if propErr != nil {
-			style.IsResolved = false // Mark style as failed to prevent partial resolution
-			return fmt.Errorf("L%d: error processing property '%s: %s' in style '%s': %w", lineNum, key, valStr, style.SourceName, propErr)
+	case "z_index":
+		zIntValue, eInt := strconv.ParseInt(cleanedString, 10, 16) // int16 for z-index
+		if eInt == nil {
+			buf := make([]byte, 2)
+			binary.LittleEndian.PutUint16(buf, uint16(zIntValue)) // Store as uint16 in KRB
+			krbProp = &KrbProperty{PropertyID: PropIDZindex, ValueType: ValTypeShort, Size: 2, Value: buf}
+		} else {
+			propErr = fmt.Errorf("invalid int16 for z_index '%s': %w", cleanedString, eInt)
 		}
 
-		// Merge the successfully converted KRB property
-		if propAdded && propID != PropIDInvalid {
-			if _, exists := mergedProps[propID]; exists {
-				overrideCount++
-			} else {
-				addedCount++
-			}
-			mergedProps[propID] = *krbProp // Direct properties override anything inherited
+	case "transform":
+		strIdx, err := state.addString(cleanedString)
+		if err != nil {
+			propErr = fmt.Errorf("failed to add transform string '%s': %w", shortValue(cleanedString), err)
+		} else {
+			krbProp = &KrbProperty{PropertyID: PropIDTransform, ValueType: ValTypeString, Size: indexSize, Value: indexBytes(strIdx)}
 		}
-	} // End loop through source properties
 
-	// --- Step 3: Finalize Resolved Properties and Calculate Size ---
-	style.Properties = make([]KrbProperty, 0, len(mergedProps))
-	propIDs := make([]uint8, 0, len(mergedProps))
-	for id := range mergedProps {
-		propIDs = append(propIDs, id)
-	}
-	// Sort properties by ID for canonical output and consistent sizing
-	sort.Slice(propIDs, func(i, j int) bool {
-		return propIDs[i] < propIDs[j]
-	})
+	case "shadow":
+		strIdx, err := state.addString(cleanedString)
+		if err != nil {
+			propErr = fmt.Errorf("failed to add shadow string '%s': %w", shortValue(cleanedString), err)
+		} else {
+			krbProp = &KrbProperty{PropertyID: PropIDShadow, ValueType: ValTypeString, Size: indexSize, Value: indexBytes(strIdx)}
+		}
 
-	finalSize := uint32(3) // StyleHeader base size: ID(1) + NameIdx(1) + PropCount(1)
-	for _, propID := range propIDs {
-		prop := mergedProps[propID]
-		style.Properties = append(style.Properties, prop)
-		finalSize += 3 + uint32(prop.Size) // PropHeader: PropID(1) + ValType(1) + Size(1) + Data(prop.Size)
+	case "transition":
+		krbProp, propErr = parseTransition(cleanedString)
+
+	default:
+		// Unhandled property key in styles
+		state.warnAt(CodeStyleProperty, keyPos, "Unhandled property '%s' in %s. Ignored.", key, owner)
 	}
 
-	style.CalculatedSize = finalSize
-	style.IsResolved = true // Mark as successfully resolved
+	return krbProp, propErr
+}
 
-	return nil // Success
+// styleExtendsPos returns the position of the style's 'extends' property,
+// falling back to its first property, or the zero Pos if it has none.
+func styleExtendsPos(style *StyleEntry) syntax.Pos {
+	for _, sp := range style.SourceProperties {
+		if sp.Key == "extends" {
+			return sp.KeyPos
+		}
+	}
+	if len(style.SourceProperties) > 0 {
+		return style.SourceProperties[0].KeyPos
+	}
+	return syntax.Pos{}
 }
@@ -0,0 +1,57 @@
+// symbols.go
+package kryc
+
+import "github.com/waozixyz/kryc/syntax"
+
+// --- Definition Symbols ---
+
+// SymbolKind classifies a Symbol.
+type SymbolKind int
+
+const (
+	SymbolStyle     SymbolKind = iota // style "name" { ... }
+	SymbolComponent                   // Define Name { ... }
+	SymbolVariable                    // name: value inside @variables { ... }
+	SymbolAnimation                   // @animation "name" { ... }
+	SymbolResource                    // name: type "path" inside @resources { ... }
+	SymbolCallback                    // name: events inside @callbacks { ... }
+)
+
+func (k SymbolKind) String() string {
+	switch k {
+	case SymbolStyle:
+		return "style"
+	case SymbolComponent:
+		return "component"
+	case SymbolVariable:
+		return "variable"
+	case SymbolAnimation:
+		return "animation"
+	case SymbolResource:
+		return "resource"
+	case SymbolCallback:
+		return "callback"
+	default:
+		return "symbol"
+	}
+}
+
+// Symbol is a named definition found in the KRY source, located in the file
+// that contains it. Editor tooling uses symbols for completion and
+// go-to-definition.
+type Symbol struct {
+	Kind   SymbolKind
+	Name   string
+	File   string
+	Line   int    // 1-based
+	Column int    // 1-based, at the start of Name
+	Detail string // Variable value, resource declaration or callback events as written; empty for other kinds
+}
+
+// addSymbol records a definition whose name starts at pos.
+func (state *CompilerState) addSymbol(kind SymbolKind, name string, pos syntax.Pos, detail string) {
+	d := state.diagnosticAt(SeverityInfo, "", pos.Line, pos.Column, name, "")
+	state.symbols = append(state.symbols, Symbol{
+		Kind: kind, Name: name, File: d.File, Line: d.Line, Column: d.Column, Detail: detail,
+	})
+}
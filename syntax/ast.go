@@ -0,0 +1,205 @@
+// ast.go
+package syntax
+
+// --- Syntax Tree ---
+
+// Node is a statement in a File or Block: one of *Include, *Variables,
+// *Resources, *Callbacks, *Style, *State, *Media, *Animation, *Keyframe,
+// *Define, *Properties, *Element or *Property.
+type Node interface {
+	Pos() Pos
+	comments() *Comments
+}
+
+// Comment is a # line comment.
+type Comment struct {
+	Pos         Pos
+	Text        string // Including the leading '#'
+	BlankBefore bool   // Separated from whatever precedes it by a blank line
+}
+
+// Comments holds the comments attached to a node.
+type Comments struct {
+	Leading     []*Comment // Comments on their own lines just before the node
+	Trailing    *Comment   // Comment at the end of the node's last line
+	BlankBefore bool       // A blank line separates the node from what precedes it
+}
+
+func (c *Comments) comments() *Comments { return c }
+
+// File is a parsed KRY source file.
+type File struct {
+	Nodes       []Node
+	EndComments []*Comment // Comments after the last node
+}
+
+// Block is a { ... } body.
+type Block struct {
+	Lbrace, Rbrace Pos
+	OpenComment    *Comment // Comment on the line of the '{'
+	Nodes          []Node
+	EndComments    []*Comment // Comments between the last node and the '}'
+}
+
+// Include is an `@include "path"` directive.
+type Include struct {
+	Comments
+	At   Pos
+	Path Token // String token
+}
+
+// Variables is an `@variables { name: value ... }` block.
+type Variables struct {
+	Comments
+	At   Pos
+	Body *Block
+}
+
+// Resources is an `@resources { name: type "path" ... }` block.
+type Resources struct {
+	Comments
+	At   Pos
+	Body *Block
+}
+
+// Callbacks is an `@callbacks { name: event, ... }` block.
+type Callbacks struct {
+	Comments
+	At   Pos
+	Body *Block
+}
+
+// Style is a `style "name" { ... }` block.
+type Style struct {
+	Comments
+	At   Pos
+	Name Token // String token
+	Body *Block
+}
+
+// State is a `state hover { ... }` block inside a style or element.
+type State struct {
+	Comments
+	At   Pos
+	Name Token // Word token such as "hover"
+	Body *Block
+}
+
+// Media is an `@media (min_width: 600) { ... }` block inside a style or
+// element.
+type Media struct {
+	Comments
+	At    Pos
+	Query Value // Tokens between @media and '{'
+	Body  *Block
+}
+
+// Animation is an `@animation "name" { ... }` block.
+type Animation struct {
+	Comments
+	At   Pos
+	Name Token // String token
+	Body *Block
+}
+
+// Keyframe is a `50% { ... }` block inside an @animation.
+type Keyframe struct {
+	Comments
+	Offset Token // Word token such as "50%"
+	Body   *Block
+}
+
+// Define is a `Define Name { ... }` component definition.
+type Define struct {
+	Comments
+	At   Pos
+	Name Token
+	Body *Block
+}
+
+// Properties is the `Properties { key: Type = default ... }` block of a
+// component definition.
+type Properties struct {
+	Comments
+	At   Pos
+	Body *Block
+}
+
+// Element is an element or component usage, `Name { ... }`.
+type Element struct {
+	Comments
+	Name Token
+	Body *Block
+}
+
+// Property is a `key: value` pair, or a `key: { ... }` sub-block such as
+// `padding: { top: 4 }`.
+type Property struct {
+	Comments
+	Key   Token
+	Value Value
+	Body  *Block // Set for sub-blocks, in which case Value is empty
+}
+
+// Value is the text of a property value.
+type Value struct {
+	Tokens []Token
+	Raw    string // Source text from the first to the last token
+}
+
+func (n *Include) Pos() Pos    { return n.At }
+func (n *Variables) Pos() Pos  { return n.At }
+func (n *Resources) Pos() Pos  { return n.At }
+func (n *Callbacks) Pos() Pos  { return n.At }
+func (n *Style) Pos() Pos      { return n.At }
+func (n *State) Pos() Pos      { return n.At }
+func (n *Media) Pos() Pos      { return n.At }
+func (n *Animation) Pos() Pos  { return n.At }
+func (n *Keyframe) Pos() Pos   { return n.Offset.Pos }
+func (n *Define) Pos() Pos     { return n.At }
+func (n *Properties) Pos() Pos { return n.At }
+func (n *Element) Pos() Pos    { return n.Name.Pos }
+func (n *Property) Pos() Pos   { return n.Key.Pos }
+
+// BodyOf returns the block of a node, or nil if it has none.
+func BodyOf(n Node) *Block {
+	switch n := n.(type) {
+	case *Variables:
+		return n.Body
+	case *Resources:
+		return n.Body
+	case *Callbacks:
+		return n.Body
+	case *Style:
+		return n.Body
+	case *State:
+		return n.Body
+	case *Media:
+		return n.Body
+	case *Animation:
+		return n.Body
+	case *Keyframe:
+		return n.Body
+	case *Define:
+		return n.Body
+	case *Properties:
+		return n.Body
+	case *Element:
+		return n.Body
+	case *Property:
+		return n.Body
+	}
+	return nil
+}
+
+// Walk calls fn for each node in depth-first source order, descending into a
+// node's block only if fn returns true.
+func Walk(nodes []Node, fn func(Node) bool) {
+	for _, n := range nodes {
+		if fn(n) {
+			if body := BodyOf(n); body != nil {
+				Walk(body.Nodes, fn)
+			}
+		}
+	}
+}
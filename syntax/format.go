@@ -0,0 +1,277 @@
+// format.go
+package syntax
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// --- Formatting ---
+// The canonical layout indents with four spaces, puts one statement per line
+// without semicolons, writes every non-empty block over several lines and
+// separates top-level blocks with a blank line. Other blank lines are kept,
+// collapsed to one.
+
+// Format parses src and returns it in canonical form. Source with syntax
+// errors is not formatted; the error is an ErrorList.
+func Format(src []byte) ([]byte, error) {
+	f, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return Print(f), nil
+}
+
+// Print renders a syntax tree in canonical form.
+func Print(f *File) []byte {
+	p := &printer{}
+	p.nodes(f.Nodes, f.EndComments, ctxTop)
+	return p.buf.Bytes()
+}
+
+// blockContext is the kind of block whose statements are being printed.
+type blockContext int
+
+const (
+	ctxTop        blockContext = iota
+	ctxElement                 // Element, style, state, @media and Define bodies
+	ctxProperties              // Properties { } declarations
+	ctxVariables               // @variables { }
+	ctxResources               // @resources { }
+	ctxCallbacks               // @callbacks { }
+	ctxEdgeInsets              // padding: { } and margin: { }
+)
+
+// nameKeys take style or element names as values, which are always quoted.
+var nameKeys = map[string]bool{"id": true, "style": true, "bar_style": true, "extends": true}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+}
+
+func (p *printer) line(text string) {
+	if text != "" {
+		p.buf.WriteString(strings.Repeat("    ", p.indent))
+		p.buf.WriteString(text)
+	}
+	p.buf.WriteByte('\n')
+}
+
+// nodes prints the statements of a block followed by its end comments.
+func (p *printer) nodes(nodes []Node, end []*Comment, ctx blockContext) {
+	switch ctx {
+	case ctxProperties:
+		nodes = sortedProperties(nodes)
+	case ctxEdgeInsets:
+		nodes = sortedEdgeInsets(nodes)
+	}
+
+	for i, n := range nodes {
+		c := n.comments()
+		blank := c.BlankBefore
+		if len(c.Leading) > 0 {
+			blank = c.Leading[0].BlankBefore
+		}
+		if ctx == ctxTop && i > 0 && (isBlock(n) || isBlock(nodes[i-1])) {
+			blank = true
+		}
+		if blank && i > 0 {
+			p.line("")
+		}
+		for j, cm := range c.Leading {
+			if j > 0 && cm.BlankBefore {
+				p.line("")
+			}
+			p.line(cm.Text)
+		}
+		if len(c.Leading) > 0 && c.BlankBefore {
+			p.line("")
+		}
+		p.node(n, ctx)
+	}
+
+	for i, cm := range end {
+		if cm.BlankBefore && (i > 0 || len(nodes) > 0) {
+			p.line("")
+		}
+		p.line(cm.Text)
+	}
+}
+
+func (p *printer) node(n Node, ctx blockContext) {
+	switch n := n.(type) {
+	case *Include:
+		p.block("@include "+n.Path.Text, nil, n.Trailing, ctx)
+	case *Variables:
+		p.block("@variables", n.Body, n.Trailing, ctxVariables)
+	case *Resources:
+		p.block("@resources", n.Body, n.Trailing, ctxResources)
+	case *Callbacks:
+		p.block("@callbacks", n.Body, n.Trailing, ctxCallbacks)
+	case *Style:
+		p.block("style "+n.Name.Text, n.Body, n.Trailing, ctxElement)
+	case *State:
+		p.block("state "+n.Name.Text, n.Body, n.Trailing, ctxElement)
+	case *Media:
+		p.block("@media "+formatQuery(n.Query.Tokens), n.Body, n.Trailing, ctxElement)
+	case *Animation:
+		p.block("@animation "+n.Name.Text, n.Body, n.Trailing, ctxElement)
+	case *Keyframe:
+		p.block(n.Offset.Text, n.Body, n.Trailing, ctxElement)
+	case *Define:
+		p.block("Define "+n.Name.Text, n.Body, n.Trailing, ctxElement)
+	case *Properties:
+		p.block("Properties", n.Body, n.Trailing, ctxProperties)
+	case *Element:
+		p.block(n.Name.Text, n.Body, n.Trailing, ctxElement)
+	case *Property:
+		if n.Body != nil {
+			p.block(n.Key.Text+":", n.Body, n.Trailing, ctxEdgeInsets)
+			return
+		}
+		text := n.Key.Text + ":"
+		if value := formatValue(n.Value.Tokens, ctx == ctxElement && nameKeys[n.Key.Text]); value != "" {
+			text += " " + value
+		}
+		p.block(text, nil, n.Trailing, ctx)
+	}
+}
+
+// block prints a statement header and, unless body is nil, its body.
+func (p *printer) block(head string, body *Block, trailing *Comment, ctx blockContext) {
+	suffix := ""
+	if trailing != nil {
+		suffix = " " + trailing.Text
+	}
+	switch {
+	case body == nil:
+		p.line(head + suffix)
+		return
+	case len(body.Nodes) == 0 && len(body.EndComments) == 0 && body.OpenComment == nil:
+		p.line(head + " {}" + suffix)
+		return
+	}
+
+	open := head + " {"
+	if body.OpenComment != nil {
+		open += " " + body.OpenComment.Text
+	}
+	p.line(open)
+	p.indent++
+	p.nodes(body.Nodes, body.EndComments, ctx)
+	p.indent--
+	p.line("}" + suffix)
+}
+
+func isBlock(n Node) bool {
+	switch n := n.(type) {
+	case *Include:
+		return false
+	case *Property:
+		return n.Body != nil
+	}
+	return true
+}
+
+// --- Values ---
+
+// formatQuery joins the tokens of an @media query as in
+// `(min_width: 600) and (orientation: landscape)`.
+func formatQuery(toks []Token) string {
+	var sb strings.Builder
+	for i, tok := range toks {
+		if i > 0 && tok.Kind != RPAREN && tok.Kind != COLON && toks[i-1].Kind != LPAREN {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(tok.Text)
+	}
+	return sb.String()
+}
+
+// formatValue joins value tokens with canonical spacing: single spaces
+// between words, none inside brackets or before commas, and spaces around
+// '='. With quoteNames, bare words other than $variables are quoted.
+func formatValue(toks []Token, quoteNames bool) string {
+	var sb strings.Builder
+	for i, tok := range toks {
+		text := tok.Text
+		if quoteNames && tok.Kind == WORD && !strings.HasPrefix(text, "$") {
+			text = `"` + text + `"`
+		}
+		if i > 0 {
+			prev := toks[i-1].Kind
+			switch {
+			case tok.Kind == COMMA || tok.Kind == RBRACK || tok.Kind == RPAREN:
+			case prev == LBRACK || prev == LPAREN:
+			case tok.Kind == LPAREN && prev == WORD && !tok.SpaceBefore:
+			case prev == COMMA || prev == ASSIGN || tok.Kind == ASSIGN || tok.SpaceBefore:
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
+
+// --- Ordering ---
+
+// sortedProperties orders component property declarations by name. Blank
+// lines between them carry no meaning once reordered and are dropped.
+func sortedProperties(nodes []Node) []Node {
+	sorted := append([]Node(nil), nodes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return nodeKey(sorted[i]) < nodeKey(sorted[j]) })
+	for _, n := range sorted {
+		clearBlank(n)
+	}
+	return sorted
+}
+
+// edgeSides lists the sides each edge inset key sets, in canonical order.
+var edgeSides = []struct {
+	key   string
+	sides string
+}{
+	{"all", "trbl"}, {"vertical", "tb"}, {"horizontal", "rl"},
+	{"top", "t"}, {"right", "r"}, {"bottom", "b"}, {"left", "l"},
+}
+
+// sortedEdgeInsets orders the entries of a padding or margin block from the
+// general to the specific. Later entries override earlier ones, so the
+// order is kept if two entries set the same side.
+func sortedEdgeInsets(nodes []Node) []Node {
+	rank := make(map[string]int, len(edgeSides))
+	for i, e := range edgeSides {
+		rank[e.key] = i
+	}
+	set := ""
+	for _, n := range nodes {
+		r, ok := rank[nodeKey(n)]
+		if !ok || strings.ContainsAny(set, edgeSides[r].sides) {
+			return nodes
+		}
+		set += edgeSides[r].sides
+	}
+	sorted := append([]Node(nil), nodes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return rank[nodeKey(sorted[i])] < rank[nodeKey(sorted[j])] })
+	for _, n := range sorted {
+		clearBlank(n)
+	}
+	return sorted
+}
+
+func nodeKey(n Node) string {
+	if prop, ok := n.(*Property); ok {
+		return prop.Key.Text
+	}
+	return ""
+}
+
+func clearBlank(n Node) {
+	c := n.comments()
+	c.BlankBefore = false
+	if len(c.Leading) > 0 {
+		c.Leading[0].BlankBefore = false
+	}
+}
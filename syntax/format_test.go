@@ -0,0 +1,117 @@
+// format_test.go
+package syntax_test
+
+import (
+	"testing"
+
+	"github.com/waozixyz/kryc/syntax"
+)
+
+func TestFormat(t *testing.T) {
+	src := `# header
+style "base" { padding: 2; layout: row center }
+App { window_title: "T"; Text { text: "a" } # trailing
+
+
+
+    Container {}
+}
+`
+	want := `# header
+style "base" {
+    padding: 2
+    layout: row center
+}
+
+App {
+    window_title: "T"
+    Text {
+        text: "a"
+    } # trailing
+
+    Container {}
+}
+`
+	got, err := syntax.Format([]byte(src))
+	if err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatSyntaxError(t *testing.T) {
+	if _, err := syntax.Format([]byte("App {\n    Text { text: \"a\"\n")); err == nil {
+		t.Error("Format of an unclosed block succeeded, want a syntax error")
+	}
+}
+
+func TestFormatIdempotent(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"empty app", "App {}"},
+		{"one line", `App { window_title: "T"; Text { text: "a" } }`},
+		{
+			"comments",
+			`# leading
+App # after the type
+{
+    # hash comment
+    Text { text: "a" } # trailing
+
+
+    /* block */ Container {}
+}
+# end
+`,
+		},
+		{
+			"top-level blocks",
+			`@include "inc.kry"
+@variables { pad: 8; color: "#FFFFFFFF" }
+@resources { logo: image "img/logo.png" embed }
+@callbacks { handleSave: click, press }
+style "base" { padding: $pad; layout: row center }
+style "btn" {
+    extends: ["base"]
+    state hover { background_color: "#303030FF" }
+    @media (min_width: 600) and (orientation: landscape) { padding: { top: 2; left: 4 } }
+}
+@animation "fade" { duration: 300ms; 0% { opacity: 0.0 } 100% { opacity: 1.0 } }
+Define Card {
+    Properties { title: String = "Untitled"; count: Int }
+    Container { Text { text: $title } }
+}
+App { Card { title: "x" } }
+`,
+		},
+		{
+			"multi-line string",
+			`App {
+    Text {
+        text: """two
+lines"""
+    }
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			once, err := syntax.Format([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("Format: %v", err)
+			}
+			twice, err := syntax.Format(once)
+			if err != nil {
+				t.Fatalf("Format of formatted source: %v\n%s", err, once)
+			}
+			if string(twice) != string(once) {
+				t.Errorf("formatting is not idempotent\nfirst:\n%s\nsecond:\n%s", once, twice)
+			}
+		})
+	}
+}
@@ -0,0 +1,417 @@
+// parser.go
+package syntax
+
+import (
+	"fmt"
+	"strings"
+)
+
+// --- Parser ---
+
+// Parse parses KRY source into a syntax tree. Parsing continues past
+// errors; the returned File holds everything that parsed and the error, if
+// any, is an ErrorList.
+func Parse(src []byte) (*File, error) {
+	toks, errs := Tokenize(src)
+	p := &parser{src: src, toks: toks, errs: errs}
+	f := &File{}
+	f.Nodes, f.EndComments = p.parseNodes(nil, "")
+	return f, p.errs.Err()
+}
+
+type parser struct {
+	src  []byte
+	toks []Token
+	pos  int
+	errs ErrorList
+}
+
+func (p *parser) peek() Token { return p.toks[p.pos] }
+
+// peekAt returns the token n places ahead, or EOF past the end.
+func (p *parser) peekAt(n int) Token {
+	if p.pos+n < len(p.toks) {
+		return p.toks[p.pos+n]
+	}
+	return p.toks[len(p.toks)-1]
+}
+
+func (p *parser) next() Token {
+	tok := p.toks[p.pos]
+	if tok.Kind != EOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(pos Pos, format string, args ...interface{}) {
+	p.errs = append(p.errs, &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// --- Comments ---
+
+// leading consumes newlines and own-line comments before the next statement.
+// blank reports whether a blank line comes between the last comment (or the
+// previous statement) and the statement.
+func (p *parser) leading() (comments []*Comment, blank bool) {
+	newlines := 0
+	if p.pos > 0 && p.toks[p.pos-1].Kind == NEWLINE {
+		newlines = 1 // The previous statement's line already ended
+	}
+	for {
+		switch tok := p.peek(); tok.Kind {
+		case NEWLINE:
+			newlines++
+			p.next()
+		case COMMENT:
+			comments = append(comments, &Comment{Pos: tok.Pos, Text: tok.Text, BlankBefore: newlines > 1})
+			newlines = 0
+			p.next()
+		default:
+			return comments, newlines > 1
+		}
+	}
+}
+
+// trailing consumes a comment on the current line, skipping separators.
+func (p *parser) trailing() *Comment {
+	for p.peek().Kind == SEMICOLON {
+		p.next()
+	}
+	if tok := p.peek(); tok.Kind == COMMENT {
+		p.next()
+		return &Comment{Pos: tok.Pos, Text: tok.Text}
+	}
+	return nil
+}
+
+// --- Statements ---
+
+// parseNodes parses statements up to the '}' closing block, or up to EOF at
+// the top level (block == nil).
+func (p *parser) parseNodes(block *Block, head string) ([]Node, []*Comment) {
+	var nodes []Node
+	for {
+		comments, blank := p.leading()
+		tok := p.peek()
+		switch {
+		case tok.Kind == EOF:
+			if block != nil {
+				p.errorf(block.Lbrace, "unclosed block '%s {' at end of file", head)
+			}
+			return nodes, comments
+		case tok.Kind == RBRACE && block != nil:
+			return nodes, comments
+		case tok.Kind == RBRACE:
+			p.errorf(tok.Pos, "unexpected '}'")
+			p.next()
+			continue
+		case tok.Kind == SEMICOLON:
+			p.next()
+			continue
+		}
+
+		n := p.parseStmt()
+		if n == nil {
+			p.skipStatement()
+			continue
+		}
+		c := n.comments()
+		if len(c.Leading) > 0 { // Comments between the header and '{' come last
+			c.Leading[0].BlankBefore, blank = blank, false
+		}
+		c.Leading, c.BlankBefore = append(comments, c.Leading...), blank
+		c.Trailing = p.trailing()
+		nodes = append(nodes, n)
+	}
+}
+
+// parseStmt parses one statement, returning nil after reporting an error.
+func (p *parser) parseStmt() Node {
+	tok := p.peek()
+	if tok.Kind != WORD {
+		p.errorf(tok.Pos, "unexpected %s", describe(tok))
+		return nil
+	}
+	if p.peekAt(1).Kind == COLON {
+		if prop := p.parseProperty(); prop != nil {
+			return prop
+		}
+		return nil
+	}
+	if tok.Text == "@include" {
+		p.next()
+		path := p.peek()
+		if path.Kind != STRING {
+			p.errorf(path.Pos, "expected quoted path after @include, found %s", describe(path))
+			return nil
+		}
+		p.next()
+		return &Include{At: tok.Pos, Path: path}
+	}
+	if tok.Text == "@media" {
+		return p.parseMedia()
+	}
+
+	// Everything else is a block: a header of words and strings, then '{'.
+	var head []Token
+	for k := p.peek().Kind; k == WORD || k == STRING; k = p.peek().Kind {
+		head = append(head, p.next())
+	}
+	comments, ok := p.skipToBrace()
+	if !ok {
+		p.errorf(p.peek().Pos, "expected '{' after '%s', found %s", head[len(head)-1].Text, describe(p.peek()))
+		return nil
+	}
+	n := p.parseBlockStmt(head)
+	if n != nil {
+		n.comments().Leading = comments
+	}
+	return n
+}
+
+// parseBlockStmt parses the block after head, whose '{' is next, returning
+// nil after reporting an error.
+func (p *parser) parseBlockStmt(head []Token) Node {
+	first := head[0]
+	switch {
+	case first.Text == "@variables" && len(head) == 1:
+		return &Variables{At: first.Pos, Body: p.parseBlock("@variables")}
+	case first.Text == "@resources" && len(head) == 1:
+		return &Resources{At: first.Pos, Body: p.parseBlock("@resources")}
+	case first.Text == "@callbacks" && len(head) == 1:
+		return &Callbacks{At: first.Pos, Body: p.parseBlock("@callbacks")}
+	case first.Text == "style" && len(head) == 2 && head[1].Kind == STRING:
+		return &Style{At: first.Pos, Name: head[1], Body: p.parseBlock("style " + head[1].Text)}
+	case first.Text == "state" && len(head) == 2 && head[1].Kind == WORD:
+		return &State{At: first.Pos, Name: head[1], Body: p.parseBlock("state " + head[1].Text)}
+	case first.Text == "@animation" && len(head) == 2 && head[1].Kind == STRING:
+		return &Animation{At: first.Pos, Name: head[1], Body: p.parseBlock("@animation " + head[1].Text)}
+	case len(head) == 1 && first.Kind == WORD && strings.HasSuffix(first.Text, "%"):
+		return &Keyframe{Offset: first, Body: p.parseBlock(first.Text)}
+	case first.Text == "Define" && len(head) == 2 && head[1].Kind == WORD:
+		return &Define{At: first.Pos, Name: head[1], Body: p.parseBlock("Define " + head[1].Text)}
+	case first.Text == "Properties" && len(head) == 1:
+		return &Properties{At: first.Pos, Body: p.parseBlock("Properties")}
+	case len(head) == 1 && first.Text[0] != '@' && first.Text != "style" && first.Text != "Define":
+		el := &Element{Name: first, Body: p.parseBlock(first.Text)}
+		// `Name { props } { children }` continues the same element.
+		for p.peek().Kind == LBRACE {
+			more := p.parseBlock(first.Text)
+			el.Body.Nodes = append(el.Body.Nodes, more.Nodes...)
+			el.Body.EndComments = append(el.Body.EndComments, more.EndComments...)
+			el.Body.Rbrace = more.Rbrace
+		}
+		return el
+	}
+	header := p.text(first, head[len(head)-1])
+	switch first.Text {
+	case "style":
+		p.errorf(first.Pos, "invalid style syntax: '%s {', use 'style \"name\" {'", header)
+	case "Define":
+		p.errorf(first.Pos, "invalid Define syntax: '%s {', use 'Define Name {'", header)
+	case "state":
+		p.errorf(first.Pos, "invalid state syntax: '%s {', use 'state hover {'", header)
+	case "@animation":
+		p.errorf(first.Pos, "invalid @animation syntax: '%s {', use '@animation \"name\" {'", header)
+	default:
+		p.errorf(first.Pos, "invalid block header '%s {'", header)
+	}
+	return nil
+}
+
+// parseMedia parses `@media query {`, where the query is every token up to
+// the '{', returning nil after reporting an error.
+func (p *parser) parseMedia() Node {
+	n := &Media{At: p.next().Pos}
+	for k := p.peek().Kind; k != LBRACE && k != NEWLINE && k != COMMENT && k != SEMICOLON && k != RBRACE && k != EOF; k = p.peek().Kind {
+		n.Query.Tokens = append(n.Query.Tokens, p.next())
+	}
+	if len(n.Query.Tokens) == 0 {
+		p.errorf(p.peek().Pos, "expected a query such as '(min_width: 600)' after @media, found %s", describe(p.peek()))
+		return nil
+	}
+	comments, ok := p.skipToBrace()
+	if !ok {
+		p.errorf(p.peek().Pos, "expected '{' after '@media %s', found %s", p.valueText(n.Query.Tokens), describe(p.peek()))
+		return nil
+	}
+	n.Leading = comments
+	n.Query.Raw = p.valueText(n.Query.Tokens)
+	n.Body = p.parseBlock("@media")
+	return n
+}
+
+// skipToBrace reports whether the next token, allowing newlines and comments
+// in between, is '{'. They are consumed only if it is, and the comments are
+// returned to become leading comments of the block.
+func (p *parser) skipToBrace() ([]*Comment, bool) {
+	n := 0
+	for k := p.peekAt(n).Kind; k == NEWLINE || k == COMMENT; k = p.peekAt(n).Kind {
+		n++
+	}
+	if p.peekAt(n).Kind != LBRACE {
+		return nil, false
+	}
+	var comments []*Comment
+	for ; n > 0; n-- {
+		if tok := p.next(); tok.Kind == COMMENT {
+			comments = append(comments, &Comment{Pos: tok.Pos, Text: tok.Text})
+		}
+	}
+	return comments, true
+}
+
+// parseProperty parses `key: value` or `key: { ... }`, returning nil after
+// reporting an error. A value ends at the end of its line unless a '[' or
+// '(' is still open. It may start on the line after `key:`.
+func (p *parser) parseProperty() *Property {
+	prop := &Property{Key: p.next()}
+	p.next() // ':'
+	if p.peek().Kind == LBRACE {
+		prop.Body = p.parseBlock(prop.Key.Text + ":")
+		return prop
+	}
+	depth := 0
+	for {
+		tok := p.peek()
+		switch tok.Kind {
+		case NEWLINE:
+			if depth > 0 {
+				p.next()
+				continue
+			}
+			if n := p.valueOnNextLine(); n > 0 && len(prop.Value.Tokens) == 0 {
+				for ; n > 0; n-- {
+					p.next()
+				}
+				continue
+			}
+		case COMMENT:
+			if depth > 0 || (tok.Text[0] == '/' && !endsValue(p.peekAt(1).Kind)) {
+				p.errorf(tok.Pos, "comments are not allowed inside the value of '%s'", prop.Key.Text)
+				return nil
+			}
+		case LBRACK, LPAREN:
+			depth++
+		case RBRACK, RPAREN:
+			depth = max(depth-1, 0)
+		case LBRACE:
+			p.errorf(tok.Pos, "unexpected '{' in value of '%s'", prop.Key.Text)
+			return nil
+		}
+		end := tok.Kind == EOF || tok.Kind == RBRACE
+		if depth == 0 && (tok.Kind == NEWLINE || tok.Kind == COMMENT || tok.Kind == SEMICOLON) {
+			end = true
+		}
+		if end {
+			if depth > 0 {
+				p.errorf(tok.Pos, "unclosed bracket in value of '%s'", prop.Key.Text)
+			}
+			prop.Value.Raw = p.valueText(prop.Value.Tokens)
+			return prop
+		}
+		prop.Value.Tokens = append(prop.Value.Tokens, p.next())
+	}
+}
+
+// valueOnNextLine returns the number of newlines before the next line with
+// tokens if that line holds only a value, as after a `key:` that ends its
+// line, or 0 if it holds a statement of its own.
+func (p *parser) valueOnNextLine() int {
+	n := 0
+	for p.peekAt(n).Kind == NEWLINE {
+		n++
+	}
+	for i := n; ; i++ {
+		switch p.peekAt(i).Kind {
+		case COLON, LBRACE:
+			return 0
+		case NEWLINE, SEMICOLON, RBRACE, COMMENT, EOF:
+			if i == n {
+				return 0
+			}
+			return n
+		}
+	}
+}
+
+// endsValue reports whether a token of kind k may follow a value at the end of
+// a statement.
+func endsValue(k Kind) bool {
+	return k == NEWLINE || k == EOF || k == RBRACE || k == SEMICOLON
+}
+
+// valueText returns the source of a value. Line breaks inside a value that
+// spans lines are replaced by single spaces.
+func (p *parser) valueText(toks []Token) string {
+	if len(toks) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for i, tok := range toks {
+		if i > 0 {
+			prev := toks[i-1]
+			if prev.Pos.Line != tok.Pos.Line {
+				sb.WriteByte(' ')
+			} else {
+				sb.Write(p.src[prev.End().Offset:tok.Pos.Offset])
+			}
+		}
+		sb.WriteString(tok.Text)
+	}
+	return sb.String()
+}
+
+// parseBlock parses a { ... } body starting at the '{'. head names the
+// statement that opens it in errors.
+func (p *parser) parseBlock(head string) *Block {
+	b := &Block{Lbrace: p.next().Pos}
+	if tok := p.peek(); tok.Kind == COMMENT {
+		p.next()
+		b.OpenComment = &Comment{Pos: tok.Pos, Text: tok.Text}
+	}
+	b.Nodes, b.EndComments = p.parseNodes(b, head)
+	if p.peek().Kind == RBRACE {
+		b.Rbrace = p.next().Pos
+	}
+	return b
+}
+
+// skipStatement skips the rest of a statement that failed to parse: up to the
+// end of its line, including the whole of any block it opens, but not past
+// the '}' of the enclosing block.
+func (p *parser) skipStatement() {
+	depth := 0
+	for {
+		switch p.peek().Kind {
+		case EOF:
+			return
+		case NEWLINE:
+			if depth == 0 {
+				return
+			}
+		case LBRACE:
+			depth++
+		case RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+		}
+		p.next()
+	}
+}
+
+// text returns the source from the start of first to the end of last.
+func (p *parser) text(first, last Token) string {
+	return string(p.src[first.Pos.Offset:last.End().Offset])
+}
+
+func describe(tok Token) string {
+	switch tok.Kind {
+	case WORD, STRING:
+		return fmt.Sprintf("'%s'", tok.Text)
+	}
+	return tok.Kind.String()
+}
@@ -0,0 +1,89 @@
+// parser_test.go
+package syntax_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/waozixyz/kryc/syntax"
+)
+
+// properties returns "key=value" for each property of f, in source order,
+// with the line of its value.
+func properties(f *syntax.File) []string {
+	var props []string
+	syntax.Walk(f.Nodes, func(n syntax.Node) bool {
+		if p, ok := n.(*syntax.Property); ok && p.Body == nil {
+			line := p.Key.Pos.Line
+			if len(p.Value.Tokens) > 0 {
+				line = p.Value.Tokens[0].Pos.Line
+			}
+			props = append(props, fmt.Sprintf("%s=%s@%d", p.Key.Text, p.Value.Raw, line))
+		}
+		return true
+	})
+	return props
+}
+
+func TestParseProperties(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"one per line", "App {\n    a: 1\n    b: \"x\"\n}\n", []string{"a=1@2", `b="x"@3`}},
+		{"shared line", "App { a: 1; b: 2 } Text { c: 3 }\n", []string{"a=1@1", "b=2@1", "c=3@1"}},
+		{"brace on next line", "App\n{\n    a: 1\n}\n", []string{"a=1@3"}},
+		{"comment before brace", "App # note\n# more\n{\n    a: 1\n}\n", []string{"a=1@4"}},
+		{"value on next line", "App {\n    text:\n        \"hello\"\n    padding:\n\n        5\n}\n", []string{`text="hello"@3`, "padding=5@6"}},
+		{"bracket spans lines", "App {\n    style: [\"a\",\n        \"b\"]\n}\n", []string{`style=["a", "b"]@2`}},
+		{"bracket on next line", "App {\n    style:\n        [\"a\",\n         \"b\"]\n}\n", []string{`style=["a", "b"]@3`}},
+		{"empty value before block", "App {\n    id:\n    Text { a: 1 }\n}\n", []string{"id=@2", "a=1@3"}},
+		{"empty value before property", "App {\n    id:\n    a: 1\n}\n", []string{"id=@2", "a=1@3"}},
+		{"trailing comment", "App {\n    a: 1 # one\n}\n", []string{"a=1@2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := syntax.Parse([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := properties(f); !slices.Equal(got, tt.want) {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // First error
+	}{
+		{"missing colon", "App {\n    id \"x\"\n}\n", "2:11: expected '{' after '\"x\"', found newline"},
+		{"missing key", "App {\n    : 1\n}\n", "2:5: unexpected ':'"},
+		{"unclosed block", "App {\n    a: 1\n", "1:5: unclosed block 'App {' at end of file"},
+		{"unclosed bracket", "App {\n    style: [\"a\"\n}\n", "3:1: unclosed bracket in value of 'style'"},
+		{"brace in value", "App {\n    a: 1 {\n}\n", "2:10: unexpected '{' in value of 'a'"},
+		{"stray brace", "App {}\n}\n", "2:1: unexpected '}'"},
+		{"bad style header", "style base {}\n", "1:1: invalid style syntax: 'style base {', use 'style \"name\" {'"},
+		{"include without path", "@include base\n", "1:10: expected quoted path after @include, found 'base'"},
+		{"block comment in value", "App {\n    a: 1 /* one */ 2\n}\n", "2:10: comments are not allowed inside the value of 'a'"},
+		{"media without query", "App { @media { a: 1 } }\n", "1:14: expected a query such as '(min_width: 600)' after @media, found '{'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := syntax.Parse([]byte(tt.src))
+			var errs syntax.ErrorList
+			if !errors.As(err, &errs) || len(errs) == 0 {
+				t.Fatalf("got error %v, want an ErrorList", err)
+			}
+			if got := errs[0].Error(); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
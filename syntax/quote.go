@@ -0,0 +1,137 @@
+// quote.go
+package syntax
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// --- String Literals ---
+// A "..." string stays on one line. A """...""" string may span lines: a
+// line break just after the opening quotes and the last line, if it holds
+// only the indentation of the closing quotes, are dropped, and so is the
+// indentation common to the remaining lines. Both kinds decode the escapes
+// \n, \r, \t, \\, \" and \u{hex}.
+
+// Unquote returns the value of a string literal, including its quotes.
+func Unquote(lit string) (string, error) {
+	var body string
+	triple := false
+	switch {
+	case len(lit) >= 6 && strings.HasPrefix(lit, `"""`) && strings.HasSuffix(lit, `"""`):
+		body, triple = dedent(lit[3:len(lit)-3]), true
+	case len(lit) >= 2 && lit[0] == '"' && lit[len(lit)-1] == '"':
+		body = lit[1 : len(lit)-1]
+	default:
+		return "", fmt.Errorf("not a string literal: %s", lit)
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '"' && (!triple || strings.HasPrefix(body[i:], `"""`)):
+			return "", errors.New("unescaped '\"' in string, use '\\\"'")
+		case c == '\n' && !triple:
+			return "", errors.New("line break in string, use '\\n' or a \"\"\" string")
+		case c != '\\':
+			sb.WriteByte(c)
+			continue
+		}
+		if i+1 == len(body) {
+			return "", errors.New("string ends with '\\'")
+		}
+		i++
+		switch body[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case '\\', '"':
+			sb.WriteByte(body[i])
+		case 'u':
+			end := strings.IndexByte(body[i:], '}')
+			if !strings.HasPrefix(body[i:], "u{") || end < 0 {
+				return "", errors.New("invalid escape sequence, use '\\u{hex}'")
+			}
+			hex := body[i+2 : i+end]
+			code, err := strconv.ParseUint(hex, 16, 32)
+			if err != nil || len(hex) > 6 || !utf8.ValidRune(rune(code)) {
+				return "", fmt.Errorf("invalid Unicode escape '\\u{%s}'", hex)
+			}
+			sb.WriteRune(rune(code))
+			i += end
+		default:
+			r, _ := utf8.DecodeRuneInString(body[i:])
+			return "", fmt.Errorf("invalid escape sequence '\\%c'", r)
+		}
+	}
+	return sb.String(), nil
+}
+
+// dedent removes the layout of a """ string body, as described above.
+func dedent(body string) string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	body = strings.TrimPrefix(body, "\n")
+	if i := strings.LastIndexByte(body, '\n'); i >= 0 && strings.TrimLeft(body[i+1:], " \t") == "" {
+		body = body[:i]
+	}
+
+	lines := strings.Split(body, "\n")
+	indent := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimLeft(line, " \t") == "" {
+			continue
+		}
+		lead := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			indent, first = lead, false
+			continue
+		}
+		for !strings.HasPrefix(lead, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	for i, line := range lines {
+		if strings.HasPrefix(line, indent) {
+			lines[i] = line[len(indent):]
+		} else {
+			lines[i] = "" // Blank line shorter than the indentation
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Quote returns a "..." literal for s, escaping quotes, backslashes and
+// control characters.
+func Quote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\u{%X}`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,248 @@
+// token.go
+// Package syntax implements a lexer, parser and printer for KRY source. The
+// syntax tree keeps comments and blank lines, so a file can be reprinted in
+// canonical form without losing anything but insignificant whitespace.
+package syntax
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// --- Tokens ---
+
+// Kind is the kind of a Token.
+type Kind int
+
+const (
+	EOF       Kind = iota
+	NEWLINE        // End of a source line
+	COMMENT        // # ... up to the end of the line, or /* ... */
+	WORD           // Identifiers, numbers, $variables, @directives and other bare text
+	STRING         // "..." or """...""" including the quotes
+	LBRACE         // {
+	RBRACE         // }
+	COLON          // :
+	SEMICOLON      // ;
+	COMMA          // ,
+	LBRACK         // [
+	RBRACK         // ]
+	LPAREN         // (
+	RPAREN         // )
+	ASSIGN         // =
+)
+
+var kindNames = [...]string{
+	EOF:       "end of file",
+	NEWLINE:   "newline",
+	COMMENT:   "comment",
+	WORD:      "word",
+	STRING:    "string",
+	LBRACE:    "'{'",
+	RBRACE:    "'}'",
+	COLON:     "':'",
+	SEMICOLON: "';'",
+	COMMA:     "','",
+	LBRACK:    "'['",
+	RBRACK:    "']'",
+	LPAREN:    "'('",
+	RPAREN:    "')'",
+	ASSIGN:    "'='",
+}
+
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Pos is a location in the source.
+type Pos struct {
+	Offset int // 0-based byte offset
+	Line   int // 1-based
+	Column int // 1-based, in bytes
+}
+
+func (p Pos) String() string { return fmt.Sprintf("%d:%d", p.Line, p.Column) }
+
+// Token is a lexical token and its location.
+type Token struct {
+	Kind        Kind
+	Text        string // Source text of the token
+	Pos         Pos
+	SpaceBefore bool // Whitespace separates the token from the previous one on its line
+}
+
+// End returns the position just after the token.
+func (t Token) End() Pos {
+	end := Pos{Offset: t.Pos.Offset + len(t.Text), Line: t.Pos.Line, Column: t.Pos.Column + len(t.Text)}
+	if i := strings.LastIndexByte(t.Text, '\n'); i >= 0 { // Block comments and """ strings
+		end.Line += strings.Count(t.Text, "\n")
+		end.Column = len(t.Text) - i
+	}
+	return end
+}
+
+// --- Lexer ---
+
+var punctuation = map[byte]Kind{
+	'{': LBRACE, '}': RBRACE, ':': COLON, ';': SEMICOLON, ',': COMMA,
+	'[': LBRACK, ']': RBRACK, '(': LPAREN, ')': RPAREN, '=': ASSIGN,
+}
+
+// isWordByte reports whether b may appear in a WORD token.
+func isWordByte(b byte) bool {
+	if _, ok := punctuation[b]; ok {
+		return false
+	}
+	return b != '"' && b != '#' && b != ' ' && b != '\t' && b != '\r' && b != '\n'
+}
+
+// isBlockComment reports whether a /* comment starts at src[off].
+func isBlockComment(src []byte, off int) bool {
+	return src[off] == '/' && off+1 < len(src) && src[off+1] == '*'
+}
+
+// Tokenize splits src into tokens, ending with an EOF token. Errors are
+// returned for unterminated comments and strings and for invalid escape
+// sequences; an unterminated "..." string runs to the end of its line.
+func Tokenize(src []byte) ([]Token, ErrorList) {
+	var toks []Token
+	var errs ErrorList
+	line, lineStart := 1, 0
+	space := false
+
+	for off := 0; off < len(src); {
+		c := src[off]
+		pos := Pos{Offset: off, Line: line, Column: off - lineStart + 1}
+		start := off
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			off++
+			space = true
+			continue
+		case c == '\n':
+			off++
+			toks = append(toks, Token{Kind: NEWLINE, Text: "\n", Pos: pos})
+			line, lineStart = line+1, off
+			space = false
+			continue
+		case c == '#':
+			for off < len(src) && src[off] != '\n' {
+				off++
+			}
+			toks = append(toks, Token{Kind: COMMENT, Text: trimRight(string(src[start:off])), Pos: pos, SpaceBefore: space})
+		case isBlockComment(src, off):
+			if end := bytes.Index(src[off+2:], []byte("*/")); end >= 0 {
+				off += 2 + end + 2
+			} else {
+				errs = append(errs, &Error{Pos: pos, Msg: "unterminated block comment"})
+				off = len(src)
+			}
+			toks = append(toks, Token{Kind: COMMENT, Text: trimRight(string(src[start:off])), Pos: pos, SpaceBefore: space})
+		case c == '"':
+			var msg string
+			off, msg = scanString(src, off)
+			tok := Token{Kind: STRING, Text: trimRight(string(src[start:off])), Pos: pos, SpaceBefore: space}
+			if msg == "" {
+				if _, err := Unquote(tok.Text); err != nil {
+					msg = err.Error()
+				}
+			}
+			if msg != "" {
+				errs = append(errs, &Error{Pos: pos, Msg: msg})
+			}
+			toks = append(toks, tok)
+		default:
+			if kind, ok := punctuation[c]; ok {
+				off++
+				toks = append(toks, Token{Kind: kind, Text: string(c), Pos: pos, SpaceBefore: space})
+				break
+			}
+			for off < len(src) && isWordByte(src[off]) && !isBlockComment(src, off) {
+				off++
+			}
+			toks = append(toks, Token{Kind: WORD, Text: string(src[start:off]), Pos: pos, SpaceBefore: space})
+		}
+		if tok := toks[len(toks)-1]; strings.IndexByte(tok.Text, '\n') >= 0 { // Spanned several lines
+			line += strings.Count(tok.Text, "\n")
+			lineStart = tok.Pos.Offset + strings.LastIndexByte(tok.Text, '\n') + 1
+		}
+		space = false
+	}
+	toks = append(toks, Token{Kind: EOF, Pos: Pos{Offset: len(src), Line: line, Column: len(src) - lineStart + 1}})
+	return toks, errs
+}
+
+// scanString returns the end of the string literal starting at src[start],
+// and an error message if it is unterminated. A "..." string ends at the end
+// of its line; a """...""" string may span lines.
+func scanString(src []byte, start int) (int, string) {
+	if bytes.HasPrefix(src[start:], []byte(`"""`)) {
+		for off := start + 3; off < len(src); off++ {
+			switch {
+			case src[off] == '\\':
+				off++
+			case bytes.HasPrefix(src[off:], []byte(`"""`)):
+				return off + 3, ""
+			}
+		}
+		return len(src), "unterminated triple-quoted string"
+	}
+	for off := start + 1; off < len(src) && src[off] != '\n'; off++ {
+		switch src[off] {
+		case '\\':
+			if off+1 < len(src) && src[off+1] != '\n' {
+				off++
+			}
+		case '"':
+			return off + 1, ""
+		}
+	}
+	end := bytes.IndexByte(src[start:], '\n')
+	if end < 0 {
+		return len(src), "unterminated string"
+	}
+	return start + end, "unterminated string"
+}
+
+func trimRight(s string) string {
+	for len(s) > 0 && (s[len(s)-1] == ' ' || s[len(s)-1] == '\t' || s[len(s)-1] == '\r') {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// --- Errors ---
+
+// Error is a syntax error at a source position.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("%s: %s", e.Pos, e.Msg) }
+
+// ErrorList is the list of syntax errors found in a source file.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns l as an error, or nil if it is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
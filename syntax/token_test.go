@@ -0,0 +1,125 @@
+// token_test.go
+package syntax_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/waozixyz/kryc/syntax"
+)
+
+// tokens returns "kind text line:column" for each token of src but the EOF.
+func tokens(t *testing.T, src string) []string {
+	t.Helper()
+	toks, errs := syntax.Tokenize([]byte(src))
+	if len(errs) > 0 {
+		t.Fatalf("Tokenize: %v", errs)
+	}
+	var out []string
+	for _, tok := range toks[:len(toks)-1] {
+		out = append(out, fmt.Sprintf("%s %q %d:%d", tok.Kind, tok.Text, tok.Pos.Line, tok.Pos.Column))
+	}
+	return out
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"property", `a: "x"; b: 1`, []string{
+			`word "a" 1:1`, `':' ":" 1:2`, `string "\"x\"" 1:4`, `';' ";" 1:7`, `word "b" 1:9`, `':' ":" 1:10`, `word "1" 1:12`,
+		}},
+		{"words", "50% ease-out $pad.x @media 0.5s", []string{
+			`word "50%" 1:1`, `word "ease-out" 1:5`, `word "$pad.x" 1:14`, `word "@media" 1:21`, `word "0.5s" 1:28`,
+		}},
+		{"line comment", "a # b \"c\"\nd", []string{
+			`word "a" 1:1`, `comment "# b \"c\"" 1:3`, `newline "\n" 1:10`, `word "d" 2:1`,
+		}},
+		{"block comment", "a/* b\n c */d", []string{
+			`word "a" 1:1`, `comment "/* b\n c */" 1:2`, `word "d" 2:6`,
+		}},
+		{"comment markers in strings", `"# /* x */"`, []string{
+			`string "\"# /* x */\"" 1:1`,
+		}},
+		{"triple-quoted string", "x: \"\"\"\n  a \"b\"\n  \"\"\" y", []string{
+			`word "x" 1:1`, `':' ":" 1:2`, `string "\"\"\"\n  a \"b\"\n  \"\"\"" 1:4`, `word "y" 3:7`,
+		}},
+		{"escaped quote", `"a\"b" c`, []string{
+			`string "\"a\\\"b\"" 1:1`, `word "c" 1:8`,
+		}},
+		{"punctuation", "[a, b](c)=", []string{
+			`'[' "[" 1:1`, `word "a" 1:2`, `',' "," 1:3`, `word "b" 1:5`, `']' "]" 1:6`,
+			`'(' "(" 1:7`, `word "c" 1:8`, `')' ")" 1:9`, `'=' "=" 1:10`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokens(t, tt.src); !slices.Equal(got, tt.want) {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizeErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"a: \"x\nb", "1:4: unterminated string"},
+		{"a: \"\"\"x\n", "1:4: unterminated triple-quoted string"},
+		{"a /* b", "1:3: unterminated block comment"},
+		{`a: "\q"`, `1:4: invalid escape sequence '\q'`},
+		{`a: "\u{110000}"`, `1:4: invalid Unicode escape '\u{110000}'`},
+		{`a: "x\"`, "1:4: unterminated string"},
+	}
+	for _, tt := range tests {
+		_, errs := syntax.Tokenize([]byte(tt.src))
+		if len(errs) == 0 {
+			t.Errorf("Tokenize(%q) succeeded, want %s", tt.src, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("Tokenize(%q): got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestUnquote(t *testing.T) {
+	tests := []struct {
+		lit  string
+		want string
+	}{
+		{`""`, ""},
+		{`"plain"`, "plain"},
+		{`"a\nb\tc\rd"`, "a\nb\tc\rd"},
+		{`"q\"b\\s"`, `q"b\s`},
+		{`"\u{48}\u{1F600}"`, "H\U0001F600"},
+		{"\"\"\"one line\"\"\"", "one line"},
+		{"\"\"\"\n    first\n      second\n\n    third\n    \"\"\"", "first\n  second\n\nthird"},
+		{"\"\"\"\n  say \"hi\"\\n\n  \"\"\"", "say \"hi\"\n"},
+	}
+	for _, tt := range tests {
+		got, err := syntax.Unquote(tt.lit)
+		if err != nil {
+			t.Errorf("Unquote(%q): %v", tt.lit, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unquote(%q) = %q, want %q", tt.lit, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteRoundTrip(t *testing.T) {
+	for _, s := range []string{"", "plain", `q"b\s`, "a\nb\tc\r", "\x00\x1f\x7f", "héllo \U0001F600"} {
+		lit := syntax.Quote(s)
+		got, err := syntax.Unquote(lit)
+		if err != nil || got != s {
+			t.Errorf("Unquote(Quote(%q)) = %q, %v; Quote gave %s", s, got, err, lit)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// target.go
+package kryc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// --- Compilation Targets ---
+// A Target describes what the runtime that loads the KRB file can decode.
+// Extensions that older or smaller runtimes lack are only used if the target
+// supports them; a document that needs one fails to compile for any other
+// target instead of being silently truncated.
+
+// Target is a named set of KRB format capabilities.
+type Target struct {
+	Name         string
+	MaxElements  int  // Elements in the main tree and all component templates
+	MaxChildren  int  // Children of a single element
+	LongStrings  bool // Strings may exceed MaxShortStringLength bytes (FlagLongStrings)
+	WideElements bool // Child counts above 255 and child offsets above 64 KiB (FlagWideElements)
+	Compression  bool // DEFLATE-compressed section payloads (FlagCompressed)
+	StateStyles  bool // Style variants for interaction states (FlagHasStyleVariants)
+	MediaQueries bool // Style variants for window sizes (FlagHasMediaVariants)
+}
+
+// DefaultTarget is the target used when Options.Target is empty.
+const DefaultTarget = "default"
+
+var targets = map[string]Target{
+	"default": {Name: "default", MaxElements: MaxElements, MaxChildren: MaxChildren, LongStrings: true, WideElements: true, Compression: true, StateStyles: true, MediaQueries: true},
+	"minimal": {Name: "minimal", MaxElements: 1024, MaxChildren: math.MaxUint8}, // Plain KRB v0.5, no optional extensions
+}
+
+// LookupTarget returns the target with the given name.
+func LookupTarget(name string) (Target, error) {
+	if name == "" {
+		name = DefaultTarget
+	}
+	t, ok := targets[name]
+	if !ok {
+		return Target{}, fmt.Errorf("unknown target '%s' (available: %s)", name, strings.Join(TargetNames(), ", "))
+	}
+	return t, nil
+}
+
+// TargetNames returns the names of all targets in sorted order.
+func TargetNames() []string {
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,164 +1,207 @@
 // types.go
-package main
+package kryc
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"log"
+	"math"
+
+	"github.com/waozixyz/kryc/krb"
+	"github.com/waozixyz/kryc/syntax"
 )
 
-// --- KRB v0.4 Constants ---
+// --- KRB v0.5 Constants ---
 const (
-	KRBMagic             = "KRB1"
-	KRBVersionMajor      = 0
-	KRBVersionMinor      = 4
-	KRBHeaderSize        = 48 // Corresponds to KRB v0.4 File Header specification
-	KRBElementHeaderSize = 17 // Includes Custom Prop Count from v0.3
+	KRBMagic                 = krb.Magic
+	KRBVersionMajor          = krb.VersionMajor
+	KRBVersionMinor          = krb.VersionMinor
+	KRBHeaderSize            = krb.HeaderSize
+	KRBElementHeaderSize     = krb.ElementHeaderSize
+	KRBElementHeaderSizeWide = krb.ElementHeaderSizeWide
 )
 
-// Header Flags (Bit 0-7)
+// Header Flags (Bit 0-8)
 const (
-	FlagHasStyles        uint16 = 1 << 0
-	FlagHasComponentDefs uint16 = 1 << 1
-	FlagHasAnimations    uint16 = 1 << 2 // Not fully implemented in compiler logic
-	FlagHasResources     uint16 = 1 << 3
-	FlagCompressed       uint16 = 1 << 4 // Not implemented
-	FlagFixedPoint       uint16 = 1 << 5
-	FlagExtendedColor    uint16 = 1 << 6
-	FlagHasApp           uint16 = 1 << 7
+	FlagHasStyles        = krb.FlagHasStyles
+	FlagHasComponentDefs = krb.FlagHasComponentDefs
+	FlagHasAnimations    = krb.FlagHasAnimations
+	FlagHasResources     = krb.FlagHasResources
+	FlagCompressed       = krb.FlagCompressed
+	FlagFixedPoint       = krb.FlagFixedPoint
+	FlagExtendedColor    = krb.FlagExtendedColor
+	FlagHasApp           = krb.FlagHasApp
+	FlagLongStrings      = krb.FlagLongStrings
+	FlagWideElements     = krb.FlagWideElements
+	FlagHasStyleVariants = krb.FlagHasStyleVariants
+	FlagHasMediaVariants = krb.FlagHasMediaVariants
 )
 
 // Element Types
 const (
-	ElemTypeApp                    uint8 = 0x00
-	ElemTypeContainer              uint8 = 0x01
-	ElemTypeText                   uint8 = 0x02
-	ElemTypeImage                  uint8 = 0x03
-	ElemTypeCanvas                 uint8 = 0x04
-	ElemTypeButton                 uint8 = 0x10
-	ElemTypeInput                  uint8 = 0x11
-	ElemTypeList                   uint8 = 0x20
-	ElemTypeGrid                   uint8 = 0x21
-	ElemTypeScrollable             uint8 = 0x22
-	ElemTypeVideo                  uint8 = 0x30
+	ElemTypeApp                          = krb.ElemTypeApp
+	ElemTypeContainer                    = krb.ElemTypeContainer
+	ElemTypeText                         = krb.ElemTypeText
+	ElemTypeImage                        = krb.ElemTypeImage
+	ElemTypeCanvas                       = krb.ElemTypeCanvas
+	ElemTypeButton                       = krb.ElemTypeButton
+	ElemTypeInput                        = krb.ElemTypeInput
+	ElemTypeList                         = krb.ElemTypeList
+	ElemTypeGrid                         = krb.ElemTypeGrid
+	ElemTypeScrollable                   = krb.ElemTypeScrollable
+	ElemTypeVideo                        = krb.ElemTypeVideo
 	ElemTypeInternalComponentUsage uint8 = 0xFE // Compiler internal: Marker for unexpanded component usage
 	ElemTypeUnknown                uint8 = 0xFF // Compiler internal: Marker for unknown KRY element name
-	ElemTypeCustomBase             uint8 = 0x31 // KRB: Base for custom types (0x31-0xFF)
+	ElemTypeCustomBase                   = krb.ElemTypeCustomBase
 )
 
 // Standard KRB Property IDs
 const (
-	PropIDInvalid        uint8 = 0x00
-	PropIDBgColor        uint8 = 0x01
-	PropIDFgColor        uint8 = 0x02 // Also text_color
-	PropIDBorderColor    uint8 = 0x03
-	PropIDBorderWidth    uint8 = 0x04
-	PropIDBorderRadius   uint8 = 0x05
-	PropIDPadding        uint8 = 0x06
-	PropIDMargin         uint8 = 0x07
-	PropIDTextContent    uint8 = 0x08
-	PropIDFontSize       uint8 = 0x09
-	PropIDFontWeight     uint8 = 0x0A
-	PropIDTextAlignment  uint8 = 0x0B
-	PropIDImageSource    uint8 = 0x0C
-	PropIDOpacity        uint8 = 0x0D
-	PropIDZindex         uint8 = 0x0E
-	PropIDVisibility     uint8 = 0x0F
-	PropIDGap            uint8 = 0x10
-	PropIDMinWidth       uint8 = 0x11
-	PropIDMinHeight      uint8 = 0x12
-	PropIDMaxWidth       uint8 = 0x13 // KRY 'width' often maps here
-	PropIDMaxHeight      uint8 = 0x14 // KRY 'height' often maps here
-	PropIDAspectRatio    uint8 = 0x15
-	PropIDTransform      uint8 = 0x16
-	PropIDShadow         uint8 = 0x17
-	PropIDOverflow       uint8 = 0x18
-	PropIDCustomDataBlob uint8 = 0x19
-	PropIDLayoutFlags    uint8 = 0x1A // KRY 'layout' property effect is encoded in Element Header, not usually written as a KRB prop.
+	PropIDInvalid        = krb.PropIDInvalid
+	PropIDBgColor        = krb.PropIDBgColor
+	PropIDFgColor        = krb.PropIDFgColor
+	PropIDBorderColor    = krb.PropIDBorderColor
+	PropIDBorderWidth    = krb.PropIDBorderWidth
+	PropIDBorderRadius   = krb.PropIDBorderRadius
+	PropIDPadding        = krb.PropIDPadding
+	PropIDMargin         = krb.PropIDMargin
+	PropIDTextContent    = krb.PropIDTextContent
+	PropIDFontSize       = krb.PropIDFontSize
+	PropIDFontWeight     = krb.PropIDFontWeight
+	PropIDTextAlignment  = krb.PropIDTextAlignment
+	PropIDImageSource    = krb.PropIDImageSource
+	PropIDOpacity        = krb.PropIDOpacity
+	PropIDZindex         = krb.PropIDZindex
+	PropIDVisibility     = krb.PropIDVisibility
+	PropIDGap            = krb.PropIDGap
+	PropIDMinWidth       = krb.PropIDMinWidth
+	PropIDMinHeight      = krb.PropIDMinHeight
+	PropIDMaxWidth       = krb.PropIDMaxWidth
+	PropIDMaxHeight      = krb.PropIDMaxHeight
+	PropIDAspectRatio    = krb.PropIDAspectRatio
+	PropIDTransform      = krb.PropIDTransform
+	PropIDShadow         = krb.PropIDShadow
+	PropIDOverflow       = krb.PropIDOverflow
+	PropIDCustomDataBlob = krb.PropIDCustomDataBlob
+	PropIDLayoutFlags    = krb.PropIDLayoutFlags
+	PropIDTransition     = krb.PropIDTransition
 	// App-Specific Properties (on ELEM_TYPE_APP)
-	PropIDWindowWidth  uint8 = 0x20
-	PropIDWindowHeight uint8 = 0x21
-	PropIDWindowTitle  uint8 = 0x22
-	PropIDResizable    uint8 = 0x23
-	PropIDKeepAspect   uint8 = 0x24
-	PropIDScaleFactor  uint8 = 0x25
-	PropIDIcon         uint8 = 0x26
-	PropIDVersion      uint8 = 0x27
-	PropIDAuthor       uint8 = 0x28
+	PropIDWindowWidth  = krb.PropIDWindowWidth
+	PropIDWindowHeight = krb.PropIDWindowHeight
+	PropIDWindowTitle  = krb.PropIDWindowTitle
+	PropIDResizable    = krb.PropIDResizable
+	PropIDKeepAspect   = krb.PropIDKeepAspect
+	PropIDScaleFactor  = krb.PropIDScaleFactor
+	PropIDIcon         = krb.PropIDIcon
+	PropIDVersion      = krb.PropIDVersion
+	PropIDAuthor       = krb.PropIDAuthor
 )
 
 // KRB Value Types
 const (
-	ValTypeNone       uint8 = 0x00
-	ValTypeByte       uint8 = 0x01 // Also used for Bool in KRB
-	ValTypeShort      uint8 = 0x02 // Also used for Int in KRB
-	ValTypeColor      uint8 = 0x03 // 1 byte (palette index) or 4 bytes (RGBA)
-	ValTypeString     uint8 = 0x04 // Represents String Table Index (typically 1 byte)
-	ValTypeResource   uint8 = 0x05 // Represents Resource Table Index (typically 1 byte)
-	ValTypePercentage uint8 = 0x06 // Represents 8.8 Fixed Point (uint16)
-	ValTypeRect       uint8 = 0x07 // Example: 4 shorts (x,y,w,h) -> 8 bytes
-	ValTypeEdgeInsets uint8 = 0x08 // Example: 4 bytes (t,r,b,l) or 4 shorts
-	ValTypeEnum       uint8 = 0x09 // Typically 1 byte, meaning depends on PropID
-	ValTypeVector     uint8 = 0x0A // Example: 2 shorts (x,y) -> 4 bytes
-	ValTypeCustom     uint8 = 0x0B // Application-specific binary data, often with PROP_ID_CUSTOM_DATA_BLOB
+	ValTypeNone       = krb.ValTypeNone
+	ValTypeByte       = krb.ValTypeByte
+	ValTypeShort      = krb.ValTypeShort
+	ValTypeColor      = krb.ValTypeColor
+	ValTypeString     = krb.ValTypeString
+	ValTypeResource   = krb.ValTypeResource
+	ValTypePercentage = krb.ValTypePercentage
+	ValTypeRect       = krb.ValTypeRect
+	ValTypeEdgeInsets = krb.ValTypeEdgeInsets
+	ValTypeEnum       = krb.ValTypeEnum
+	ValTypeVector     = krb.ValTypeVector
+	ValTypeCustom     = krb.ValTypeCustom
 
 	// --- Internal Compiler Hint Types (Not written directly as ValueType in KRB) ---
 	// These guide the KRY parser/resolver for KRY source property values.
-	ValTypeStyleID uint8 = 0x0C // KRY source: "style_name_string" -> KRB: StyleID in Element Header
-	ValTypeFloat   uint8 = 0x0D // KRY source: "0.5" -> KRB: ValTypePercentage (8.8 fixed point)
-	ValTypeInt     uint8 = 0x0E // KRY source: "100" -> KRB: ValTypeShort (or Byte if small enough)
-	ValTypeBool    uint8 = 0x0F // KRY source: "true" -> KRB: ValTypeByte (0 or 1)
+	ValTypeStyleID = krb.ValTypeStyleID
+	ValTypeFloat   = krb.ValTypeFloat
+	ValTypeInt     = krb.ValTypeInt
+	ValTypeBool    = krb.ValTypeBool
+
+	ValTypeTransition = krb.ValTypeTransition
+)
+
+// Animation Easing Functions & Triggers
+const (
+	EasingLinear     = krb.EasingLinear
+	EasingEase       = krb.EasingEase
+	EasingEaseIn     = krb.EasingEaseIn
+	EasingEaseOut    = krb.EasingEaseOut
+	EasingEaseInOut  = krb.EasingEaseInOut
+	AnimTriggerLoad  = krb.AnimTriggerLoad
+	AnimTriggerHover = krb.AnimTriggerHover
+	AnimTriggerPress = krb.AnimTriggerPress
+	AnimTriggerFocus = krb.AnimTriggerFocus
+
+	AnimIterationsInfinite = krb.AnimIterationsInfinite
 )
 
 // Event Types
 const (
-	EventTypeClick uint8 = 0x01
-	// Add other event types as needed (Press, Release, Change, etc.)
+	EventTypeClick     = krb.EventTypeClick
+	EventTypePress     = krb.EventTypePress
+	EventTypeRelease   = krb.EventTypeRelease
+	EventTypeHover     = krb.EventTypeHover
+	EventTypeLeave     = krb.EventTypeLeave
+	EventTypeFocus     = krb.EventTypeFocus
+	EventTypeBlur      = krb.EventTypeBlur
+	EventTypeChange    = krb.EventTypeChange
+	EventTypeSubmit    = krb.EventTypeSubmit
+	EventTypeScroll    = krb.EventTypeScroll
+	EventTypeKeyDown   = krb.EventTypeKeyDown
+	EventTypeLongPress = krb.EventTypeLongPress
 )
 
 // Layout Byte Bit Definitions
 const (
-	LayoutDirectionMask     uint8 = 0x03 // Bits 0-1
-	LayoutDirectionRow      uint8 = 0
-	LayoutDirectionColumn   uint8 = 1
-	LayoutDirectionRowRev   uint8 = 2
-	LayoutDirectionColRev   uint8 = 3
-	LayoutAlignmentMask     uint8 = 0x0C // Bits 2-3
-	LayoutAlignmentStart    uint8 = (0 << 2)
-	LayoutAlignmentCenter   uint8 = (1 << 2)
-	LayoutAlignmentEnd      uint8 = (2 << 2)
-	LayoutAlignmentSpaceBtn uint8 = (3 << 2)
-	LayoutWrapBit           uint8 = (1 << 4) // Bit 4
-	LayoutGrowBit           uint8 = (1 << 5) // Bit 5
-	LayoutAbsoluteBit       uint8 = (1 << 6) // Bit 6
+	LayoutDirectionMask     = krb.LayoutDirectionMask
+	LayoutDirectionRow      = krb.LayoutDirectionRow
+	LayoutDirectionColumn   = krb.LayoutDirectionColumn
+	LayoutDirectionRowRev   = krb.LayoutDirectionRowRev
+	LayoutDirectionColRev   = krb.LayoutDirectionColRev
+	LayoutAlignmentMask     = krb.LayoutAlignmentMask
+	LayoutAlignmentStart    = krb.LayoutAlignmentStart
+	LayoutAlignmentCenter   = krb.LayoutAlignmentCenter
+	LayoutAlignmentEnd      = krb.LayoutAlignmentEnd
+	LayoutAlignmentSpaceBtn = krb.LayoutAlignmentSpaceBtn
+	LayoutWrapBit           = krb.LayoutWrapBit
+	LayoutGrowBit           = krb.LayoutGrowBit
+	LayoutAbsoluteBit       = krb.LayoutAbsoluteBit
 	// Bit 7: Reserved
 )
 
 // Resource Types & Formats
 const (
-	ResTypeImage      uint8 = 0x01
-	ResTypeFont       uint8 = 0x02
-	ResTypeSound      uint8 = 0x03
-	ResTypeVideo      uint8 = 0x04
-	ResTypeCustom     uint8 = 0x05
-	ResFormatExternal uint8 = 0x00 // Data is string index to path
-	ResFormatInline   uint8 = 0x01 // Data is size + raw bytes (not fully implemented in compiler)
+	ResTypeImage      = krb.ResTypeImage
+	ResTypeFont       = krb.ResTypeFont
+	ResTypeSound      = krb.ResTypeSound
+	ResTypeVideo      = krb.ResTypeVideo
+	ResTypeCustom     = krb.ResTypeCustom
+	ResFormatExternal = krb.ResFormatExternal
+	ResFormatInline   = krb.ResFormatInline
 )
 
 // --- Compiler Limits ---
 const (
-	MaxElements         = 1024 // Max elements in the main UI tree + all template definitions
-	MaxStrings          = 1024
-	MaxProperties       = 64  // Max standard KRB properties per element/style/component property def
-	MaxStyleProperties  = 128 // Max source properties for a style during parsing/resolution
-	MaxCustomProperties = 32  // Max custom KRB properties per element instance
-	MaxStyles           = 256
-	MaxChildren         = 256 // Max source children for an element during parsing
-	MaxEvents           = 16
-	MaxLineLength       = 2048
-	MaxResources        = 256
-	MaxIncludeDepth     = 16
-	MaxComponentDefs    = 128
-	MaxBlockDepth       = 64 // Max nesting of KRY blocks {}
-	MaxPathLen          = 4096
+	MaxElements          = math.MaxUint16 // Max elements in the main UI tree + all template definitions; see Target.MaxElements
+	MaxStrings           = math.MaxUint16 // String, resource and style references are 16-bit
+	MaxProperties        = 64             // Max standard KRB properties per element/style/component property def
+	MaxStyleProperties   = 128            // Max source properties for a style during parsing/resolution
+	MaxCustomProperties  = 32             // Max custom KRB properties per element instance
+	MaxStyles            = math.MaxUint16 // StyleIDs are 1-based
+	MaxChildren          = math.MaxUint16 // Max children of one element; see Target.MaxChildren
+	MaxEvents            = 16
+	MaxAnimations        = math.MaxUint16 // Animation references are 16-bit
+	MaxAnimationRefs     = math.MaxUint8  // Animation references per element
+	MaxTransitions       = 63             // 4-byte entries after the count byte of a one-byte-sized value
+	MaxLineLength        = 2048
+	MaxResources         = math.MaxUint16
+	MaxShortStringLength = 255 // Longest string whose length fits the single-byte prefix
+	MaxIncludeDepth      = 16
+	MaxComponentDefs     = 128
+	MaxBlockDepth        = 64 // Max nesting of KRY blocks {}
+	MaxPathLen           = 4096
 )
 
 // --- Go Data Structures for KRB Compilation ---
@@ -171,11 +214,20 @@ type KrbProperty struct {
 	Value      []byte // Final binary value for the property
 }
 
+// lineOrigin records where a line of the include-expanded source came from.
+type lineOrigin struct {
+	File string // Path of the file containing the line
+	Line int    // 1-based line number within File
+	Text string // The line as written in File
+}
+
 // SourceProperty represents a property as parsed from the .kry source file.
 type SourceProperty struct {
 	Key      string
 	ValueStr string // Raw string value from source
 	LineNum  int
+	KeyPos   syntax.Pos // Where the key and the value start
+	ValuePos syntax.Pos
 }
 
 // ComponentPropertyDef describes a property declared in a `Define ComponentName { Properties { ... } }` block.
@@ -189,24 +241,61 @@ type ComponentPropertyDef struct {
 // KrbEvent represents an event entry in an Element Block.
 type KrbEvent struct {
 	EventType  uint8
-	CallbackID uint8 // String table index (0-based) for the callback function name
+	CallbackID uint16 // String table index (0-based) for the callback function name
+}
+
+// KrbAnimationRef represents an animation reference in an Element Block.
+type KrbAnimationRef struct {
+	AnimationIndex uint16 // 0-based index into the Animation Table
+	Trigger        uint8  // ANIM_TRIGGER_*
+}
+
+// KrbKeyframe is one keyframe of an animation.
+type KrbKeyframe struct {
+	Offset     uint8 // Position within the animation in percent (0-100)
+	Properties []KrbProperty
+}
+
+// AnimationEntry represents a parsed `@animation "name" { ... }` block.
+type AnimationEntry struct {
+	Name           string
+	NameIndex      uint16 // String table index for Name
+	Index          uint16 // 0-based index of this animation in the KRB Animation Table
+	DurationMs     uint16
+	Easing         uint8 // EASING_*
+	Iterations     uint8 // 0 repeats forever
+	Keyframes      []KrbKeyframe
+	DefLine        int    // Line number in KRY source where `@animation` started
+	CalculatedSize uint32 // Calculated size of this entry in the KRB file
 }
 
 // ResourceEntry represents an entry in the KRB Resource Table.
 type ResourceEntry struct {
+	Name            string // Logical name declared in @resources; empty for resources referenced by path
 	Type            uint8
-	NameIndex       uint8 // String table index for resource name/identifier
+	NameIndex       uint16 // String table index for resource name/identifier (the path if Name is empty)
 	Format          uint8
-	DataStringIndex uint8  // For RES_FORMAT_EXTERNAL: string table index of the resource path/URL
-	Index           uint8  // 0-based index of this resource in the KRB Resource Table
+	DataStringIndex uint16 // For RES_FORMAT_EXTERNAL: string table index of the resource path/URL
+	Data            []byte // For RES_FORMAT_INLINE: the embedded file contents
+	Index           uint16 // 0-based index of this resource in the KRB Resource Table
 	CalculatedSize  uint32 // Calculated size of this entry in the KRB file
+	DefLine         int    // Line of the @resources declaration; 0 for resources referenced by path
+}
+
+// CallbackEntry is a callback declared in an @callbacks block. Callbacks are
+// not written to the KRB file; event handlers still refer to them by name.
+type CallbackEntry struct {
+	Name    string
+	Events  []uint8 // Event types the callback handles; nil if it handles any
+	DefLine int     // Line of the @callbacks declaration
+	Used    bool    // Named by at least one event handler
 }
 
 // StringEntry represents an entry in the KRB String Table.
 type StringEntry struct {
 	Text   string // The actual UTF-8 string content
 	Length int    // Length in bytes (Go `len()`)
-	Index  uint8  // 0-based index of this string in the KRB String Table
+	Index  uint16 // 0-based index of this string in the KRB String Table
 }
 
 // ComponentDefinition represents a parsed `Define ComponentName { ... }` block.
@@ -226,38 +315,100 @@ type ComponentDefinition struct {
 
 // StyleEntry represents a parsed `style "name" { ... }` block.
 type StyleEntry struct {
-	ID                uint8            // 1-based ID for this style in KRB
-	SourceName        string           // Name of the style from KRY source (e.g., "my_button_style")
-	NameIndex         uint8            // String table index for SourceName
-	ExtendsStyleNames []string         // Names of base styles this style extends
-	Properties        []KrbProperty    // Final resolved KRB properties for this style
-	SourceProperties  []SourceProperty // Raw properties from KRY source before resolution
-	CalculatedSize    uint32           // Calculated size of this style block in the KRB file
-	IsResolved        bool             // Flag used during style inheritance resolution
-	IsResolving       bool             // Flag used during style inheritance resolution for cycle detection
+	ID                uint16            // 1-based ID for this style in KRB
+	SourceName        string            // Name of the style from KRY source (e.g., "my_button_style")
+	NameIndex         uint16            // String table index for SourceName
+	DefLine           int               // Line number in KRY source where `style` started; 0 if synthesized
+	ExtendsStyleNames []string          // Names of base styles this style extends
+	Properties        []KrbProperty     // Final resolved KRB properties for this style
+	SourceProperties  []SourceProperty  // Raw properties from KRY source before resolution
+	AnimationRefs     []KrbAnimationRef // From `animation:`, or inherited; applied to elements using the style
+	CalculatedSize    uint32            // Calculated size of this style block in the KRB file
+	IsResolved        bool              // Flag used during style inheritance resolution
+	IsResolving       bool              // Flag used during style inheritance resolution for cycle detection
+	Composite         bool              // Synthesized for an element listing several styles
+	StateBlocks       []StateBlock      // `state hover { ... }` blocks from KRY source
+	Variants          []StyleVariant    // Resolved state variants, own and inherited, in state order
+	MediaBlocks       []MediaBlock      // `@media (...) { ... }` blocks from KRY source
+	MediaVariants     []MediaVariant    // Resolved media variants, inherited ones first
+	ElementVariants   bool              // Synthesized for an element with state or @media blocks
+	resolveErr        error             // Why resolution failed, kept so it is reported once
+}
+
+// propertyBlock holds the source properties of a state or @media block,
+// before they are converted.
+type propertyBlock struct {
+	SourceProperties []SourceProperty
+	LineNum          int
+}
+
+// StateBlock is a `state hover { ... }` block of a style or element.
+type StateBlock struct {
+	State uint8 // krb.State*
+	propertyBlock
+}
+
+// MediaBlock is an `@media (min_width: 600) { ... }` block of a style or
+// element.
+type MediaBlock struct {
+	Conditions []krb.MediaCondition // Sorted by feature
+	propertyBlock
+}
+
+// addSourceProperty adds a raw key-value pair to a state or @media block.
+// The last definition of a key wins.
+func (block *propertyBlock) addSourceProperty(key, value string, keyPos, valuePos syntax.Pos) error {
+	for i := range block.SourceProperties {
+		if block.SourceProperties[i].Key == key {
+			block.SourceProperties[i].ValueStr = value
+			block.SourceProperties[i].LineNum = keyPos.Line
+			block.SourceProperties[i].KeyPos, block.SourceProperties[i].ValuePos = keyPos, valuePos
+			return nil
+		}
+	}
+	if len(block.SourceProperties) >= MaxStyleProperties {
+		return fmt.Errorf("maximum source properties (%d) exceeded for block", MaxStyleProperties)
+	}
+	block.SourceProperties = append(block.SourceProperties, SourceProperty{Key: key, ValueStr: value, LineNum: keyPos.Line, KeyPos: keyPos, ValuePos: valuePos})
+	return nil
+}
+
+// StyleVariant is the resolved form of a style's state, written to the style
+// variant table.
+type StyleVariant struct {
+	State      uint8
+	Properties []KrbProperty // Sorted by property ID
+}
+
+// MediaVariant is the resolved form of a style's @media block, written to
+// the media variant table.
+type MediaVariant struct {
+	Conditions []krb.MediaCondition
+	Properties []KrbProperty // Sorted by property ID
 }
 
 // addSourceProperty adds a raw key-value pair from the .kry source to a style entry.
 // The last definition of a property key in the source for a given style wins.
-func (style *StyleEntry) addSourceProperty(key, value string, lineNum int) error {
+func (style *StyleEntry) addSourceProperty(key, value string, keyPos, valuePos syntax.Pos) error {
 	for i := range style.SourceProperties {
 		if style.SourceProperties[i].Key == key {
 			style.SourceProperties[i].ValueStr = value
-			style.SourceProperties[i].LineNum = lineNum
+			style.SourceProperties[i].LineNum = keyPos.Line
+			style.SourceProperties[i].KeyPos, style.SourceProperties[i].ValuePos = keyPos, valuePos
 			return nil
 		}
 	}
 	if len(style.SourceProperties) >= MaxStyleProperties {
-		return fmt.Errorf("L%d: maximum source properties (%d) exceeded for style '%s'", lineNum, MaxStyleProperties, style.SourceName)
+		return fmt.Errorf("maximum source properties (%d) exceeded for style '%s'", MaxStyleProperties, style.SourceName)
 	}
-	prop := SourceProperty{Key: key, ValueStr: value, LineNum: lineNum}
+	prop := SourceProperty{Key: key, ValueStr: value, LineNum: keyPos.Line, KeyPos: keyPos, ValuePos: valuePos}
 	style.SourceProperties = append(style.SourceProperties, prop)
 	return nil
 }
 
 // KrbCustomProperty represents a custom key-value property entry in an Element Block.
 type KrbCustomProperty struct {
-	KeyIndex  uint8  // String table index for the property key name
+	KeyIndex  uint16 // String table index for the property key name
 	ValueType uint8  // VAL_TYPE_* for the value
 	Size      uint8  // Size of the value data in bytes
 	Value     []byte // The actual value data
@@ -267,24 +418,25 @@ type KrbCustomProperty struct {
 // This includes both elements instantiated in the main UI tree and elements forming component templates.
 type Element struct {
 	// Data that maps directly to the KRB Element Header
-	Type            uint8 // ELEM_TYPE_*
-	IDStringIndex   uint8 // String table index for KRY `id` or custom element type name
+	Type            uint8  // ELEM_TYPE_*
+	IDStringIndex   uint16 // String table index for KRY `id` or custom element type name
 	PosX            uint16
 	PosY            uint16
 	Width           uint16
 	Height          uint16
-	Layout          uint8 // Final calculated layout byte (derived from KRY `layout` property)
-	StyleID         uint8 // 1-based index into Style Blocks; 0 for no style
-	PropertyCount   uint8 // Final count of *standard* KRB properties for this element
-	ChildCount      uint8 // Final count of children for this element in its context (main tree or template)
+	Layout          uint8  // Final calculated layout byte (derived from KRY `layout` property)
+	StyleID         uint16 // 1-based index into Style Blocks; 0 for no style
+	PropertyCount   uint8  // Final count of *standard* KRB properties for this element
+	ChildCount      uint16 // Final count of children for this element in its context (main tree or template)
 	EventCount      uint8
-	AnimationCount  uint8 // Typically 0 in this compiler version
+	AnimationCount  uint8
 	CustomPropCount uint8 // Final count of *custom* KRB properties for this element
 
 	// Resolved KRB data for this element's block sections
 	KrbProperties       []KrbProperty       // Standard properties
 	KrbCustomProperties []KrbCustomProperty // Custom properties
 	KrbEvents           []KrbEvent
+	KrbAnimationRefs    []KrbAnimationRef
 	Children            []*Element // Pointers to child elements within `CompilerState.Elements`
 	// For main tree: actual children. For templates: children within that template.
 
@@ -298,6 +450,9 @@ type Element struct {
 	SourceIDName          string               // Value of `id` property from KRY source (e.g., "my_button")
 	SourceProperties      []SourceProperty     // Properties as parsed from KRY source block before resolution
 	SourceChildrenIndices []int                // Indices of children as parsed, before `Children` pointers are resolved
+	StateBlocks           []StateBlock         // `state hover { ... }` blocks, applied through a synthesized style
+	MediaBlocks           []MediaBlock         // `@media (...) { ... }` blocks, applied through a synthesized style
+	VariantBase           *StyleEntry          // Composite style refined by that synthesized style, if it is not in the style table
 	SourceLineNum         int                  // Line number in KRY source where this element started
 	LayoutFlagsSource     uint8                // Layout byte derived *directly* from KRY `layout` property string, before style merge
 	PositionHint          string               // KRY `position` property value (e.g., "top", "bottom"), used by resolver/writer
@@ -318,6 +473,7 @@ type VariableDef struct {
 	DefLine     int    // Line number where this variable was defined (latest if redefined)
 	IsResolving bool   // For cycle detection during inter-variable resolution
 	IsResolved  bool   // True if Value holds the final literal
+	Failed      bool   // True if resolving failed; the error is already reported
 }
 
 // CompilerState holds the entire state of the compilation process.
@@ -326,7 +482,9 @@ type CompilerState struct {
 	Strings       []StringEntry
 	Styles        []StyleEntry
 	Resources     []ResourceEntry
+	Callbacks     []CallbackEntry        // Declared in @callbacks blocks; nil without a callback manifest
 	ComponentDefs []ComponentDefinition  // Parsed component definitions
+	Animations    []AnimationEntry       // Parsed @animation blocks, in Animation Table order
 	Variables     map[string]VariableDef // Stores all defined variables
 
 	HasApp      bool   // True if the main UI tree has an `App` root (or implicit via root component)
@@ -336,11 +494,31 @@ type CompilerState struct {
 	CurrentLineNum  int
 	CurrentFilePath string
 
+	// Compilation environment and collected output
+	sources     map[string][]byte // In-memory source files keyed by cleaned path (see Options.Sources)
+	logger      *log.Logger       // Destination for progress output; nil discards it
+	diagnostics []Diagnostic      // Diagnostics collected during compilation
+	lineOrigins []lineOrigin      // Origin of each line of the include-expanded source, for diagnostics
+	symbols     []Symbol          // Definitions found while compiling, for editor tooling
+	errorCount  int               // Errors recorded so far by passes that recover from them
+	maxErrors   int               // Stop after this many recorded errors; 0 means no limit
+	target      Target            // Format capabilities of the runtime being compiled for
+	compress    bool              // Compress the section payloads (FlagCompressed)
+
+	columnShifts map[int][]columnShift // Column changes made by variable substitution, by line of the include-expanded source
+
+	// Embedded resources (ResFormatInline)
+	embedAll     bool                         // Write every resource inline (see Options.EmbedResources)
+	maxEmbedSize int                          // Largest embedded resource file in bytes
+	embedded     map[[sha256.Size]byte]uint16 // Inline resources by content hash, for deduplication
+
+	elementVariantStyles int // Styles synthesized so far for elements with state or @media blocks, for naming
+
 	// Calculated Offsets & Sizes for KRB File Header
 	ElementOffset      uint32 // Byte offset to Element Blocks (main UI tree)
 	StyleOffset        uint32 // Byte offset to Style Blocks
 	ComponentDefOffset uint32 // Byte offset to Component Definition Table
-	AnimOffset         uint32 // Byte offset to Animation Table (currently unused)
+	AnimOffset         uint32 // Byte offset to Animation Table
 	StringOffset       uint32 // Byte offset to String Table
 	ResourceOffset     uint32 // Byte offset to Resource Table
 	TotalSize          uint32 // Total KRB file size in bytes
@@ -349,6 +527,7 @@ type CompilerState struct {
 	TotalElementDataSize      uint32
 	TotalStyleDataSize        uint32
 	TotalComponentDefDataSize uint32
+	TotalAnimationDataSize    uint32
 	TotalStringDataSize       uint32 // Size of string data (length prefixes + UTF-8 bytes)
 	TotalResourceTableSize    uint32 // Size of all resource entries
 }
@@ -365,24 +544,41 @@ const (
 	CtxComponentDef                              // Inside a Define Name { } block (specifically, before its Properties or root element)
 	CtxProperties                                // Inside a Define -> Properties { } sub-block
 	CtxEdgeInsetProperty                         // Inside a padding: { } or margin: { } sub-block
+	CtxAnimation                                 // Inside an @animation "name" { } block
+	CtxKeyframe                                  // Inside a 50% { } keyframe of an @animation block
+	CtxResources                                 // Inside an @resources { } block
+	CtxCallbacks                                 // Inside an @callbacks { } block
+	CtxState                                     // Inside a state hover { } block of a style or element
+	CtxMedia                                     // Inside an @media (...) { } block of a style or element
 )
 
-// EdgeInsetParseState manages parsing of multi-value KRY properties like `padding: { top: N; ... }`.
-type EdgeInsetParseState struct {
-	ParentKey     string           // "padding" or "margin"
-	ParentCtx     interface{}      // Points to the *Element or *StyleEntry containing this block
-	ParentCtxType BlockContextType // CtxElement or CtxStyle
-	Indent        int              // Indentation level where this edge inset block started
-	StartLine     int              // Line number where this edge inset block started
-	Top           *string          // String pointers differentiate not-set from explicitly "0"
-	Right         *string
-	Bottom        *string
-	Left          *string
-}
-
-// BlockStackEntry is used by the KRY parser to manage nested block structures.
-type BlockStackEntry struct {
-	Indent  int
-	Context interface{} // Can be *Element, *StyleEntry, *ComponentDefinition, *EdgeInsetParseState
-	Type    BlockContextType
+func (t BlockContextType) String() string {
+	switch t {
+	case CtxNone:
+		return "top level"
+	case CtxElement:
+		return "Element"
+	case CtxStyle:
+		return "style"
+	case CtxComponentDef:
+		return "Define"
+	case CtxProperties:
+		return "Properties"
+	case CtxEdgeInsetProperty:
+		return "edge inset"
+	case CtxAnimation:
+		return "@animation"
+	case CtxKeyframe:
+		return "keyframe"
+	case CtxResources:
+		return "@resources"
+	case CtxCallbacks:
+		return "@callbacks"
+	case CtxState:
+		return "state"
+	case CtxMedia:
+		return "@media"
+	default:
+		return fmt.Sprintf("BlockContextType(%d)", int(t))
+	}
 }
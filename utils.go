@@ -1,28 +1,31 @@
 // utils.go
-package main
+package kryc
 
 import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"log"
+	"math"
 	"strings"
 	"unicode"
+	"unicode/utf8"
+
+	"github.com/waozixyz/kryc/krb"
+	"github.com/waozixyz/kryc/syntax"
 )
 
 // --- String/Value Cleaning ---
 
-// trimQuotes removes leading/trailing double quotes if present
-func trimQuotes(s string) string {
-	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
-		return s[1 : len(s)-1]
-	}
-	return s
-}
-
+// cleanAndQuoteValue returns the value of a property, without quotes and with
+// the escape sequences of a string literal decoded.
 func cleanAndQuoteValue(valStr string) (cleanedString string, wasQuoted bool) {
 	trimmed := strings.TrimSpace(valStr) // Initial trim
 
+	// A complete string literal may contain anything, including '#' and escaped quotes
+	if decoded, err := syntax.Unquote(trimmed); err == nil {
+		return decoded, true
+	}
+
 	// Check for full-line comment first
 	if strings.HasPrefix(trimmed, "#") {
 		return "", false // Treat as empty if line starts with #
@@ -66,13 +69,27 @@ func cleanAndQuoteValue(valStr string) (cleanedString string, wasQuoted bool) {
 	// (e.g., "#FF00FF comment_without_leading_hash") - Treat as invalid to avoid issues.
 	// This is a heuristic.
 	if strings.HasPrefix(cleanedString, "#") && strings.Contains(cleanedString, " ") {
-		log.Printf("Warning: Potential invalid value detected after cleaning '%s', resulting in '%s'. Treating as empty.", valStr, cleanedString)
 		return "", wasQuoted // Return empty to cause parsing error downstream if needed
 	}
 
 	return // Use named return values
 }
 
+// maxMessageValue is how many bytes of a value error messages quote.
+const maxMessageValue = 40
+
+// shortValue shortens s for quoting in an error message.
+func shortValue(s string) string {
+	if len(s) <= maxMessageValue {
+		return s
+	}
+	end := maxMessageValue
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end] + "..."
+}
+
 // --- Binary Writing Helpers ---
 
 // Helper for writing binary data
@@ -88,6 +105,87 @@ func writeUint32(w io.Writer, value uint32) error {
 	return binary.Write(w, binary.LittleEndian, value)
 }
 
+// --- Table Indices ---
+
+// Sizes of the KRB v0.5 encodings that hold string, resource and style references.
+const (
+	indexSize            = 2               // A string, resource or style reference (uint16)
+	styleHeaderSize      = 2*indexSize + 1 // ID + NameIndex + PropCount
+	externalResourceSize = 2*indexSize + 2 // Type + NameIndex + Format + DataStringIndex
+	inlineResourceHeader = indexSize + 6   // Type + NameIndex + Format + DataSize (uint32), before the data
+	customPropHeaderSize = indexSize + 2   // KeyIndex + ValueType + Size
+	eventSize            = 1 + indexSize   // EventType + CallbackID
+	animationRefSize     = indexSize + 1   // AnimationIndex + Trigger
+	animationHeaderSize  = indexSize + 5   // NameIndex + DurationMs + Easing + Iterations + KeyframeCount
+	keyframeHeaderSize   = 2               // Offset + PropCount
+	styleVariantHeader   = indexSize + 2   // StyleID + State + PropCount
+	mediaVariantHeader   = indexSize + 2   // StyleID + CondCount + PropCount
+	mediaConditionSize   = 3               // Feature + Value (uint16)
+)
+
+// indexBytes encodes a string or resource table index as a property value.
+func indexBytes(index uint16) []byte {
+	return binary.LittleEndian.AppendUint16(nil, index)
+}
+
+// writeIndex writes a string, resource or style reference.
+func writeIndex(w io.Writer, index uint16) error {
+	return writeUint16(w, index)
+}
+
+// stringLength encodes the length prefix of a string table entry: one byte,
+// or an unsigned LEB128 varint once FlagLongStrings is set.
+func (state *CompilerState) stringLength(length int) []byte {
+	if state.HeaderFlags&FlagLongStrings != 0 {
+		return binary.AppendUvarint(nil, uint64(length))
+	}
+	return []byte{uint8(length)}
+}
+
+// --- Element Encoding ---
+
+// wideElements reports whether element blocks use 16-bit child counts and
+// 32-bit child offsets (FlagWideElements).
+func (state *CompilerState) wideElements() bool {
+	return state.HeaderFlags&FlagWideElements != 0
+}
+
+func (state *CompilerState) elementHeaderSize() uint32 {
+	if state.wideElements() {
+		return KRBElementHeaderSizeWide
+	}
+	return KRBElementHeaderSize
+}
+
+func (state *CompilerState) childOffsetSize() uint32 {
+	if state.wideElements() {
+		return 4
+	}
+	return 2
+}
+
+// writeChildOffset writes the offset from an element's header to one of its
+// children.
+func (state *CompilerState) writeChildOffset(w io.Writer, offset uint32) error {
+	if state.wideElements() {
+		return writeUint32(w, offset)
+	}
+	return writeUint16(w, uint16(offset))
+}
+
+// requireWideElements switches to the wide element encoding because of el,
+// or fails if the target cannot decode it. Sizes calculated so far are stale
+// once it succeeds.
+func (state *CompilerState) requireWideElements(el *Element, format string, args ...interface{}) error {
+	reason := fmt.Sprintf(format, args...)
+	if !state.target.WideElements {
+		return state.errorf(CodeLimit, el.SourceLineNum, "", "%s, which target '%s' cannot encode (at most %d children per element and child offsets up to 64 KiB)", reason, state.target.Name, math.MaxUint8)
+	}
+	state.logf("      %s; using wide element encoding.", reason)
+	state.HeaderFlags |= FlagWideElements
+	return nil
+}
+
 // --- Parsing Helpers ---
 
 // parseColor converts "#RRGGBBAA" or "#RGB" etc. to [4]uint8 {R, G, B, A}
@@ -129,57 +227,34 @@ func parseColor(valueStr string) ([4]uint8, bool) {
 		}
 	}
 
-	log.Printf("Warning: Invalid color format '%s', Error: %v\n", valueStr, err)
-	return c, false // Return default black on error
+	return c, false // Return default black on error; callers report the invalid value
 }
 
 // guessResourceType provides a basic guess for resource type based on common keywords in the property key.
-func guessResourceType(key string) uint8 {
+// The boolean result is false when no keyword matched and the Image default was used.
+func guessResourceType(key string) (uint8, bool) {
 	lowerKey := strings.ToLower(key)
 	if strings.Contains(lowerKey, "image") || strings.Contains(lowerKey, "icon") || strings.Contains(lowerKey, "sprite") || strings.Contains(lowerKey, "texture") || strings.Contains(lowerKey, "background") || strings.Contains(lowerKey, "logo") || strings.Contains(lowerKey, "avatar") {
-		return ResTypeImage
+		return ResTypeImage, true
 	}
 	if strings.Contains(lowerKey, "font") {
-		return ResTypeFont
+		return ResTypeFont, true
 	}
 	if strings.Contains(lowerKey, "sound") || strings.Contains(lowerKey, "audio") || strings.Contains(lowerKey, "music") {
-		return ResTypeSound
+		return ResTypeSound, true
 	}
 	// Default guess if no strong hints found
-	log.Printf("Debug: Could not guess resource type for key '%s', defaulting to Image.", key)
-	return ResTypeImage
+	return ResTypeImage, false
 }
 
 // getElementTypeFromName maps standard KRY element names to KRB type IDs
 func getElementTypeFromName(name string) uint8 {
-	switch name {
-	case "App":
-		return ElemTypeApp
-	case "Container":
-		return ElemTypeContainer
-	case "Text":
-		return ElemTypeText
-	case "Image":
-		return ElemTypeImage
-	case "Canvas":
-		return ElemTypeCanvas
-	case "Button":
-		return ElemTypeButton
-	case "Input":
-		return ElemTypeInput
-	case "List":
-		return ElemTypeList
-	case "Grid":
-		return ElemTypeGrid
-	case "Scrollable":
-		return ElemTypeScrollable
-	case "Video":
-		return ElemTypeVideo
-	default:
-		// It might be a component name or a truly unknown type.
-		// The parser handles component lookup; resolver handles unknown standard types.
-		return ElemTypeUnknown
+	if t, ok := krb.ElementTypeByName(name); ok {
+		return t
 	}
+	// It might be a component name or a truly unknown type.
+	// The parser handles component lookup; resolver handles unknown standard types.
+	return ElemTypeUnknown
 }
 
 // parseLayoutString converts a space-separated layout string (e.g., "row center wrap grow")
@@ -271,10 +346,10 @@ func (style *StyleEntry) SourcePropertiesContainsKey(key string) bool {
 // addKrbProperty adds a resolved KRB property to an element.
 func (el *Element) addKrbProperty(propID, valType uint8, data []byte) error {
 	if len(el.KrbProperties) >= MaxProperties {
-		return fmt.Errorf("L%d: maximum KRB properties (%d) exceeded for element '%s'", el.SourceLineNum, MaxProperties, el.SourceElementName)
+		return fmt.Errorf("maximum KRB properties (%d) exceeded for element '%s'", MaxProperties, el.SourceElementName)
 	}
 	if len(data) > 255 { // KRB Property.Size is 1 byte
-		return fmt.Errorf("L%d: property data size (%d) exceeds maximum (255) for element '%s', prop ID 0x%X", el.SourceLineNum, len(data), el.SourceElementName, propID)
+		return fmt.Errorf("property data size (%d) exceeds maximum (255) for element '%s', prop ID 0x%X", len(data), el.SourceElementName, propID)
 	}
 	prop := KrbProperty{PropertyID: propID, ValueType: valType, Size: uint8(len(data)), Value: data}
 	el.KrbProperties = append(el.KrbProperties, prop)
@@ -286,17 +361,28 @@ func (el *Element) addKrbProperty(propID, valType uint8, data []byte) error {
 func (state *CompilerState) addKrbStringProperty(el *Element, propID uint8, valueStr string) error {
 	idx, err := state.addString(valueStr) // addString is a method of *CompilerState
 	if err != nil {
-		return fmt.Errorf("L%d: failed adding string for property 0x%X ('%s'): %w", el.SourceLineNum, propID, valueStr, err)
+		return fmt.Errorf("failed adding string for property 0x%X ('%s'): %w", propID, shortValue(valueStr), err)
 	}
-	return el.addKrbProperty(propID, ValTypeString, []byte{idx}) // Calls Element's method
+	return el.addKrbProperty(propID, ValTypeString, indexBytes(idx)) // Calls Element's method
 }
 
 // addKrbResourceProperty adds a resource property (looks up/adds resource, stores index).
-// This should be a method of CompilerState
-func (state *CompilerState) addKrbResourceProperty(el *Element, propID, resType uint8, pathStr string) error {
-	idx, err := state.addResource(resType, pathStr) // addResource is a method of *CompilerState
+// value is the raw KRY value: a path, optionally followed by the `embed` keyword.
+func (state *CompilerState) addKrbResourceProperty(el *Element, propID, resType uint8, value string) error {
+	cleaned, _ := cleanAndQuoteValue(value)
+	if res, isRef, err := state.resourceRef(cleaned); isRef {
+		if err != nil {
+			return err
+		}
+		if res.Type != resType {
+			return fmt.Errorf("resource '%s' is a %s resource, expected %s", res.Name, krb.ResourceTypeName(res.Type), krb.ResourceTypeName(resType))
+		}
+		return el.addKrbProperty(propID, ValTypeResource, indexBytes(res.Index))
+	}
+	pathStr, embed := resourceValue(value)
+	idx, err := state.addResource(resType, pathStr, embed) // addResource is a method of *CompilerState
 	if err != nil {
-		return fmt.Errorf("L%d: failed adding resource for property 0x%X ('%s'): %w", el.SourceLineNum, propID, pathStr, err)
+		return fmt.Errorf("failed adding resource for property 0x%X ('%s'): %w", propID, pathStr, err)
 	}
-	return el.addKrbProperty(propID, ValTypeResource, []byte{idx}) // Calls Element's method
+	return el.addKrbProperty(propID, ValTypeResource, indexBytes(idx)) // Calls Element's method
 }
@@ -1,23 +1,33 @@
 // variables.go
-package main
+package kryc
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
-	"log"
+	"maps"
+	"math"
 	"regexp"
+	"slices"
 	"strings"
 	"unicode"
+
+	"github.com/waozixyz/kryc/syntax"
 )
 
 var varUsageRegex = regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)`)
 
 // ProcessAndSubstituteVariables is the main entry point for the variable processing pass.
 // It collects, resolves, and substitutes variables, then removes @variables blocks.
+// Invalid definitions are recorded and the pass goes on, so that one run
+// reports every variable error; the pass then fails if any were recorded.
 func (state *CompilerState) ProcessAndSubstituteVariables(source string) (string, error) {
 	state.Variables = make(map[string]VariableDef)
 
-	if err := state.collectRawVariables(source); err != nil {
+	// Syntax errors outside @variables blocks are reported by the parse pass.
+	file, parseErr := syntax.Parse([]byte(source))
+	blocks := variablesBlocks(file)
+
+	if err := state.collectRawVariables(blocks, parseErr); err != nil {
 		return source, fmt.Errorf("error collecting variables: %w", err)
 	}
 
@@ -25,102 +35,141 @@ func (state *CompilerState) ProcessAndSubstituteVariables(source string) (string
 		return source, fmt.Errorf("error resolving variables: %w", err)
 	}
 
-	substitutedSource, err := state.performSubstitutionAndRemoveBlocks(source)
+	substitutedSource, err := state.performSubstitutionAndRemoveBlocks(source, blocks)
 	if err != nil {
 		return source, fmt.Errorf("error substituting variables: %w", err)
 	}
+	if err := state.recordedErrors(); err != nil {
+		return source, err
+	}
 	return substitutedSource, nil
 }
 
-// collectRawVariables scans the source for @variables blocks and populates state.Variables.
-// Handles redefinition (later wins, with a warning).
-func (state *CompilerState) collectRawVariables(source string) error {
-	scanner := bufio.NewScanner(strings.NewReader(source))
-	inVariablesBlock := false
-	currentLineNum := 0
-
-	for scanner.Scan() {
-		currentLineNum++
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
-
-		if strings.HasPrefix(trimmedLine, "#") { // Skip full-line comments
-			continue
+// variablesBlocks returns the @variables blocks of file, wherever they appear.
+func variablesBlocks(file *syntax.File) []*syntax.Variables {
+	var blocks []*syntax.Variables
+	syntax.Walk(file.Nodes, func(n syntax.Node) bool {
+		if v, ok := n.(*syntax.Variables); ok {
+			blocks = append(blocks, v)
+			return false // Nested blocks are rejected by collectRawVariables
 		}
+		return true
+	})
+	return blocks
+}
 
-		// Strip trailing comments from the line
-		commentIndex := -1
-		inQuotes := false
-		for i, r := range trimmedLine {
-			if r == '"' {
-				inQuotes = !inQuotes
-			}
-			if r == '#' && !inQuotes {
-				commentIndex = i
-				break
-			}
-		}
-		if commentIndex != -1 {
-			trimmedLine = strings.TrimSpace(trimmedLine[:commentIndex])
-		}
+// variablesSpan returns the source lines covered by an @variables block.
+func variablesSpan(v *syntax.Variables) (first, last int) {
+	if v.Body.Rbrace.Line == 0 {
+		return v.At.Line, math.MaxInt // Unclosed; runs to the end of the source
+	}
+	return v.At.Line, v.Body.Rbrace.Line
+}
 
-		if trimmedLine == "@variables {" {
-			if inVariablesBlock {
-				return fmt.Errorf("L%d: nested @variables blocks are not allowed", currentLineNum)
+// collectRawVariables reads the definitions in @variables blocks into state.Variables.
+// Handles redefinition (later wins, with a warning). Invalid definitions are
+// recorded and skipped; the error returned stops compilation.
+func (state *CompilerState) collectRawVariables(blocks []*syntax.Variables, parseErr error) error {
+	var syntaxErrs syntax.ErrorList
+	errors.As(parseErr, &syntaxErrs)
+	for _, e := range syntaxErrs {
+		for _, v := range blocks {
+			if first, last := variablesSpan(v); e.Pos.Line >= first && e.Pos.Line <= last {
+				if stop := state.recordError(state.errorAt(CodeVariable, e.Pos, "invalid @variables block: %s", e.Msg)); stop != nil {
+					return stop
+				}
+				break
 			}
-			inVariablesBlock = true
-			continue
 		}
+	}
 
-		if trimmedLine == "}" {
-			if inVariablesBlock {
-				inVariablesBlock = false
-				continue
+	for _, v := range blocks {
+		for _, n := range v.Body.Nodes {
+			line := n.Pos().Line
+			def, ok := n.(*syntax.Property)
+			var err error
+			switch nested, isBlock := n.(*syntax.Variables); {
+			case isBlock:
+				err = state.errorAt(CodeVariable, nested.At, "nested @variables blocks are not allowed")
+			case !ok || def.Body != nil:
+				err = state.errorAt(CodeVariable, n.Pos(), "invalid variable definition syntax in @variables block. Expected 'name: value'")
+			case !isValidIdentifier(def.Key.Text):
+				err = state.errorAt(CodeVariable, def.Key.Pos, "invalid variable name '%s'", def.Key.Text)
+			case def.Key.Text == resourceNamespace:
+				err = state.errorAt(CodeVariable, def.Key.Pos, "variable name '%s' is reserved for resource references ($%s.name)", def.Key.Text, resourceNamespace)
 			}
-			// If not inVariablesBlock, this '}' is for other KRY syntax, ignore here.
-		}
-
-		if inVariablesBlock {
-			if trimmedLine == "" {
+			if err != nil {
+				if stop := state.recordError(err); stop != nil {
+					return stop
+				}
 				continue
 			}
-			parts := strings.SplitN(trimmedLine, ":", 2)
-			if len(parts) != 2 {
-				return fmt.Errorf("L%d: invalid variable definition syntax in @variables block: '%s'. Expected 'name: value'", currentLineNum, trimmedLine)
-			}
-			varName := strings.TrimSpace(parts[0])
-			rawValue := strings.TrimSpace(parts[1])
-
-			if !isValidIdentifier(varName) {
-				return fmt.Errorf("L%d: invalid variable name '%s'", currentLineNum, varName)
-			}
+			varName := def.Key.Text
+			rawValue := singleLineValue(def.Value)
 
 			if existing, exists := state.Variables[varName]; exists {
-				log.Printf("L%d: Warn: Variable '%s' redefined. Previous definition at L%d.", currentLineNum, varName, existing.DefLine)
+				d := state.diagnosticAt(SeverityWarning, CodeVariableRedefined, line, def.Key.Pos.Column, varName, fmt.Sprintf("variable '%s' redefined", varName))
+				d.Related = append(d.Related, state.relatedAt(existing.DefLine, varName, "previous definition is here"))
+				state.report(d)
 			}
 			state.Variables[varName] = VariableDef{
 				RawValue: rawValue,
-				DefLine:  currentLineNum,
+				DefLine:  line,
 			}
+			state.addSymbol(SymbolVariable, varName, def.Key.Pos, rawValue)
+		}
+	}
+	return nil
+}
+
+// singleLineValue returns the source of a value with """ strings that span
+// lines rewritten as "..." strings, so substituting it keeps line numbers.
+func singleLineValue(v syntax.Value) string {
+	raw := v.Raw
+	for _, tok := range v.Tokens {
+		if tok.Kind != syntax.STRING || !strings.Contains(tok.Text, "\n") {
+			continue
+		}
+		if decoded, err := syntax.Unquote(tok.Text); err == nil {
+			raw = strings.Replace(raw, tok.Text, syntax.Quote(decoded), 1)
 		}
 	}
-	return scanner.Err()
+	return raw
 }
 
 // resolveAllVariables resolves inter-variable dependencies and detects cycles.
-// Updates VariableDef.Value with the final literal string.
+// Updates VariableDef.Value with the final literal string. A variable that
+// cannot be resolved is recorded and marked failed, along with the variables
+// that were being resolved through it; the error returned stops compilation.
 func (state *CompilerState) resolveAllVariables() error {
-	for name := range state.Variables {
-		if !state.Variables[name].IsResolved {
-			_, err := state.resolveVariable(name, make(map[string]struct{}))
-			if err != nil {
-				return err
+	for _, name := range slices.Sorted(maps.Keys(state.Variables)) { // Sorted, so errors come in a stable order
+		if state.Variables[name].IsResolved || state.Variables[name].Failed {
+			continue
+		}
+		_, err := state.resolveVariable(name, make(map[string]struct{}))
+		if err == nil {
+			continue
+		}
+		for n, def := range state.Variables {
+			if def.IsResolving {
+				def.IsResolving, def.Failed = false, true
+				state.Variables[n] = def
 			}
 		}
+		if errors.Is(err, errVariableFailed) {
+			continue // Reported on the variable that failed
+		}
+		if stop := state.recordError(err); stop != nil {
+			return stop
+		}
 	}
 	return nil
 }
 
+// errVariableFailed is returned when resolving a variable that refers to
+// one whose failure has already been reported.
+var errVariableFailed = errors.New("variable failed to resolve")
+
 // resolveVariable recursively resolves a single variable.
 func (state *CompilerState) resolveVariable(name string, visited map[string]struct{}) (string, error) {
 	varDef, exists := state.Variables[name]
@@ -133,11 +182,14 @@ func (state *CompilerState) resolveVariable(name string, visited map[string]stru
 	if varDef.IsResolved {
 		return varDef.Value, nil
 	}
+	if varDef.Failed {
+		return "", fmt.Errorf("variable '%s': %w", name, errVariableFailed)
+	}
 	if varDef.IsResolving { // Also check visited for path-specific cycle
-		return "", fmt.Errorf("L%d: cyclic variable definition detected for '%s'", varDef.DefLine, name)
+		return "", state.errorf(CodeVariable, varDef.DefLine, name, "cyclic variable definition detected for '%s'", name)
 	}
 	if _, alreadyVisited := visited[name]; alreadyVisited {
-		return "", fmt.Errorf("L%d: cyclic variable definition detected involving '%s' (path: %v)", varDef.DefLine, name, getPath(visited, name))
+		return "", state.errorf(CodeVariable, varDef.DefLine, name, "cyclic variable definition detected involving '%s' (path: %v)", name, getPath(visited, name))
 	}
 
 	varDef.IsResolving = true
@@ -149,10 +201,16 @@ func (state *CompilerState) resolveVariable(name string, visited map[string]stru
 	matches := varUsageRegex.FindAllStringSubmatch(currentValue, -1)
 	for _, match := range matches {
 		refVarName := match[1]
+		if refVarName == resourceNamespace {
+			continue // $res.name is resolved with the properties that use it
+		}
+		if _, defined := state.Variables[refVarName]; !defined {
+			return "", state.errorf(CodeVariable, varDef.DefLine, "$"+refVarName, "undefined variable '$%s' used in variable '%s'", refVarName, name)
+		}
 		resolvedRefValue, err := state.resolveVariable(refVarName, visited)
 		if err != nil {
-			// Prepend current variable's context to the error
-			return "", fmt.Errorf("L%d: in variable '%s': %w", varDef.DefLine, name, err)
+			// Prepend current variable's context; the diagnostic stays on the innermost definition
+			return "", fmt.Errorf("in variable '%s': %w", name, err)
 		}
 		// Substitute resolved value textually
 		currentValue = strings.ReplaceAll(currentValue, "$"+refVarName, resolvedRefValue)
@@ -167,56 +225,89 @@ func (state *CompilerState) resolveVariable(name string, visited map[string]stru
 	return varDef.Value, nil
 }
 
-// performSubstitutionAndRemoveBlocks removes @variables blocks and substitutes $varName elsewhere.
-func (state *CompilerState) performSubstitutionAndRemoveBlocks(source string) (string, error) {
-	var result strings.Builder
-	scanner := bufio.NewScanner(strings.NewReader(source))
-	inVariablesBlock := false
-	currentLineNum := 0
-	var substitutionErrors []string
+// performSubstitutionAndRemoveBlocks blanks out @variables blocks and substitutes $varName elsewhere.
+func (state *CompilerState) performSubstitutionAndRemoveBlocks(source string, blocks []*syntax.Variables) (string, error) {
+	// @variables blocks are blanked rather than removed so that later passes
+	// report the same lines and columns as this one.
+	blanked := []byte(source)
+	for _, v := range blocks {
+		end := len(blanked)
+		if v.Body.Rbrace.Line > 0 {
+			end = v.Body.Rbrace.Offset + 1
+		}
+		for i := v.At.Offset; i < end; i++ {
+			if blanked[i] != '\n' {
+				blanked[i] = ' '
+			}
+		}
+	}
 
-	for scanner.Scan() {
-		currentLineNum++
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
+	// Substitution applies to words and strings; comments are copied as they are.
+	var result strings.Builder
+	var substitutionErrors []Diagnostic
+	// shifts records how substitution moves columns, so that later passes can
+	// report them as written; delta is the bytes added to each line so far.
+	shifts := make(map[int][]columnShift)
+	delta := make(map[int]int)
 
-		if strings.HasPrefix(trimmedLine, "@variables {") {
-			inVariablesBlock = true
-			continue // Remove this line
-		}
-		if inVariablesBlock && trimmedLine == "}" {
-			inVariablesBlock = false
-			continue // Remove this line
+	toks, _ := syntax.Tokenize(blanked) // Errors are reported by the parse pass
+	copied := 0
+	for _, tok := range toks {
+		if tok.Kind != syntax.WORD && tok.Kind != syntax.STRING {
+			continue
 		}
-		if inVariablesBlock {
-			continue // Remove lines inside @variables block
+		matches := varUsageRegex.FindAllStringIndex(tok.Text, -1)
+		if matches == nil {
+			continue
 		}
+		result.Write(blanked[copied:tok.Pos.Offset])
+		prevEnd := 0
+		for _, m := range matches {
+			match := tok.Text[m[0]:m[1]]
+			result.WriteString(tok.Text[prevEnd:m[0]])
+			prevEnd = m[1]
+			pos := advancePos(tok.Pos, tok.Text, m[0]) // Strings may span lines
+			lineNum, col := pos.Line, pos.Column
 
-		// Perform substitution for lines not in @variables block
-		substitutedLine := varUsageRegex.ReplaceAllStringFunc(line, func(match string) string {
 			varName := match[1:] // Remove leading '$'
+			if varName == resourceNamespace && strings.HasPrefix(tok.Text[m[1]:], ".") {
+				result.WriteString(match) // $res.name refers to an @resources entry
+				continue
+			}
 			varDef, exists := state.Variables[varName]
 			if !exists {
-				errStr := fmt.Sprintf("L%d: undefined variable '$%s' used", currentLineNum, varName)
-				substitutionErrors = append(substitutionErrors, errStr)
-				return match // Return original if undefined, error will be reported
+				substitutionErrors = append(substitutionErrors, state.diagnosticAt(SeverityError, CodeVariable, lineNum, col, match,
+					fmt.Sprintf("undefined variable '$%s' used", varName)))
+				result.WriteString(match) // Keep the original if undefined, error will be reported
+				continue
+			}
+			if varDef.Failed {
+				result.WriteString(match) // Its definition is already reported
+				continue
 			}
 			if !varDef.IsResolved { // Should not happen if resolveAllVariables was successful
-				errStr := fmt.Sprintf("L%d: internal error: variable '$%s' used but not resolved", currentLineNum, varName)
-				substitutionErrors = append(substitutionErrors, errStr)
-				return match
+				substitutionErrors = append(substitutionErrors, state.diagnosticAt(SeverityError, CodeInternal, lineNum, col, match,
+					fmt.Sprintf("internal error: variable '$%s' used but not resolved", varName)))
+				result.WriteString(match)
+				continue
 			}
-			return varDef.Value
-		})
-		result.WriteString(substitutedLine)
-		result.WriteString("\n")
+			result.WriteString(varDef.Value)
+			shifts[lineNum] = append(shifts[lineNum], columnShift{
+				Column: col + delta[lineNum], Width: len(varDef.Value),
+				OriginalColumn: col, OriginalWidth: len(match),
+			})
+			delta[lineNum] += len(varDef.Value) - len(match)
+		}
+		result.WriteString(tok.Text[prevEnd:])
+		copied = tok.Pos.Offset + len(tok.Text)
 	}
+	result.Write(blanked[copied:])
+	state.columnShifts = shifts // Set last: the diagnostics above use columns as written
 
-	if err := scanner.Err(); err != nil {
-		return "", err
-	}
-	if len(substitutionErrors) > 0 {
-		return "", fmt.Errorf(strings.Join(substitutionErrors, "\n"))
+	for _, d := range substitutionErrors {
+		if stop := state.recordError(&DiagnosticError{Diagnostic: d, err: errors.New(d.Message)}); stop != nil {
+			return "", stop
+		}
 	}
 
 	return result.String(), nil
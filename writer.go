@@ -1,22 +1,33 @@
 // writer.go
-package main
+package kryc
 
 import (
 	"bufio"
 	"fmt"
 	"io"
-	"log"
 	"math"
-	"os"
 	"sort"
 )
 
-// --- Pass 2: Calculate Offsets & Sizes (KRB v0.4) ---
+// --- Pass 2: Calculate Offsets & Sizes (KRB v0.5) ---
 
 func (state *CompilerState) calculateOffsetsAndSizes() error {
-	log.Println("Pass 2: Calculating final offsets and sizes (KRB v0.4)...")
+	state.logf("Pass 2: Calculating final offsets and sizes (KRB v%d.%d)...", KRBVersionMajor, KRBVersionMinor)
 	currentOffset := uint32(KRBHeaderSize) // Start after the main file header
 
+	// --- 0. Element Encoding ---
+	// More than 255 children need the wide element encoding, and so do child
+	// offsets beyond 64 KiB. Those are only known once elements are sized, so
+	// sizing starts over if one turns up.
+	for i := range state.Elements {
+		el := &state.Elements[i]
+		if n := max(len(el.Children), len(el.SourceChildrenIndices)); n > math.MaxUint8 && !state.wideElements() {
+			if err := state.requireWideElements(el, "element '%s' has %d children", el.SourceElementName, n); err != nil {
+				return err
+			}
+		}
+	}
+
 	// --- 1. Elements Section Size (Main UI Tree Placeholders and Standard Elements ONLY) ---
 	state.ElementOffset = currentOffset
 	state.TotalElementDataSize = 0
@@ -35,7 +46,7 @@ func (state *CompilerState) calculateOffsetsAndSizes() error {
 		mainTreeElementCount++
 		el.AbsoluteOffset = currentOffset // Global offset for this main tree element/placeholder
 
-		size := uint32(KRBElementHeaderSize) // Type, ID, PosX/Y, W/H, Layout, StyleID, Counts...
+		size := state.elementHeaderSize() // Type, ID, PosX/Y, W/H, Layout, StyleID, Counts...
 		// Standard Properties of the placeholder/element
 		for _, prop := range el.KrbProperties {
 			size += 3                 // PropertyID(1) + ValueType(1) + Size(1)
@@ -43,25 +54,37 @@ func (state *CompilerState) calculateOffsetsAndSizes() error {
 		}
 		// Custom Properties of the placeholder (e.g., _componentName, instance props)
 		for _, customProp := range el.KrbCustomProperties {
-			size += 1                       // Key Index
-			size += 1                       // Value Type
-			size += 1                       // Value Size
+			size += customPropHeaderSize    // KeyIndex(2) + ValueType(1) + Size(1)
 			size += uint32(customProp.Size) // Value data
 		}
 		// Events on the placeholder/element
-		size += uint32(len(el.KrbEvents)) * 2 // EventType(1) + CallbackID(1)
+		size += uint32(len(el.KrbEvents)) * eventSize // EventType(1) + CallbackID(2)
+		// Animation references of the placeholder/element
+		size += uint32(len(el.KrbAnimationRefs)) * animationRefSize // AnimationIndex(2) + Trigger(1)
 		// Children of the placeholder (from KRY usage tag)
-		size += uint32(len(el.Children)) * 2 // RelativeOffsetToChild(2 bytes)
+		size += uint32(len(el.Children)) * state.childOffsetSize() // RelativeOffsetToChild(2 or 4 bytes)
 
 		el.CalculatedSize = size
-		if size < KRBElementHeaderSize {
-			return fmt.Errorf("internal: main element/placeholder %d ('%s') calculated size %d < header size %d", i, el.SourceElementName, size, KRBElementHeaderSize)
+		if size < state.elementHeaderSize() {
+			return fmt.Errorf("internal: main element/placeholder %d ('%s') calculated size %d < header size %d", i, el.SourceElementName, size, state.elementHeaderSize())
 		}
 		state.TotalElementDataSize += size
 		currentOffset += size
 		// log.Printf("  -> Sized Main Tree Element: Idx=%d, Name='%s', Size=%d, AbsOffset=%d", i, el.SourceElementName, size, el.AbsoluteOffset)
 	}
-	log.Printf("      Calculated Main UI Tree: %d elements, %d bytes data.", mainTreeElementCount, state.TotalElementDataSize)
+	state.logf("      Calculated Main UI Tree: %d elements, %d bytes data.", mainTreeElementCount, state.TotalElementDataSize)
+	for i := range state.Elements {
+		el := &state.Elements[i]
+		for _, child := range el.Children {
+			if el.IsDefinitionRoot || state.wideElements() || child.AbsoluteOffset-el.AbsoluteOffset <= math.MaxUint16 {
+				continue
+			}
+			if err := state.requireWideElements(el, "element '%s' is %d bytes before its child '%s'", el.SourceElementName, child.AbsoluteOffset-el.AbsoluteOffset, child.SourceElementName); err != nil {
+				return err
+			}
+			return state.calculateOffsetsAndSizes()
+		}
+	}
 
 	// --- 2. Styles Section Size ---
 	state.StyleOffset = currentOffset
@@ -70,14 +93,33 @@ func (state *CompilerState) calculateOffsetsAndSizes() error {
 		for i := range state.Styles {
 			style := &state.Styles[i]
 			// Size calculation for style.CalculatedSize should already be done in style_resolver.go
-			if style.CalculatedSize < 3 { // Smallest possible style block (header only, 0 props)
-				return fmt.Errorf("internal: style %d ('%s') calculated size %d < minimum 3 (was: %d)", i, style.SourceName, style.CalculatedSize, style.CalculatedSize)
+			if style.CalculatedSize < styleHeaderSize { // Smallest possible style block (header only, 0 props)
+				return fmt.Errorf("internal: style %d ('%s') calculated size %d < minimum %d", i, style.SourceName, style.CalculatedSize, styleHeaderSize)
 			}
 			state.TotalStyleDataSize += style.CalculatedSize
 			currentOffset += style.CalculatedSize
 		}
+		// The style variant table follows the last style block, so readers
+		// that do not know FlagHasStyleVariants skip it with the section.
+		if size, count := state.styleVariantTableSize(); count > 0 {
+			if count > math.MaxUint16 {
+				return fmt.Errorf("%d style variants exceed the maximum of %d", count, math.MaxUint16)
+			}
+			state.HeaderFlags |= FlagHasStyleVariants
+			state.TotalStyleDataSize += size
+			currentOffset += size
+		}
+		// The media variant table follows the style variant table.
+		if size, count := state.mediaVariantTableSize(); count > 0 {
+			if count > math.MaxUint16 {
+				return fmt.Errorf("%d media variants exceed the maximum of %d", count, math.MaxUint16)
+			}
+			state.HeaderFlags |= FlagHasMediaVariants
+			state.TotalStyleDataSize += size
+			currentOffset += size
+		}
 	}
-	log.Printf("      Calculated Styles: %d styles, %d bytes data.", len(state.Styles), state.TotalStyleDataSize)
+	state.logf("      Calculated Styles: %d styles, %d bytes data.", len(state.Styles), state.TotalStyleDataSize)
 
 	// --- 3. Component Definition Table Section Size ---
 	state.ComponentDefOffset = currentOffset
@@ -92,8 +134,8 @@ func (state *CompilerState) calculateOffsetsAndSizes() error {
 			if err != nil {
 				return fmt.Errorf("CompDef '%s': error ensuring component name in string table for sizing: %w", def.Name, err)
 			}
-			singleDefEntrySize += 1 // Name Index (1 byte for the string table index)
-			singleDefEntrySize += 1 // Property Def Count (1 byte)
+			singleDefEntrySize += indexSize // Name Index (string table index)
+			singleDefEntrySize += 1         // Property Def Count (1 byte)
 
 			// Size of Property Definitions part
 			for _, propDef := range def.Properties {
@@ -101,9 +143,9 @@ func (state *CompilerState) calculateOffsetsAndSizes() error {
 				if err != nil {
 					return fmt.Errorf("CompDef '%s' prop '%s': error ensuring prop name in string table for sizing: %w", def.Name, propDef.Name, err)
 				}
-				singleDefEntrySize += 1 // Property Name Index (1 byte)
-				singleDefEntrySize += 1 // Value Type Hint (1 byte)
-				singleDefEntrySize += 1 // Default Value Size (1 byte)
+				singleDefEntrySize += indexSize // Property Name Index
+				singleDefEntrySize += 1         // Value Type Hint (1 byte)
+				singleDefEntrySize += 1         // Default Value Size (1 byte)
 
 				// Sizing for Default Value Data (ensures strings for defaults are added to string table *now*)
 				_, defaultValDataSize, parseErr := getBinaryDefaultValue(state, propDef.DefaultValueStr, propDef.ValueTypeHint)
@@ -133,13 +175,14 @@ func (state *CompilerState) calculateOffsetsAndSizes() error {
 				tplEl := &state.Elements[tplElIdx]
 				templateElementOffsets[tplEl.SelfIndex] = currentTemplateElementOffset
 
-				tempSize := uint32(KRBElementHeaderSize)
+				tempSize := state.elementHeaderSize()
 				for _, prop := range tplEl.KrbProperties { // Standard properties of the template element
 					tempSize += 3 + uint32(prop.Size)
 				}
+				tempSize += uint32(len(tplEl.KrbAnimationRefs)) * animationRefSize
 				// Custom Props and Events should be 0 for template elements as per spec
 				if tplEl.CustomPropCount > 0 || tplEl.EventCount > 0 {
-					log.Printf("Warning: CompDef '%s' template element '%s' (idx %d) has CustomPropCount=%d or EventCount=%d. These should be 0 for templates.", def.Name, tplEl.SourceElementName, tplEl.SelfIndex, tplEl.CustomPropCount, tplEl.EventCount)
+					state.warnf(CodeEncodingConsistency, 0, "", "CompDef '%s' template element '%s' (idx %d) has CustomPropCount=%d or EventCount=%d. These should be 0 for templates.", def.Name, tplEl.SourceElementName, tplEl.SelfIndex, tplEl.CustomPropCount, tplEl.EventCount)
 				}
 
 				// ChildCount for template elements refers to children *within this template*.
@@ -158,7 +201,7 @@ func (state *CompilerState) calculateOffsetsAndSizes() error {
 						actualTemplateChildCount++
 					}
 				}
-				tempSize += uint32(actualTemplateChildCount) * 2 // ChildOffset(2 bytes) for each *template child*
+				tempSize += uint32(actualTemplateChildCount) * state.childOffsetSize() // ChildOffset for each *template child*
 
 				tplEl.CalculatedSize = tempSize // Size of this *one* element within the template definition
 				templateTotalDataSize += tempSize
@@ -166,6 +209,19 @@ func (state *CompilerState) calculateOffsetsAndSizes() error {
 			}
 			// Store these relative offsets for use during writing the template
 			def.InternalTemplateElementOffsets = templateElementOffsets
+			for _, tplElIdx := range templateElementsIndices {
+				tplEl := &state.Elements[tplElIdx]
+				for _, childIdx := range tplEl.SourceChildrenIndices {
+					childOffset, ok := templateElementOffsets[childIdx]
+					if !ok || state.wideElements() || childOffset-templateElementOffsets[tplElIdx] <= math.MaxUint16 {
+						continue
+					}
+					if err := state.requireWideElements(tplEl, "template element '%s' of '%s' is %d bytes before its child", tplEl.SourceElementName, def.Name, childOffset-templateElementOffsets[tplElIdx]); err != nil {
+						return err
+					}
+					return state.calculateOffsetsAndSizes()
+				}
+			}
 
 			singleDefEntrySize += templateTotalDataSize
 			def.CalculatedSize = singleDefEntrySize // Total size for this single component definition entry
@@ -173,27 +229,45 @@ func (state *CompilerState) calculateOffsetsAndSizes() error {
 			currentOffset += singleDefEntrySize
 		}
 	}
-	log.Printf("      Calculated Component Defs: %d defs, %d bytes data.", len(state.ComponentDefs), state.TotalComponentDefDataSize)
+	state.logf("      Calculated Component Defs: %d defs, %d bytes data.", len(state.ComponentDefs), state.TotalComponentDefDataSize)
 
 	// --- 4. Animations Section Size ---
 	state.AnimOffset = currentOffset // Even if 0 anims, offset points to where it would start
-	// No data if 0 anims. state.TotalAnimationDataSize would be 0.
-	log.Printf("      Calculated Animations: 0 anims, 0 bytes data.")
+	state.TotalAnimationDataSize = 0
+	if (state.HeaderFlags & FlagHasAnimations) != 0 {
+		for i := range state.Animations {
+			anim := &state.Animations[i]
+			size := uint32(animationHeaderSize)
+			for _, kf := range anim.Keyframes {
+				size += keyframeHeaderSize
+				for _, prop := range kf.Properties {
+					size += 3 + uint32(prop.Size)
+				}
+			}
+			anim.CalculatedSize = size
+			state.TotalAnimationDataSize += size
+		}
+	}
+	currentOffset += state.TotalAnimationDataSize
+	state.logf("      Calculated Animations: %d anims, %d bytes data.", len(state.Animations), state.TotalAnimationDataSize)
 
 	// --- 5. Strings Section Size ---
 	state.StringOffset = currentOffset
 	stringSectionHeaderSize := uint32(2) // String Count (uint16) - Always present in section
 	state.TotalStringDataSize = 0
-	if len(state.Strings) > 0 { // String data only if strings exist
-		for _, s := range state.Strings {
-			if s.Length > 255 { // KRB String length is 1 byte
-				return fmt.Errorf("string '%s...' (idx %d) length %d exceeds max 255 for KRB", s.Text[:min(len(s.Text), 20)], s.Index, s.Length)
+	for _, s := range state.Strings {
+		if s.Length > MaxShortStringLength {
+			if !state.target.LongStrings {
+				return fmt.Errorf("string '%s...' (idx %d) length %d exceeds max %d for target '%s'", s.Text[:20], s.Index, s.Length, MaxShortStringLength, state.target.Name)
 			}
-			state.TotalStringDataSize += 1 + uint32(s.Length) // LengthByte(1) + UTF-8 Bytes
+			state.HeaderFlags |= FlagLongStrings
 		}
 	}
+	for _, s := range state.Strings {
+		state.TotalStringDataSize += uint32(len(state.stringLength(s.Length)) + s.Length) // Length prefix + UTF-8 Bytes
+	}
 	currentOffset += stringSectionHeaderSize + state.TotalStringDataSize
-	log.Printf("      Calculated Strings: %d strings, %d bytes data (+%d for count field).", len(state.Strings), state.TotalStringDataSize, stringSectionHeaderSize)
+	state.logf("      Calculated Strings: %d strings, %d bytes data (+%d for count field).", len(state.Strings), state.TotalStringDataSize, stringSectionHeaderSize)
 
 	// --- 6. Resources Section Size ---
 	state.ResourceOffset = currentOffset
@@ -205,36 +279,39 @@ func (state *CompilerState) calculateOffsetsAndSizes() error {
 			res := &state.Resources[i]
 			// res.CalculatedSize should be set during addResource or a dedicated resource sizing pass
 			if res.CalculatedSize == 0 { // Fallback if not pre-calculated
-				if res.Format == ResFormatExternal {
-					res.CalculatedSize = 4
-				} else {
+				switch res.Format {
+				case ResFormatExternal:
+					res.CalculatedSize = externalResourceSize
+				case ResFormatInline:
+					res.CalculatedSize = inlineResourceHeader + uint32(len(res.Data))
+				default:
 					return fmt.Errorf("unsupported/unsized resource format %d for resource %d ('%s') during offset calculation", res.Format, i, state.Strings[res.NameIndex].Text)
 				}
 			}
+			if uint64(currentOffset)+uint64(resourceSectionHeaderSize)+uint64(state.TotalResourceTableSize)+uint64(res.CalculatedSize) > math.MaxUint32 {
+				return fmt.Errorf("resource table too large: resource %d ('%s') would end beyond the 4 GiB offset limit", i, state.Strings[res.NameIndex].Text)
+			}
 			state.TotalResourceTableSize += res.CalculatedSize
 		}
 	}
 	currentOffset += resourceSectionHeaderSize + state.TotalResourceTableSize
-	log.Printf("      Calculated Resources: %d resources, %d bytes data (+%d for count field).", len(state.Resources), state.TotalResourceTableSize, resourceSectionHeaderSize)
+	state.logf("      Calculated Resources: %d resources, %d bytes data (+%d for count field).", len(state.Resources), state.TotalResourceTableSize, resourceSectionHeaderSize)
 
 	state.TotalSize = currentOffset
-	log.Printf("      Total calculated KRB file size: %d bytes\n", state.TotalSize)
+	state.logf("      Total calculated KRB file size: %d bytes\n", state.TotalSize)
 	return nil
 }
 
-// --- Pass 3: Write KRB File (KRB v0.4) ---
+// --- Pass 3: Write KRB File (KRB v0.5) ---
 
-func (state *CompilerState) writeKrbFile(filePath string) error {
-	log.Printf("Pass 3: Writing KRB v%d.%d binary to '%s'...\n", KRBVersionMajor, KRBVersionMinor, filePath)
+func (state *CompilerState) writeKrbFile(out io.Writer) error {
+	state.logf("Pass 3: Writing KRB v%d.%d binary...\n", KRBVersionMajor, KRBVersionMinor)
 
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("error creating output file '%s': %w", filePath, err)
-	}
-	defer file.Close()
+	var err error
+	file := &countingWriter{w: out}
 	writer := bufio.NewWriter(file)
 
-	// --- Write KRB File Header (48 bytes for v0.4) ---
+	// --- Write KRB File Header (48 bytes) ---
 	if _, err = writer.WriteString(KRBMagic); err != nil {
 		return fmt.Errorf("write magic: %w", err)
 	}
@@ -261,9 +338,9 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 	if err = writeUint16(writer, uint16(len(state.ComponentDefs))); err != nil {
 		return fmt.Errorf("write component def count: %w", err)
 	}
-	if err = writeUint16(writer, uint16(0)); err != nil {
+	if err = writeUint16(writer, uint16(len(state.Animations))); err != nil {
 		return fmt.Errorf("write animation count: %w", err)
-	} // Animation Count
+	}
 	if err = writeUint16(writer, uint16(len(state.Strings))); err != nil {
 		return fmt.Errorf("write string count: %w", err)
 	}
@@ -317,7 +394,7 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 	currentFilePos, _ = file.Seek(0, io.SeekCurrent) // Update currentFilePos
 
 	// --- Write Element Blocks (Main UI Tree Placeholders and Standard Elements ONLY) ---
-	log.Printf("    Writing %d main UI tree elements at offset %d (actual: %d)\n", mainTreeElementCount, state.ElementOffset, currentFilePos)
+	state.logf("    Writing %d main UI tree elements at offset %d (actual: %d)\n", mainTreeElementCount, state.ElementOffset, currentFilePos)
 	if uint32(currentFilePos) != state.ElementOffset {
 		return fmt.Errorf("file pos %d != ElementOffset %d before writing main elements", currentFilePos, state.ElementOffset)
 	}
@@ -342,7 +419,7 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 			return fmt.Errorf("main elem %d ('%s') offset mismatch: current write pos %d != expected abs_offset %d", i, el.SourceElementName, currentFilePos, el.AbsoluteOffset)
 		}
 
-		if err = writeElementHeader(writer, el); err != nil {
+		if err = writeElementHeader(writer, el, state.wideElements()); err != nil {
 			return fmt.Errorf("main elem %d ('%s') header write: %w", i, el.SourceElementName, err)
 		}
 		if err = writeElementProperties(writer, el.KrbProperties, "StdP"); err != nil {
@@ -354,6 +431,9 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 		if err = writeElementEvents(writer, el.KrbEvents); err != nil {
 			return fmt.Errorf("main elem %d ('%s') events: %w", i, el.SourceElementName, err)
 		}
+		if err = writeElementAnimationRefs(writer, el.KrbAnimationRefs); err != nil {
+			return fmt.Errorf("main elem %d ('%s') animation refs: %w", i, el.SourceElementName, err)
+		}
 
 		// Write Child References for this placeholder/standard element
 		// Children are those from the KRY usage tag (for placeholders) or direct KRY children (for standard elements)
@@ -361,10 +441,10 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 			// childInstance.AbsoluteOffset is the global offset where that child (which could be another placeholder) WILL BE written.
 			// el.AbsoluteOffset is where the current parent `el` header started.
 			relativeOffset := childInstance.AbsoluteOffset - el.AbsoluteOffset
-			if relativeOffset > math.MaxUint16 || (relativeOffset <= 0 && childInstance.AbsoluteOffset != el.AbsoluteOffset) { // relativeOffset can be 0 if child is empty and written immediately after
+			if (relativeOffset > math.MaxUint16 && !state.wideElements()) || (relativeOffset <= 0 && childInstance.AbsoluteOffset != el.AbsoluteOffset) { // relativeOffset can be 0 if child is empty and written immediately after
 				return fmt.Errorf("main elem %d ('%s') child #%d ('%s') invalid relative offset %d (child_abs=%d, parent_abs=%d)", i, el.SourceElementName, cIdx, childInstance.SourceElementName, relativeOffset, childInstance.AbsoluteOffset, el.AbsoluteOffset)
 			}
-			if err = writeUint16(writer, uint16(relativeOffset)); err != nil {
+			if err = state.writeChildOffset(writer, relativeOffset); err != nil {
 				return fmt.Errorf("main elem %d child #%d rel offset: %w", i, cIdx, err)
 			}
 		}
@@ -384,7 +464,7 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 	}
 
 	// --- Write Style Blocks ---
-	log.Printf("    Writing %d styles at offset %d (actual: %d)\n", len(state.Styles), state.StyleOffset, currentFilePos)
+	state.logf("    Writing %d styles at offset %d (actual: %d)\n", len(state.Styles), state.StyleOffset, currentFilePos)
 	if (state.HeaderFlags & FlagHasStyles) != 0 {
 		if uint32(currentFilePos) != state.StyleOffset {
 			return fmt.Errorf("file pos %d != StyleOffset %d before writing styles", currentFilePos, state.StyleOffset)
@@ -392,10 +472,10 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 		for i := range state.Styles {
 			style := &state.Styles[i]
 			startPos := currentFilePos
-			if err = writeUint8(writer, style.ID); err != nil {
+			if err = writeIndex(writer, style.ID); err != nil {
 				return fmt.Errorf("style %d ID: %w", i, err)
 			}
-			if err = writeUint8(writer, style.NameIndex); err != nil {
+			if err = writeIndex(writer, style.NameIndex); err != nil {
 				return fmt.Errorf("style %d NameIdx: %w", i, err)
 			}
 			if err = writeUint8(writer, uint8(len(style.Properties))); err != nil {
@@ -417,10 +497,32 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 				return fmt.Errorf("style %d ('%s') size mismatch: wrote %d, expected %d", i, style.SourceName, bytesWrittenThisStyle, style.CalculatedSize)
 			}
 		}
+		if (state.HeaderFlags & FlagHasStyleVariants) != 0 {
+			if err = state.writeStyleVariants(writer); err != nil {
+				return fmt.Errorf("style variants: %w", err)
+			}
+			if err = writer.Flush(); err != nil {
+				return fmt.Errorf("style variants flush: %w", err)
+			}
+			if currentFilePos, err = file.Seek(0, io.SeekCurrent); err != nil {
+				return fmt.Errorf("style variants seek: %w", err)
+			}
+		}
+		if (state.HeaderFlags & FlagHasMediaVariants) != 0 {
+			if err = state.writeMediaVariants(writer); err != nil {
+				return fmt.Errorf("media variants: %w", err)
+			}
+			if err = writer.Flush(); err != nil {
+				return fmt.Errorf("media variants flush: %w", err)
+			}
+			if currentFilePos, err = file.Seek(0, io.SeekCurrent); err != nil {
+				return fmt.Errorf("media variants seek: %w", err)
+			}
+		}
 	}
 
 	// --- Write Component Definition Table ---
-	log.Printf("    Writing %d component definitions at offset %d (actual: %d)\n", len(state.ComponentDefs), state.ComponentDefOffset, currentFilePos)
+	state.logf("    Writing %d component definitions at offset %d (actual: %d)\n", len(state.ComponentDefs), state.ComponentDefOffset, currentFilePos)
 	if (state.HeaderFlags & FlagHasComponentDefs) != 0 {
 		if uint32(currentFilePos) != state.ComponentDefOffset {
 			return fmt.Errorf("file pos %d != ComponentDefOffset %d before writing comp defs", currentFilePos, state.ComponentDefOffset)
@@ -434,7 +536,7 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 			if !strErr {
 				return fmt.Errorf("CompDef '%s': name not found in string table during write", def.Name)
 			}
-			if err = writeUint8(writer, nameIdx); err != nil {
+			if err = writeIndex(writer, nameIdx); err != nil {
 				return fmt.Errorf("CompDef '%s' write name index: %w", def.Name, err)
 			}
 
@@ -449,7 +551,7 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 				if !strErr2 {
 					return fmt.Errorf("CompDef '%s' prop #%d ('%s'): name not found in string table", def.Name, pdi, propDef.Name)
 				}
-				if err = writeUint8(writer, propNameIdx); err != nil {
+				if err = writeIndex(writer, propNameIdx); err != nil {
 					return fmt.Errorf("CompDef '%s' prop '%s' write name idx: %w", def.Name, propDef.Name, err)
 				}
 				if err = writeUint8(writer, propDef.ValueTypeHint); err != nil {
@@ -481,7 +583,7 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 			// Its pre-calculated offset within def.InternalTemplateElementOffsets should be 0.
 			offsetOfThisTemplateRootWithinBlob := def.InternalTemplateElementOffsets[templateElementsIndices[0]]
 			if offsetOfThisTemplateRootWithinBlob != 0 {
-				log.Printf("Warning: CompDef '%s' root template element (idx %d) has non-zero internal offset %d. This might be unexpected.", def.Name, templateElementsIndices[0], offsetOfThisTemplateRootWithinBlob)
+				state.warnf(CodeEncodingConsistency, 0, "", "CompDef '%s' root template element (idx %d) has non-zero internal offset %d. This might be unexpected.", def.Name, templateElementsIndices[0], offsetOfThisTemplateRootWithinBlob)
 			}
 
 			for _, tplElIdx := range templateElementsIndices { // Elements are sorted by SelfIndex by getTemplateElementIndices
@@ -506,15 +608,18 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 						actualTemplateChildCount++
 					}
 				}
-				tplEl.ChildCount = uint8(actualTemplateChildCount)
+				tplEl.ChildCount = uint16(actualTemplateChildCount)
 
-				if err = writeElementHeader(writer, tplEl); err != nil {
+				if err = writeElementHeader(writer, tplEl, state.wideElements()); err != nil {
 					return fmt.Errorf("TplElem '%s' (in CompDef '%s') header: %w", tplEl.SourceElementName, def.Name, err)
 				}
 				if err = writeElementProperties(writer, tplEl.KrbProperties, fmt.Sprintf("TplElem '%s' Prop", tplEl.SourceElementName)); err != nil {
 					return err
 				}
 				// No custom props or events for template elements.
+				if err = writeElementAnimationRefs(writer, tplEl.KrbAnimationRefs); err != nil {
+					return fmt.Errorf("TplElem '%s' (in CompDef '%s') animation refs: %w", tplEl.SourceElementName, def.Name, err)
+				}
 
 				// Write Child Relative Offsets for template children
 				// These offsets are relative to the start of *this template's root element header*
@@ -545,11 +650,11 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 					currentTplElOffsetWithinBlob := def.InternalTemplateElementOffsets[tplEl.SelfIndex]
 					relativeOffset := offsetOfChildWithinBlob - currentTplElOffsetWithinBlob
 
-					if relativeOffset > math.MaxUint16 || (relativeOffset <= 0 && offsetOfChildWithinBlob != currentTplElOffsetWithinBlob) {
+					if (relativeOffset > math.MaxUint16 && !state.wideElements()) || (relativeOffset <= 0 && offsetOfChildWithinBlob != currentTplElOffsetWithinBlob) {
 						return fmt.Errorf("CompDef '%s', TplParent '%s': template child '%s' invalid relative offset %d (child_blob_offset=%d, parent_blob_offset=%d)",
 							def.Name, tplEl.SourceElementName, childElInTemplate.SourceElementName, relativeOffset, offsetOfChildWithinBlob, currentTplElOffsetWithinBlob)
 					}
-					if err = writeUint16(writer, uint16(relativeOffset)); err != nil {
+					if err = state.writeChildOffset(writer, relativeOffset); err != nil {
 						return fmt.Errorf("CompDef '%s', TplParent '%s' child #%d ('%s') write rel offset: %w", def.Name, tplEl.SourceElementName, childNum, childElInTemplate.SourceElementName, err)
 					}
 				}
@@ -565,23 +670,56 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 
 			bytesWrittenForThisDef := uint32(currentFilePos - startPosDef)
 			if bytesWrittenForThisDef != def.CalculatedSize {
-				log.Printf("Warning: CompDef '%s' size mismatch: wrote %d, expected %d. Review CalculatedSize logic.", def.Name, bytesWrittenForThisDef, def.CalculatedSize)
+				state.warnf(CodeEncodingConsistency, 0, "", "CompDef '%s' size mismatch: wrote %d, expected %d. Review CalculatedSize logic.", def.Name, bytesWrittenForThisDef, def.CalculatedSize)
 			}
 		}
 	}
 
 	// --- Write Animation Table Section ---
-	log.Printf("    Writing 0 animations at offset %d (actual: %d)\n", state.AnimOffset, currentFilePos)
+	state.logf("    Writing %d animations at offset %d (actual: %d)\n", len(state.Animations), state.AnimOffset, currentFilePos)
 	if uint32(currentFilePos) != state.AnimOffset {
 		// Allow if no anims and it's where the next section (strings) starts
 		if !(state.AnimOffset == state.StringOffset && (state.HeaderFlags&FlagHasAnimations) == 0) {
-			return fmt.Errorf("file pos %d != AnimOffset %d before writing (empty) animation section", currentFilePos, state.AnimOffset)
+			return fmt.Errorf("file pos %d != AnimOffset %d before writing animation section", currentFilePos, state.AnimOffset)
+		}
+	}
+	if (state.HeaderFlags & FlagHasAnimations) != 0 {
+		for i := range state.Animations {
+			anim := &state.Animations[i]
+			startPos := currentFilePos
+			if err = writeIndex(writer, anim.NameIndex); err != nil {
+				return fmt.Errorf("anim %d NameIdx: %w", i, err)
+			}
+			if err = writeUint16(writer, anim.DurationMs); err != nil {
+				return fmt.Errorf("anim %d duration: %w", i, err)
+			}
+			if _, err = writer.Write([]byte{anim.Easing, anim.Iterations, uint8(len(anim.Keyframes))}); err != nil {
+				return fmt.Errorf("anim %d timing: %w", i, err)
+			}
+			for k, kf := range anim.Keyframes {
+				if _, err = writer.Write([]byte{kf.Offset, uint8(len(kf.Properties))}); err != nil {
+					return fmt.Errorf("anim %d keyframe %d header: %w", i, k, err)
+				}
+				if err = writeElementProperties(writer, kf.Properties, "KeyP"); err != nil {
+					return fmt.Errorf("anim %d ('%s') keyframe %d props: %w", i, anim.Name, k, err)
+				}
+			}
+
+			if err = writer.Flush(); err != nil {
+				return fmt.Errorf("anim %d ('%s') flush: %w", i, anim.Name, err)
+			}
+			currentFilePos, err = file.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return fmt.Errorf("anim %d ('%s') seek: %w", i, anim.Name, err)
+			}
+			if bytesWritten := uint32(currentFilePos - startPos); bytesWritten != anim.CalculatedSize {
+				return fmt.Errorf("anim %d ('%s') size mismatch: wrote %d, expected %d", i, anim.Name, bytesWritten, anim.CalculatedSize)
+			}
 		}
 	}
-	// No data to write if Animation Count is 0.
 
 	// --- Write String Table Section ---
-	log.Printf("    Writing %d strings at offset %d (actual: %d)\n", len(state.Strings), state.StringOffset, currentFilePos)
+	state.logf("    Writing %d strings at offset %d (actual: %d)\n", len(state.Strings), state.StringOffset, currentFilePos)
 	if uint32(currentFilePos) != state.StringOffset {
 		return fmt.Errorf("file pos %d != StringOffset %d before writing strings", currentFilePos, state.StringOffset)
 	}
@@ -590,9 +728,9 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 	} // String Count field
 	for i := range state.Strings {
 		s := &state.Strings[i]
-		if err = writeUint8(writer, uint8(s.Length)); err != nil {
+		if _, err = writer.Write(state.stringLength(s.Length)); err != nil {
 			return fmt.Errorf("Str%d ('%s') write len: %w", i, s.Text, err)
-		} // Length byte
+		} // Length prefix
 		if s.Length > 0 {
 			if _, err = writer.WriteString(s.Text); err != nil {
 				return fmt.Errorf("Str%d ('%s') write text: %w", i, s.Text, err)
@@ -608,7 +746,7 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 	}
 
 	// --- Write Resource Table Section ---
-	log.Printf("    Writing %d resources at offset %d (actual: %d)\n", len(state.Resources), state.ResourceOffset, currentFilePos)
+	state.logf("    Writing %d resources at offset %d (actual: %d)\n", len(state.Resources), state.ResourceOffset, currentFilePos)
 	if (state.HeaderFlags&FlagHasResources) != 0 && len(state.Resources) > 0 {
 		if uint32(currentFilePos) != state.ResourceOffset {
 			return fmt.Errorf("file pos %d != ResourceOffset %d before writing resource section header", currentFilePos, state.ResourceOffset)
@@ -620,17 +758,25 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 			if err = writeUint8(writer, r.Type); err != nil {
 				return fmt.Errorf("write res type: %w", err)
 			}
-			if err = writeUint8(writer, r.NameIndex); err != nil {
+			if err = writeIndex(writer, r.NameIndex); err != nil {
 				return fmt.Errorf("write res name idx: %w", err)
 			}
 			if err = writeUint8(writer, r.Format); err != nil {
 				return fmt.Errorf("write res format: %w", err)
 			}
-			if r.Format == ResFormatExternal {
-				if err = writeUint8(writer, r.DataStringIndex); err != nil {
+			switch r.Format {
+			case ResFormatExternal:
+				if err = writeIndex(writer, r.DataStringIndex); err != nil {
 					return fmt.Errorf("write res data str idx: %w", err)
 				}
-			} else {
+			case ResFormatInline:
+				if err = writeUint32(writer, uint32(len(r.Data))); err != nil {
+					return fmt.Errorf("write res data size: %w", err)
+				}
+				if _, err = writer.Write(r.Data); err != nil {
+					return fmt.Errorf("write res data: %w", err)
+				}
+			default:
 				return fmt.Errorf("unsupported resource format %d during write for resource '%s'", r.Format, state.Strings[r.NameIndex].Text)
 			}
 		}
@@ -652,20 +798,42 @@ func (state *CompilerState) writeKrbFile(filePath string) error {
 		return fmt.Errorf("final write size mismatch: actual %d != calculated total %d", finalFileSize, state.TotalSize)
 	}
 
-	log.Printf("   Successfully wrote %d bytes.\n", finalFileSize)
+	state.logf("   Successfully wrote %d bytes.\n", finalFileSize)
 	return nil
 }
 
+// countingWriter tracks how many bytes have been written to the underlying
+// writer, so offsets can be verified without requiring a seekable output.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Seek reports the current write position. Only Seek(0, io.SeekCurrent) is supported.
+func (cw *countingWriter) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekCurrent {
+		return cw.n, fmt.Errorf("countingWriter: unsupported seek (offset %d, whence %d)", offset, whence)
+	}
+	return cw.n, nil
+}
+
 // --- Helper functions for writing parts of an element block ---
 
-// writeElementHeader writes the 17-byte KRB element header.
-func writeElementHeader(w *bufio.Writer, el *Element) error {
+// writeElementHeader writes the KRB element header: 19 bytes, or 20 with a
+// 16-bit child count in the wide element encoding.
+func writeElementHeader(w *bufio.Writer, el *Element, wide bool) error {
 	// Counts should be finalized on `el` before calling this
 	var err error
 	if err = writeUint8(w, el.Type); err != nil {
 		return err
 	}
-	if err = writeUint8(w, el.IDStringIndex); err != nil {
+	if err = writeIndex(w, el.IDStringIndex); err != nil {
 		return err
 	}
 	if err = writeUint16(w, el.PosX); err != nil {
@@ -683,13 +851,18 @@ func writeElementHeader(w *bufio.Writer, el *Element) error {
 	if err = writeUint8(w, el.Layout); err != nil {
 		return err
 	}
-	if err = writeUint8(w, el.StyleID); err != nil {
+	if err = writeIndex(w, el.StyleID); err != nil {
 		return err
 	}
 	if err = writeUint8(w, el.PropertyCount); err != nil {
 		return err
 	} // Standard KRB Property Count
-	if err = writeUint8(w, el.ChildCount); err != nil {
+	if wide {
+		err = writeUint16(w, el.ChildCount)
+	} else {
+		err = writeUint8(w, uint8(el.ChildCount))
+	}
+	if err != nil {
 		return err
 	} // KRB Child Count
 	if err = writeUint8(w, el.EventCount); err != nil {
@@ -737,7 +910,7 @@ func writeElementProperties(w *bufio.Writer, props []KrbProperty, logPrefix stri
 func writeElementCustomProperties(w *bufio.Writer, props []KrbCustomProperty, logPrefix string) error {
 	for i, prop := range props {
 		var err error
-		if err = writeUint8(w, prop.KeyIndex); err != nil {
+		if err = writeIndex(w, prop.KeyIndex); err != nil {
 			return fmt.Errorf("%s #%d KeyIdx %d: %w", logPrefix, i, prop.KeyIndex, err)
 		}
 		if err = writeUint8(w, prop.ValueType); err != nil {
@@ -769,13 +942,119 @@ func writeElementEvents(w *bufio.Writer, events []KrbEvent) error {
 		if err = writeUint8(w, event.EventType); err != nil {
 			return fmt.Errorf("Event #%d type 0x%X: %w", i, event.EventType, err)
 		}
-		if err = writeUint8(w, event.CallbackID); err != nil {
+		if err = writeIndex(w, event.CallbackID); err != nil {
 			return fmt.Errorf("Event #%d cbID %d: %w", i, event.CallbackID, err)
 		}
 	}
 	return nil
 }
 
+// writeElementAnimationRefs writes KRB animation references.
+func writeElementAnimationRefs(w *bufio.Writer, refs []KrbAnimationRef) error {
+	for i, ref := range refs {
+		if err := writeIndex(w, ref.AnimationIndex); err != nil {
+			return fmt.Errorf("AnimRef #%d index %d: %w", i, ref.AnimationIndex, err)
+		}
+		if err := writeUint8(w, ref.Trigger); err != nil {
+			return fmt.Errorf("AnimRef #%d trigger 0x%X: %w", i, ref.Trigger, err)
+		}
+	}
+	return nil
+}
+
+// styleVariantTableSize returns the encoded size of the style variant table
+// and the number of variants in it.
+func (state *CompilerState) styleVariantTableSize() (size uint32, count int) {
+	size = 2 // Variant Count (uint16)
+	for _, style := range state.Styles {
+		for _, v := range style.Variants {
+			size += styleVariantHeader
+			for _, prop := range v.Properties {
+				size += 3 + uint32(prop.Size)
+			}
+			count++
+		}
+	}
+	return size, count
+}
+
+// writeStyleVariants writes the style variant table: Count(2), then per
+// variant StyleID, State(1), PropCount(1) and the properties.
+func (state *CompilerState) writeStyleVariants(w *bufio.Writer) error {
+	_, count := state.styleVariantTableSize()
+	if err := writeUint16(w, uint16(count)); err != nil {
+		return fmt.Errorf("count: %w", err)
+	}
+	for _, style := range state.Styles {
+		for _, v := range style.Variants {
+			if err := writeIndex(w, style.ID); err != nil {
+				return fmt.Errorf("style %d state 0x%X ID: %w", style.ID, v.State, err)
+			}
+			if err := writeUint8(w, v.State); err != nil {
+				return fmt.Errorf("style %d state 0x%X: %w", style.ID, v.State, err)
+			}
+			if err := writeUint8(w, uint8(len(v.Properties))); err != nil {
+				return fmt.Errorf("style %d state 0x%X PropCount: %w", style.ID, v.State, err)
+			}
+			if err := writeElementProperties(w, v.Properties, "StyleVariantP"); err != nil {
+				return fmt.Errorf("style %d ('%s') state 0x%X props: %w", style.ID, style.SourceName, v.State, err)
+			}
+		}
+	}
+	return nil
+}
+
+// mediaVariantTableSize returns the encoded size of the media variant table
+// and the number of variants in it.
+func (state *CompilerState) mediaVariantTableSize() (size uint32, count int) {
+	size = 2 // Variant Count (uint16)
+	for _, style := range state.Styles {
+		for _, v := range style.MediaVariants {
+			size += mediaVariantHeader + mediaConditionSize*uint32(len(v.Conditions))
+			for _, prop := range v.Properties {
+				size += 3 + uint32(prop.Size)
+			}
+			count++
+		}
+	}
+	return size, count
+}
+
+// writeMediaVariants writes the media variant table: Count(2), then per
+// variant StyleID, CondCount(1), the conditions as Feature(1) and Value(2),
+// PropCount(1) and the properties.
+func (state *CompilerState) writeMediaVariants(w *bufio.Writer) error {
+	_, count := state.mediaVariantTableSize()
+	if err := writeUint16(w, uint16(count)); err != nil {
+		return fmt.Errorf("count: %w", err)
+	}
+	for _, style := range state.Styles {
+		for i, v := range style.MediaVariants {
+			if err := writeIndex(w, style.ID); err != nil {
+				return fmt.Errorf("style %d media #%d ID: %w", style.ID, i, err)
+			}
+			if err := writeUint8(w, uint8(len(v.Conditions))); err != nil {
+				return fmt.Errorf("style %d media #%d CondCount: %w", style.ID, i, err)
+			}
+			for _, c := range v.Conditions {
+				if err := writeUint8(w, c.Feature); err != nil {
+					return fmt.Errorf("style %d media #%d feature 0x%X: %w", style.ID, i, c.Feature, err)
+				}
+				if err := writeUint16(w, c.Value); err != nil {
+					return fmt.Errorf("style %d media #%d feature 0x%X value: %w", style.ID, i, c.Feature, err)
+				}
+			}
+			if err := writeUint8(w, uint8(len(v.Properties))); err != nil {
+				return fmt.Errorf("style %d media #%d PropCount: %w", style.ID, i, err)
+			}
+			if err := writeElementProperties(w, v.Properties, "MediaVariantP"); err != nil {
+				return fmt.Errorf("style %d ('%s') media #%d props: %w", style.ID, style.SourceName, i, err)
+			}
+		}
+	}
+	return nil
+}
+
 // getBinaryDefaultValue retrieves the binary data and its size for a component property's default value.
 func getBinaryDefaultValue(state *CompilerState, valueStr string, hint uint8) (data []byte, size uint8, err error) {
 	if valueStr == "" {
@@ -784,7 +1063,8 @@ func getBinaryDefaultValue(state *CompilerState, valueStr string, hint uint8) (d
 	// parseKryValueToKrbBytes is defined in resolver.go and needs access to CompilerState
 	// for tasks like adding default strings to the string table.
 	// The propKey and lineNum are illustrative for the call context within parseKryValueToKrbBytes.
-	data, _, size, err = parseKryValueToKrbBytes(state, valueStr, hint, "compDefDefaultSerialization", 0)
+	cleanedValue, _ := cleanAndQuoteValue(valueStr)
+	data, _, size, err = parseKryValueToKrbBytes(state, cleanedValue, hint, "compDefDefaultSerialization", 0)
 	return data, size, err
 }
 
@@ -839,7 +1119,7 @@ func getTemplateElementIndices(state *CompilerState, rootTemplateElIdx int) []in
 		if state.Elements[rootTemplateElIdx].IsDefinitionRoot {
 			collect(rootTemplateElIdx)
 		} else {
-			log.Printf("Error: Root index %d provided to getTemplateElementIndices is not itself a definition root.", rootTemplateElIdx)
+			state.logf("Error: Root index %d provided to getTemplateElementIndices is not itself a definition root.", rootTemplateElIdx)
 		}
 	}
 	sort.Ints(indices) // Sort by original parse order (SelfIndex) for consistent writing